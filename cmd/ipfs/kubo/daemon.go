@@ -61,6 +61,7 @@ const (
 	routingOptionDHTClientKwd  = "dhtclient"
 	routingOptionDHTKwd        = "dht"
 	routingOptionDHTServerKwd  = "dhtserver"
+	routingOptionLANKwd        = "lan"
 	routingOptionNoneKwd       = "none"
 	routingOptionCustomKwd     = "custom"
 	routingOptionDefaultKwd    = "default"
@@ -421,6 +422,12 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 		ncfg.Routing = libp2p.DHTOption
 	case routingOptionDHTServerKwd:
 		ncfg.Routing = libp2p.DHTServerOption
+	case routingOptionLANKwd:
+		if cfg.Routing.AcceleratedDHTClient {
+			return fmt.Errorf("Routing.AcceleratedDHTClient option is set even tho Routing.Type is lan, the accelerated DHT client only works with the public DHT")
+		}
+		ncfg.Routing = libp2p.LANDHTOption
+		ncfg.ExtraOpts["lan"] = true
 	case routingOptionNoneKwd:
 		ncfg.Routing = libp2p.NilRouterOption
 	case routingOptionCustomKwd:
@@ -570,7 +577,10 @@ take effect.
 
 	// TODO(9285): make metrics more configurable
 	// initialize metrics collector
-	prometheus.MustRegister(&corehttp.IpfsNodeCollector{Node: node})
+	prometheus.MustRegister(&corehttp.IpfsNodeCollector{
+		Node:            node,
+		BitswapTopPeers: int(cfg.Bitswap.MetricsTopPeers.WithDefault(config.DefaultBitswapMetricsTopPeers)),
+	})
 
 	// start MFS pinning thread
 	startPinMFS(daemonConfigPollInterval, cctx, &ipfsPinMFSNode{node})
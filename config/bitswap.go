@@ -0,0 +1,46 @@
+package config
+
+const (
+	DefaultBitswapMode            = "client+server"
+	DefaultBitswapServePolicy     = "all"
+	DefaultBitswapMaxWantlistSize = 1024
+	DefaultBitswapMetricsTopPeers = 10
+)
+
+// Bitswap configures the bitswap protocol, used to exchange blocks with other
+// peers.
+type Bitswap struct {
+	// Mode is "client+server", "client" (never send blocks to other peers)
+	// or "server" (never fetch blocks from other peers).
+	Mode *OptionalString `json:",omitempty"`
+
+	// ServePolicy restricts the blocks sent to other peers: "all",
+	// "pinned", "pinned+mfs" or "peers" (only ServeAllowedPeers are served).
+	ServePolicy *OptionalString `json:",omitempty"`
+	// ServeAllowedPeers are served any block, whatever the ServePolicy.
+	ServeAllowedPeers []string `json:",omitempty"`
+
+	// PriorityPeers have their requests handled before the requests of
+	// other peers, and are exempt from MaxSendRatePerPeer.
+	PriorityPeers []string `json:",omitempty"`
+	// MaxWantlistSize is the number of entries kept from the wantlist of
+	// each peer.
+	MaxWantlistSize *OptionalInteger `json:",omitempty"`
+	// MaxSendRatePerPeer caps the bytes per second sent to each peer, e.g.
+	// "1MiB". Unset means unlimited.
+	MaxSendRatePerPeer *OptionalString `json:",omitempty"`
+
+	// TaskWorkerCount, EngineBlockstoreWorkerCount, EngineTaskWorkerCount,
+	// MaxOutstandingBytesPerPeer and ProviderSearchDelay replace the
+	// Internal.Bitswap options of the same name, which are still used when
+	// these are unset.
+	TaskWorkerCount             *OptionalInteger  `json:",omitempty"`
+	EngineBlockstoreWorkerCount *OptionalInteger  `json:",omitempty"`
+	EngineTaskWorkerCount       *OptionalInteger  `json:",omitempty"`
+	MaxOutstandingBytesPerPeer  *OptionalInteger  `json:",omitempty"`
+	ProviderSearchDelay         *OptionalDuration `json:",omitempty"`
+
+	// MetricsTopPeers is the number of peers, with the most data sent to
+	// them, whose ledger is exported as Prometheus metrics.
+	MetricsTopPeers *OptionalInteger `json:",omitempty"`
+}
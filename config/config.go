@@ -30,6 +30,8 @@ type Config struct {
 	Peering   Peering
 	DNS       DNS
 	Migration Migration
+	P2P       P2P
+	Bitswap   Bitswap
 
 	Provider     Provider
 	Reprovider   Reprovider
@@ -1,9 +1,45 @@
 package config
 
+import "time"
+
+const (
+	DefaultRendezvousEnabled  = false
+	DefaultRendezvousServer   = true
+	DefaultRendezvousInterval = time.Minute
+	DefaultRendezvousPeering  = true
+
+	// DefaultMDNSServiceTag is the DNS-SD service of libp2p mDNS discovery.
+	DefaultMDNSServiceTag = "_p2p._udp"
+)
+
 type Discovery struct {
-	MDNS MDNS
+	MDNS       MDNS
+	Rendezvous Rendezvous
 }
 
 type MDNS struct {
 	Enabled bool
+
+	// ServiceTag is the DNS-SD service the node announces itself and looks
+	// for peers under. Nodes only discover the nodes using the same tag.
+	ServiceTag *OptionalString `json:",omitempty"`
+}
+
+// Rendezvous configures peer discovery in private networks: nodes register
+// with the peers they are connected to, and learn from them the peers they
+// know.
+type Rendezvous struct {
+	// Enabled turns on rendezvous discovery. It requires a swarm key.
+	Enabled Flag `json:",omitempty"`
+
+	// Server makes the node a rendezvous point for the other peers.
+	Server Flag `json:",omitempty"`
+
+	// Interval is how often the node registers with and queries the
+	// rendezvous points.
+	Interval *OptionalDuration `json:",omitempty"`
+
+	// Peering adds the discovered peers to the peering service, so that
+	// they stay connected.
+	Peering Flag `json:",omitempty"`
 }
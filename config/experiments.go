@@ -2,6 +2,7 @@ package config
 
 type Experiments struct {
 	FilestoreEnabled              bool
+	FilestoreWatch                bool `json:",omitempty"`
 	UrlstoreEnabled               bool
 	ShardingEnabled               bool `json:",omitempty"` // deprecated by autosharding: https://github.com/ipfs/kubo/pull/8527
 	Libp2pStreamMounting          bool
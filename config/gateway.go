@@ -1,10 +1,17 @@
 package config
 
+import "time"
+
 const (
 	DefaultInlineDNSLink         = false
 	DefaultDeserializedResponses = true
 	DefaultDisableHTMLErrors     = false
 	DefaultExposeRoutingAPI      = false
+	DefaultAcceptProviderRecords = false
+	DefaultProviderRecordTTL     = 24 * time.Hour
+
+	DefaultMaxProviderRecordsPerPeer = 100_000
+	DefaultMaxProviderRecords        = 1_000_000
 )
 
 type GatewaySpec struct {
@@ -73,4 +80,21 @@ type Gateway struct {
 	// ExposeRoutingAPI configures the gateway port to expose
 	// routing system as HTTP API at /routing/v1 (https://specs.ipfs.tech/routing/http-routing-v1/).
 	ExposeRoutingAPI Flag
+
+	// AcceptProviderRecords configures the routing API exposed with
+	// ExposeRoutingAPI to accept signed provider announcements, and to return
+	// them along with the providers found by the routing system.
+	AcceptProviderRecords Flag
+
+	// ProviderRecordTTL is the maximum lifetime of the provider records
+	// accepted with AcceptProviderRecords.
+	ProviderRecordTTL *OptionalDuration `json:",omitempty"`
+
+	// MaxProviderRecordsPerPeer is the maximum number of provider records
+	// accepted from a single peer with AcceptProviderRecords.
+	MaxProviderRecordsPerPeer *OptionalInteger `json:",omitempty"`
+
+	// MaxProviderRecords is the maximum number of provider records accepted
+	// with AcceptProviderRecords.
+	MaxProviderRecords *OptionalInteger `json:",omitempty"`
 }
@@ -149,6 +149,29 @@ func badgerSpec() map[string]interface{} {
 	}
 }
 
+func levelSpec() map[string]interface{} {
+	return map[string]interface{}{
+		"type":   "measure",
+		"prefix": "leveldb.datastore",
+		"child": map[string]interface{}{
+			"type":        "levelds",
+			"path":        "datastore",
+			"compression": "none",
+		},
+	}
+}
+
+func pebbleSpec() map[string]interface{} {
+	return map[string]interface{}{
+		"type":   "measure",
+		"prefix": "pebble.datastore",
+		"child": map[string]interface{}{
+			"type": "pebbleds",
+			"path": "pebbleds",
+		},
+	}
+}
+
 func flatfsSpec() map[string]interface{} {
 	return map[string]interface{}{
 		"type": "mount",
@@ -0,0 +1,51 @@
+package config
+
+// P2P configures the libp2p stream mounting subsystem ('ipfs p2p'). It is
+// only used when Experimental.Libp2pStreamMounting is enabled.
+type P2P struct {
+	// Listeners are the libp2p services started with the daemon, as with
+	// 'ipfs p2p listen'.
+	Listeners []P2PListener `json:",omitempty"`
+
+	// Forwards are the local listeners forwarding connections to remote
+	// libp2p services started with the daemon, as with 'ipfs p2p forward'.
+	Forwards []P2PForward `json:",omitempty"`
+}
+
+// P2PListener forwards the libp2p streams opened for Protocol to
+// TargetAddress.
+type P2PListener struct {
+	Protocol      string
+	TargetAddress string
+
+	// ReportPeerID sends the remote peer ID to the target when a new
+	// connection is established.
+	ReportPeerID bool `json:",omitempty"`
+
+	// AllowedPeers restricts the peers allowed to open streams. When empty,
+	// any peer is allowed.
+	AllowedPeers []string `json:",omitempty"`
+
+	// Token is a shared secret that peers must send as the first line of
+	// every stream.
+	Token string `json:",omitempty"`
+
+	// MaxStreams is the maximum number of concurrent streams.
+	MaxStreams *OptionalInteger `json:",omitempty"`
+
+	// MaxBandwidth is the maximum throughput of a stream in each direction,
+	// in bytes per second.
+	MaxBandwidth *OptionalInteger `json:",omitempty"`
+}
+
+// P2PForward forwards the connections made to ListenAddress to the Protocol
+// service of the peer at TargetAddress.
+type P2PForward struct {
+	Protocol      string
+	ListenAddress string
+	TargetAddress string
+
+	// Token is sent as the first line of every stream, for services
+	// requiring one.
+	Token string `json:",omitempty"`
+}
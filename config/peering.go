@@ -1,9 +1,50 @@
 package config
 
-import "github.com/libp2p/go-libp2p/core/peer"
+import (
+	"sort"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	DefaultPeeringInitialBackoff = 5 * time.Second
+	DefaultPeeringMaxBackoff     = 10 * time.Minute
+)
 
 // Peering configures the peering service.
 type Peering struct {
 	// Peers lists the nodes to attempt to stay connected with.
 	Peers []peer.AddrInfo
+
+	// Groups are named lists of nodes to attempt to stay connected with,
+	// each with its own reconnection backoff. The "default" group holds
+	// Peers and the peers added with 'ipfs swarm peering add'.
+	Groups map[string]PeeringGroup `json:",omitempty"`
+}
+
+// PeeringGroup is a named list of peers of the peering service.
+type PeeringGroup struct {
+	Peers []peer.AddrInfo
+
+	// InitialBackoff is the delay before reconnecting to a peer of the
+	// group. It grows with each failed attempt, up to MaxBackoff.
+	InitialBackoff *OptionalDuration `json:",omitempty"`
+	MaxBackoff     *OptionalDuration `json:",omitempty"`
+}
+
+// AllPeers returns Peers followed by the peers of all the groups, sorted by
+// group name.
+func (p Peering) AllPeers() []peer.AddrInfo {
+	names := make([]string, 0, len(p.Groups))
+	for name := range p.Groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	peers := append([]peer.AddrInfo(nil), p.Peers...)
+	for _, name := range names {
+		peers = append(peers, p.Groups[name].Peers...)
+	}
+	return peers
 }
@@ -70,6 +70,24 @@ profile, enables discovery in local networks.`,
 			return nil
 		},
 	},
+	"lan": {
+		Description: `Runs the node in local networks without internet access:
+skips the public bootstrap peers and DHT, runs a LAN DHT only, prefers
+private and link-local addresses in announcements, and discovers peers
+with mDNS.`,
+
+		Transform: func(c *Config) error {
+			c.Addresses.NoAnnounce = deleteEntries(c.Addresses.NoAnnounce, defaultServerFilters)
+			c.Swarm.AddrFilters = deleteEntries(c.Swarm.AddrFilters, defaultServerFilters)
+			c.Bootstrap = []string{}
+			c.Routing.Type = NewOptionalString("lan")
+			c.Routing.AcceleratedDHTClient = false
+			c.Discovery.MDNS.Enabled = true
+			c.Swarm.DisableNatPortMap = true
+			c.AutoNAT.ServiceMode = AutoNATServiceDisabled
+			return nil
+		},
+	},
 	"test": {
 		Description: `Reduces external interference of IPFS daemon, this
 is useful when using the daemon in test environments.`,
@@ -134,7 +152,8 @@ You should use this datastore if:
 * You want to minimize memory usage.
 * You are ok with the default speed of data import, or prefer to use --nocopy.
 
-This profile may only be applied when first initializing the node.
+This profile may only be applied when first initializing the node. Use
+'ipfs repo convert --to=flatfs' to convert an existing repo.
 `,
 
 		InitOnly: true,
@@ -160,7 +179,8 @@ However, be aware that:
 * The current implementation is based on old badger 1.x
   which is no longer supported by the upstream team.
 
-This profile may only be applied when first initializing the node.`,
+This profile may only be applied when first initializing the node. Use
+'ipfs repo convert --to=badgerds' to convert an existing repo.`,
 
 		InitOnly: true,
 		Transform: func(c *Config) error {
@@ -168,6 +188,40 @@ This profile may only be applied when first initializing the node.`,
 			return nil
 		},
 	},
+	"levelds": {
+		Description: `Configures the node to store everything, including blocks, in
+a single leveldb datastore.
+
+Use this datastore if you store many small blocks and want to avoid creating a
+file per block, but be aware that leveldb is slower than flatfs with large
+blocks and compacts its data in the background.
+
+This profile may only be applied when first initializing the node. Use
+'ipfs repo convert --to=levelds' to convert an existing repo.`,
+
+		InitOnly: true,
+		Transform: func(c *Config) error {
+			c.Datastore.Spec = levelSpec()
+			return nil
+		},
+	},
+	"pebbleds": {
+		Description: `Configures the node to store everything, including blocks, in
+a single pebble datastore.
+
+Pebble is a LevelDB/RocksDB inspired key-value store that performs better
+than leveldb under heavy write loads. Its cache size, memtable size,
+compaction concurrency and WAL syncing can be tuned in Datastore.Spec.
+
+This profile may only be applied when first initializing the node. Use
+'ipfs repo convert --to=pebbleds' to convert an existing repo.`,
+
+		InitOnly: true,
+		Transform: func(c *Config) error {
+			c.Datastore.Spec = pebbleSpec()
+			return nil
+		},
+	},
 	"lowpower": {
 		Description: `Reduces daemon overhead on the system. May affect node
 functionality - performance of content discovery and data
@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 const (
 	// LastSeenMessagesStrategy is a strategy that calculates the TTL countdown
 	// based on the last time a Pubsub message is seen. This means that if a message
@@ -17,6 +19,14 @@ const (
 	// DefaultSeenMessagesStrategy is the strategy that is used by default if
 	// no Pubsub.SeenMessagesStrategy is specified.
 	DefaultSeenMessagesStrategy = LastSeenMessagesStrategy
+
+	// DefaultPubsubRetentionSize is the default number of messages buffered
+	// for a durable topic.
+	DefaultPubsubRetentionSize = 1000
+
+	// DefaultPubsubRetentionAge is the default age after which buffered
+	// messages of a durable topic are dropped.
+	DefaultPubsubRetentionAge = 24 * time.Hour
 )
 
 type PubsubConfig struct {
@@ -38,4 +48,43 @@ type PubsubConfig struct {
 	// SeenMessagesStrategy is a setting that determines how the time-to-live
 	// (TTL) countdown for deduplicating messages is calculated.
 	SeenMessagesStrategy *OptionalString `json:",omitempty"`
+
+	// PeerScoring enables gossipsub peer scoring, penalizing peers that
+	// misbehave. Scores are reported by 'ipfs pubsub inspect'.
+	PeerScoring Flag `json:",omitempty"`
+
+	// Topics configures access control and validation of messages, keyed by
+	// topic name. Topics without an entry accept any message.
+	Topics map[string]PubsubTopic `json:",omitempty"`
+}
+
+// PubsubTopic configures which messages are accepted on a single topic.
+type PubsubTopic struct {
+	// AllowedPublishers is the list of peer IDs allowed to author messages
+	// on this topic. When empty, messages from any peer are accepted.
+	AllowedPublishers []string `json:",omitempty"`
+
+	// MaxMessageSize is the maximum size of a message payload, in bytes.
+	MaxMessageSize *OptionalInteger `json:",omitempty"`
+
+	// RateLimit is the maximum number of messages per second accepted from
+	// a single peer forwarding messages on this topic.
+	RateLimit *OptionalInteger `json:",omitempty"`
+
+	// Validator is the name of a validator registered by a plugin, which
+	// is run after all the built-in checks pass.
+	Validator *OptionalString `json:",omitempty"`
+
+	// Durable makes the daemon stay subscribed to this topic and buffer the
+	// received messages in the repo datastore, so that subscribers can
+	// replay them with 'ipfs pubsub sub --since'.
+	Durable Flag `json:",omitempty"`
+
+	// RetentionSize is the maximum number of messages kept in the buffer of
+	// a durable topic.
+	RetentionSize *OptionalInteger `json:",omitempty"`
+
+	// RetentionAge is the maximum age of messages kept in the buffer of a
+	// durable topic.
+	RetentionAge *OptionalDuration `json:",omitempty"`
 }
@@ -4,14 +4,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"runtime"
+	"time"
 )
 
 // Routing defines configuration options for libp2p routing.
 type Routing struct {
 	// Type sets default daemon routing mode.
 	//
-	// Can be one of "auto", "autoclient", "dht", "dhtclient", "dhtserver", "none", or "custom".
+	// Can be one of "auto", "autoclient", "dht", "dhtclient", "dhtserver", "lan", "none", or "custom".
 	// When unset or set to "auto", DHT and implicit routers are used.
+	// When "lan" is set, only the LAN DHT is used.
 	// When "custom" is set, user-provided Routing.Routers is used.
 	Type *OptionalString `json:",omitempty"`
 
@@ -75,7 +77,8 @@ func (r *RouterParser) UnmarshalJSON(b []byte) error {
 	if err := json.Unmarshal(b, &out); err != nil {
 		return err
 	}
-	raw := out.Parameters.(*json.RawMessage)
+	// "Parameters": null sets out.Parameters to nil.
+	raw, _ := out.Parameters.(*json.RawMessage)
 
 	var p interface{}
 	switch out.Type {
@@ -87,10 +90,15 @@ func (r *RouterParser) UnmarshalJSON(b []byte) error {
 		p = &ComposableRouterParams{}
 	case RouterTypeParallel:
 		p = &ComposableRouterParams{}
+	case RouterTypeStatic:
+		p = &StaticRouterParams{}
 	}
 
-	if err := json.Unmarshal(*raw, &p); err != nil {
-		return err
+	// Parameters are optional for routers that need none.
+	if raw != nil && len(*raw) > 0 {
+		if err := json.Unmarshal(*raw, &p); err != nil {
+			return err
+		}
 	}
 
 	r.Router.Type = out.Type
@@ -108,6 +116,7 @@ const (
 	RouterTypeDHT        RouterType = "dht"        // DHT router.
 	RouterTypeSequential RouterType = "sequential" // Router helper to execute several routers sequentially.
 	RouterTypeParallel   RouterType = "parallel"   // Router helper to execute several routers in parallel.
+	RouterTypeStatic     RouterType = "static"     // Router serving records from a local file or the datastore.
 )
 
 type DHTMode string
@@ -140,6 +149,26 @@ type HTTPRouterParams struct {
 
 	// MaxProvideConcurrency determines the number of threads used when providing content. GOMAXPROCS by default.
 	MaxProvideConcurrency int
+
+	// Cache, when set, caches the provider, peer and IPNS records returned by the router.
+	Cache *RouterCacheParams `json:",omitempty"`
+}
+
+const (
+	DefaultRouterCacheTTL         = 5 * time.Minute
+	DefaultRouterCacheNegativeTTL = time.Minute
+	DefaultRouterCacheMaxEntries  = 10000
+)
+
+type RouterCacheParams struct {
+	// TTL is how long records are cached. IPNS records are cached at most for their own TTL.
+	TTL *OptionalDuration `json:",omitempty"`
+
+	// NegativeTTL is how long the absence of records is cached. Set to 0 to disable negative caching.
+	NegativeTTL *OptionalDuration `json:",omitempty"`
+
+	// MaxEntries is the maximum number of lookups cached, the least recently used are evicted first.
+	MaxEntries *OptionalInteger `json:",omitempty"`
 }
 
 func (hrp *HTTPRouterParams) FillDefaults() {
@@ -158,6 +187,12 @@ type DHTRouterParams struct {
 	PublicIPNetwork      bool
 }
 
+type StaticRouterParams struct {
+	// File is a JSON file holding the records. Relative paths are relative to
+	// the repo directory. When unset, the records are stored in the datastore.
+	File string `json:",omitempty"`
+}
+
 type ComposableRouterParams struct {
 	Routers []ConfigRouter
 	Timeout *OptionalDuration `json:",omitempty"`
@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 type SwarmConfig struct {
 	// AddrFilters specifies a set libp2p addresses that we should never
 	// dial or receive connections from.
@@ -32,6 +34,27 @@ type SwarmConfig struct {
 
 	// ResourceMgr configures the libp2p Network Resource Manager
 	ResourceMgr ResourceMgr
+
+	// Reputation configures the banning of misbehaving peers.
+	Reputation Reputation
+}
+
+const (
+	DefaultReputationEnabled      = false
+	DefaultReputationBanThreshold = 100
+	DefaultReputationBanDuration  = time.Hour
+)
+
+// Reputation configures the reputation subsystem, which scores peers on
+// their misbehavior and temporarily bans the worst ones.
+type Reputation struct {
+	Enabled Flag `json:",omitempty"`
+
+	// BanThreshold is the score at which peers get banned.
+	BanThreshold *OptionalInteger `json:",omitempty"`
+
+	// BanDuration is how long peers stay banned.
+	BanDuration *OptionalDuration `json:",omitempty"`
 }
 
 type RelayClient struct {
@@ -110,6 +133,42 @@ type ConnMgr struct {
 	LowWater    *OptionalInteger  `json:",omitempty"`
 	HighWater   *OptionalInteger  `json:",omitempty"`
 	GracePeriod *OptionalDuration `json:",omitempty"`
+
+	// Rules tag, and optionally protect, the peers matching them in the
+	// basic connection manager.
+	Rules []ConnMgrRule `json:",omitempty"`
+}
+
+// DefaultConnMgrRuleWeight is the default value of the tag set on the peers
+// matching a connection manager rule.
+const DefaultConnMgrRuleWeight = 50
+
+// ConnMgrRule tags the peers matching all its conditions in the connection
+// manager, making them less likely to be trimmed.
+type ConnMgrRule struct {
+	// Name identifies the rule, the peers matching it are tagged with
+	// "rule:<Name>".
+	Name string
+
+	// AgentVersionPrefix matches the peers whose identify agent version
+	// starts with it.
+	AgentVersionPrefix *OptionalString `json:",omitempty"`
+
+	// Networks matches the peers connected from an address in one of the
+	// networks, in the format of Swarm.AddrFilters.
+	Networks []string `json:",omitempty"`
+
+	// ProvidedWithin matches the peers that sent us blocks within the
+	// duration.
+	ProvidedWithin *OptionalDuration `json:",omitempty"`
+
+	// Weight is the value of the tag, peers with the lowest total value are
+	// trimmed first.
+	Weight *OptionalInteger `json:",omitempty"`
+
+	// Protect keeps the connections to the matching peers from being
+	// trimmed at all.
+	Protect Flag `json:",omitempty"`
 }
 
 // ResourceMgr defines configuration options for the libp2p Network Resource Manager
@@ -6,6 +6,7 @@ import (
 
 	cmdenv "github.com/ipfs/kubo/core/commands/cmdenv"
 	e "github.com/ipfs/kubo/core/commands/e"
+	"github.com/ipfs/kubo/core/node"
 
 	humanize "github.com/dustin/go-humanize"
 	bitswap "github.com/ipfs/boxo/bitswap"
@@ -92,6 +93,14 @@ const (
 	bitswapHumanOptionName   = "human"
 )
 
+// bitswapStat adds the counters of the serve policy to the bitswap
+// statistics.
+type bitswapStat struct {
+	bitswap.Stat
+	ServePolicy string `json:",omitempty"`
+	ServeDenied uint64 `json:",omitempty"`
+}
+
 var bitswapStatCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline:          "Show some diagnostic information on the bitswap agent.",
@@ -101,7 +110,7 @@ var bitswapStatCmd = &cmds.Command{
 		cmds.BoolOption(bitswapVerboseOptionName, "v", "Print extra information"),
 		cmds.BoolOption(bitswapHumanOptionName, "Print sizes in human readable format (e.g., 1K 234M 2G)"),
 	},
-	Type: bitswap.Stat{},
+	Type: bitswapStat{},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		nd, err := cmdenv.GetNode(env)
 		if err != nil {
@@ -122,10 +131,15 @@ var bitswapStatCmd = &cmds.Command{
 			return err
 		}
 
-		return cmds.EmitOnce(res, st)
+		out := &bitswapStat{Stat: *st}
+		if p := nd.BitswapServePolicy; p != nil {
+			out.ServePolicy = p.Policy()
+			out.ServeDenied = p.Denied()
+		}
+		return cmds.EmitOnce(res, out)
 	},
 	Encoders: cmds.EncoderMap{
-		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, s *bitswap.Stat) error {
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, s *bitswapStat) error {
 			enc, err := cmdenv.GetLowLevelCidEncoder(req)
 			if err != nil {
 				return err
@@ -150,6 +164,10 @@ var bitswapStatCmd = &cmds.Command{
 			} else {
 				fmt.Fprintf(w, "\tdup data received: %d\n", s.DupDataReceived)
 			}
+			if s.ServePolicy != "" {
+				fmt.Fprintf(w, "\tserve policy: %s\n", s.ServePolicy)
+				fmt.Fprintf(w, "\tdenied requests: %d\n", s.ServeDenied)
+			}
 			fmt.Fprintf(w, "\twantlist [%d keys]\n", len(s.Wantlist))
 			for _, k := range s.Wantlist {
 				fmt.Fprintf(w, "\t\t%s\n", enc.Encode(k))
@@ -167,17 +185,27 @@ var bitswapStatCmd = &cmds.Command{
 	},
 }
 
+const (
+	ledgerAllOptionName  = "all"
+	ledgerSortOptionName = "sort"
+)
+
 var ledgerCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Show the current ledger for a peer.",
 		ShortDescription: `
 The Bitswap decision engine tracks the number of bytes exchanged between IPFS
 nodes, and stores this information as a collection of ledgers. This command
-prints the ledger associated with a given peer.
+prints the ledger associated with a given peer, or with --all the ledgers of
+every peer, sorted by --sort.
 `,
 	},
 	Arguments: []cmds.Argument{
-		cmds.StringArg("peer", true, false, "The PeerID (B58) of the ledger to inspect."),
+		cmds.StringArg("peer", false, false, "The PeerID (B58) of the ledger to inspect."),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(ledgerAllOptionName, "a", "Show the ledgers of all peers."),
+		cmds.StringOption(ledgerSortOptionName, "s", "Field to sort the ledgers of --all by, in decreasing order: sent, recv, exchanged or value.").WithDefault("sent"),
 	},
 	Type: server.Receipt{},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
@@ -195,6 +223,27 @@ prints the ledger associated with a given peer.
 			return e.TypeErr(bs, nd.Exchange)
 		}
 
+		all, _ := req.Options[ledgerAllOptionName].(bool)
+		if all {
+			if len(req.Arguments) > 0 {
+				return fmt.Errorf("cannot use --%s with a peer argument", ledgerAllOptionName)
+			}
+			sortBy, _ := req.Options[ledgerSortOptionName].(string)
+			ledgers, err := node.BitswapLedgers(bs, sortBy)
+			if err != nil {
+				return err
+			}
+			for _, l := range ledgers {
+				if err := res.Emit(l); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		if len(req.Arguments) == 0 {
+			return fmt.Errorf("a peer argument or --%s is required", ledgerAllOptionName)
+		}
 		partner, err := peer.Decode(req.Arguments[0])
 		if err != nil {
 			return err
@@ -124,12 +124,31 @@ func TestCommands(t *testing.T) {
 		"/routing/findpeer",
 		"/routing/findprovs",
 		"/routing/provide",
+		"/routing/explain",
+		"/routing/explain/findpeer",
+		"/routing/explain/findprovs",
+		"/routing/explain/get",
+		"/routing/static",
+		"/routing/static/add",
+		"/routing/static/add/ipns",
+		"/routing/static/add/peer",
+		"/routing/static/add/provider",
+		"/routing/static/ls",
+		"/routing/static/rm",
+		"/routing/static/rm/ipns",
+		"/routing/static/rm/peer",
+		"/routing/static/rm/provider",
 		"/diag",
 		"/diag/cmds",
 		"/diag/cmds/clear",
 		"/diag/cmds/set-time",
 		"/diag/profile",
 		"/diag/sys",
+		"/dns",
+		"/dns/cache",
+		"/dns/cache/flush",
+		"/dns/cache/ls",
+		"/dns/resolve",
 		"/files",
 		"/files/chcid",
 		"/files/cp",
@@ -144,6 +163,8 @@ func TestCommands(t *testing.T) {
 		"/filestore",
 		"/filestore/dups",
 		"/filestore/ls",
+		"/filestore/reindex",
+		"/filestore/rm",
 		"/filestore/verify",
 		"/get",
 		"/id",
@@ -213,6 +234,7 @@ func TestCommands(t *testing.T) {
 		"/pin/verify",
 		"/ping",
 		"/pubsub",
+		"/pubsub/inspect",
 		"/pubsub/ls",
 		"/pubsub/peers",
 		"/pubsub/pub",
@@ -220,8 +242,11 @@ func TestCommands(t *testing.T) {
 		"/refs",
 		"/refs/local",
 		"/repo",
+		"/repo/backup",
 		"/repo/gc",
 		"/repo/migrate",
+		"/repo/convert",
+		"/repo/restore",
 		"/repo/stat",
 		"/repo/verify",
 		"/repo/version",
@@ -238,8 +263,11 @@ func TestCommands(t *testing.T) {
 		"/swarm/addrs",
 		"/swarm/addrs/listen",
 		"/swarm/addrs/local",
+		"/swarm/bans",
+		"/swarm/bans/rm",
 		"/swarm/connect",
 		"/swarm/disconnect",
+		"/swarm/discover",
 		"/swarm/filters",
 		"/swarm/filters/add",
 		"/swarm/filters/rm",
@@ -248,8 +276,11 @@ func TestCommands(t *testing.T) {
 		"/swarm/peering/add",
 		"/swarm/peering/ls",
 		"/swarm/peering/rm",
+		"/swarm/peering/status",
 		"/swarm/resources",
 		"/update",
+		"/urlstore",
+		"/urlstore/add",
 		"/version",
 		"/version/deps",
 	}
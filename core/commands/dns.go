@@ -0,0 +1,206 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ipfs/boxo/namesys"
+	"github.com/ipfs/boxo/path"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/kubo/core/commands/cmdenv"
+	"github.com/ipfs/kubo/dnsresolver"
+)
+
+const dnsExplainOptionName = "explain"
+
+var DNSCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Resolve DNSLink records and inspect the DNS cache.",
+		ShortDescription: `
+Resolves DNSLink records with the resolvers of DNS.Resolvers, explains how
+they were answered, and lists or flushes the answers cached from DNS over
+HTTPS resolvers.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"resolve": dnsResolveCmd,
+		"cache":   dnsCacheCmd,
+	},
+}
+
+type dnsResolveOutput struct {
+	Path    string               `json:",omitempty"`
+	Error   string               `json:",omitempty"`
+	Lookups []dnsresolver.Lookup `json:",omitempty"`
+}
+
+var dnsResolveCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Resolve the DNSLink record of a domain.",
+		ShortDescription: `
+Returns the content path of the DNSLink record of a domain, read from the TXT
+records of _dnslink.<domain>. The path is not resolved further, use
+'ipfs resolve' for that.
+
+  > ipfs dns resolve docs.ipfs.tech
+  /ipfs/bafybeieenxnjdjm7vbr5zdwemaun4sw4iy7h4imlvyhxcw6ul2hh7xvxai
+
+With --explain, the DNS lookups made are printed, with the resolver that
+answered them (a DoH resolver URL, or 'system' for the resolver of the
+operating system), the raw TXT records, their TTL as answered by the DoH
+resolver, and whether the DoH resolver answered from its cache. The TTL of a
+cached answer is what remains of it.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("domain", true, false, "The domain to resolve, or an /ipns/<domain> path."),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(dnsExplainOptionName, "Print the DNS lookups made, with their resolver and records."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		node, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		explain, _ := req.Options[dnsExplainOptionName].(bool)
+
+		name := strings.TrimPrefix(req.Arguments[0], "/ipns/")
+		p, err := path.NewPath("/ipns/" + name)
+		if err != nil {
+			return err
+		}
+
+		ctx, trace := dnsresolver.WithTrace(req.Context)
+		result, err := namesys.NewDNSResolver(node.DNS.LookupTXT).Resolve(ctx, p, namesys.ResolveWithDepth(1))
+		if !explain {
+			if err != nil {
+				return err
+			}
+			return cmds.EmitOnce(res, &dnsResolveOutput{Path: result.Path.String()})
+		}
+
+		out := &dnsResolveOutput{Lookups: trace.Lookups()}
+		if err != nil {
+			out.Error = err.Error()
+		} else {
+			out.Path = result.Path.String()
+		}
+		if emitErr := res.Emit(out); emitErr != nil {
+			return emitErr
+		}
+		return err
+	},
+	Type: dnsResolveOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *dnsResolveOutput) error {
+			for _, l := range out.Lookups {
+				line := fmt.Sprintf("%s %s via %s", l.Type, l.Name, l.Resolver)
+				if l.Cached {
+					line += " (cached)"
+				}
+				if l.TTL != 0 {
+					line += fmt.Sprintf(" TTL %s", time.Duration(l.TTL)*time.Second)
+				}
+				fmt.Fprintln(w, line)
+				if l.Error != "" {
+					fmt.Fprintf(w, "\terror: %s\n", l.Error)
+				}
+				for _, r := range l.Records {
+					fmt.Fprintf(w, "\t%q\n", r)
+				}
+			}
+			if out.Path != "" {
+				fmt.Fprintln(w, out.Path)
+			}
+			return nil
+		}),
+	},
+}
+
+var dnsCacheCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Inspect the cache of DNS over HTTPS answers.",
+		ShortDescription: `
+Answers of the DNS over HTTPS resolvers are cached for their TTL, capped by
+DNS.MaxCacheTTL. Answers of the system resolver are not cached by the node.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"ls":    dnsCacheLsCmd,
+		"flush": dnsCacheFlushCmd,
+	},
+}
+
+type dnsCacheEntries struct {
+	Entries []dnsresolver.CacheEntry
+}
+
+var dnsCacheLsCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "List the DNS answers fetched from DoH resolvers.",
+		ShortDescription: `
+Lists the cached answers fetched from DNS over HTTPS resolvers, with the time
+they were fetched, the TTL of their records and when they expire. Each answer
+stays cached for its TTL, capped by DNS.MaxCacheTTL.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		node, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &dnsCacheEntries{Entries: node.DNS.CacheEntries()})
+	},
+	Type: dnsCacheEntries{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *dnsCacheEntries) error {
+			tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "NAME\tTYPE\tRESOLVER\tFETCHED\tTTL\tEXPIRES")
+			for _, e := range out.Entries {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s ago\t%s\tin %s\n", e.Name, e.Type, e.Resolver, time.Since(e.Fetched).Round(time.Second),
+					time.Duration(e.TTL)*time.Second, time.Until(e.Expires).Round(time.Second))
+				for _, r := range e.Records {
+					fmt.Fprintf(tw, "\t\t%q\t\t\t\n", r)
+				}
+			}
+			return tw.Flush()
+		}),
+	},
+}
+
+type dnsCacheFlushOutput struct {
+	Removed int
+}
+
+var dnsCacheFlushCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Remove all the DNS answers from the cache.",
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		node, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		removed, err := node.DNS.FlushCache()
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &dnsCacheFlushOutput{Removed: removed})
+	},
+	Type: dnsCacheFlushOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *dnsCacheFlushOutput) error {
+			_, err := fmt.Fprintf(w, "removed %d cache entries\n", out.Removed)
+			return err
+		}),
+	},
+}
@@ -5,12 +5,17 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 
+	"github.com/ipfs/boxo/blockservice"
+	offline "github.com/ipfs/boxo/exchange/offline"
 	filestore "github.com/ipfs/boxo/filestore"
+	"github.com/ipfs/boxo/ipld/merkledag"
 	cmds "github.com/ipfs/go-ipfs-cmds"
 	core "github.com/ipfs/kubo/core"
 	cmdenv "github.com/ipfs/kubo/core/commands/cmdenv"
 	e "github.com/ipfs/kubo/core/commands/e"
+	"github.com/ipfs/kubo/core/node"
 
 	"github.com/ipfs/go-cid"
 )
@@ -20,9 +25,11 @@ var FileStoreCmd = &cmds.Command{
 		Tagline: "Interact with filestore objects.",
 	},
 	Subcommands: map[string]*cmds.Command{
-		"ls":     lsFileStore,
-		"verify": verifyFileStore,
-		"dups":   dupsFileStore,
+		"ls":      lsFileStore,
+		"verify":  verifyFileStore,
+		"dups":    dupsFileStore,
+		"reindex": reindexFileStore,
+		"rm":      rmFileStore,
 	},
 }
 
@@ -112,13 +119,16 @@ The output is:
 
 Where <status> is one of:
 ok:       the block can be reconstructed
-changed:  the contents of the backing file have changed
+changed:  the contents of the backing file or URL have changed
 no-file:  the backing file could not be found
-error:    there was some other problem reading the file
+error:    there was some other problem reading the file or URL
 missing:  <obj> could not be found in the filestore
 ERROR:    internal error, most likely due to a corrupt database
 
 For ERROR entries the error will also be printed to stderr.
+
+The blocks added with 'ipfs urlstore add' are fetched from their URL, which
+requires Experimental.UrlstoreEnabled.
 `,
 	},
 	Arguments: []cmds.Argument{
@@ -224,6 +234,123 @@ var dupsFileStore = &cmds.Command{
 	Type:     RefWrapper{},
 }
 
+var reindexFileStore = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Update filestore references to files that moved.",
+		LongDescription: `
+Look for the backing files of the filestore objects that are missing or
+changed in <dir>, and update the references to the files found there with the
+same contents, without re-adding them. Files with the same name are tried
+first, then any file large enough. <dir> must be under the filestore root,
+the parent directory of the repo.
+
+The output is:
+
+<old path> -> <new path> (<blocks> blocks)
+
+for the files found, and an error for the others.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("dir", true, false, "Directory to look for the files in."),
+	},
+	PreRun: func(req *cmds.Request, env cmds.Environment) error {
+		// The path is resolved by the daemon, which may run in another directory.
+		dir, err := filepath.Abs(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+		req.Arguments[0] = dir
+		return nil
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, fs, err := getFilestore(env)
+		if err != nil {
+			return err
+		}
+		root, err := node.FilestoreRoot(n.Repo)
+		if err != nil {
+			return err
+		}
+
+		return node.FilestoreReindex(req.Context, fs, root, req.Arguments[0], func(r *node.FilestoreReindexRes) error {
+			return res.Emit(r)
+		})
+	},
+	PostRun: cmds.PostRunMap{
+		cmds.CLI: streamResult(func(v interface{}, out io.Writer) nonFatalError {
+			r := v.(*node.FilestoreReindexRes)
+			if r.ErrorMsg != "" {
+				return nonFatalError(fmt.Sprintf("%s: %s", r.From, r.ErrorMsg))
+			}
+			fmt.Fprintf(out, "%s -> %s (%d blocks)\n", r.From, r.To, r.Blocks)
+			return ""
+		}),
+	},
+	Type: node.FilestoreReindexRes{},
+}
+
+var rmFileStore = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Remove references from the filestore.",
+		LongDescription: `
+Remove the filestore references to the blocks of <obj>, without touching the
+backing files. <obj> is either a CID, whose own reference and the references
+to the blocks of its DAG are removed, or a file or directory path or a URL
+added with 'ipfs urlstore add', the references to whose blocks are removed.
+
+The removed blocks are no longer available, even if they are pinned: re-add
+the files to make them available again.
+
+The output is:
+
+<hash> <size> <path> <offset>
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("obj", true, true, "CID or path of the objects to remove."),
+	},
+	PreRun: func(req *cmds.Request, env cmds.Environment) error {
+		return absPathArgs(req)
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, fs, err := getFilestore(env)
+		if err != nil {
+			return err
+		}
+		root, err := node.FilestoreRoot(n.Repo)
+		if err != nil {
+			return err
+		}
+		// Only walk the blocks we have.
+		dag := merkledag.NewDAGService(blockservice.New(n.Blockstore, offline.Exchange(n.Blockstore)))
+
+		for _, arg := range req.Arguments {
+			err := node.FilestoreRemove(req.Context, fs, dag, root, arg, func(r *filestore.ListRes) error {
+				return res.Emit(r)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	PostRun: cmds.PostRunMap{
+		cmds.CLI: func(res cmds.Response, re cmds.ResponseEmitter) error {
+			enc, err := cmdenv.GetCidEncoder(res.Request())
+			if err != nil {
+				return err
+			}
+			return streamResult(func(v interface{}, out io.Writer) nonFatalError {
+				r := v.(*filestore.ListRes)
+				fmt.Fprintf(out, "%s\n", r.FormatLong(enc.Encode))
+				return ""
+			})(res, re)
+		},
+	},
+	Type: filestore.ListRes{},
+}
+
 func getFilestore(env cmds.Environment) (*core.IpfsNode, *filestore.Filestore, error) {
 	n, err := cmdenv.GetNode(env)
 	if err != nil {
@@ -257,3 +384,20 @@ func listByArgs(ctx context.Context, res cmds.ResponseEmitter, fs *filestore.Fil
 
 	return nil
 }
+
+// absPathArgs makes the file path arguments of req absolute, as they are
+// resolved by the daemon, which may run in another directory. CIDs and URLs
+// are left as is.
+func absPathArgs(req *cmds.Request) error {
+	for i, arg := range req.Arguments {
+		if _, err := cid.Decode(arg); err == nil || filestore.IsURL(arg) {
+			continue
+		}
+		path, err := filepath.Abs(arg)
+		if err != nil {
+			return err
+		}
+		req.Arguments[i] = path
+	}
+	return nil
+}
@@ -31,6 +31,11 @@ type IdOutput struct { // nolint
 	Addresses    []string
 	AgentVersion string
 	Protocols    []protocol.ID
+
+	// Mode is "lan" when the local node runs in LAN mode, with the mDNS
+	// service it is discovered under.
+	Mode           string `json:",omitempty"`
+	MDNSServiceTag string `json:",omitempty"`
 }
 
 const (
@@ -210,5 +215,9 @@ func printSelf(keyEnc ke.KeyEncoder, node *core.IpfsNode) (interface{}, error) {
 		sort.Slice(info.Protocols, func(i, j int) bool { return info.Protocols[i] < info.Protocols[j] })
 	}
 	info.AgentVersion = version.GetUserAgentVersion()
+	if node.LAN != nil {
+		info.Mode = "lan"
+		info.MDNSServiceTag = node.LAN.MDNSServiceTag
+	}
 	return info, nil
 }
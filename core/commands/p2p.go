@@ -10,6 +10,7 @@ import (
 	"text/tabwriter"
 	"time"
 
+	config "github.com/ipfs/kubo/config"
 	core "github.com/ipfs/kubo/core"
 	cmdenv "github.com/ipfs/kubo/core/commands/cmdenv"
 	p2p "github.com/ipfs/kubo/p2p"
@@ -19,7 +20,6 @@ import (
 	pstore "github.com/libp2p/go-libp2p/core/peerstore"
 	protocol "github.com/libp2p/go-libp2p/core/protocol"
 	ma "github.com/multiformats/go-multiaddr"
-	madns "github.com/multiformats/go-multiaddr-dns"
 )
 
 // P2PProtoPrefix is the default required prefix for protocol names
@@ -53,6 +53,11 @@ type P2PStreamsOutput struct {
 const (
 	allowCustomProtocolOptionName = "allow-custom-protocol"
 	reportPeerIDOptionName        = "report-peer-id"
+	allowPeerOptionName           = "allow-peer"
+	p2pTokenOptionName            = "token"
+	maxStreamsOptionName          = "max-streams"
+	maxBandwidthOptionName        = "max-bandwidth"
+	p2pPersistOptionName          = "persist"
 )
 
 var resolveTimeout = 10 * time.Second
@@ -92,6 +97,10 @@ Example:
   ipfs p2p forward ` + P2PProtoPrefix + `myproto /ip4/127.0.0.1/tcp/4567 /p2p/QmPeer
     - Forward connections to 127.0.0.1:4567 to '` + P2PProtoPrefix + `myproto' service on /p2p/QmPeer
 
+Use --token to send a token to services created with 'ipfs p2p listen --token'.
+
+With --persist, the forward is also saved to P2P.Forwards in the config and is
+started again when the daemon restarts.
 `,
 	},
 	Arguments: []cmds.Argument{
@@ -101,6 +110,8 @@ Example:
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption(allowCustomProtocolOptionName, "Don't require /x/ prefix"),
+		cmds.StringOption(p2pTokenOptionName, "Token sent as the first line of every stream."),
+		cmds.BoolOption(p2pPersistOptionName, "Save the forward to the config so it is started again when the daemon restarts."),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		n, err := p2pGetNode(env)
@@ -130,10 +141,43 @@ Example:
 			return errors.New("protocol name must be within '" + P2PProtoPrefix + "' namespace")
 		}
 
-		return forwardLocal(n.Context(), n.P2P, n.Peerstore, proto, listen, targets)
+		token, _ := req.Options[p2pTokenOptionName].(string)
+
+		if err := forwardLocal(n.Context(), n.P2P, n.Peerstore, proto, listen, targets, token); err != nil {
+			return err
+		}
+
+		if persist, _ := req.Options[p2pPersistOptionName].(bool); persist {
+			return persistForward(n, config.P2PForward{
+				Protocol:      protoOpt,
+				ListenAddress: listenOpt,
+				TargetAddress: targetOpt,
+				Token:         token,
+			})
+		}
+		return nil
 	},
 }
 
+// persistForward saves a forward to P2P.Forwards, replacing any previous entry
+// for the same listen address.
+func persistForward(n *core.IpfsNode, f config.P2PForward) error {
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		return err
+	}
+
+	forwards := []config.P2PForward{}
+	for _, existing := range cfg.P2P.Forwards {
+		if existing.ListenAddress != f.ListenAddress {
+			forwards = append(forwards, existing)
+		}
+	}
+	cfg.P2P.Forwards = append(forwards, f)
+
+	return n.Repo.SetConfig(cfg)
+}
+
 // parseIpfsAddr is a function that takes in addr string and return ipfsAddrs
 func parseIpfsAddr(addr string) (*peer.AddrInfo, error) {
 	multiaddr, err := ma.NewMultiaddr(addr)
@@ -141,43 +185,9 @@ func parseIpfsAddr(addr string) (*peer.AddrInfo, error) {
 		return nil, err
 	}
 
-	pi, err := peer.AddrInfoFromP2pAddr(multiaddr)
-	if err == nil {
-		return pi, nil
-	}
-
-	// resolve multiaddr whose protocol is not ma.P_IPFS
 	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
 	defer cancel()
-	addrs, err := madns.Resolve(ctx, multiaddr)
-	if err != nil {
-		return nil, err
-	}
-	if len(addrs) == 0 {
-		return nil, errors.New("fail to resolve the multiaddr:" + multiaddr.String())
-	}
-	var info peer.AddrInfo
-	for _, addr := range addrs {
-		taddr, id := peer.SplitAddr(addr)
-		if id == "" {
-			// not an ipfs addr, skipping.
-			continue
-		}
-		switch info.ID {
-		case "":
-			info.ID = id
-		case id:
-		default:
-			return nil, fmt.Errorf(
-				"ambiguous multiaddr %s could refer to %s or %s",
-				multiaddr,
-				info.ID,
-				id,
-			)
-		}
-		info.Addrs = append(info.Addrs, taddr)
-	}
-	return &info, nil
+	return p2p.ResolvePeerAddr(ctx, multiaddr)
 }
 
 var p2pListenCmd = &cmds.Command{
@@ -193,6 +203,19 @@ Example:
   ipfs p2p listen ` + P2PProtoPrefix + `myproto /ip4/127.0.0.1/tcp/1234
     - Forward connections to 'myproto' libp2p service to 127.0.0.1:1234
 
+Streams are encrypted by libp2p, but any peer can open them by default. They
+can be restricted with:
+
+  --allow-peer      only accept streams from the given peer IDs.
+  --token           require the first line of every stream to be the given
+                    token. It is not forwarded to the target, and is sent
+                    by 'ipfs p2p forward --token'.
+  --max-streams     limit the number of concurrent streams.
+  --max-bandwidth   limit the throughput of each stream, in bytes per second
+                    in each direction.
+
+With --persist, the listener is also saved to P2P.Listeners in the config and
+is started again when the daemon restarts.
 `,
 	},
 	Arguments: []cmds.Argument{
@@ -202,6 +225,11 @@ Example:
 	Options: []cmds.Option{
 		cmds.BoolOption(allowCustomProtocolOptionName, "Don't require /x/ prefix"),
 		cmds.BoolOption(reportPeerIDOptionName, "r", "Send remote base58 peerid to target when a new connection is established"),
+		cmds.StringsOption(allowPeerOptionName, "Only accept streams from this peer ID. Can be passed multiple times."),
+		cmds.StringOption(p2pTokenOptionName, "Require this token as the first line of every stream."),
+		cmds.IntOption(maxStreamsOptionName, "Maximum number of concurrent streams."),
+		cmds.Int64Option(maxBandwidthOptionName, "Maximum throughput of each stream, in bytes per second."),
+		cmds.BoolOption(p2pPersistOptionName, "Save the listener to the config so it is started again when the daemon restarts."),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		n, err := p2pGetNode(env)
@@ -212,9 +240,26 @@ Example:
 		protoOpt := req.Arguments[0]
 		targetOpt := req.Arguments[1]
 
-		proto := protocol.ID(protoOpt)
+		allowCustom, _ := req.Options[allowCustomProtocolOptionName].(bool)
+		if !allowCustom && !strings.HasPrefix(protoOpt, P2PProtoPrefix) {
+			return errors.New("protocol name must be within '" + P2PProtoPrefix + "' namespace")
+		}
+
+		lcfg := config.P2PListener{
+			Protocol:      protoOpt,
+			TargetAddress: targetOpt,
+		}
+		lcfg.ReportPeerID, _ = req.Options[reportPeerIDOptionName].(bool)
+		lcfg.AllowedPeers, _ = req.Options[allowPeerOptionName].([]string)
+		lcfg.Token, _ = req.Options[p2pTokenOptionName].(string)
+		if maxStreams, ok := req.Options[maxStreamsOptionName].(int); ok {
+			lcfg.MaxStreams = config.NewOptionalInteger(int64(maxStreams))
+		}
+		if maxBandwidth, ok := req.Options[maxBandwidthOptionName].(int64); ok {
+			lcfg.MaxBandwidth = config.NewOptionalInteger(maxBandwidth)
+		}
 
-		target, err := ma.NewMultiaddr(targetOpt)
+		proto, target, opts, err := p2p.ParseListenerConfig(lcfg)
 		if err != nil {
 			return err
 		}
@@ -224,16 +269,34 @@ Example:
 			return err
 		}
 
-		allowCustom, _ := req.Options[allowCustomProtocolOptionName].(bool)
-		reportPeerID, _ := req.Options[reportPeerIDOptionName].(bool)
+		if _, err := n.P2P.ForwardRemoteWithOptions(n.Context(), proto, target, opts); err != nil {
+			return err
+		}
 
-		if !allowCustom && !strings.HasPrefix(string(proto), P2PProtoPrefix) {
-			return errors.New("protocol name must be within '" + P2PProtoPrefix + "' namespace")
+		if persist, _ := req.Options[p2pPersistOptionName].(bool); persist {
+			return persistListener(n, lcfg)
 		}
+		return nil
+	},
+}
 
-		_, err = n.P2P.ForwardRemote(n.Context(), proto, target, reportPeerID)
+// persistListener saves a listener to P2P.Listeners, replacing any previous
+// entry for the same protocol.
+func persistListener(n *core.IpfsNode, l config.P2PListener) error {
+	cfg, err := n.Repo.Config()
+	if err != nil {
 		return err
-	},
+	}
+
+	listeners := []config.P2PListener{}
+	for _, existing := range cfg.P2P.Listeners {
+		if existing.Protocol != l.Protocol {
+			listeners = append(listeners, existing)
+		}
+	}
+	cfg.P2P.Listeners = append(listeners, l)
+
+	return n.Repo.SetConfig(cfg)
 }
 
 // checkPort checks whether target multiaddr contains tcp or udp protocol
@@ -271,10 +334,10 @@ func checkPort(target ma.Multiaddr) error {
 }
 
 // forwardLocal forwards local connections to a libp2p service
-func forwardLocal(ctx context.Context, p *p2p.P2P, ps pstore.Peerstore, proto protocol.ID, bindAddr ma.Multiaddr, addr *peer.AddrInfo) error {
+func forwardLocal(ctx context.Context, p *p2p.P2P, ps pstore.Peerstore, proto protocol.ID, bindAddr ma.Multiaddr, addr *peer.AddrInfo, token string) error {
 	ps.AddAddrs(addr.ID, addr.Addrs, pstore.TempAddrTTL)
 	// TODO: return some info
-	_, err := p.ForwardLocal(ctx, addr.ID, proto, bindAddr)
+	_, err := p.ForwardLocalWithToken(ctx, addr.ID, proto, bindAddr, token)
 	return err
 }
 
@@ -356,6 +419,7 @@ var p2pCloseCmd = &cmds.Command{
 		cmds.StringOption(p2pProtocolOptionName, "p", "Match protocol name"),
 		cmds.StringOption(p2pListenAddressOptionName, "l", "Match listen address"),
 		cmds.StringOption(p2pTargetAddressOptionName, "t", "Match target address"),
+		cmds.BoolOption(p2pPersistOptionName, "Also remove the matching listeners and forwards from the config."),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		n, err := p2pGetNode(env)
@@ -394,25 +458,34 @@ var p2pCloseCmd = &cmds.Command{
 			return errors.New("can't combine --all with other matching options")
 		}
 
-		match := func(listener p2p.Listener) bool {
+		matchAddrs := func(listenerProto protocol.ID, listenerListen, listenerTarget ma.Multiaddr) bool {
 			if closeAll {
 				return true
 			}
-			if p && proto != listener.Protocol() {
+			if p && proto != listenerProto {
 				return false
 			}
-			if l && !listen.Equal(listener.ListenAddress()) {
+			if l && !listen.Equal(listenerListen) {
 				return false
 			}
-			if t && !target.Equal(listener.TargetAddress()) {
+			if t && !target.Equal(listenerTarget) {
 				return false
 			}
 			return true
 		}
+		match := func(listener p2p.Listener) bool {
+			return matchAddrs(listener.Protocol(), listener.ListenAddress(), listener.TargetAddress())
+		}
 
 		done := n.P2P.ListenersLocal.Close(match)
 		done += n.P2P.ListenersP2P.Close(match)
 
+		if persist, _ := req.Options[p2pPersistOptionName].(bool); persist {
+			if err := removePersisted(n, matchAddrs); err != nil {
+				return err
+			}
+		}
+
 		return cmds.EmitOnce(res, done)
 	},
 	Type: int(0),
@@ -544,6 +617,50 @@ var p2pStreamCloseCmd = &cmds.Command{
 	},
 }
 
+// removePersisted removes the listeners and forwards matching the same
+// criteria as running ones from the config.
+func removePersisted(n *core.IpfsNode, match func(protocol.ID, ma.Multiaddr, ma.Multiaddr) bool) error {
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		return err
+	}
+
+	self, err := ma.NewComponent("p2p", n.Identity.String())
+	if err != nil {
+		return err
+	}
+
+	listeners := []config.P2PListener{}
+	for _, pl := range cfg.P2P.Listeners {
+		target, err := ma.NewMultiaddr(pl.TargetAddress)
+		if err == nil && match(protocol.ID(pl.Protocol), self, target) {
+			continue
+		}
+		listeners = append(listeners, pl)
+	}
+
+	forwards := []config.P2PForward{}
+	for _, pf := range cfg.P2P.Forwards {
+		_, listen, target, err := p2p.ParseForwardConfig(pf)
+		if err == nil {
+			if match(protocol.ID(pf.Protocol), listen, target) {
+				continue
+			}
+			// running forwards report their target as /p2p/<peer id>
+			if _, id := peer.SplitAddr(target); id != "" {
+				if pt, err := ma.NewComponent("p2p", id.String()); err == nil && match(protocol.ID(pf.Protocol), listen, pt) {
+					continue
+				}
+			}
+		}
+		forwards = append(forwards, pf)
+	}
+
+	cfg.P2P.Listeners = listeners
+	cfg.P2P.Forwards = forwards
+	return n.Repo.SetConfig(cfg)
+}
+
 func p2pGetNode(env cmds.Environment) (*core.IpfsNode, error) {
 	nd, err := cmdenv.GetNode(env)
 	if err != nil {
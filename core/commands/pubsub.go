@@ -6,6 +6,8 @@ import (
 	"io"
 	"net/http"
 	"sort"
+	"strconv"
+	"time"
 
 	cmdenv "github.com/ipfs/kubo/core/commands/cmdenv"
 	mbase "github.com/multiformats/go-multibase"
@@ -31,20 +33,26 @@ DEPRECATED FEATURE (see https://github.com/ipfs/kubo/issues/9717)
 `,
 	},
 	Subcommands: map[string]*cmds.Command{
-		"pub":   PubsubPubCmd,
-		"sub":   PubsubSubCmd,
-		"ls":    PubsubLsCmd,
-		"peers": PubsubPeersCmd,
+		"pub":     PubsubPubCmd,
+		"sub":     PubsubSubCmd,
+		"ls":      PubsubLsCmd,
+		"peers":   PubsubPeersCmd,
+		"inspect": PubsubInspectCmd,
 	},
 }
 
 type pubsubMessage struct {
-	From     string   `json:"from,omitempty"`
-	Data     string   `json:"data,omitempty"`
-	Seqno    string   `json:"seqno,omitempty"`
-	TopicIDs []string `json:"topicIDs,omitempty"`
+	From      string   `json:"from,omitempty"`
+	Data      string   `json:"data,omitempty"`
+	Seqno     string   `json:"seqno,omitempty"`
+	TopicIDs  []string `json:"topicIDs,omitempty"`
+	BufferSeq uint64   `json:"bufferSeq,omitempty"`
 }
 
+const (
+	pubsubSinceOptionName = "since"
+)
+
 var PubsubSubCmd = &cmds.Command{
 	Status: cmds.Deprecated,
 	Helptext: cmds.HelpText{
@@ -71,11 +79,26 @@ TOPIC AND DATA ENCODING
 
   You can inspect the format by passing --enc=json. The ipfs multibase commands
   can be used for encoding/decoding multibase strings in the userland.
+
+DURABLE TOPICS
+
+  Messages on topics configured with Pubsub.Topics[topic].Durable are buffered
+  by the daemon. Passing --since replays the buffered messages before
+  streaming new ones, so no message is lost while a subscriber reconnects or
+  the daemon restarts. The value is either the bufferSeq of the last message
+  received, to replay every message after it, or an RFC 3339 time, to replay
+  every message received since then:
+
+    > ipfs pubsub sub --since=42 my-topic
+    > ipfs pubsub sub --since=2024-01-02T15:04:05Z my-topic
 `,
 	},
 	Arguments: []cmds.Argument{
 		cmds.StringArg("topic", true, false, "Name of topic to subscribe to (multibase encoded when sent over HTTP RPC)."),
 	},
+	Options: []cmds.Option{
+		cmds.StringOption(pubsubSinceOptionName, "Replay buffered messages of a durable topic after this bufferSeq or since this RFC 3339 time."),
+	},
 	PreRun: urlArgsEncoder,
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		api, err := cmdenv.GetApi(env, req)
@@ -88,6 +111,10 @@ TOPIC AND DATA ENCODING
 
 		topic := req.Arguments[0]
 
+		if since, ok := req.Options[pubsubSinceOptionName].(string); ok {
+			return pubsubSubDurable(req, res, env, topic, since)
+		}
+
 		sub, err := api.PubSub().Subscribe(req.Context, topic)
 		if err != nil {
 			return err
@@ -144,6 +171,59 @@ TOPIC AND DATA ENCODING
 	Type: pubsubMessage{},
 }
 
+// pubsubSubDurable streams the messages of a durable topic, starting with the
+// ones buffered since the given bufferSeq or time.
+func pubsubSubDurable(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment, topic, since string) error {
+	nd, err := cmdenv.GetNode(env)
+	if err != nil {
+		return err
+	}
+	if nd.PubSubBuffer == nil {
+		return errors.New("experimental pubsub feature not enabled, run daemon with --enable-pubsub-experiment to use")
+	}
+
+	var (
+		sinceSeq  uint64
+		sinceTime time.Time
+	)
+	if seq, err := strconv.ParseUint(since, 10, 64); err == nil {
+		sinceSeq = seq
+	} else if sinceTime, err = time.Parse(time.RFC3339, since); err != nil {
+		return fmt.Errorf("invalid --%s value %q: must be a bufferSeq or an RFC 3339 time", pubsubSinceOptionName, since)
+	}
+
+	sub, err := nd.PubSubBuffer.Subscribe(topic, sinceSeq, sinceTime)
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+
+	if f, ok := res.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	encoder, _ := mbase.EncoderByName("base64url")
+	for {
+		msg, err := sub.Next(req.Context)
+		if err == context.Canceled {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		psm := pubsubMessage{
+			Data:      encoder.Encode(msg.Data),
+			From:      msg.From.String(),
+			Seqno:     encoder.Encode(msg.Seqno),
+			TopicIDs:  []string{encoder.Encode([]byte(msg.Topic))},
+			BufferSeq: msg.Seq,
+		}
+		if err := res.Emit(&psm); err != nil {
+			return err
+		}
+	}
+}
+
 var PubsubPubCmd = &cmds.Command{
 	Status: cmds.Deprecated,
 	Helptext: cmds.HelpText{
@@ -334,6 +414,145 @@ TOPIC AND DATA ENCODING
 	},
 }
 
+type pubsubTopicInspection struct {
+	Topic         string
+	Mesh          []string
+	Fanout        []string
+	Delivered     uint64
+	Duplicate     uint64
+	Rejected      uint64
+	IHaveSent     uint64
+	IHaveReceived uint64
+}
+
+type pubsubInspection struct {
+	Topics        []pubsubTopicInspection
+	Scores        map[string]float64 `json:",omitempty"`
+	IWantSent     uint64
+	IWantReceived uint64
+}
+
+var PubsubInspectCmd = &cmds.Command{
+	Status: cmds.Deprecated,
+	Helptext: cmds.HelpText{
+		Tagline: "Show the gossipsub mesh, peer scores and message counters.",
+		ShortDescription: `
+ipfs pubsub inspect shows, for every known topic or only the given one:
+  - the peers in our gossipsub mesh, and the fanout peers we recently sent
+    messages to on topics we are not subscribed to,
+  - the number of messages delivered, dropped as duplicates and rejected,
+  - the number of message IDs advertised (IHAVE) to and by peers.
+
+It also shows the number of message IDs requested (IWANT) by and from peers
+and, when Pubsub.PeerScoring is enabled, the gossipsub score of each peer.
+
+DEPRECATED FEATURE (see https://github.com/ipfs/kubo/issues/9717)
+
+  It is not intended in its current state to be used in a production
+  environment.  To use, the daemon must be run with
+  '--enable-pubsub-experiment'.
+
+TOPIC ENCODING
+
+  Topic names are a binary data. To ensure all bytes are transferred
+  correctly RPC client and server will use multibase encoding behind
+  the scenes.
+
+  You can inspect the format by passing --enc=json. ipfs multibase commands
+  can be used for encoding/decoding multibase strings in the userland.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("topic", false, false, "Topic to inspect."),
+	},
+	PreRun: urlArgsEncoder,
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if err := urlArgsDecoder(req, env); err != nil {
+			return err
+		}
+		if !nd.IsOnline {
+			return ErrNotOnline
+		}
+		if nd.PubSubTracer == nil {
+			return errors.New("experimental pubsub feature not enabled, run daemon with --enable-pubsub-experiment to use")
+		}
+
+		var topic string
+		if len(req.Arguments) == 1 {
+			topic = req.Arguments[0]
+		}
+
+		snapshot := nd.PubSubTracer.Inspect(topic)
+
+		encoder, _ := mbase.EncoderByName("base64url")
+		out := &pubsubInspection{
+			Topics:        make([]pubsubTopicInspection, 0, len(snapshot.Topics)),
+			IWantSent:     snapshot.IWantSent,
+			IWantReceived: snapshot.IWantReceived,
+		}
+		for _, t := range snapshot.Topics {
+			ti := pubsubTopicInspection{
+				Topic:         encoder.Encode([]byte(t.Topic)),
+				Mesh:          make([]string, 0, len(t.Mesh)),
+				Fanout:        make([]string, 0, len(t.Fanout)),
+				Delivered:     t.Delivered,
+				Duplicate:     t.Duplicate,
+				Rejected:      t.Rejected,
+				IHaveSent:     t.IHaveSent,
+				IHaveReceived: t.IHaveReceived,
+			}
+			for _, p := range t.Mesh {
+				ti.Mesh = append(ti.Mesh, p.String())
+			}
+			for _, p := range t.Fanout {
+				ti.Fanout = append(ti.Fanout, p.String())
+			}
+			out.Topics = append(out.Topics, ti)
+		}
+		if snapshot.Scores != nil {
+			out.Scores = make(map[string]float64, len(snapshot.Scores))
+			for p, s := range snapshot.Scores {
+				out.Scores[p.String()] = s
+			}
+		}
+
+		return cmds.EmitOnce(res, out)
+	},
+	Type: pubsubInspection{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *pubsubInspection) error {
+			printPeers := func(kind string, peers []string) {
+				fmt.Fprintf(w, "  %s peers: %d\n", kind, len(peers))
+				for _, p := range peers {
+					if score, ok := out.Scores[p]; ok {
+						fmt.Fprintf(w, "    %s (score %.2f)\n", p, score)
+					} else {
+						fmt.Fprintf(w, "    %s\n", p)
+					}
+				}
+			}
+
+			for _, t := range out.Topics {
+				_, topic, err := mbase.Decode(t.Topic)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(w, "%s\n", cmdenv.EscNonPrint(string(topic)))
+				printPeers("mesh", t.Mesh)
+				printPeers("fanout", t.Fanout)
+				fmt.Fprintf(w, "  messages: %d delivered, %d duplicate, %d rejected\n", t.Delivered, t.Duplicate, t.Rejected)
+				fmt.Fprintf(w, "  ihave: %d sent, %d received\n", t.IHaveSent, t.IHaveReceived)
+			}
+			fmt.Fprintf(w, "iwant: %d sent, %d received\n", out.IWantSent, out.IWantReceived)
+			return nil
+		}),
+	},
+}
+
 // TODO: move to cmdenv?
 // Encode binary data to be passed as multibase string in URL arguments.
 // (avoiding issues described in https://github.com/ipfs/kubo/issues/7939)
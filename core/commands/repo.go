@@ -6,12 +6,15 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"sync"
 	"text/tabwriter"
 
 	oldcmds "github.com/ipfs/kubo/commands"
+	config "github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/core"
 	cmdenv "github.com/ipfs/kubo/core/commands/cmdenv"
 	corerepo "github.com/ipfs/kubo/core/corerepo"
 	fsrepo "github.com/ipfs/kubo/repo/fsrepo"
@@ -20,6 +23,8 @@ import (
 
 	humanize "github.com/dustin/go-humanize"
 	bstore "github.com/ipfs/boxo/blockstore"
+	dshelp "github.com/ipfs/boxo/datastore/dshelp"
+	files "github.com/ipfs/boxo/files"
 	cid "github.com/ipfs/go-cid"
 	cmds "github.com/ipfs/go-ipfs-cmds"
 )
@@ -42,6 +47,9 @@ var RepoCmd = &cmds.Command{
 		"version": repoVersionCmd,
 		"verify":  repoVerifyCmd,
 		"migrate": repoMigrateCmd,
+		"convert": repoConvertCmd,
+		"backup":  repoBackupCmd,
+		"restore": repoRestoreCmd,
 		"ls":      RefsLocalCmd,
 	},
 }
@@ -57,6 +65,12 @@ const (
 	repoQuietOptionName          = "quiet"
 	repoSilentOptionName         = "silent"
 	repoAllowDowngradeOptionName = "allow-downgrade"
+	repoDryRunOptionName         = "dry-run"
+	repoConvertToOptionName      = "to"
+	repoKeysOptionName           = "keys"
+	repoPassphraseOptionName     = "passphrase"
+	repoIdentityOptionName       = "replace-identity"
+	repoConfigOptionName         = "replace-config"
 )
 
 var repoGcCmd = &cmds.Command{
@@ -231,31 +245,26 @@ type VerifyProgress struct {
 	Progress int
 }
 
-func verifyWorkerRun(ctx context.Context, wg *sync.WaitGroup, keys <-chan cid.Cid, results chan<- string, bs bstore.Blockstore) {
+type verifyResult struct {
+	key cid.Cid
+	err error
+}
+
+func verifyWorkerRun(ctx context.Context, wg *sync.WaitGroup, keys <-chan cid.Cid, results chan<- verifyResult, bs bstore.Blockstore) {
 	defer wg.Done()
 
 	for k := range keys {
 		_, err := bs.Get(ctx, k)
-		if err != nil {
-			select {
-			case results <- fmt.Sprintf("block %s was corrupt (%s)", k, err):
-			case <-ctx.Done():
-				return
-			}
-
-			continue
-		}
-
 		select {
-		case results <- "":
+		case results <- verifyResult{key: k, err: err}:
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
-func verifyResultChan(ctx context.Context, keys <-chan cid.Cid, bs bstore.Blockstore) <-chan string {
-	results := make(chan string)
+func verifyResultChan(ctx context.Context, keys <-chan cid.Cid, bs bstore.Blockstore) <-chan verifyResult {
+	results := make(chan verifyResult)
 
 	go func() {
 		defer close(results)
@@ -273,9 +282,40 @@ func verifyResultChan(ctx context.Context, keys <-chan cid.Cid, bs bstore.Blocks
 	return results
 }
 
+const (
+	repoRepairOptionName     = "repair"
+	repoQuarantineOptionName = "quarantine"
+	repoPinsOnlyOptionName   = "pins-only"
+)
+
 var repoVerifyCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Verify all blocks in repo are not corrupted.",
+		ShortDescription: `
+'ipfs repo verify' checks that the hash of every block in the repo matches
+its contents, and reports the corrupt blocks.
+`,
+		LongDescription: `
+'ipfs repo verify' checks that the hash of every block in the repo matches
+its contents, and reports the corrupt blocks.
+
+With --repair, the corrupt blocks are removed, and the pins and MFS paths that
+include them are reported. The removed blocks of these pins and paths are then
+fetched again from the network, which requires a running daemon. With
+--quarantine, the corrupt blocks are moved to the 'quarantine' directory of
+the repo instead of being removed. Without a running daemon, --repair requires
+--quarantine, so that no block is lost. Blocks that can not be read, for
+another reason than a hash mismatch, are reported and left in place.
+
+With --pins-only, the blocks are not hashed: instead, the DAG of every
+recursive pin is walked to report the blocks missing from it, for instance
+after a crash. With --repair, the missing blocks are fetched from the network.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(repoRepairOptionName, "Remove corrupt blocks, and fetch the pinned ones again."),
+		cmds.BoolOption(repoQuarantineOptionName, "With --repair, move corrupt blocks to the quarantine directory of the repo instead of removing them."),
+		cmds.BoolOption(repoPinsOnlyOptionName, "Only check that every recursive pin is complete."),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		nd, err := cmdenv.GetNode(env)
@@ -283,6 +323,20 @@ var repoVerifyCmd = &cmds.Command{
 			return err
 		}
 
+		repair, _ := req.Options[repoRepairOptionName].(bool)
+		quarantine, _ := req.Options[repoQuarantineOptionName].(bool)
+		pinsOnly, _ := req.Options[repoPinsOnlyOptionName].(bool)
+		if quarantine && !repair {
+			return fmt.Errorf("--%s requires --%s", repoQuarantineOptionName, repoRepairOptionName)
+		}
+
+		if pinsOnly {
+			return verifyPins(req, res, nd, repair)
+		}
+		if repair && !quarantine && !nd.IsOnline {
+			return fmt.Errorf("--%s can not fetch the corrupt blocks again without a running daemon: start the daemon, or keep the corrupt blocks with --%s", repoRepairOptionName, repoQuarantineOptionName)
+		}
+
 		bs := bstore.NewBlockstore(nd.Repo.Datastore())
 		bs.HashOnRead(true)
 
@@ -294,14 +348,22 @@ var repoVerifyCmd = &cmds.Command{
 
 		results := verifyResultChan(req.Context, keys, bs)
 
-		var fails int
-		var i int
-		for msg := range results {
-			if msg != "" {
-				if err := res.Emit(&VerifyProgress{Msg: msg}); err != nil {
+		var corrupt []cid.Cid
+		var unreadable, i int
+		for r := range results {
+			switch {
+			case errors.Is(r.err, bstore.ErrHashMismatch):
+				if err := res.Emit(&VerifyProgress{Msg: fmt.Sprintf("block %s was corrupt (%s)", r.key, r.err)}); err != nil {
+					return err
+				}
+				corrupt = append(corrupt, r.key)
+			case r.err != nil:
+				// Only blocks whose hash does not match are repaired: other
+				// errors may be transient, or come from the datastore.
+				if err := res.Emit(&VerifyProgress{Msg: fmt.Sprintf("block %s could not be read (%s)", r.key, r.err)}); err != nil {
 					return err
 				}
-				fails++
+				unreadable++
 			}
 			i++
 			if err := res.Emit(&VerifyProgress{Progress: i}); err != nil {
@@ -313,8 +375,19 @@ var repoVerifyCmd = &cmds.Command{
 			return err
 		}
 
-		if fails != 0 {
-			return errors.New("verify complete, some blocks were corrupt")
+		if len(corrupt) != 0 {
+			if !repair {
+				return errors.New("verify complete, some blocks were corrupt")
+			}
+			if err := repairBlocks(req, res, nd, corrupt, quarantine); err != nil {
+				return err
+			}
+		}
+		if unreadable != 0 {
+			return errors.New("verify complete, some blocks could not be read")
+		}
+		if len(corrupt) != 0 {
+			return res.Emit(&VerifyProgress{Msg: "verify complete, corrupt blocks were repaired."})
 		}
 
 		return res.Emit(&VerifyProgress{Msg: "verify complete, all blocks validated."})
@@ -322,7 +395,7 @@ var repoVerifyCmd = &cmds.Command{
 	Type: &VerifyProgress{},
 	Encoders: cmds.EncoderMap{
 		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, obj *VerifyProgress) error {
-			if strings.Contains(obj.Msg, "was corrupt") {
+			if strings.Contains(obj.Msg, "was corrupt") || strings.Contains(obj.Msg, "could not be read") {
 				fmt.Fprintln(os.Stdout, obj.Msg)
 				return nil
 			}
@@ -341,6 +414,103 @@ var repoVerifyCmd = &cmds.Command{
 	},
 }
 
+// repairBlocks removes or quarantines the corrupt blocks, reports the pins and
+// MFS paths that include them, and fetches these blocks again.
+func repairBlocks(req *cmds.Request, res cmds.ResponseEmitter, nd *core.IpfsNode, corrupt []cid.Cid, quarantine bool) error {
+	ctx := req.Context
+	var quarantineDir string
+	if quarantine {
+		pr, ok := nd.Repo.(interface{ Path() string })
+		if !ok {
+			return errors.New("the quarantine directory is unknown for this repo")
+		}
+		quarantineDir = filepath.Join(pr.Path(), "quarantine")
+		if err := os.MkdirAll(quarantineDir, 0o700); err != nil {
+			return err
+		}
+	}
+
+	mhs := make(map[string]struct{}, len(corrupt))
+	for _, k := range corrupt {
+		mhs[string(k.Hash())] = struct{}{}
+
+		msg := fmt.Sprintf("removed corrupt block %s", k)
+		if quarantine {
+			dsKey := dshelp.MultihashToDsKey(k.Hash())
+			data, err := nd.Repo.Datastore().Get(ctx, bstore.BlockPrefix.Child(dsKey))
+			if err != nil {
+				return err
+			}
+			dst := filepath.Join(quarantineDir, dsKey.Name())
+			if err := os.WriteFile(dst, data, 0o600); err != nil {
+				return err
+			}
+			msg = fmt.Sprintf("moved corrupt block %s to %s", k, dst)
+		}
+		// Remove through the node's blockstore, so that its caches forget
+		// the block.
+		if err := nd.BaseBlocks.DeleteBlock(ctx, k); err != nil {
+			return err
+		}
+		if err := res.Emit(&VerifyProgress{Msg: msg}); err != nil {
+			return err
+		}
+	}
+
+	affected, err := corerepo.FindAffected(ctx, nd, mhs)
+	if err != nil {
+		return fmt.Errorf("finding the pins affected by corrupt blocks: %w", err)
+	}
+	for _, p := range affected.Pins {
+		if err := res.Emit(&VerifyProgress{Msg: fmt.Sprintf("pin %s was affected", p)}); err != nil {
+			return err
+		}
+	}
+	for _, p := range affected.MFS {
+		if err := res.Emit(&VerifyProgress{Msg: fmt.Sprintf("MFS path %s was affected", p)}); err != nil {
+			return err
+		}
+	}
+
+	var failed int
+	for _, c := range affected.Cids {
+		msg := fmt.Sprintf("fetched block %s again", c)
+		if err := corerepo.FetchBlock(ctx, nd, c); err != nil {
+			msg = fmt.Sprintf("could not fetch block %s again: %s", c, err)
+			failed++
+		}
+		if err := res.Emit(&VerifyProgress{Msg: msg}); err != nil {
+			return err
+		}
+	}
+	if failed != 0 {
+		return errors.New("verify complete, some pinned blocks could not be repaired")
+	}
+	return nil
+}
+
+// verifyPins reports the blocks missing from recursive pins, and fetches them
+// when repair is set.
+func verifyPins(req *cmds.Request, res cmds.ResponseEmitter, nd *core.IpfsNode, repair bool) error {
+	var incomplete int
+	err := corerepo.CheckPins(req.Context, nd, repair, func(pin, c cid.Cid, fetched bool) error {
+		msg := fmt.Sprintf("pin %s is missing block %s", pin, c)
+		if fetched {
+			msg = fmt.Sprintf("pin %s was missing block %s, fetched it", pin, c)
+		} else {
+			incomplete++
+		}
+		return res.Emit(&VerifyProgress{Msg: msg})
+	})
+	if err != nil {
+		return err
+	}
+	if incomplete != 0 {
+		return errors.New("verify complete, some pins are incomplete")
+	}
+	return res.Emit(&VerifyProgress{Msg: "verify complete, all pins are complete."})
+}
+
 var repoVersionCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Show the repo version.",
@@ -375,9 +545,19 @@ var repoVersionCmd = &cmds.Command{
 var repoMigrateCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Apply any outstanding migrations to the repo.",
+		ShortDescription: `
+'ipfs repo migrate' migrates the repo to the version used by this version of
+Kubo. Recent migrations are built into Kubo and run in-process. Migrations for
+older repo versions are looked up in PATH or downloaded from the sources set in
+Migration.DownloadSources.
+
+With --dry-run, the changes the migrations would make are printed and the repo
+is left untouched. Only built-in migrations support dry runs.
+`,
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption(repoAllowDowngradeOptionName, "Allow downgrading to a lower repo version"),
+		cmds.BoolOption(repoDryRunOptionName, "Print the changes the migrations would make without applying them"),
 	},
 	NoRemote: true,
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
@@ -395,6 +575,10 @@ var repoMigrateCmd = &cmds.Command{
 
 		fmt.Println("Found outdated fs-repo, starting migration.")
 
+		if dryRun, _ := req.Options[repoDryRunOptionName].(bool); dryRun {
+			return migrations.DryRunMigration(cctx.Context(), fsrepo.RepoVersion, "", allowDowngrade)
+		}
+
 		// Read Migration section of IPFS config
 		configFileOpt, _ := req.Options[ConfigFileOption].(string)
 		migrationCfg, err := migrations.ReadMigrationConfig(cctx.ConfigRoot, configFileOpt)
@@ -434,3 +618,276 @@ var repoMigrateCmd = &cmds.Command{
 		return nil
 	},
 }
+
+var repoConvertCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Convert the repo to another datastore.",
+		ShortDescription: `
+'ipfs repo convert' copies every entry of the datastore of the repo to a new
+datastore configured by a datastore profile (flatfs, levelds, pebbleds or badgerds), then
+replaces the old datastore with the new one and updates Datastore.Spec.
+`,
+		LongDescription: `
+'ipfs repo convert' copies every entry of the datastore of the repo to a new
+datastore configured by a datastore profile (flatfs, levelds, pebbleds or badgerds), then
+replaces the old datastore with the new one and updates Datastore.Spec.
+
+The new datastore is built in the 'datastore-convert' directory of the repo.
+Once every entry is copied, the entry counts and checksums of both datastores
+are compared before they are swapped, and the old datastore is removed. The
+repo needs enough free space to hold both datastores.
+
+When the daemon is running, the datastore is copied while the daemon keeps
+using the old one, and the datastores are swapped the next time the daemon
+starts. The entries written in the meantime are copied then, before the swap.
+When the daemon is not running, the datastores are swapped right away.
+
+If the conversion is interrupted, run 'ipfs repo convert' again, with or
+without --to, to resume it: the entries that were already copied are skipped.
+
+Example:
+
+  $ ipfs repo convert --to=badgerds
+`,
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(repoConvertToOptionName, "Datastore profile to convert to, e.g. flatfs, levelds, pebbleds or badgerds."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		cctx := env.(*oldcmds.Context)
+
+		var spec map[string]interface{}
+		if to, ok := req.Options[repoConvertToOptionName].(string); ok {
+			var err error
+			spec, err = datastoreProfileSpec(to)
+			if err != nil {
+				return err
+			}
+		}
+
+		var emitErr error
+		progress := func(p fsrepo.ConvertProgress) {
+			if emitErr == nil {
+				emitErr = res.Emit(&p)
+			}
+		}
+
+		// the repo is locked when this runs in the daemon
+		locked, err := fsrepo.LockedByOtherProcess(cctx.ConfigRoot)
+		if err != nil {
+			return err
+		}
+		if locked {
+			n, err := cmdenv.GetNode(env)
+			if err != nil {
+				return err
+			}
+			err = fsrepo.PrepareDatastoreConversion(req.Context, cctx.ConfigRoot, n.Repo.Datastore(), spec, progress)
+			if err != nil {
+				return err
+			}
+		} else {
+			err = fsrepo.ConvertDatastore(req.Context, cctx.ConfigRoot, spec, progress)
+			if err != nil {
+				return err
+			}
+		}
+		return emitErr
+	},
+	Type: fsrepo.ConvertProgress{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, p *fsrepo.ConvertProgress) error {
+			var err error
+			switch p.Phase {
+			case fsrepo.ConvertPhaseCopy:
+				_, err = fmt.Fprintf(w, "Copied %d entries (%d already copied)\n", p.Copied, p.Skipped)
+			case fsrepo.ConvertPhaseVerify:
+				_, err = fmt.Fprintln(w, "Verifying the new datastore...")
+			case fsrepo.ConvertPhasePending:
+				_, err = fmt.Fprintln(w, "Success: the datastore has been copied, it will be swapped the next time the daemon starts.")
+			case fsrepo.ConvertPhaseSwapOld:
+				_, err = fmt.Fprintln(w, "Swapping the datastores...")
+			case fsrepo.ConvertPhaseDone:
+				_, err = fmt.Fprintln(w, "Success: the datastore has been converted.")
+			}
+			return err
+		}),
+	},
+}
+
+// datastoreProfileSpec returns the Datastore.Spec set by a profile.
+func datastoreProfileSpec(name string) (map[string]interface{}, error) {
+	profile, ok := config.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("%s is not a profile", name)
+	}
+	var cfg config.Config
+	if err := profile.Transform(&cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Datastore.Spec == nil {
+		return nil, fmt.Errorf("profile %s does not configure the datastore", name)
+	}
+	return cfg.Datastore.Spec, nil
+}
+
+var repoBackupCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Write a backup of the repo to stdout.",
+		ShortDescription: `
+'ipfs repo backup' writes a portable backup of the repo as a CAR stream: the
+pinned and MFS content, the pins with their names, the MFS root, the config
+and, with --keys, the keys. Restore it with 'ipfs repo restore'.
+`,
+		LongDescription: `
+'ipfs repo backup' writes a portable backup of the repo as a CAR stream: the
+pinned and MFS content, the pins with their names, the MFS root, the config
+and, with --keys, the keys. Restore it with 'ipfs repo restore'.
+
+The backup is a CARv1 whose root is a JSON manifest listing the pins, the MFS
+root, the config and the keys. It doesn't depend on the datastore of the repo.
+Every pinned block must be present locally: run 'ipfs repo verify' first if in
+doubt. The private key of the identity is not stored in the config of the
+backup, but with the other keys. The other secrets of the config are left out:
+the RPC API authorizations, the API keys of the remote pinning services and
+the tokens of the p2p services.
+
+The keys are left out unless --keys is given, in which case they are
+encrypted with the passphrase given with --passphrase.
+
+Example:
+
+  $ ipfs repo backup --keys --passphrase="my secret" > backup.car
+`,
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(repoKeysOptionName, "Include the identity and keystore keys, requires --passphrase."),
+		cmds.StringOption(repoPassphraseOptionName, "Encrypt the keys with this passphrase."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		keys, _ := req.Options[repoKeysOptionName].(bool)
+		passphrase, _ := req.Options[repoPassphraseOptionName].(string)
+		if passphrase != "" && !keys {
+			return fmt.Errorf("--%s requires --%s", repoPassphraseOptionName, repoKeysOptionName)
+		}
+		// Private keys are never written in plain text.
+		if keys && passphrase == "" {
+			return fmt.Errorf("--%s requires --%s", repoKeysOptionName, repoPassphraseOptionName)
+		}
+
+		pipeR, pipeW := io.Pipe()
+		errCh := make(chan error, 1)
+		go func() {
+			err := corerepo.Backup(req.Context, n, pipeW, corerepo.BackupOptions{
+				Keys:       keys,
+				Passphrase: passphrase,
+			})
+			pipeW.CloseWithError(err)
+			errCh <- err
+		}()
+
+		if err := res.Emit(pipeR); err != nil {
+			pipeR.Close() // ignore the error if any
+			return err
+		}
+		return <-errCh
+	},
+}
+
+var repoRestoreCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Restore a backup written by 'ipfs repo backup'.",
+		ShortDescription: `
+'ipfs repo restore' imports the content of a backup written by
+'ipfs repo backup' into the repo, pins it again with the same names, and adds
+the MFS entries and keys of the backup.
+`,
+		LongDescription: `
+'ipfs repo restore' imports the content of a backup written by
+'ipfs repo backup' into the repo, pins it again with the same names, and adds
+the MFS entries and keys of the backup.
+
+The blocks are written through the blockstore, so a backup can be restored to
+a repo with any datastore, and while the daemon is running. Existing content is
+kept: the top-level MFS entries and the keys of the backup are only added when
+their name is not used yet. The keys are not restored with --keys=false, and
+there are none to restore from a backup written without --keys: restoring
+such a backup fails only if --keys or --replace-identity is given.
+
+The identity and the config of the repo are kept, unless --replace-identity
+or --replace-config are given. --replace-identity replaces the peer ID and
+private key with the ones of the backup. --replace-config replaces the config
+with the one of the backup, except for the Identity and Datastore sections.
+The secrets left out of the backup are kept from the config of the repo: the
+RPC API authorizations, the API keys of the remote pinning services with the
+same name and endpoint, and the tokens of the p2p services with the same
+protocol. Both take effect once the daemon is restarted.
+
+Example:
+
+  $ ipfs init --profile=badgerds
+  $ ipfs repo restore --replace-identity --replace-config --passphrase="my secret" backup.car
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.FileArg("file", true, false, "Backup file to restore.").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(repoKeysOptionName, "Import the keystore keys of the backup. Default: true if the backup has keys."),
+		cmds.BoolOption(repoIdentityOptionName, "Replace the identity of the repo with the one of the backup."),
+		cmds.BoolOption(repoConfigOptionName, "Replace the config of the repo with the one of the backup."),
+		cmds.StringOption(repoPassphraseOptionName, "Passphrase the keys were encrypted with."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		it := req.Files.Entries()
+		if !it.Next() {
+			if it.Err() != nil {
+				return it.Err()
+			}
+			return errors.New("expected a backup file")
+		}
+		file := files.FileFromEntry(it)
+		if file == nil {
+			return errors.New("expected a file handle")
+		}
+		defer file.Close()
+
+		keys, keysSet := req.Options[repoKeysOptionName].(bool)
+		if !keysSet {
+			keys = true
+		}
+		identity, _ := req.Options[repoIdentityOptionName].(bool)
+		cfg, _ := req.Options[repoConfigOptionName].(bool)
+		passphrase, _ := req.Options[repoPassphraseOptionName].(string)
+
+		return corerepo.Restore(req.Context, n, file, corerepo.RestoreOptions{
+			Keys:            keys,
+			SkipMissingKeys: !keysSet,
+			Identity:        identity,
+			Config:          cfg,
+			Passphrase:      passphrase,
+		}, func(msg string) error {
+			return res.Emit(&MessageOutput{msg})
+		})
+	},
+	Type: MessageOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *MessageOutput) error {
+			_, err := fmt.Fprintln(w, out.Message)
+			return err
+		}),
+	},
+}
@@ -64,6 +64,7 @@ ADVANCED COMMANDS
   stats         Various operational stats
   p2p           Libp2p stream mounting (experimental)
   filestore     Manage the filestore (experimental)
+  urlstore      Add URLs to the filestore (experimental)
   mount         Mount an IPFS read-only mount point (experimental)
 
 NETWORK COMMANDS
@@ -72,6 +73,7 @@ NETWORK COMMANDS
   swarm         Manage connections to the p2p network
   dht           Query the DHT for values or peers
   routing       Issue routing commands
+  dns           Resolve DNSLink records and inspect the DNS cache
   ping          Measure the latency of a connection
   bitswap       Inspect bitswap state
   pubsub        Send and receive messages via pubsub
@@ -132,6 +134,7 @@ var rootSubcommands = map[string]*cmds.Command{
 	"commands":  CommandsDaemonCmd,
 	"files":     FilesCmd,
 	"filestore": FileStoreCmd,
+	"urlstore":  urlStoreCmd,
 	"get":       GetCmd,
 	"pubsub":    PubsubCmd,
 	"repo":      RepoCmd,
@@ -142,6 +145,7 @@ var rootSubcommands = map[string]*cmds.Command{
 	"dht":       DhtCmd,
 	"routing":   RoutingCmd,
 	"diag":      DiagCmd,
+	"dns":       DNSCmd,
 	"id":        IDCmd,
 	"key":       KeyCmd,
 	"log":       LogCmd,
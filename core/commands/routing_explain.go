@@ -0,0 +1,212 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	cmdenv "github.com/ipfs/kubo/core/commands/cmdenv"
+	irouting "github.com/ipfs/kubo/routing"
+	peer "github.com/libp2p/go-libp2p/core/peer"
+)
+
+var explainRoutingCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Show how routing queries go through the configured routers.",
+		ShortDescription: `
+Runs a routing query and streams what each router of Routing.Routers does with
+it: when it is queried, its results, its errors, and whether it timed out or
+was canceled, with the time elapsed since it was queried.
+`,
+		LongDescription: `
+Runs a routing query and streams what each router of Routing.Routers does with
+it: when it is queried, its results, its errors, and whether it timed out or
+was canceled, with the time elapsed since it was queried.
+
+Routers are shown with the parallel or sequential router that queried them,
+e.g. 'ParallelHelper > HTTP'. Errors of routers set with IgnoreErrors are
+marked as ignored. The events of the whole routing system, including the
+routers not configured in Routing.Routers, are shown as 'routing'.
+
+The routers of Routing.Routers are only used when Routing.Type is "custom".
+With other routing types, only the 'routing' events are shown.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"findprovs": {
+			Helptext: cmds.HelpText{
+				Tagline: "Explain a provider lookup.",
+			},
+			Arguments: []cmds.Argument{
+				cmds.StringArg("key", true, false, "The CID to find providers for."),
+			},
+			Options: []cmds.Option{
+				cmds.IntOption(numProvidersOptionName, "n", "The number of providers to find.").WithDefault(20),
+			},
+			Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+				c, err := cid.Parse(req.Arguments[0])
+				if err != nil {
+					return err
+				}
+				numProviders, _ := req.Options[numProvidersOptionName].(int)
+				if numProviders < 1 {
+					return fmt.Errorf("number of providers must be greater than 0")
+				}
+				return explainRouting(req, res, env, func(ctx context.Context, result func(string)) error {
+					n, err := cmdenv.GetNode(env)
+					if err != nil {
+						return err
+					}
+					for p := range n.Routing.FindProvidersAsync(ctx, c, numProviders) {
+						result(p.String())
+					}
+					return nil
+				})
+			},
+			Type:     irouting.ExplainEvent{},
+			Encoders: explainEncoders,
+		},
+		"findpeer": {
+			Helptext: cmds.HelpText{
+				Tagline: "Explain a peer lookup.",
+			},
+			Arguments: []cmds.Argument{
+				cmds.StringArg("peerID", true, false, "The ID of the peer to search for."),
+			},
+			Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+				pid, err := peer.Decode(req.Arguments[0])
+				if err != nil {
+					return err
+				}
+				return explainRouting(req, res, env, func(ctx context.Context, result func(string)) error {
+					n, err := cmdenv.GetNode(env)
+					if err != nil {
+						return err
+					}
+					ai, err := n.Routing.FindPeer(ctx, pid)
+					if err != nil {
+						return err
+					}
+					result(ai.String())
+					return nil
+				})
+			},
+			Type:     irouting.ExplainEvent{},
+			Encoders: explainEncoders,
+		},
+		"get": {
+			Helptext: cmds.HelpText{
+				Tagline: "Explain a value lookup, such as an IPNS record.",
+			},
+			Arguments: []cmds.Argument{
+				cmds.StringArg("key", true, false, "The key to find a value for, e.g. /ipns/<name>."),
+			},
+			Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+				return explainRouting(req, res, env, func(ctx context.Context, result func(string)) error {
+					api, err := cmdenv.GetApi(env, req)
+					if err != nil {
+						return err
+					}
+					val, err := api.Routing().Get(ctx, req.Arguments[0])
+					if err != nil {
+						return err
+					}
+					result(fmt.Sprintf("value of %d bytes", len(val)))
+					return nil
+				})
+			},
+			Type:     irouting.ExplainEvent{},
+			Encoders: explainEncoders,
+		},
+	},
+}
+
+// explainRouting runs query and emits the explain events of the routers it
+// goes through, followed by its own results and outcome.
+func explainRouting(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment, query func(ctx context.Context, result func(string)) error) error {
+	n, err := cmdenv.GetNode(env)
+	if err != nil {
+		return err
+	}
+	if !n.IsOnline {
+		return ErrNotOnline
+	}
+
+	ctx, cancel := context.WithCancel(req.Context)
+	defer cancel()
+
+	events := make(chan irouting.ExplainEvent)
+	stop := make(chan struct{})
+	send := func(ev irouting.ExplainEvent) {
+		select {
+		case events <- ev:
+		case <-stop:
+			// Routers still running once the query is over are not reported.
+		}
+	}
+	ctx = irouting.ContextWithExplainer(ctx, send)
+
+	begin := time.Now()
+	report := func(t irouting.ExplainEventType, result string, err error) {
+		ev := irouting.ExplainEvent{Event: t, Elapsed: time.Since(begin), Result: result}
+		if err != nil {
+			ev.Error = err.Error()
+		}
+		send(ev)
+	}
+
+	queryErr := make(chan error, 1)
+	go func() {
+		report(irouting.ExplainStart, "", nil)
+		err := query(ctx, func(result string) {
+			report(irouting.ExplainResult, result, nil)
+		})
+		if err != nil {
+			report(irouting.ExplainError, "", err)
+		} else {
+			report(irouting.ExplainDone, "", nil)
+		}
+		queryErr <- err
+	}()
+
+	for {
+		select {
+		case ev := <-events:
+			if err := res.Emit(&ev); err != nil {
+				close(stop)
+				return err
+			}
+		case err := <-queryErr:
+			close(stop)
+			return err
+		}
+	}
+}
+
+var explainEncoders = cmds.EncoderMap{
+	cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, ev *irouting.ExplainEvent) error {
+		router := ev.Router
+		switch {
+		case router == "":
+			router = "routing"
+		case ev.Parent != "":
+			router = ev.Parent + " > " + router
+		}
+		line := fmt.Sprintf("%8s  %s: %s", ev.Elapsed.Round(time.Millisecond), router, ev.Event)
+		if ev.Result != "" {
+			line += " " + ev.Result
+		}
+		if ev.Error != "" {
+			line += ": " + ev.Error
+			if ev.IgnoreErrors {
+				line += " (ignored)"
+			}
+		}
+		_, err := fmt.Fprintln(w, line)
+		return err
+	}),
+}
@@ -0,0 +1,346 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/ipfs/boxo/files"
+	"github.com/ipfs/boxo/ipns"
+	cid "github.com/ipfs/go-cid"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/kubo/config"
+	cmdenv "github.com/ipfs/kubo/core/commands/cmdenv"
+	irouting "github.com/ipfs/kubo/routing"
+	peer "github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+const staticRouterOptionName = "router"
+
+var errNoStaticRecord = errors.New("no matching static record")
+
+var staticRoutingCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Edit the records of static routers.",
+		ShortDescription: `
+Static routers, configured in Routing.Routers with the "static" type, serve
+provider records, peer addresses and IPNS records from a JSON file or from the
+datastore instead of querying the network. These commands edit their records.
+`,
+		LongDescription: `
+Static routers, configured in Routing.Routers with the "static" type, serve
+provider records, peer addresses and IPNS records from a JSON file or from the
+datastore instead of querying the network. These commands edit their records.
+
+A running daemon picks up the changes within a second, whether they are made
+with these commands or by editing the file directly. When several static
+routers are configured, pick one with --router.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(staticRouterOptionName, "Name of the static router in Routing.Routers. Required if there are several."),
+	},
+	Subcommands: map[string]*cmds.Command{
+		"ls":  lsStaticRoutingCmd,
+		"add": addStaticRoutingCmd,
+		"rm":  rmStaticRoutingCmd,
+	},
+}
+
+var lsStaticRoutingCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "List the records of a static router.",
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		store, err := staticRouterStore(req, env)
+		if err != nil {
+			return err
+		}
+		recs, err := store.Load(req.Context)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, recs)
+	},
+	Type: irouting.StaticRecords{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *irouting.StaticRecords) error {
+			for _, k := range sortedKeys(out.Providers) {
+				for _, p := range out.Providers[k] {
+					fmt.Fprintf(w, "provider %s %s\n", k, p)
+				}
+			}
+			for _, k := range sortedKeys(out.Peers) {
+				for _, a := range out.Peers[k] {
+					fmt.Fprintf(w, "peer %s %s\n", k, a)
+				}
+			}
+			for _, k := range sortedKeys(out.IPNS) {
+				fmt.Fprintf(w, "ipns %s\n", k)
+			}
+			return nil
+		}),
+	},
+}
+
+var addStaticRoutingCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Add records to a static router.",
+	},
+	Subcommands: map[string]*cmds.Command{
+		"provider": {
+			Helptext: cmds.HelpText{
+				Tagline: "Add providers of a CID.",
+			},
+			Arguments: []cmds.Argument{
+				cmds.StringArg("cid", true, false, "CID the peers provide."),
+				cmds.StringArg("peer", true, true, "Peer IDs of the providers."),
+			},
+			Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+				c, err := cid.Decode(req.Arguments[0])
+				if err != nil {
+					return err
+				}
+				providers, err := decodePeers(req.Arguments[1:])
+				if err != nil {
+					return err
+				}
+				return editStaticRecords(req, env, func(r *irouting.StaticRecords) error {
+					r.AddProviders(c, providers)
+					return nil
+				})
+			},
+		},
+		"peer": {
+			Helptext: cmds.HelpText{
+				Tagline: "Add addresses of a peer.",
+			},
+			Arguments: []cmds.Argument{
+				cmds.StringArg("peer", true, false, "Peer ID."),
+				cmds.StringArg("address", true, true, "Multiaddrs of the peer, without /p2p."),
+			},
+			Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+				p, addrs, err := decodePeerAddrs(req.Arguments)
+				if err != nil {
+					return err
+				}
+				return editStaticRecords(req, env, func(r *irouting.StaticRecords) error {
+					r.AddPeer(p, addrs)
+					return nil
+				})
+			},
+		},
+		"ipns": {
+			Helptext: cmds.HelpText{
+				Tagline: "Set the IPNS record of a name.",
+				ShortDescription: `
+Sets the IPNS record of <name> to the record read from <record>, replacing the
+previous one. The record must be valid and signed by the key of <name>, for
+instance one written by 'ipfs routing get /ipns/<name>'.
+`,
+			},
+			Arguments: []cmds.Argument{
+				cmds.StringArg("name", true, false, "IPNS name."),
+				cmds.FileArg("record", true, false, "File holding the IPNS record.").EnableStdin(),
+			},
+			Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+				name, err := ipns.NameFromString(req.Arguments[0])
+				if err != nil {
+					return err
+				}
+				record, err := readFileArg(req)
+				if err != nil {
+					return err
+				}
+				return editStaticRecords(req, env, func(r *irouting.StaticRecords) error {
+					return r.PutIPNS(name, record)
+				})
+			},
+		},
+	},
+}
+
+var rmStaticRoutingCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Remove records from a static router.",
+	},
+	Subcommands: map[string]*cmds.Command{
+		"provider": {
+			Helptext: cmds.HelpText{
+				Tagline: "Remove providers of a CID, or all of them.",
+			},
+			Arguments: []cmds.Argument{
+				cmds.StringArg("cid", true, false, "CID the peers provide."),
+				cmds.StringArg("peer", false, true, "Peer IDs of the providers. All of them if unset."),
+			},
+			Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+				c, err := cid.Decode(req.Arguments[0])
+				if err != nil {
+					return err
+				}
+				providers, err := decodePeers(req.Arguments[1:])
+				if err != nil {
+					return err
+				}
+				return editStaticRecords(req, env, func(r *irouting.StaticRecords) error {
+					if !r.RemoveProviders(c, providers) {
+						return errNoStaticRecord
+					}
+					return nil
+				})
+			},
+		},
+		"peer": {
+			Helptext: cmds.HelpText{
+				Tagline: "Remove addresses of a peer, or all of them.",
+			},
+			Arguments: []cmds.Argument{
+				cmds.StringArg("peer", true, false, "Peer ID."),
+				cmds.StringArg("address", false, true, "Multiaddrs of the peer. All of them if unset."),
+			},
+			Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+				p, addrs, err := decodePeerAddrs(req.Arguments)
+				if err != nil {
+					return err
+				}
+				return editStaticRecords(req, env, func(r *irouting.StaticRecords) error {
+					if !r.RemovePeer(p, addrs) {
+						return errNoStaticRecord
+					}
+					return nil
+				})
+			},
+		},
+		"ipns": {
+			Helptext: cmds.HelpText{
+				Tagline: "Remove the IPNS record of a name.",
+			},
+			Arguments: []cmds.Argument{
+				cmds.StringArg("name", true, false, "IPNS name."),
+			},
+			Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+				name, err := ipns.NameFromString(req.Arguments[0])
+				if err != nil {
+					return err
+				}
+				return editStaticRecords(req, env, func(r *irouting.StaticRecords) error {
+					if !r.RemoveIPNS(name) {
+						return errNoStaticRecord
+					}
+					return nil
+				})
+			},
+		},
+	},
+}
+
+// staticRouterStore returns the store of the static router picked with
+// --router, or of the only one configured.
+func staticRouterStore(req *cmds.Request, env cmds.Environment) (irouting.StaticStore, error) {
+	n, err := cmdenv.GetNode(env)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	name, _ := req.Options[staticRouterOptionName].(string)
+	if name == "" {
+		for rn, r := range cfg.Routing.Routers {
+			if r.Type != config.RouterTypeStatic {
+				continue
+			}
+			if name != "" {
+				return nil, fmt.Errorf("several static routers are configured, pick one with --%s", staticRouterOptionName)
+			}
+			name = rn
+		}
+		if name == "" {
+			return nil, errors.New("no static router is configured in Routing.Routers")
+		}
+	}
+	r, ok := cfg.Routing.Routers[name]
+	if !ok || r.Type != config.RouterTypeStatic {
+		return nil, fmt.Errorf("%q is not a static router in Routing.Routers", name)
+	}
+
+	params, _ := r.Parameters.(*config.StaticRouterParams)
+	if params == nil {
+		params = &config.StaticRouterParams{}
+	}
+	var repoPath string
+	if pr, ok := n.Repo.(interface{ Path() string }); ok {
+		repoPath = pr.Path()
+	}
+	return irouting.NewStaticStore(name, params, &irouting.ExtraStaticParams{
+		RepoPath:  repoPath,
+		Datastore: n.Repo.Datastore(),
+	})
+}
+
+func editStaticRecords(req *cmds.Request, env cmds.Environment, edit func(*irouting.StaticRecords) error) error {
+	store, err := staticRouterStore(req, env)
+	if err != nil {
+		return err
+	}
+	return irouting.EditStaticRecords(req.Context, store, edit)
+}
+
+func decodePeers(args []string) ([]peer.ID, error) {
+	peers := make([]peer.ID, len(args))
+	for i, a := range args {
+		p, err := peer.Decode(a)
+		if err != nil {
+			return nil, err
+		}
+		peers[i] = p
+	}
+	return peers, nil
+}
+
+func decodePeerAddrs(args []string) (peer.ID, []ma.Multiaddr, error) {
+	p, err := peer.Decode(args[0])
+	if err != nil {
+		return "", nil, err
+	}
+	addrs := make([]ma.Multiaddr, len(args)-1)
+	for i, a := range args[1:] {
+		if addrs[i], err = ma.NewMultiaddr(a); err != nil {
+			return "", nil, err
+		}
+	}
+	return p, addrs, nil
+}
+
+func readFileArg(req *cmds.Request) ([]byte, error) {
+	it := req.Files.Entries()
+	if !it.Next() {
+		if it.Err() != nil {
+			return nil, it.Err()
+		}
+		return nil, errors.New("expected a file argument")
+	}
+	file := files.FileFromEntry(it)
+	if file == nil {
+		return nil, errors.New("expected a file argument")
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
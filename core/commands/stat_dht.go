@@ -40,6 +40,9 @@ var statDhtCmd = &cmds.Command{
 		ShortDescription: `
 Returns statistics about the DHT(s) the node is participating in.
 
+In LAN mode (Routing.Type = "lan"), the node only participates in the LAN
+DHT, and only its table is listed.
+
 This interface is not stable and may change from release to release.
 `,
 	},
@@ -67,6 +70,9 @@ This interface is not stable and may change from release to release.
 		dhts := req.Arguments
 		if len(dhts) == 0 {
 			dhts = []string{"wan", "lan"}
+			if nd.LAN != nil {
+				dhts = []string{"lan"}
+			}
 		}
 
 	dhttypeloop:
@@ -118,6 +124,9 @@ This interface is not stable and may change from release to release.
 				}
 				fallthrough
 			case "wanserver":
+				if nd.LAN != nil {
+					return cmds.Errorf(cmds.ErrClient, "the WAN DHT is disabled in LAN mode")
+				}
 				dht = nd.DHT.WAN
 			case "lan":
 				if separateClient {
@@ -18,10 +18,12 @@ import (
 	"github.com/ipfs/kubo/config"
 	"github.com/ipfs/kubo/core/commands/cmdenv"
 	"github.com/ipfs/kubo/core/node/libp2p"
+	"github.com/ipfs/kubo/peering"
 	"github.com/ipfs/kubo/repo"
 	"github.com/ipfs/kubo/repo/fsrepo"
 
 	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/libp2p/go-libp2p/core/connmgr"
 	ic "github.com/libp2p/go-libp2p/core/crypto"
 	inet "github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
@@ -55,8 +57,10 @@ ipfs peers in the internet.
 	},
 	Subcommands: map[string]*cmds.Command{
 		"addrs":      swarmAddrsCmd,
+		"bans":       swarmBansCmd,
 		"connect":    swarmConnectCmd,
 		"disconnect": swarmDisconnectCmd,
+		"discover":   swarmDiscoverCmd,
 		"filters":    swarmFiltersCmd,
 		"peers":      swarmPeersCmd,
 		"peering":    swarmPeeringCmd,
@@ -73,6 +77,8 @@ const (
 	swarmResetLimitsOptionName       = "reset"
 	swarmUsedResourcesPercentageName = "min-used-limit-perc"
 	swarmIdentifyOptionName          = "identify"
+	swarmPeeringGroupOptionName      = "group"
+	swarmTagsOptionName              = "tags"
 )
 
 type peeringResult struct {
@@ -91,9 +97,10 @@ The changes are not saved to the config.
 `,
 	},
 	Subcommands: map[string]*cmds.Command{
-		"add": swarmPeeringAddCmd,
-		"ls":  swarmPeeringLsCmd,
-		"rm":  swarmPeeringRmCmd,
+		"add":    swarmPeeringAddCmd,
+		"ls":     swarmPeeringLsCmd,
+		"rm":     swarmPeeringRmCmd,
+		"status": swarmPeeringStatusCmd,
 	},
 }
 
@@ -107,7 +114,12 @@ var swarmPeeringAddCmd = &cmds.Command{
 	Arguments: []cmds.Argument{
 		cmds.StringArg("address", true, true, "address of peer to add into the peering subsystem"),
 	},
+	Options: []cmds.Option{
+		cmds.StringOption(swarmPeeringGroupOptionName, "Peering group to add the peers to.").WithDefault(peering.DefaultGroup),
+	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		group, _ := req.Options[swarmPeeringGroupOptionName].(string)
+
 		addrs := make([]ma.Multiaddr, len(req.Arguments))
 
 		for i, arg := range req.Arguments {
@@ -133,7 +145,7 @@ var swarmPeeringAddCmd = &cmds.Command{
 		}
 
 		for _, addrinfo := range addInfos {
-			node.Peering.AddPeer(addrinfo)
+			node.PeeringGroups.AddPeer(group, addrinfo)
 			err = res.Emit(peeringResult{addrinfo.ID, "success"})
 			if err != nil {
 				return err
@@ -187,6 +199,90 @@ type addrInfos struct {
 	Peers []peer.AddrInfo
 }
 
+type peeringPeerStatus struct {
+	ID            peer.ID
+	Group         string
+	Addrs         []string
+	Connected     bool
+	LastConnected time.Time
+	Failures      int
+	LastError     string `json:",omitempty"`
+	Latency       time.Duration
+}
+
+type peeringStatus struct {
+	Peers []peeringPeerStatus
+}
+
+var swarmPeeringStatusCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show the connection status of the peers in the peering subsystem.",
+		ShortDescription: `
+'ipfs swarm peering status' shows, for each peer in the peering subsystem, its
+group, whether it is connected, when it was last connected, the number of
+failed reconnection attempts since then with the last error, and its latency.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		node, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if !node.IsOnline {
+			return ErrNotOnline
+		}
+
+		out := peeringStatus{Peers: []peeringPeerStatus{}}
+		for _, st := range node.PeeringGroups.Status() {
+			ps := peeringPeerStatus{
+				ID:            st.ID,
+				Group:         st.Group,
+				Connected:     st.Connected,
+				LastConnected: st.LastConnected,
+				Failures:      st.Failures,
+				LastError:     st.LastError,
+				Latency:       st.Latency,
+			}
+			for _, addr := range st.Addrs {
+				ps.Addrs = append(ps.Addrs, addr.String())
+			}
+			out.Peers = append(out.Peers, ps)
+		}
+		return cmds.EmitOnce(res, &out)
+	},
+	Type: peeringStatus{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *peeringStatus) error {
+			tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "GROUP\tPEER\tSTATE\tLAST CONNECTED\tFAILURES\tLATENCY\t")
+			for _, p := range out.Peers {
+				state := "disconnected"
+				if p.Connected {
+					state = "connected"
+				}
+				lastConnected := "never"
+				if !p.LastConnected.IsZero() {
+					lastConnected = p.LastConnected.Format(time.RFC3339)
+				}
+				latency := "n/a"
+				if p.Latency > 0 {
+					latency = p.Latency.Round(time.Microsecond).String()
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\t\n", p.Group, p.ID, state, lastConnected, p.Failures, latency)
+			}
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+			for _, p := range out.Peers {
+				if p.LastError != "" {
+					fmt.Fprintf(w, "%s: %s\n", p.ID, p.LastError)
+				}
+			}
+			return nil
+		}),
+	},
+}
+
 var swarmPeeringRmCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Remove a peer from the peering subsystem.",
@@ -212,7 +308,7 @@ var swarmPeeringRmCmd = &cmds.Command{
 				return err
 			}
 
-			node.Peering.RemovePeer(id)
+			node.PeeringGroups.RemovePeer(id)
 			if err = res.Emit(peeringResult{id, "success"}); err != nil {
 				return err
 			}
@@ -241,6 +337,7 @@ var swarmPeersCmd = &cmds.Command{
 		cmds.BoolOption(swarmLatencyOptionName, "Also list information about latency to each peer"),
 		cmds.BoolOption(swarmDirectionOptionName, "Also list information about the direction of connection"),
 		cmds.BoolOption(swarmIdentifyOptionName, "Also list information about peers identify"),
+		cmds.BoolOption(swarmTagsOptionName, "Also list the connection manager tags and value of each peer"),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		api, err := cmdenv.GetApi(env, req)
@@ -252,6 +349,7 @@ var swarmPeersCmd = &cmds.Command{
 		streams, _ := req.Options[swarmStreamsOptionName].(bool)
 		direction, _ := req.Options[swarmDirectionOptionName].(bool)
 		identify, _ := req.Options[swarmIdentifyOptionName].(bool)
+		tags, _ := req.Options[swarmTagsOptionName].(bool)
 
 		conns, err := api.Swarm().Peers(req.Context)
 		if err != nil {
@@ -301,6 +399,14 @@ var swarmPeersCmd = &cmds.Command{
 				identifyResult, _ := ci.identifyPeer(n.Peerstore, c.ID())
 				ci.Identify = identifyResult
 			}
+
+			if verbose || tags {
+				n, err := cmdenv.GetNode(env)
+				if err != nil {
+					return err
+				}
+				ci.ConnMgr = connMgrInfoOf(n.PeerHost.ConnManager(), c.ID())
+			}
 			sort.Sort(&ci)
 			out.Peers = append(out.Peers, ci)
 		}
@@ -322,6 +428,22 @@ var swarmPeersCmd = &cmds.Command{
 				}
 				fmt.Fprintln(w)
 
+				if cm := info.ConnMgr; cm != nil {
+					names := make([]string, 0, len(cm.Tags))
+					for name := range cm.Tags {
+						names = append(names, name)
+					}
+					sort.Strings(names)
+					fmt.Fprintf(w, "  value %d", cm.Value)
+					if cm.Protected {
+						fmt.Fprint(w, ", protected")
+					}
+					for _, name := range names {
+						fmt.Fprintf(w, ", %s=%d", name, cm.Tags[name])
+					}
+					fmt.Fprintln(w)
+				}
+
 				for _, s := range info.Streams {
 					if s.Protocol == "" {
 						s.Protocol = "<no protocol name>"
@@ -433,6 +555,24 @@ type connInfo struct {
 	Direction inet.Direction `json:",omitempty"`
 	Streams   []streamInfo   `json:",omitempty"`
 	Identify  IdOutput       `json:",omitempty"`
+	ConnMgr   *connMgrInfo   `json:",omitempty"`
+}
+
+// connMgrInfo is how the connection manager values a peer when trimming
+// connections, lowest first.
+type connMgrInfo struct {
+	Value     int
+	Tags      map[string]int
+	Protected bool
+}
+
+func connMgrInfoOf(cm connmgr.ConnManager, p peer.ID) *connMgrInfo {
+	info := &connMgrInfo{Tags: map[string]int{}, Protected: cm.IsProtected(p, "")}
+	if ti := cm.GetTagInfo(p); ti != nil {
+		info.Value = ti.Value
+		info.Tags = ti.Tags
+	}
+	return info
 }
 
 func (ci *connInfo) Less(i, j int) bool {
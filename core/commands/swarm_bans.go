@@ -0,0 +1,156 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/kubo/core"
+	"github.com/ipfs/kubo/core/commands/cmdenv"
+	"github.com/ipfs/kubo/reputation"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const swarmBansAllOptionName = "all"
+
+var errReputationDisabled = errors.New("the reputation subsystem is not enabled, see Swarm.Reputation.Enabled")
+
+type swarmBans struct {
+	Peers []reputation.PeerReputation
+}
+
+type swarmUnbanResult struct {
+	ID     peer.ID
+	Banned bool
+}
+
+var swarmBansCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "List the peers banned for misbehaving.",
+		ShortDescription: `
+'ipfs swarm bans' lists the peers banned by the reputation subsystem, with
+their score and the misbehaviors they were penalized for. Banned peers are
+disconnected, and no connection is made with them until the ban expires.
+
+Peers are penalized for:
+
+  bitswap-wantlist  sending bitswap wantlists over Bitswap.MaxWantlistSize
+  dht-invalid       putting invalid records, such as IPNS records, in the DHT
+  pubsub-invalid    forwarding pubsub messages failing signature checks or
+                    validation, such as invalid IPNS records over pubsub
+  stream-limit      opening streams over their resource manager limits
+
+IPNS records put through the /routing/v1 HTTP API are not penalized, as they
+do not come from a peer.
+
+Scores halve every 10 minutes, and peers are banned for
+Swarm.Reputation.BanDuration when their score reaches
+Swarm.Reputation.BanThreshold.
+
+The reputation subsystem is enabled with Swarm.Reputation.Enabled.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(swarmBansAllOptionName, "a", "Also list the penalized peers that are not banned."),
+	},
+	Subcommands: map[string]*cmds.Command{
+		"rm": swarmBansRmCmd,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := reputationNode(env)
+		if err != nil {
+			return err
+		}
+		all, _ := req.Options[swarmBansAllOptionName].(bool)
+
+		out := swarmBans{Peers: []reputation.PeerReputation{}}
+		for _, p := range n.Reputation.Peers() {
+			if all || !p.BannedUntil.IsZero() {
+				out.Peers = append(out.Peers, p)
+			}
+		}
+		return cmds.EmitOnce(res, &out)
+	},
+	Type: swarmBans{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *swarmBans) error {
+			tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "PEER\tSCORE\tBANNED FOR\tREASONS")
+			for _, p := range out.Peers {
+				banned := "-"
+				if !p.BannedUntil.IsZero() {
+					banned = time.Until(p.BannedUntil).Round(time.Second).String()
+				}
+				reasons := make([]string, 0, len(p.Reasons))
+				for r, count := range p.Reasons {
+					reasons = append(reasons, fmt.Sprintf("%s=%d", r, count))
+				}
+				sort.Strings(reasons)
+				fmt.Fprintf(tw, "%s\t%.1f\t%s\t%s\n", p.ID, p.Score, banned, strings.Join(reasons, ","))
+			}
+			return tw.Flush()
+		}),
+	},
+}
+
+var swarmBansRmCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Lift the ban of peers.",
+		ShortDescription: `
+'ipfs swarm bans rm' lifts the ban of peers and forgets their penalties.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("ID", true, true, "ID of the peer to unban."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := reputationNode(env)
+		if err != nil {
+			return err
+		}
+		for _, arg := range req.Arguments {
+			id, err := peer.Decode(arg)
+			if err != nil {
+				return err
+			}
+			if err := res.Emit(&swarmUnbanResult{ID: id, Banned: n.Reputation.Unban(id)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Type: swarmUnbanResult{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *swarmUnbanResult) error {
+			if out.Banned {
+				_, err := fmt.Fprintf(w, "unbanned %s\n", out.ID)
+				return err
+			}
+			_, err := fmt.Fprintf(w, "%s was not banned, penalties forgotten\n", out.ID)
+			return err
+		}),
+	},
+}
+
+// reputationNode returns the node, if it is online with the reputation
+// subsystem enabled.
+func reputationNode(env cmds.Environment) (*core.IpfsNode, error) {
+	n, err := cmdenv.GetNode(env)
+	if err != nil {
+		return nil, err
+	}
+	if !n.IsOnline {
+		return nil, ErrNotOnline
+	}
+	if n.Reputation == nil {
+		return nil, errReputationDisabled
+	}
+	return n, nil
+}
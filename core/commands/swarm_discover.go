@@ -0,0 +1,88 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/kubo/core/commands/cmdenv"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const swarmDiscoverRefreshOptionName = "refresh"
+
+type discoveredPeer struct {
+	ID       peer.ID
+	Addrs    []string
+	Via      peer.ID
+	LastSeen time.Time
+	Peered   bool
+}
+
+type discoveredPeers struct {
+	Peers []discoveredPeer
+}
+
+var swarmDiscoverCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "List the peers found through rendezvous discovery.",
+		ShortDescription: `
+'ipfs swarm discover' lists the peers of the private network found through
+the rendezvous points the node is connected to, with the rendezvous point
+they were last found through, and whether they were added to the peering
+subsystem.
+
+Rendezvous discovery is enabled with Discovery.Rendezvous.Enabled, and
+requires a swarm key.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(swarmDiscoverRefreshOptionName, "Query the rendezvous points before listing the peers."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		node, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if !node.IsOnline {
+			return ErrNotOnline
+		}
+		if node.Rendezvous == nil {
+			return fmt.Errorf("rendezvous discovery is not enabled, see Discovery.Rendezvous.Enabled")
+		}
+
+		if refresh, _ := req.Options[swarmDiscoverRefreshOptionName].(bool); refresh {
+			if err := node.Rendezvous.Refresh(req.Context); err != nil {
+				return err
+			}
+		}
+
+		out := discoveredPeers{Peers: []discoveredPeer{}}
+		for _, p := range node.Rendezvous.Peers() {
+			dp := discoveredPeer{ID: p.ID, Via: p.Via, LastSeen: p.LastSeen, Peered: p.Peered}
+			for _, a := range p.Addrs {
+				dp.Addrs = append(dp.Addrs, a.String())
+			}
+			out.Peers = append(out.Peers, dp)
+		}
+		return cmds.EmitOnce(res, &out)
+	},
+	Type: discoveredPeers{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *discoveredPeers) error {
+			for _, p := range out.Peers {
+				line := fmt.Sprintf("%s via %s, seen %s ago", p.ID, p.Via, time.Since(p.LastSeen).Round(time.Second))
+				if p.Peered {
+					line += ", peered"
+				}
+				fmt.Fprintln(w, line)
+				for _, addr := range p.Addrs {
+					fmt.Fprintf(w, "\t%s\n", addr)
+				}
+			}
+			return nil
+		}),
+	},
+}
@@ -0,0 +1,117 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+
+	files "github.com/ipfs/boxo/files"
+	filestore "github.com/ipfs/boxo/filestore"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	cmdenv "github.com/ipfs/kubo/core/commands/cmdenv"
+	options "github.com/ipfs/kubo/core/coreiface/options"
+)
+
+var urlStoreCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Interact with urlstore.",
+	},
+	Subcommands: map[string]*cmds.Command{
+		"add": urlAdd,
+	},
+}
+
+var urlAdd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Add URL via urlstore.",
+		LongDescription: `
+Add the contents of <url> to IPFS without storing the data locally. The daemon
+downloads the file once to compute its blocks, and only keeps references to
+them in the filestore: the blocks are fetched from <url> with HTTP range
+requests whenever they are read.
+
+The server must support range requests, and the contents of <url> must not
+change, or the blocks will no longer be available. 'ipfs filestore verify'
+checks the blocks of URLs too, and 'ipfs filestore rm <url>' removes the
+references to them.
+
+This command is experimental and requires Experimental.UrlstoreEnabled. The
+file is always added with raw leaves and CIDv1.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(trickleOptionName, "t", "Use trickle-dag format for dag generation."),
+		cmds.BoolOption(pinOptionName, "Pin this object when adding.").WithDefault(true),
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("url", true, false, "URL to add to IPFS"),
+	},
+	Type: &BlockStat{},
+
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		urlString := req.Arguments[0]
+		if !filestore.IsURL(urlString) {
+			return fmt.Errorf("unsupported url syntax: %s", urlString)
+		}
+
+		u, err := url.Parse(urlString)
+		if err != nil {
+			return err
+		}
+
+		enc, err := cmdenv.GetCidEncoder(req)
+		if err != nil {
+			return err
+		}
+
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		cfg, err := n.Repo.Config()
+		if err != nil {
+			return err
+		}
+		if !cfg.Experimental.UrlstoreEnabled {
+			return filestore.ErrUrlstoreNotEnabled
+		}
+
+		api, err := cmdenv.GetApi(env, req)
+		if err != nil {
+			return err
+		}
+
+		useTrickledag, _ := req.Options[trickleOptionName].(bool)
+		dopin, _ := req.Options[pinOptionName].(bool)
+
+		opts := []options.UnixfsAddOption{
+			options.Unixfs.Pin(dopin),
+			options.Unixfs.CidVersion(1),
+			options.Unixfs.RawLeaves(true),
+			options.Unixfs.Nocopy(true),
+		}
+
+		if useTrickledag {
+			opts = append(opts, options.Unixfs.Layout(options.TrickleLayout))
+		}
+
+		file := files.NewWebFile(u)
+
+		path, err := api.Unixfs().Add(req.Context, file, opts...)
+		if err != nil {
+			return err
+		}
+
+		size, _ := file.Size()
+		return cmds.EmitOnce(res, &BlockStat{
+			Key:  enc.Encode(path.RootCid()),
+			Size: int(size),
+		})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, bs *BlockStat) error {
+			_, err := fmt.Fprintln(w, bs.Key)
+			return err
+		}),
+	},
+}
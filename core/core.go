@@ -53,9 +53,12 @@ import (
 	"github.com/ipfs/kubo/config"
 	"github.com/ipfs/kubo/core/node"
 	"github.com/ipfs/kubo/core/node/libp2p"
+	"github.com/ipfs/kubo/dnsresolver"
 	"github.com/ipfs/kubo/fuse/mount"
 	"github.com/ipfs/kubo/p2p"
+	kpeering "github.com/ipfs/kubo/peering"
 	"github.com/ipfs/kubo/repo"
+	"github.com/ipfs/kubo/reputation"
 	irouting "github.com/ipfs/kubo/routing"
 )
 
@@ -94,10 +97,15 @@ type IpfsNode struct {
 	// Online
 	PeerHost                  p2phost.Host               `optional:"true"` // the network host (server+client)
 	Peering                   *peering.PeeringService    `optional:"true"`
+	PeeringGroups             *kpeering.Groups           `optional:"true"` // groups of the peers of Peering
+	Rendezvous                *libp2p.Rendezvous         `optional:"true"` // peer discovery in private networks
+	Reputation                *reputation.Tracker        `optional:"true"` // bans of misbehaving peers
+	LAN                       *libp2p.LAN                `optional:"true"` // set in LAN mode
 	Filters                   *ma.Filters                `optional:"true"`
 	Bootstrapper              io.Closer                  `optional:"true"` // the periodic bootstrapper
 	Routing                   irouting.ProvideManyRouter `optional:"true"` // the routing system. recommend ipfs-dht
 	DNSResolver               *madns.Resolver            // the DNS resolver
+	DNS                       *dnsresolver.Resolver      // the DoH resolvers and their cache
 	IPLDPathResolver          pathresolver.Resolver      `name:"ipldPathResolver"`          // The IPLD path resolver
 	UnixFSPathResolver        pathresolver.Resolver      `name:"unixFSPathResolver"`        // The UnixFS path resolver
 	OfflineIPLDPathResolver   pathresolver.Resolver      `name:"offlineIpldPathResolver"`   // The IPLD path resolver that uses only locally available blocks
@@ -108,14 +116,18 @@ type IpfsNode struct {
 	IpnsRepub                 *ipnsrp.Republisher        `optional:"true"`
 	ResourceManager           network.ResourceManager    `optional:"true"`
 
-	PubSub   *pubsub.PubSub             `optional:"true"`
-	PSRouter *psrouter.PubsubValueStore `optional:"true"`
+	PubSub       *pubsub.PubSub             `optional:"true"`
+	PubSubBuffer *libp2p.PubsubBuffer       `optional:"true"` // buffer of durable pubsub topics
+	PubSubTracer *libp2p.PubsubTracer       `optional:"true"` // gossipsub mesh and message statistics
+	PSRouter     *psrouter.PubsubValueStore `optional:"true"`
 
 	DHT       *ddht.DHT       `optional:"true"`
 	DHTClient routing.Routing `name:"dhtc" optional:"true"`
 
 	P2P *p2p.P2P `optional:"true"`
 
+	BitswapServePolicy *node.ServePolicy `optional:"true"`
+
 	Process goprocess.Process
 	ctx     context.Context
 
@@ -209,7 +221,11 @@ func (n *IpfsNode) loadBootstrapPeers() ([]peer.AddrInfo, error) {
 		return nil, err
 	}
 
-	return cfg.BootstrapPeers()
+	ps, err := cfg.BootstrapPeers()
+	if err != nil || n.LAN == nil {
+		return ps, err
+	}
+	return n.LAN.BootstrapPeers(ps), nil
 }
 
 func (n *IpfsNode) saveTempBootstrapPeers(ctx context.Context, peerList []peer.AddrInfo) error {
@@ -236,7 +252,11 @@ func (n *IpfsNode) loadTempBootstrapPeers(ctx context.Context) ([]peer.AddrInfo,
 	if err := json.Unmarshal(bytes, &addrs); err != nil {
 		return nil, err
 	}
-	return config.ParseBootstrapPeers(addrs)
+	ps, err := config.ParseBootstrapPeers(addrs)
+	if err != nil || n.LAN == nil {
+		return ps, err
+	}
+	return n.LAN.BootstrapPeers(ps), nil
 }
 
 type ConstructPeerHostOpts struct {
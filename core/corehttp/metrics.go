@@ -5,7 +5,9 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/ipfs/boxo/bitswap"
 	core "github.com/ipfs/kubo/core"
+	"github.com/ipfs/kubo/core/node"
 	"go.opencensus.io/stats/view"
 	"go.opencensus.io/zpages"
 
@@ -158,12 +160,39 @@ var peersTotalMetric = prometheus.NewDesc(
 	nil,
 )
 
+var (
+	bitswapPeerSentMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "bitswap", "peer_sent_bytes"),
+		"Bytes sent to the peer over bitswap, for the peers with the most data sent",
+		[]string{"peer"},
+		nil,
+	)
+	bitswapPeerRecvMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "bitswap", "peer_received_bytes"),
+		"Bytes received from the peer over bitswap, for the peers with the most data sent",
+		[]string{"peer"},
+		nil,
+	)
+	bitswapPeerExchangedMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "bitswap", "peer_exchanged_blocks"),
+		"Blocks exchanged with the peer over bitswap, for the peers with the most data sent",
+		[]string{"peer"},
+		nil,
+	)
+)
+
 type IpfsNodeCollector struct {
 	Node *core.IpfsNode
+	// BitswapTopPeers is the number of peers, with the most data sent to
+	// them, whose bitswap ledger is exported.
+	BitswapTopPeers int
 }
 
 func (IpfsNodeCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- peersTotalMetric
+	ch <- bitswapPeerSentMetric
+	ch <- bitswapPeerRecvMetric
+	ch <- bitswapPeerExchangedMetric
 }
 
 func (c IpfsNodeCollector) Collect(ch chan<- prometheus.Metric) {
@@ -175,6 +204,27 @@ func (c IpfsNodeCollector) Collect(ch chan<- prometheus.Metric) {
 			tr,
 		)
 	}
+	c.collectBitswapLedgers(ch)
+}
+
+func (c IpfsNodeCollector) collectBitswapLedgers(ch chan<- prometheus.Metric) {
+	bs, ok := c.Node.Exchange.(*bitswap.Bitswap)
+	if !ok || c.BitswapTopPeers <= 0 {
+		return
+	}
+	ledgers, err := node.BitswapLedgers(bs, "sent")
+	if err != nil {
+		log.Errorf("collecting bitswap ledgers: %s", err)
+		return
+	}
+	if len(ledgers) > c.BitswapTopPeers {
+		ledgers = ledgers[:c.BitswapTopPeers]
+	}
+	for _, l := range ledgers {
+		ch <- prometheus.MustNewConstMetric(bitswapPeerSentMetric, prometheus.GaugeValue, float64(l.Sent), l.Peer)
+		ch <- prometheus.MustNewConstMetric(bitswapPeerRecvMetric, prometheus.GaugeValue, float64(l.Recv), l.Peer)
+		ch <- prometheus.MustNewConstMetric(bitswapPeerExchangedMetric, prometheus.GaugeValue, float64(l.Exchanged), l.Peer)
+	}
 }
 
 func (c IpfsNodeCollector) PeersTotalValues() map[string]float64 {
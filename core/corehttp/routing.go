@@ -2,8 +2,10 @@ package corehttp
 
 import (
 	"context"
+	"errors"
 	"net"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/ipfs/boxo/gateway"
@@ -12,19 +14,44 @@ import (
 	"github.com/ipfs/boxo/routing/http/types"
 	"github.com/ipfs/boxo/routing/http/types/iter"
 	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/kubo/config"
 	core "github.com/ipfs/kubo/core"
+	irouting "github.com/ipfs/kubo/routing"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/routing"
+	"github.com/multiformats/go-multihash"
 )
 
 func RoutingOption() ServeOption {
+	// The provider records are shared by the gateway listeners, which are
+	// set up concurrently.
+	var (
+		providersOnce sync.Once
+		providers     *irouting.ProviderStore
+	)
 	return func(n *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
 		_, headers, err := getGatewayConfig(n)
 		if err != nil {
 			return nil, err
 		}
 
-		handler := server.Handler(&contentRouter{n})
+		cfg, err := n.Repo.Config()
+		if err != nil {
+			return nil, err
+		}
+
+		router := &contentRouter{n: n}
+		if cfg.Gateway.AcceptProviderRecords.WithDefault(config.DefaultAcceptProviderRecords) {
+			providersOnce.Do(func() {
+				providers = irouting.NewProviderStore(n.Context(), n.Repo.Datastore(),
+					int(cfg.Gateway.MaxProviderRecordsPerPeer.WithDefault(config.DefaultMaxProviderRecordsPerPeer)),
+					int(cfg.Gateway.MaxProviderRecords.WithDefault(config.DefaultMaxProviderRecords)))
+			})
+			router.providers = providers
+			router.providerTTL = cfg.Gateway.ProviderRecordTTL.WithDefault(config.DefaultProviderRecordTTL)
+		}
+
+		handler := server.Handler(router)
 		handler = gateway.NewHeaders(headers).ApplyCors().Wrap(handler)
 		mux.Handle("/routing/v1/", handler)
 		return mux, nil
@@ -33,20 +60,65 @@ func RoutingOption() ServeOption {
 
 type contentRouter struct {
 	n *core.IpfsNode
+
+	// providers stores the accepted provider announcements, or is nil if
+	// they are not accepted.
+	providers   *irouting.ProviderStore
+	providerTTL time.Duration
 }
 
 func (r *contentRouter) FindProviders(ctx context.Context, key cid.Cid, limit int) (iter.ResultIter[types.Record], error) {
+	var local []peer.AddrInfo
+	if r.providers != nil {
+		var err error
+		local, err = r.providers.Get(ctx, key.Hash())
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	ctx, cancel := context.WithCancel(ctx)
 	ch := r.n.Routing.FindProvidersAsync(ctx, key, limit)
 	return iter.ToResultIter[types.Record](&peerChanIter{
+		local:  local,
 		ch:     ch,
 		cancel: cancel,
+		limit:  limit,
+		seen:   make(map[peer.ID]struct{}),
 	}), nil
 }
 
 // nolint deprecated
 func (r *contentRouter) ProvideBitswap(ctx context.Context, req *server.BitswapWriteProvideRequest) (time.Duration, error) {
-	return 0, routing.ErrNotSupported
+	if r.providers == nil {
+		return 0, routing.ErrNotSupported
+	}
+
+	// The signed timestamp bounds the lifetime of the announcement, so that
+	// replaying it does not extend it.
+	now := time.Now()
+	start := req.Timestamp
+	if start.IsZero() || start.After(now) {
+		start = now
+	}
+	ttl := r.providerTTL
+	if req.AdvisoryTTL > 0 && req.AdvisoryTTL < ttl {
+		ttl = req.AdvisoryTTL
+	}
+	expires := start.Add(ttl)
+	if !expires.After(now) {
+		return 0, errors.New("provider announcement has expired")
+	}
+
+	keys := make([]multihash.Multihash, len(req.Keys))
+	for i, c := range req.Keys {
+		keys[i] = c.Hash()
+	}
+	err := r.providers.Put(ctx, keys, peer.AddrInfo{ID: req.ID, Addrs: req.Addrs}, expires)
+	if err != nil {
+		return 0, err
+	}
+	return expires.Sub(now), nil
 }
 
 func (r *contentRouter) FindPeers(ctx context.Context, pid peer.ID, limit int) (iter.ResultIter[*types.PeerRecord], error) {
@@ -96,19 +168,37 @@ func (r *contentRouter) PutIPNS(ctx context.Context, name ipns.Name, record *ipn
 	return r.n.Routing.PutValue(ctx, string(name.RoutingKey()), raw)
 }
 
+// peerChanIter returns the local providers, followed by the providers read
+// from ch, skipping the duplicates and stopping after limit providers, if
+// positive.
 type peerChanIter struct {
+	local  []peer.AddrInfo
 	ch     <-chan peer.AddrInfo
 	cancel context.CancelFunc
+	limit  int
+	seen   map[peer.ID]struct{}
 	next   *peer.AddrInfo
 }
 
 func (it *peerChanIter) Next() bool {
-	addr, ok := <-it.ch
-	if ok {
+	it.next = nil
+	for it.limit <= 0 || len(it.seen) < it.limit {
+		var addr peer.AddrInfo
+		if len(it.local) > 0 {
+			addr, it.local = it.local[0], it.local[1:]
+		} else {
+			var ok bool
+			if addr, ok = <-it.ch; !ok {
+				return false
+			}
+		}
+		if _, ok := it.seen[addr.ID]; ok {
+			continue
+		}
+		it.seen[addr.ID] = struct{}{}
 		it.next = &addr
 		return true
 	}
-	it.next = nil
 	return false
 }
 
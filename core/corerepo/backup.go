@@ -0,0 +1,549 @@
+package corerepo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ipfs/boxo/ipld/merkledag"
+	uio "github.com/ipfs/boxo/ipld/unixfs/io"
+	"github.com/ipfs/boxo/mfs"
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	gocar "github.com/ipld/go-car"
+	carutil "github.com/ipld/go-car/util"
+	gocarv2 "github.com/ipld/go-car/v2"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	mh "github.com/multiformats/go-multihash"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+
+	"github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/core"
+)
+
+// BackupVersion is the version of the backups written by Backup.
+const BackupVersion = 1
+
+// BackupSelfKey is the name of the identity key in backups.
+const BackupSelfKey = "self"
+
+// restoreBatchSize is the number of blocks Restore writes at once.
+const restoreBatchSize = 256
+
+// BackupPin is a pin saved in a backup.
+type BackupPin struct {
+	Cid       cid.Cid
+	Recursive bool
+	Name      string `json:",omitempty"`
+}
+
+// BackupManifest describes a backup. A backup is a CARv1 whose only root is
+// the manifest, encoded as a JSON raw block, followed by the config and key
+// blocks it references, then by the blocks of the pins and of MFS.
+type BackupManifest struct {
+	Version int
+	Created time.Time
+	PeerID  string
+	Pins    []BackupPin
+	MFSRoot cid.Cid `json:",omitempty"`
+	// Config is the repo config, without the identity private key and the
+	// other secrets hidden by 'ipfs config show' or used by 'ipfs p2p'.
+	Config cid.Cid
+	// Keys are the private keys, by name. The identity key is named
+	// BackupSelfKey.
+	Keys map[string]cid.Cid `json:",omitempty"`
+	// KeysEncrypted is set when the keys are encrypted with a passphrase,
+	// using scrypt and secretbox.
+	KeysEncrypted bool `json:",omitempty"`
+}
+
+// BackupOptions configure Backup.
+type BackupOptions struct {
+	// Keys includes the identity and keystore keys.
+	Keys bool
+	// Passphrase, if set, encrypts the keys.
+	Passphrase string
+}
+
+// Backup writes the pins, MFS, config and keys of the node to w. Every
+// pinned block must be present locally.
+func Backup(ctx context.Context, n *core.IpfsNode, w io.Writer, opts BackupOptions) error {
+	// Keep the pinned blocks from being collected while they are written.
+	defer n.Blockstore.PinLock(ctx).Unlock(ctx)
+
+	manifest := BackupManifest{
+		Version: BackupVersion,
+		Created: time.Now().UTC(),
+		PeerID:  n.Identity.String(),
+	}
+	for _, recursive := range []bool{false, true} {
+		keys := n.Pinning.DirectKeys(ctx, true)
+		if recursive {
+			keys = n.Pinning.RecursiveKeys(ctx, true)
+		}
+		for sp := range keys {
+			if sp.Err != nil {
+				return sp.Err
+			}
+			manifest.Pins = append(manifest.Pins, BackupPin{Cid: sp.Pin.Key, Recursive: recursive, Name: sp.Pin.Name})
+		}
+	}
+	if n.FilesRoot != nil {
+		root, err := n.FilesRoot.GetDirectory().GetNode()
+		if err != nil {
+			return err
+		}
+		manifest.MFSRoot = root.Cid()
+	}
+
+	var meta []blocks.Block
+
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		return err
+	}
+	cfg, err = cfg.Clone()
+	if err != nil {
+		return err
+	}
+	scrubConfig(cfg)
+	cfgBytes, err := config.HumanOutput(cfg)
+	if err != nil {
+		return err
+	}
+	cfgBlock, err := rawBlock(cfgBytes)
+	if err != nil {
+		return err
+	}
+	manifest.Config = cfgBlock.Cid()
+	meta = append(meta, cfgBlock)
+
+	if opts.Keys {
+		keys := map[string]crypto.PrivKey{BackupSelfKey: n.PrivateKey}
+		ks := n.Repo.Keystore()
+		names, err := ks.List()
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if keys[name], err = ks.Get(name); err != nil {
+				return err
+			}
+		}
+
+		manifest.Keys = make(map[string]cid.Cid, len(keys))
+		manifest.KeysEncrypted = opts.Passphrase != ""
+		for name, sk := range keys {
+			data, err := crypto.MarshalPrivateKey(sk)
+			if err != nil {
+				return err
+			}
+			if manifest.KeysEncrypted {
+				if data, err = encryptKey(data, opts.Passphrase); err != nil {
+					return err
+				}
+			}
+			b, err := rawBlock(data)
+			if err != nil {
+				return err
+			}
+			manifest.Keys[name] = b.Cid()
+			meta = append(meta, b)
+		}
+	}
+
+	manifestBytes, err := json.Marshal(&manifest)
+	if err != nil {
+		return err
+	}
+	manifestBlock, err := rawBlock(manifestBytes)
+	if err != nil {
+		return err
+	}
+
+	if err := gocar.WriteHeader(&gocar.CarHeader{Roots: []cid.Cid{manifestBlock.Cid()}, Version: 1}, w); err != nil {
+		return err
+	}
+	for _, b := range append([]blocks.Block{manifestBlock}, meta...) {
+		if err := carutil.LdWrite(w, b.Cid().Bytes(), b.RawData()); err != nil {
+			return err
+		}
+	}
+
+	dag := offlineDAG(n)
+	visited := cid.NewSet()
+	getLinks := func(ctx context.Context, c cid.Cid) ([]*ipld.Link, error) {
+		nd, err := dag.Get(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		if err := carutil.LdWrite(w, c.Bytes(), nd.RawData()); err != nil {
+			return nil, err
+		}
+		return nd.Links(), nil
+	}
+	for _, p := range manifest.Pins {
+		var err error
+		if p.Recursive {
+			err = merkledag.Walk(ctx, getLinks, p.Cid, visited.Visit)
+		} else if visited.Visit(p.Cid) {
+			_, err = getLinks(ctx, p.Cid)
+		}
+		if err != nil {
+			return fmt.Errorf("writing pin %s: %w", p.Cid, err)
+		}
+	}
+	if manifest.MFSRoot.Defined() {
+		if err := merkledag.Walk(ctx, getLinks, manifest.MFSRoot, visited.Visit); err != nil {
+			return fmt.Errorf("writing MFS: %w", err)
+		}
+	}
+	return nil
+}
+
+// RestoreOptions configure Restore.
+type RestoreOptions struct {
+	// Keys imports the keystore keys whose name isn't used yet.
+	Keys bool
+	// SkipMissingKeys makes Keys import nothing from a backup without keys,
+	// instead of failing.
+	SkipMissingKeys bool
+	// Identity replaces the identity of the repo with the one of the backup.
+	Identity bool
+	// Config replaces the config of the repo with the one of the backup,
+	// except for the identity and the datastore.
+	Config bool
+	// Passphrase decrypts the keys.
+	Passphrase string
+}
+
+// Restore imports a backup written by Backup from r: the blocks are added to
+// the blockstore and pinned again, and the MFS entries and keys whose name is
+// not used yet are added. Changes to the identity and the config apply once
+// the node is restarted. report is called with a message for each step.
+func Restore(ctx context.Context, n *core.IpfsNode, r io.Reader, opts RestoreOptions, report func(string) error) error {
+	car, err := gocarv2.NewBlockReader(r)
+	if err != nil {
+		return err
+	}
+	if len(car.Roots) != 1 {
+		return errors.New("not a backup: expected a single root")
+	}
+	first, err := car.Next()
+	if err != nil {
+		return fmt.Errorf("not a backup: %w", err)
+	}
+	if !first.Cid().Equals(car.Roots[0]) {
+		return errors.New("not a backup: the manifest is not the first block")
+	}
+	var manifest BackupManifest
+	if err := json.Unmarshal(first.RawData(), &manifest); err != nil {
+		return fmt.Errorf("not a backup: %w", err)
+	}
+	if manifest.Version != BackupVersion {
+		return fmt.Errorf("unsupported backup version %d", manifest.Version)
+	}
+	if manifest.Keys == nil && (opts.Identity || opts.Keys && !opts.SkipMissingKeys) {
+		return errors.New("the backup has no keys")
+	}
+	if manifest.Keys != nil && (opts.Keys || opts.Identity) {
+		if manifest.KeysEncrypted && opts.Passphrase == "" {
+			return errors.New("the keys of the backup are encrypted, a passphrase is required")
+		}
+	}
+
+	// The config and keys are kept out of the blockstore.
+	meta := map[cid.Cid][]byte{manifest.Config: nil}
+	for _, c := range manifest.Keys {
+		meta[c] = nil
+	}
+
+	defer n.Blockstore.PinLock(ctx).Unlock(ctx)
+
+	var batch []blocks.Block
+	var count int
+	for {
+		b, err := car.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if _, ok := meta[b.Cid()]; ok {
+			meta[b.Cid()] = b.RawData()
+			continue
+		}
+		batch = append(batch, b)
+		if len(batch) == restoreBatchSize {
+			if err := n.Blockstore.PutMany(ctx, batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+		count++
+	}
+	if err := n.Blockstore.PutMany(ctx, batch); err != nil {
+		return err
+	}
+	if err := report(fmt.Sprintf("imported %d blocks", count)); err != nil {
+		return err
+	}
+
+	dag := offlineDAG(n)
+	for _, p := range manifest.Pins {
+		nd, err := dag.Get(ctx, p.Cid)
+		if err != nil {
+			return fmt.Errorf("pinning %s: %w", p.Cid, err)
+		}
+		if err := n.Pinning.Pin(ctx, nd, p.Recursive, p.Name); err != nil {
+			return fmt.Errorf("pinning %s: %w", p.Cid, err)
+		}
+	}
+	if err := n.Pinning.Flush(ctx); err != nil {
+		return err
+	}
+	if err := report(fmt.Sprintf("restored %d pins", len(manifest.Pins))); err != nil {
+		return err
+	}
+
+	if manifest.MFSRoot.Defined() && n.FilesRoot != nil {
+		if err := restoreMFS(ctx, n, dag, manifest.MFSRoot, report); err != nil {
+			return fmt.Errorf("restoring MFS: %w", err)
+		}
+	}
+
+	keys := make(map[string]crypto.PrivKey)
+	if opts.Keys || opts.Identity {
+		for name, c := range manifest.Keys {
+			data := meta[c]
+			if data == nil {
+				return fmt.Errorf("key %q is missing from the backup", name)
+			}
+			if manifest.KeysEncrypted {
+				if data, err = decryptKey(data, opts.Passphrase); err != nil {
+					return err
+				}
+			}
+			if keys[name], err = crypto.UnmarshalPrivateKey(data); err != nil {
+				return fmt.Errorf("key %q: %w", name, err)
+			}
+		}
+	}
+	if opts.Keys {
+		ks := n.Repo.Keystore()
+		for name, sk := range keys {
+			if name == BackupSelfKey {
+				continue
+			}
+			msg := fmt.Sprintf("restored key %s", name)
+			if has, err := ks.Has(name); err != nil {
+				return err
+			} else if has {
+				msg = fmt.Sprintf("skipped key %s: a key with this name exists", name)
+			} else if err := ks.Put(name, sk); err != nil {
+				return err
+			}
+			if err := report(msg); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !opts.Config && !opts.Identity {
+		return nil
+	}
+	cur, err := n.Repo.Config()
+	if err != nil {
+		return err
+	}
+	cfg, err := cur.Clone()
+	if err != nil {
+		return err
+	}
+	if opts.Config {
+		data := meta[manifest.Config]
+		if data == nil {
+			return errors.New("the config is missing from the backup")
+		}
+		var restored config.Config
+		if err := json.Unmarshal(data, &restored); err != nil {
+			return fmt.Errorf("config: %w", err)
+		}
+		restored.Identity = cfg.Identity
+		restored.Datastore = cfg.Datastore
+		keepSecrets(&restored, cfg)
+		cfg = &restored
+	}
+	if opts.Identity {
+		sk := keys[BackupSelfKey]
+		if sk == nil {
+			return errors.New("the identity key is missing from the backup")
+		}
+		id, err := peer.IDFromPrivateKey(sk)
+		if err != nil {
+			return err
+		}
+		skBytes, err := crypto.MarshalPrivateKey(sk)
+		if err != nil {
+			return err
+		}
+		cfg.Identity.PeerID = id.String()
+		cfg.Identity.PrivKey = base64.StdEncoding.EncodeToString(skBytes)
+	}
+	if err := n.Repo.SetConfig(cfg); err != nil {
+		return err
+	}
+	return report("restored the config, restart the daemon to apply it")
+}
+
+// scrubConfig removes the secrets from cfg: the identity private key, the
+// RPC API authorizations, the API keys of the remote pinning services and the
+// tokens of the p2p services.
+func scrubConfig(cfg *config.Config) {
+	cfg.Identity.PrivKey = ""
+	cfg.API.Authorizations = nil
+	for name, svc := range cfg.Pinning.RemoteServices {
+		svc.API.Key = ""
+		cfg.Pinning.RemoteServices[name] = svc
+	}
+	for i := range cfg.P2P.Listeners {
+		cfg.P2P.Listeners[i].Token = ""
+	}
+	for i := range cfg.P2P.Forwards {
+		cfg.P2P.Forwards[i].Token = ""
+	}
+}
+
+// keepSecrets sets the secrets removed by scrubConfig from the restored
+// config to the ones of the current config, when they are missing from the
+// restored config. The p2p listeners are matched by protocol, the forwards by
+// protocol and listen address.
+func keepSecrets(restored, cur *config.Config) {
+	if len(restored.API.Authorizations) == 0 {
+		restored.API.Authorizations = cur.API.Authorizations
+	}
+	for name, svc := range restored.Pinning.RemoteServices {
+		if curSvc, ok := cur.Pinning.RemoteServices[name]; ok && svc.API.Key == "" && svc.API.Endpoint == curSvc.API.Endpoint {
+			svc.API.Key = curSvc.API.Key
+			restored.Pinning.RemoteServices[name] = svc
+		}
+	}
+	for i, l := range restored.P2P.Listeners {
+		if l.Token != "" {
+			continue
+		}
+		for _, curL := range cur.P2P.Listeners {
+			if curL.Protocol == l.Protocol {
+				restored.P2P.Listeners[i].Token = curL.Token
+				break
+			}
+		}
+	}
+	for i, f := range restored.P2P.Forwards {
+		if f.Token != "" {
+			continue
+		}
+		for _, curF := range cur.P2P.Forwards {
+			if curF.Protocol == f.Protocol && curF.ListenAddress == f.ListenAddress {
+				restored.P2P.Forwards[i].Token = curF.Token
+				break
+			}
+		}
+	}
+}
+
+// restoreMFS adds the entries of the MFS root of the backup whose name isn't
+// used yet.
+func restoreMFS(ctx context.Context, n *core.IpfsNode, dag ipld.DAGService, root cid.Cid, report func(string) error) error {
+	nd, err := dag.Get(ctx, root)
+	if err != nil {
+		return err
+	}
+	dir, err := uio.NewDirectoryFromNode(dag, nd)
+	if err != nil {
+		return err
+	}
+	err = dir.ForEachLink(ctx, func(l *ipld.Link) error {
+		p := "/" + l.Name
+		if _, err := mfs.Lookup(n.FilesRoot, p); err == nil {
+			return report(fmt.Sprintf("skipped MFS path %s: it exists", p))
+		}
+		child, err := l.GetNode(ctx, dag)
+		if err != nil {
+			return err
+		}
+		if err := mfs.PutNode(n.FilesRoot, p, child); err != nil {
+			return err
+		}
+		return report(fmt.Sprintf("restored MFS path %s", p))
+	})
+	if err != nil {
+		return err
+	}
+	_, err = mfs.FlushPath(ctx, n.FilesRoot, "/")
+	return err
+}
+
+func rawBlock(data []byte) (blocks.Block, error) {
+	c, err := cid.Prefix{Version: 1, Codec: cid.Raw, MhType: mh.SHA2_256, MhLength: -1}.Sum(data)
+	if err != nil {
+		return nil, err
+	}
+	return blocks.NewBlockWithCid(data, c)
+}
+
+const (
+	keySaltSize  = 16
+	keyNonceSize = 24
+)
+
+func passphraseKey(passphrase string, salt []byte) (*[32]byte, error) {
+	k, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	var key [32]byte
+	copy(key[:], k)
+	return &key, nil
+}
+
+// encryptKey encrypts data as salt || nonce || secretbox(data).
+func encryptKey(data []byte, passphrase string) ([]byte, error) {
+	out := make([]byte, keySaltSize+keyNonceSize)
+	if _, err := rand.Read(out); err != nil {
+		return nil, err
+	}
+	key, err := passphraseKey(passphrase, out[:keySaltSize])
+	if err != nil {
+		return nil, err
+	}
+	var nonce [keyNonceSize]byte
+	copy(nonce[:], out[keySaltSize:])
+	return secretbox.Seal(out, data, &nonce, key), nil
+}
+
+func decryptKey(data []byte, passphrase string) ([]byte, error) {
+	if len(data) < keySaltSize+keyNonceSize {
+		return nil, errors.New("encrypted key is too short")
+	}
+	key, err := passphraseKey(passphrase, data[:keySaltSize])
+	if err != nil {
+		return nil, err
+	}
+	var nonce [keyNonceSize]byte
+	copy(nonce[:], data[keySaltSize:keySaltSize+keyNonceSize])
+	out, ok := secretbox.Open(nil, data[keySaltSize+keyNonceSize:], &nonce, key)
+	if !ok {
+		return nil, errors.New("could not decrypt the keys: wrong passphrase")
+	}
+	return out, nil
+}
@@ -0,0 +1,187 @@
+package corerepo
+
+import (
+	"context"
+	"errors"
+	"path"
+	"time"
+
+	"github.com/ipfs/boxo/blockservice"
+	offline "github.com/ipfs/boxo/exchange/offline"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	uio "github.com/ipfs/boxo/ipld/unixfs/io"
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+
+	"github.com/ipfs/kubo/core"
+)
+
+// FetchTimeout is how long FetchBlock waits for a block.
+const FetchTimeout = time.Minute
+
+// Affected lists the pins and MFS paths whose DAG include some given blocks.
+type Affected struct {
+	Pins []cid.Cid
+	MFS  []string
+	// Cids are the CIDs the blocks are linked with in these DAGs, by
+	// multihash.
+	Cids map[string]cid.Cid
+}
+
+// FindAffected returns the pins and MFS paths whose DAG include one of the
+// blocks with the multihashes mhs. Only the blocks present locally are
+// walked.
+func FindAffected(ctx context.Context, n *core.IpfsNode, mhs map[string]struct{}) (*Affected, error) {
+	a := &Affected{Cids: make(map[string]cid.Cid)}
+	dag := offlineDAG(n)
+
+	// contains returns whether the DAG of root includes one of the blocks.
+	contains := func(root cid.Cid) (bool, error) {
+		found := false
+		visited := cid.NewSet()
+		err := merkledag.Walk(ctx, localLinks(dag), root, func(c cid.Cid) bool {
+			if !visited.Visit(c) {
+				return false
+			}
+			if _, ok := mhs[string(c.Hash())]; ok {
+				found = true
+				a.Cids[string(c.Hash())] = c
+			}
+			return true
+		})
+		return found, err
+	}
+
+	for sp := range n.Pinning.DirectKeys(ctx, false) {
+		if sp.Err != nil {
+			return nil, sp.Err
+		}
+		if _, ok := mhs[string(sp.Pin.Key.Hash())]; ok {
+			a.Pins = append(a.Pins, sp.Pin.Key)
+			a.Cids[string(sp.Pin.Key.Hash())] = sp.Pin.Key
+		}
+	}
+	for sp := range n.Pinning.RecursiveKeys(ctx, false) {
+		if sp.Err != nil {
+			return nil, sp.Err
+		}
+		found, err := contains(sp.Pin.Key)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			a.Pins = append(a.Pins, sp.Pin.Key)
+		}
+	}
+
+	if n.FilesRoot != nil {
+		root, err := n.FilesRoot.GetDirectory().GetNode()
+		if err != nil {
+			return nil, err
+		}
+		var walk func(nd ipld.Node, p string) error
+		walk = func(nd ipld.Node, p string) error {
+			dir, err := uio.NewDirectoryFromNode(dag, nd)
+			if err != nil {
+				// Not a directory: report the whole file.
+				found, err := contains(nd.Cid())
+				if found {
+					a.MFS = append(a.MFS, p)
+				}
+				return err
+			}
+			if _, ok := mhs[string(nd.Cid().Hash())]; ok {
+				a.MFS = append(a.MFS, p)
+				a.Cids[string(nd.Cid().Hash())] = nd.Cid()
+			}
+			err = dir.ForEachLink(ctx, func(l *ipld.Link) error {
+				child, err := l.GetNode(ctx, dag)
+				if ipld.IsNotFound(err) {
+					if _, ok := mhs[string(l.Cid.Hash())]; ok {
+						a.MFS = append(a.MFS, path.Join(p, l.Name))
+						a.Cids[string(l.Cid.Hash())] = l.Cid
+					}
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				return walk(child, path.Join(p, l.Name))
+			})
+			if ipld.IsNotFound(err) {
+				// A block of a sharded directory is missing.
+				a.MFS = append(a.MFS, p)
+				return nil
+			}
+			return err
+		}
+		if err := walk(root, "/"); err != nil {
+			return nil, err
+		}
+	}
+
+	return a, nil
+}
+
+// CheckPins walks the DAG of every recursive pin, and calls missing for each
+// block that is missing locally. When fetch is set, the missing blocks are
+// fetched with FetchBlock first, and the walk continues below the blocks that
+// could be fetched.
+func CheckPins(ctx context.Context, n *core.IpfsNode, fetch bool, missing func(pin, c cid.Cid, fetched bool) error) error {
+	dag := offlineDAG(n)
+	for sp := range n.Pinning.RecursiveKeys(ctx, false) {
+		if sp.Err != nil {
+			return sp.Err
+		}
+		pin := sp.Pin.Key
+		getLinks := func(ctx context.Context, c cid.Cid) ([]*ipld.Link, error) {
+			nd, err := dag.Get(ctx, c)
+			if !ipld.IsNotFound(err) {
+				if err != nil {
+					return nil, err
+				}
+				return nd.Links(), nil
+			}
+			fetched := fetch && FetchBlock(ctx, n, c) == nil
+			if err := missing(pin, c, fetched); err != nil {
+				return nil, err
+			}
+			if !fetched {
+				return nil, nil
+			}
+			return ipld.GetLinks(ctx, dag, c)
+		}
+		if err := merkledag.Walk(ctx, getLinks, pin, cid.NewSet().Visit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FetchBlock fetches the block c from the network, waiting at most
+// FetchTimeout.
+func FetchBlock(ctx context.Context, n *core.IpfsNode, c cid.Cid) error {
+	if !n.IsOnline {
+		return errors.New("node is offline")
+	}
+	ctx, cancel := context.WithTimeout(ctx, FetchTimeout)
+	defer cancel()
+	_, err := n.Blocks.GetBlock(ctx, c)
+	return err
+}
+
+func offlineDAG(n *core.IpfsNode) ipld.DAGService {
+	return merkledag.NewDAGService(blockservice.New(n.Blockstore, offline.Exchange(n.Blockstore)))
+}
+
+// localLinks returns the links of the blocks present locally, and no links for
+// the missing ones.
+func localLinks(dag ipld.DAGService) merkledag.GetLinks {
+	return func(ctx context.Context, c cid.Cid) ([]*ipld.Link, error) {
+		links, err := ipld.GetLinks(ctx, dag, c)
+		if ipld.IsNotFound(err) {
+			return nil, nil
+		}
+		return links, err
+	}
+}
@@ -2,21 +2,35 @@ package node
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
 	"time"
 
+	"github.com/dustin/go-humanize"
 	"github.com/ipfs/boxo/bitswap"
+	bsmsg "github.com/ipfs/boxo/bitswap/message"
 	"github.com/ipfs/boxo/bitswap/network"
+	"github.com/ipfs/boxo/bitswap/server"
+	"github.com/ipfs/boxo/bitswap/tracer"
 	blockstore "github.com/ipfs/boxo/blockstore"
 	exchange "github.com/ipfs/boxo/exchange"
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
 	"github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/reputation"
 	irouting "github.com/ipfs/kubo/routing"
 	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
 	"go.uber.org/fx"
 
 	"github.com/ipfs/kubo/core/node/helpers"
+	"github.com/ipfs/kubo/core/node/libp2p"
 )
 
-// Docs: https://github.com/ipfs/kubo/blob/master/docs/config.md#internalbitswap
+// Docs: https://github.com/ipfs/kubo/blob/master/docs/config.md#bitswap
 const (
 	DefaultEngineBlockstoreWorkerCount = 128
 	DefaultTaskWorkerCount             = 8
@@ -31,28 +45,115 @@ type bitswapOptionsOut struct {
 	BitswapOpts []bitswap.Option `group:"bitswap-options,flatten"`
 }
 
+type bitswapOptionsIn struct {
+	fx.In
+
+	ServePolicy  *ServePolicy         `optional:"true"`
+	ConnMgrRules *libp2p.ConnMgrRules `optional:"true"`
+	Reputation   *reputation.Tracker  `optional:"true"`
+}
+
 // BitswapOptions creates configuration options for Bitswap from the config file
 // and whether to provide data.
 func BitswapOptions(cfg *config.Config, provide bool) interface{} {
-	return func() bitswapOptionsOut {
+	return func(in bitswapOptionsIn) (bitswapOptionsOut, error) {
 		var internalBsCfg config.InternalBitswap
 		if cfg.Internal.Bitswap != nil {
 			internalBsCfg = *cfg.Internal.Bitswap
 		}
+		bsCfg := cfg.Bitswap
+
+		mode := bsCfg.Mode.WithDefault(config.DefaultBitswapMode)
+		switch mode {
+		case "client+server", "server":
+		case "client":
+			// Nothing is served, so there is nothing to announce either.
+			provide = false
+		default:
+			return bitswapOptionsOut{}, fmt.Errorf("unknown Bitswap.Mode %q", mode)
+		}
+
+		priorityPeers, err := parsePeerIDs(bsCfg.PriorityPeers)
+		if err != nil {
+			return bitswapOptionsOut{}, fmt.Errorf("invalid Bitswap.PriorityPeers: %w", err)
+		}
+
+		maxWantlistSize := bsCfg.MaxWantlistSize.WithDefault(config.DefaultBitswapMaxWantlistSize)
+		if maxWantlistSize < 1 {
+			return bitswapOptionsOut{}, fmt.Errorf("Bitswap.MaxWantlistSize must be positive")
+		}
 
 		opts := []bitswap.Option{
 			bitswap.ProvideEnabled(provide),
-			bitswap.ProviderSearchDelay(internalBsCfg.ProviderSearchDelay.WithDefault(DefaultProviderSearchDelay)), // See https://github.com/ipfs/go-ipfs/issues/8807 for rationale
-			bitswap.EngineBlockstoreWorkerCount(int(internalBsCfg.EngineBlockstoreWorkerCount.WithDefault(DefaultEngineBlockstoreWorkerCount))),
-			bitswap.TaskWorkerCount(int(internalBsCfg.TaskWorkerCount.WithDefault(DefaultTaskWorkerCount))),
-			bitswap.EngineTaskWorkerCount(int(internalBsCfg.EngineTaskWorkerCount.WithDefault(DefaultEngineTaskWorkerCount))),
-			bitswap.MaxOutstandingBytesPerPeer(int(internalBsCfg.MaxOutstandingBytesPerPeer.WithDefault(DefaultMaxOutstandingBytesPerPeer))),
+			bitswap.ProviderSearchDelay(bsCfg.ProviderSearchDelay.WithDefault(internalBsCfg.ProviderSearchDelay.WithDefault(DefaultProviderSearchDelay))), // See https://github.com/ipfs/go-ipfs/issues/8807 for rationale
+			bitswap.EngineBlockstoreWorkerCount(int(bsCfg.EngineBlockstoreWorkerCount.WithDefault(internalBsCfg.EngineBlockstoreWorkerCount.WithDefault(DefaultEngineBlockstoreWorkerCount)))),
+			bitswap.TaskWorkerCount(int(bsCfg.TaskWorkerCount.WithDefault(internalBsCfg.TaskWorkerCount.WithDefault(DefaultTaskWorkerCount)))),
+			bitswap.EngineTaskWorkerCount(int(bsCfg.EngineTaskWorkerCount.WithDefault(internalBsCfg.EngineTaskWorkerCount.WithDefault(DefaultEngineTaskWorkerCount)))),
+			bitswap.MaxOutstandingBytesPerPeer(int(bsCfg.MaxOutstandingBytesPerPeer.WithDefault(internalBsCfg.MaxOutstandingBytesPerPeer.WithDefault(DefaultMaxOutstandingBytesPerPeer)))),
+			bitswap.MaxQueuedWantlistEntriesPerPeer(uint(maxWantlistSize)),
 		}
 
-		return bitswapOptionsOut{BitswapOpts: opts}
+		switch {
+		case mode == "client":
+			// bitswap always runs its server: it keeps the wantlists of
+			// other peers but denies every request.
+			opts = append(opts, bitswap.WithPeerBlockRequestFilter(func(peer.ID, cid.Cid) bool { return false }))
+		case in.ServePolicy != nil:
+			opts = append(opts, bitswap.WithPeerBlockRequestFilter(in.ServePolicy.Allow))
+		}
+
+		var tracers multiTracer
+		if in.ConnMgrRules != nil {
+			// Swarm.ConnMgr.Rules match the peers that sent us blocks.
+			tracers = append(tracers, in.ConnMgrRules)
+		}
+		if in.Reputation != nil {
+			tracers = append(tracers, libp2p.ReputationBitswapTracer(in.Reputation, int(maxWantlistSize)))
+		}
+		if len(tracers) > 0 {
+			opts = append(opts, bitswap.WithTracer(tracers))
+		}
+
+		if len(priorityPeers) > 0 {
+			opts = append(opts, bitswap.WithTaskComparator(func(ta, tb *server.TaskInfo) bool {
+				_, aPriority := priorityPeers[ta.Peer]
+				_, bPriority := priorityPeers[tb.Peer]
+				return aPriority && !bPriority
+			}))
+		}
+
+		return bitswapOptionsOut{BitswapOpts: opts}, nil
+	}
+}
+
+// multiTracer passes the bitswap messages to several tracers, as bitswap
+// takes a single one.
+type multiTracer []tracer.Tracer
+
+func (mt multiTracer) MessageReceived(p peer.ID, msg bsmsg.BitSwapMessage) {
+	for _, t := range mt {
+		t.MessageReceived(p, msg)
+	}
+}
+
+func (mt multiTracer) MessageSent(p peer.ID, msg bsmsg.BitSwapMessage) {
+	for _, t := range mt {
+		t.MessageSent(p, msg)
 	}
 }
 
+func parsePeerIDs(ids []string) (map[peer.ID]struct{}, error) {
+	peers := make(map[peer.ID]struct{}, len(ids))
+	for _, s := range ids {
+		pid, err := peer.Decode(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid peer ID %q: %w", s, err)
+		}
+		peers[pid] = struct{}{}
+	}
+	return peers, nil
+}
+
 type onlineExchangeIn struct {
 	fx.In
 
@@ -61,21 +162,207 @@ type onlineExchangeIn struct {
 	Rt          irouting.ProvideManyRouter
 	Bs          blockstore.GCBlockstore
 	BitswapOpts []bitswap.Option `group:"bitswap-options"`
+
+	ConnMgrRules *libp2p.ConnMgrRules `optional:"true"`
 }
 
 // OnlineExchange creates new LibP2P backed block exchange (BitSwap).
 // Additional options to bitswap.New can be provided via the "bitswap-options"
 // group.
-func OnlineExchange() interface{} {
-	return func(in onlineExchangeIn, lc fx.Lifecycle) exchange.Interface {
-		bitswapNetwork := network.NewFromIpfsHost(in.Host, in.Rt)
+func OnlineExchange(cfg config.Bitswap) interface{} {
+	return func(in onlineExchangeIn, lc fx.Lifecycle) (exchange.Interface, error) {
+		ctx := helpers.LifecycleCtx(in.Mctx, lc)
+		var bitswapNetwork network.BitSwapNetwork = network.NewFromIpfsHost(in.Host, in.Rt)
 
-		exch := bitswap.New(helpers.LifecycleCtx(in.Mctx, lc), bitswapNetwork, in.Bs, in.BitswapOpts...)
+		if rate := cfg.MaxSendRatePerPeer.WithDefault(""); rate != "" {
+			bytesPerSec, err := humanize.ParseBytes(rate)
+			if err != nil {
+				return nil, fmt.Errorf("invalid Bitswap.MaxSendRatePerPeer: %w", err)
+			}
+			exempt, err := parsePeerIDs(cfg.PriorityPeers)
+			if err != nil {
+				return nil, fmt.Errorf("invalid Bitswap.PriorityPeers: %w", err)
+			}
+			if bytesPerSec > 0 {
+				bitswapNetwork = newRateLimitedNetwork(ctx, bitswapNetwork, float64(bytesPerSec), exempt)
+			}
+		}
+
+		exch := bitswap.New(ctx, bitswapNetwork, in.Bs, in.BitswapOpts...)
+		if in.ConnMgrRules != nil {
+			// ProvidedWithin only credits the blocks we asked for.
+			in.ConnMgrRules.SetWantlist(exch.GetWantlist)
+		}
 		lc.Append(fx.Hook{
 			OnStop: func(ctx context.Context) error {
 				return exch.Close()
 			},
 		})
-		return exch
+		return exch, nil
+	}
+}
+
+// rateLimitQueueTime bounds the messages queued for a rate limited peer to
+// this long at its rate.
+const rateLimitQueueTime = 10 * time.Second
+
+var errSendQueueFull = errors.New("bitswap send queue of the peer is full")
+
+// rateLimitedNetwork paces the messages bitswap sends to each peer so that no
+// more than bytesPerSec are sent to a peer, except to exempt peers. Only
+// SendMessage, which the bitswap server uses to send blocks, is limited: the
+// wantlists sent by the client are not.
+//
+// SendMessage must not hold the bitswap task workers, which are shared by all
+// peers: messages to a limited peer are queued and sent by a goroutine of that
+// peer. Messages that would exceed rateLimitQueueTime of queued data are
+// dropped, the peer requests the blocks again when it rebroadcasts its
+// wantlist.
+type rateLimitedNetwork struct {
+	network.BitSwapNetwork
+
+	ctx         context.Context
+	bytesPerSec float64
+	exempt      map[peer.ID]struct{}
+
+	mu     sync.Mutex
+	queues map[peer.ID]*sendQueue
+}
+
+type sendQueue struct {
+	msgs  []bsmsg.BitSwapMessage
+	bytes int
+}
+
+func newRateLimitedNetwork(ctx context.Context, bsnet network.BitSwapNetwork, bytesPerSec float64, exempt map[peer.ID]struct{}) *rateLimitedNetwork {
+	return &rateLimitedNetwork{
+		BitSwapNetwork: bsnet,
+		ctx:            ctx,
+		bytesPerSec:    bytesPerSec,
+		exempt:         exempt,
+		queues:         make(map[peer.ID]*sendQueue),
+	}
+}
+
+func (n *rateLimitedNetwork) SendMessage(ctx context.Context, p peer.ID, msg bsmsg.BitSwapMessage) error {
+	if _, ok := n.exempt[p]; ok {
+		return n.BitSwapNetwork.SendMessage(ctx, p, msg)
+	}
+
+	size := msg.Size()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	q, ok := n.queues[p]
+	if !ok {
+		q = &sendQueue{}
+		n.queues[p] = q
+		go n.sendLoop(p, q)
+	}
+	// A single message is always accepted, however large.
+	if q.bytes > 0 && float64(q.bytes+size) > n.bytesPerSec*rateLimitQueueTime.Seconds() {
+		return errSendQueueFull
+	}
+	q.msgs = append(q.msgs, msg)
+	q.bytes += size
+	return nil
+}
+
+// sendLoop sends the messages queued for p, waiting after each message for as
+// long as it takes to send it at the rate. It returns once the queue is
+// empty and the wait is over.
+func (n *rateLimitedNetwork) sendLoop(p peer.ID, q *sendQueue) {
+	for {
+		n.mu.Lock()
+		if len(q.msgs) == 0 || n.ctx.Err() != nil {
+			delete(n.queues, p)
+			n.mu.Unlock()
+			return
+		}
+		msg := q.msgs[0]
+		q.msgs[0] = nil
+		q.msgs = q.msgs[1:]
+		size := msg.Size()
+		q.bytes -= size
+		n.mu.Unlock()
+
+		if err := n.BitSwapNetwork.SendMessage(n.ctx, p, msg); err != nil {
+			logger.Debugw("failed to send rate limited bitswap message", "peer", p, "error", err)
+		}
+
+		timer := time.NewTimer(time.Duration(float64(size) / n.bytesPerSec * float64(time.Second)))
+		select {
+		case <-timer.C:
+		case <-n.ctx.Done():
+			timer.Stop()
+		}
+	}
+}
+
+// serverOnlyExchange never fetches blocks from other peers. It is used by the
+// blockservice in the "server" Bitswap.Mode, while bitswap keeps serving and
+// announcing the blocks that are added.
+type serverOnlyExchange struct {
+	exchange.Interface
+}
+
+func (serverOnlyExchange) GetBlock(_ context.Context, c cid.Cid) (blocks.Block, error) {
+	return nil, ipld.ErrNotFound{Cid: c}
+}
+
+func (serverOnlyExchange) GetBlocks(context.Context, []cid.Cid) (<-chan blocks.Block, error) {
+	out := make(chan blocks.Block)
+	close(out)
+	return out, nil
+}
+
+// ServerOnlyExchange provides the exchange used by the blockservice in the
+// "server" Bitswap.Mode.
+func ServerOnlyExchange(rem exchange.Interface) blockserviceExchangeOut {
+	return blockserviceExchangeOut{Exchange: serverOnlyExchange{rem}}
+}
+
+type blockserviceExchangeOut struct {
+	fx.Out
+
+	Exchange exchange.Interface `name:"blockserviceExchange"`
+}
+
+// BitswapLedgerSortFields are the fields BitswapLedgers can sort by.
+var BitswapLedgerSortFields = []string{"sent", "recv", "exchanged", "value"}
+
+// BitswapLedgers returns the ledgers of the peers bitswap has a session with,
+// sorted by decreasing sortBy, one of BitswapLedgerSortFields.
+func BitswapLedgers(bs *bitswap.Bitswap, sortBy string) ([]*server.Receipt, error) {
+	var key func(r *server.Receipt) float64
+	switch sortBy {
+	case "sent":
+		key = func(r *server.Receipt) float64 { return float64(r.Sent) }
+	case "recv":
+		key = func(r *server.Receipt) float64 { return float64(r.Recv) }
+	case "exchanged":
+		key = func(r *server.Receipt) float64 { return float64(r.Exchanged) }
+	case "value":
+		key = func(r *server.Receipt) float64 { return r.Value }
+	default:
+		return nil, fmt.Errorf("cannot sort ledgers by %q, expected one of %v", sortBy, BitswapLedgerSortFields)
+	}
+
+	st, err := bs.Stat()
+	if err != nil {
+		return nil, err
+	}
+	ledgers := make([]*server.Receipt, 0, len(st.Peers))
+	for _, s := range st.Peers {
+		p, err := peer.Decode(s)
+		if err != nil {
+			continue
+		}
+		if r := bs.LedgerForPeer(p); r != nil {
+			ledgers = append(ledgers, r)
+		}
 	}
+	sort.SliceStable(ledgers, func(i, j int) bool {
+		return key(ledgers[i]) > key(ledgers[j])
+	})
+	return ledgers, nil
 }
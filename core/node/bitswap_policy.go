@@ -0,0 +1,266 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ipfs/boxo/blockservice"
+	blockstore "github.com/ipfs/boxo/blockstore"
+	offline "github.com/ipfs/boxo/exchange/offline"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	"github.com/ipfs/boxo/mfs"
+	pin "github.com/ipfs/boxo/pinning/pinner"
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"go.uber.org/fx"
+
+	"github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/core/node/helpers"
+)
+
+const (
+	// servePolicyRefreshInterval is how often the blocks allowed by a serve
+	// policy are listed again, so that unpinned blocks stop being served.
+	servePolicyRefreshInterval = 10 * time.Minute
+	// servePolicyChangeDelay is how long a refresh waits after pins or MFS
+	// changed, so that successive changes are listed at once.
+	servePolicyChangeDelay = time.Second
+)
+
+// ServePolicy decides which blocks bitswap sends to other peers, following
+// Bitswap.ServePolicy, much like Reprovider.Strategy decides which blocks are
+// announced.
+//
+// The "pinned" and "pinned+mfs" policies keep the multihashes of the pinned
+// (and MFS) blocks in memory. They are listed again when pins are added or
+// updated, when MFS is published, and periodically. Until they are first
+// listed after startup, only Bitswap.ServeAllowedPeers are served.
+type ServePolicy struct {
+	policy       string
+	allowedPeers map[peer.ID]struct{}
+
+	pinner pin.Pinner
+	files  *mfs.Root
+	dag    ipld.DAGService
+	bs     blockstore.Blockstore
+	ctx    context.Context
+
+	mu      sync.RWMutex
+	allowed map[string]struct{}
+
+	denied atomic.Uint64
+}
+
+// Policy returns the name of the policy.
+func (p *ServePolicy) Policy() string {
+	return p.policy
+}
+
+// Denied returns the number of requests for blocks we have that were denied.
+func (p *ServePolicy) Denied() uint64 {
+	return p.denied.Load()
+}
+
+// Allow returns whether the block c may be sent to the peer pid. It is used as
+// the bitswap PeerBlockRequestFilter.
+func (p *ServePolicy) Allow(pid peer.ID, c cid.Cid) bool {
+	if _, ok := p.allowedPeers[pid]; ok {
+		return true
+	}
+
+	if p.policy != "peers" {
+		p.mu.RLock()
+		_, ok := p.allowed[string(c.Hash())]
+		p.mu.RUnlock()
+		if ok {
+			return true
+		}
+	}
+
+	// Only count requests for blocks we could have served: the filter is
+	// applied before bitswap looks the block up.
+	if has, err := p.bs.Has(p.ctx, c); err == nil && has {
+		p.denied.Add(1)
+	}
+	return false
+}
+
+// refreshLoop lists the allowed blocks now, then every
+// servePolicyRefreshInterval and shortly after changed is signaled, until the
+// node stops.
+func (p *ServePolicy) refreshLoop(changed <-chan struct{}) {
+	ticker := time.NewTicker(servePolicyRefreshInterval)
+	defer ticker.Stop()
+	for {
+		if err := p.refresh(p.ctx); err != nil && p.ctx.Err() == nil {
+			logger.Errorf("listing blocks allowed by Bitswap.ServePolicy: %s", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-changed:
+			select {
+			case <-time.After(servePolicyChangeDelay):
+			case <-p.ctx.Done():
+				return
+			}
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
+
+// refresh lists the blocks allowed by the policy. Blocks of pinned DAGs that
+// are missing locally are skipped.
+func (p *ServePolicy) refresh(ctx context.Context) error {
+	allowed := make(map[string]struct{})
+	visit := func(c cid.Cid) bool {
+		k := string(c.Hash())
+		if _, ok := allowed[k]; ok {
+			return false
+		}
+		allowed[k] = struct{}{}
+		return true
+	}
+	getLinks := func(ctx context.Context, c cid.Cid) ([]*ipld.Link, error) {
+		links, err := ipld.GetLinks(ctx, p.dag, c)
+		if ipld.IsNotFound(err) {
+			return nil, nil
+		}
+		return links, err
+	}
+
+	for sp := range p.pinner.DirectKeys(ctx, false) {
+		if sp.Err != nil {
+			return sp.Err
+		}
+		visit(sp.Pin.Key)
+	}
+	for sp := range p.pinner.RecursiveKeys(ctx, false) {
+		if sp.Err != nil {
+			return sp.Err
+		}
+		if err := merkledag.Walk(ctx, getLinks, sp.Pin.Key, visit); err != nil {
+			return fmt.Errorf("walking pin %s: %w", sp.Pin.Key, err)
+		}
+	}
+	if p.policy == "pinned+mfs" {
+		root, err := p.files.GetDirectory().GetNode()
+		if err != nil {
+			return err
+		}
+		if err := merkledag.Walk(ctx, getLinks, root.Cid(), visit); err != nil {
+			return fmt.Errorf("walking MFS: %w", err)
+		}
+	}
+
+	p.mu.Lock()
+	p.allowed = allowed
+	p.mu.Unlock()
+	return nil
+}
+
+// servePolicyPinner signals changed when pins are added or updated, so that
+// the newly pinned blocks are served without waiting for the next periodic
+// refresh.
+type servePolicyPinner struct {
+	pin.Pinner
+	changed func()
+}
+
+func (p *servePolicyPinner) Pin(ctx context.Context, node ipld.Node, recursive bool, name string) error {
+	err := p.Pinner.Pin(ctx, node, recursive, name)
+	p.changed()
+	return err
+}
+
+func (p *servePolicyPinner) PinWithMode(ctx context.Context, c cid.Cid, mode pin.Mode, name string) error {
+	err := p.Pinner.PinWithMode(ctx, c, mode, name)
+	p.changed()
+	return err
+}
+
+func (p *servePolicyPinner) Update(ctx context.Context, from, to cid.Cid, unpin bool) error {
+	err := p.Pinner.Update(ctx, from, to, unpin)
+	p.changed()
+	return err
+}
+
+// BitswapServePolicy provides the ServePolicy configured by Bitswap.ServePolicy
+// and Bitswap.ServeAllowedPeers. Nothing is provided when every block is
+// served to every peer.
+func BitswapServePolicy(cfg config.Bitswap) fx.Option {
+	policy := cfg.ServePolicy.WithDefault(config.DefaultBitswapServePolicy)
+	switch policy {
+	case "all":
+		return fx.Options()
+	case "pinned", "pinned+mfs", "peers":
+	default:
+		return fx.Error(fmt.Errorf("unknown Bitswap.ServePolicy %q", policy))
+	}
+
+	allowedPeers := make(map[peer.ID]struct{}, len(cfg.ServeAllowedPeers))
+	for _, s := range cfg.ServeAllowedPeers {
+		pid, err := peer.Decode(s)
+		if err != nil {
+			return fx.Error(fmt.Errorf("invalid peer ID in Bitswap.ServeAllowedPeers %q: %w", s, err))
+		}
+		allowedPeers[pid] = struct{}{}
+	}
+
+	// Pin and MFS changes are signaled without blocking, and coalesced until
+	// the refresh loop picks them up.
+	changed := make(chan struct{}, 1)
+	signal := func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+
+	type input struct {
+		fx.In
+		Mctx helpers.MetricsCtx
+		Lc   fx.Lifecycle
+		Bs   blockstore.Blockstore
+	}
+	provide := fx.Provide(func(in input) *ServePolicy {
+		return &ServePolicy{
+			policy:       policy,
+			allowedPeers: allowedPeers,
+			dag:          merkledag.NewDAGService(blockservice.New(in.Bs, offline.Exchange(in.Bs))),
+			bs:           in.Bs,
+			ctx:          helpers.LifecycleCtx(in.Mctx, in.Lc),
+		}
+	})
+	if policy == "peers" {
+		return provide
+	}
+
+	// The pinner and MFS depend on the exchange, and so on the ServePolicy
+	// through bitswap: they are set once everything is provided.
+	start := fx.Invoke(func(p *ServePolicy, pinner pin.Pinner, files *mfs.Root, lc fx.Lifecycle) {
+		p.pinner = pinner
+		p.files = files
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go p.refreshLoop(changed)
+				return nil
+			},
+		})
+	})
+	opts := []fx.Option{
+		provide,
+		start,
+		fx.Decorate(func(p pin.Pinner) pin.Pinner {
+			return &servePolicyPinner{Pinner: p, changed: signal}
+		}),
+	}
+	if policy == "pinned+mfs" {
+		opts = append(opts, fx.Supply(mfsPublished(func(cid.Cid) { signal() })))
+	}
+	return fx.Options(opts...)
+}
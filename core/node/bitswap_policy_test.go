@@ -0,0 +1,157 @@
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/blockservice"
+	blockstore "github.com/ipfs/boxo/blockstore"
+	offline "github.com/ipfs/boxo/exchange/offline"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	ft "github.com/ipfs/boxo/ipld/unixfs"
+	"github.com/ipfs/boxo/mfs"
+	"github.com/ipfs/boxo/pinning/pinner/dspinner"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestServePolicy(t *testing.T) {
+	ctx := context.Background()
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bs := blockstore.NewBlockstore(dstore)
+	dag := merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs)))
+	pinner, err := dspinner.New(ctx, dstore, dag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := mfs.NewRoot(ctx, dag, ft.EmptyDirNode(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	add := func(data string, links ...*merkledag.ProtoNode) *merkledag.ProtoNode {
+		nd := merkledag.NodeWithData(ft.FilePBData([]byte(data), uint64(len(data))))
+		for i, l := range links {
+			if err := nd.AddNodeLink(string(rune('a'+i)), l); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := dag.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+		return nd
+	}
+	child := add("child")
+	pinned := add("pinned", child)
+	unpinned := add("unpinned")
+	inMFS := add("mfs")
+	if err := pinner.Pin(ctx, pinned, true, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := mfs.PutNode(files, "/file", inMFS); err != nil {
+		t.Fatal(err)
+	}
+
+	friend := peer.ID("friend")
+	other := peer.ID("other")
+
+	for _, tc := range []struct {
+		policy  string
+		allowed []*merkledag.ProtoNode
+		denied  []*merkledag.ProtoNode
+	}{
+		{"pinned", []*merkledag.ProtoNode{pinned, child}, []*merkledag.ProtoNode{unpinned, inMFS}},
+		{"pinned+mfs", []*merkledag.ProtoNode{pinned, child, inMFS}, []*merkledag.ProtoNode{unpinned}},
+		{"peers", nil, []*merkledag.ProtoNode{pinned, unpinned}},
+	} {
+		t.Run(tc.policy, func(t *testing.T) {
+			p := &ServePolicy{
+				policy:       tc.policy,
+				allowedPeers: map[peer.ID]struct{}{friend: {}},
+				pinner:       pinner,
+				files:        files,
+				dag:          dag,
+				bs:           bs,
+				ctx:          ctx,
+			}
+			if tc.policy != "peers" {
+				if err := p.refresh(ctx); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, nd := range tc.allowed {
+				if !p.Allow(other, nd.Cid()) {
+					t.Errorf("%s should be served", nd.Cid())
+				}
+			}
+			for _, nd := range tc.denied {
+				if p.Allow(other, nd.Cid()) {
+					t.Errorf("%s should not be served", nd.Cid())
+				}
+				if !p.Allow(friend, nd.Cid()) {
+					t.Errorf("%s should be served to allowed peers", nd.Cid())
+				}
+			}
+			if p.Denied() != uint64(len(tc.denied)) {
+				t.Errorf("expected %d denied requests, got %d", len(tc.denied), p.Denied())
+			}
+
+			// Requests for blocks we don't have aren't counted.
+			p.Allow(other, merkledag.NodeWithData(ft.FilePBData([]byte("missing"), 7)).Cid())
+			if p.Denied() != uint64(len(tc.denied)) {
+				t.Error("request for a missing block was counted as denied")
+			}
+		})
+	}
+}
+
+func TestServePolicyRefresh(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bs := blockstore.NewBlockstore(dstore)
+	dag := merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs)))
+	dspin, err := dspinner.New(ctx, dstore, dag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := make(chan struct{}, 1)
+	pinner := &servePolicyPinner{Pinner: dspin, changed: func() { changed <- struct{}{} }}
+
+	p := &ServePolicy{policy: "pinned", pinner: pinner, dag: dag, bs: bs, ctx: ctx}
+	go p.refreshLoop(changed)
+	// Wait for the initial refresh.
+	for {
+		p.mu.RLock()
+		listed := p.allowed != nil
+		p.mu.RUnlock()
+		if listed {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	nd := merkledag.NodeWithData(ft.FilePBData([]byte("pinned"), 6))
+	if err := dag.Add(ctx, nd); err != nil {
+		t.Fatal(err)
+	}
+	other := peer.ID("other")
+	if p.Allow(other, nd.Cid()) {
+		t.Fatal("unpinned block should not be served")
+	}
+
+	// Requests don't refresh the policy, pins do.
+	if err := pinner.Pin(ctx, nd, true, ""); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !p.Allow(other, nd.Cid()) {
+		if time.Now().After(deadline) {
+			t.Fatal("newly pinned block is not served")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
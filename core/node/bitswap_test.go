@@ -0,0 +1,128 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	bsmsg "github.com/ipfs/boxo/bitswap/message"
+	"github.com/ipfs/boxo/bitswap/network"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// recordingNetwork records when messages are sent to each peer.
+type recordingNetwork struct {
+	network.BitSwapNetwork
+
+	mu   sync.Mutex
+	sent map[peer.ID][]time.Time
+}
+
+func (n *recordingNetwork) SendMessage(_ context.Context, p peer.ID, _ bsmsg.BitSwapMessage) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sent[p] = append(n.sent[p], time.Now())
+	return nil
+}
+
+func (n *recordingNetwork) sentTo(p peer.ID) []time.Time {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]time.Time(nil), n.sent[p]...)
+}
+
+func blockMessage(size int) bsmsg.BitSwapMessage {
+	msg := bsmsg.New(false)
+	msg.AddBlock(blocks.NewBlock(make([]byte, size)))
+	return msg
+}
+
+func TestRateLimitedNetwork(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rec := &recordingNetwork{sent: make(map[peer.ID][]time.Time)}
+	exempt := peer.ID("exempt")
+	n := newRateLimitedNetwork(ctx, rec, 1000, map[peer.ID]struct{}{exempt: {}})
+
+	// More capped peers than bitswap task workers: the workers must not be
+	// held by the capped peers.
+	const workers, peersPerWorker = DefaultTaskWorkerCount, 3
+	var capped []peer.ID
+	for i := 0; i < workers*peersPerWorker; i++ {
+		capped = append(capped, peer.ID(fmt.Sprintf("capped-%d", i)))
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(peers []peer.ID) {
+			defer wg.Done()
+			for _, p := range peers {
+				// The first message is sent right away and delays the next
+				// one by 200ms.
+				for i := 0; i < 2; i++ {
+					if err := n.SendMessage(ctx, p, blockMessage(200)); err != nil {
+						t.Error(err)
+					}
+				}
+			}
+		}(capped[w*peersPerWorker : (w+1)*peersPerWorker])
+	}
+	wg.Wait()
+	for i := 0; i < 10; i++ {
+		if err := n.SendMessage(ctx, exempt, blockMessage(1000)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("sending to capped peers held the workers: %s", elapsed)
+	}
+	if sent := rec.sentTo(exempt); len(sent) != 10 {
+		t.Fatalf("expected 10 messages sent to the exempt peer, got %d", len(sent))
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for _, p := range capped {
+		sent := rec.sentTo(p)
+		for len(sent) < 2 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+			sent = rec.sentTo(p)
+		}
+		if len(sent) != 2 {
+			t.Fatalf("expected 2 messages sent to %s, got %d", p, len(sent))
+		}
+		if gap := sent[1].Sub(sent[0]); gap < 150*time.Millisecond {
+			t.Fatalf("second message to %s was not delayed: %s", p, gap)
+		}
+	}
+}
+
+func TestRateLimitedNetworkQueueFull(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rec := &recordingNetwork{sent: make(map[peer.ID][]time.Time)}
+	p := peer.ID("capped")
+	// 100 bytes may be queued.
+	n := newRateLimitedNetwork(ctx, rec, 10, nil)
+
+	if err := n.SendMessage(ctx, p, blockMessage(200)); err != nil {
+		t.Fatal(err)
+	}
+	for len(rec.sentTo(p)) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// A single message is queued however large, the next one is dropped.
+	if err := n.SendMessage(ctx, p, blockMessage(200)); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.SendMessage(ctx, p, blockMessage(200)); !errors.Is(err, errSendQueueFull) {
+		t.Fatalf("expected errSendQueueFull, got %v", err)
+	}
+}
@@ -28,9 +28,24 @@ import (
 	"github.com/ipfs/kubo/repo"
 )
 
+type blockServiceIn struct {
+	fx.In
+
+	Lc  fx.Lifecycle
+	Bs  blockstore.Blockstore
+	Rem exchange.Interface
+	// RemOverride replaces Rem when set, see ServerOnlyExchange.
+	RemOverride exchange.Interface `name:"blockserviceExchange" optional:"true"`
+}
+
 // BlockService creates new blockservice which provides an interface to fetch content-addressable blocks
-func BlockService(lc fx.Lifecycle, bs blockstore.Blockstore, rem exchange.Interface) blockservice.BlockService {
-	bsvc := blockservice.New(bs, rem)
+func BlockService(in blockServiceIn) blockservice.BlockService {
+	rem := in.Rem
+	if in.RemOverride != nil {
+		rem = in.RemOverride
+	}
+	bsvc := blockservice.New(in.Bs, rem)
+	lc := in.Lc
 
 	lc.Append(fx.Hook{
 		OnStop: func(ctx context.Context) error {
@@ -145,8 +160,17 @@ func Dag(bs blockservice.BlockService) format.DAGService {
 	return merkledag.NewDAGService(bs)
 }
 
+// mfsPublished is called with the new MFS root each time it is published.
+type mfsPublished func(cid.Cid)
+
+type filesHooks struct {
+	fx.In
+
+	Published mfsPublished `optional:"true"`
+}
+
 // Files loads persisted MFS root
-func Files(mctx helpers.MetricsCtx, lc fx.Lifecycle, repo repo.Repo, dag format.DAGService) (*mfs.Root, error) {
+func Files(mctx helpers.MetricsCtx, lc fx.Lifecycle, repo repo.Repo, dag format.DAGService, hooks filesHooks) (*mfs.Root, error) {
 	dsk := datastore.NewKey("/local/filesroot")
 	pf := func(ctx context.Context, c cid.Cid) error {
 		rootDS := repo.Datastore()
@@ -160,7 +184,13 @@ func Files(mctx helpers.MetricsCtx, lc fx.Lifecycle, repo repo.Repo, dag format.
 		if err := rootDS.Put(ctx, dsk, c.Bytes()); err != nil {
 			return err
 		}
-		return rootDS.Sync(ctx, dsk)
+		if err := rootDS.Sync(ctx, dsk); err != nil {
+			return err
+		}
+		if hooks.Published != nil {
+			hooks.Published(c)
+		}
+		return nil
 	}
 
 	var nd *merkledag.ProtoNode
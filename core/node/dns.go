@@ -4,17 +4,17 @@ import (
 	"math"
 	"time"
 
-	"github.com/ipfs/boxo/gateway"
 	config "github.com/ipfs/kubo/config"
-	doh "github.com/libp2p/go-doh-resolver"
+	"github.com/ipfs/kubo/dnsresolver"
 	madns "github.com/multiformats/go-multiaddr-dns"
 )
 
-func DNSResolver(cfg *config.Config) (*madns.Resolver, error) {
-	var dohOpts []doh.Option
-	if !cfg.DNS.MaxCacheTTL.IsDefault() {
-		dohOpts = append(dohOpts, doh.WithMaxCacheTTL(cfg.DNS.MaxCacheTTL.WithDefault(time.Duration(math.MaxUint32)*time.Second)))
-	}
+func DNSResolver(cfg *config.Config) (*dnsresolver.Resolver, error) {
+	return dnsresolver.New(cfg.DNS.Resolvers, cfg.DNS.MaxCacheTTL.WithDefault(time.Duration(math.MaxUint32)*time.Second))
+}
 
-	return gateway.NewDNSResolver(cfg.DNS.Resolvers, dohOpts...)
+// MultiaddrDNSResolver provides the resolver of /dns* multiaddrs and DNSLink
+// records.
+func MultiaddrDNSResolver(rslv *dnsresolver.Resolver) *madns.Resolver {
+	return rslv.Resolver
 }
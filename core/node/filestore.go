@@ -0,0 +1,265 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ipfs/boxo/filestore"
+	"github.com/ipfs/boxo/filestore/posinfo"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+
+	"github.com/ipfs/kubo/repo"
+)
+
+// FilestoreRoot returns the directory the paths of the filestore references
+// are relative to: the parent of the repo directory.
+func FilestoreRoot(r repo.Repo) (string, error) {
+	pr, ok := r.(interface{ Path() string })
+	if !ok {
+		return "", errors.New("filestore root is unknown for this repo")
+	}
+	return filepath.Dir(pr.Path()), nil
+}
+
+// filestoreEntry is a reference to a block stored in a file.
+type filestoreEntry struct {
+	key    cid.Cid
+	offset uint64
+	size   uint64
+}
+
+// readFilestoreEntry reads the block referenced by e from f, and returns it if
+// its hash matches.
+func readFilestoreEntry(f *os.File, e filestoreEntry) (blocks.Block, bool) {
+	buf := make([]byte, e.size)
+	if _, err := f.ReadAt(buf, int64(e.offset)); err != nil {
+		return nil, false
+	}
+	c, err := e.key.Prefix().Sum(buf)
+	if err != nil || !c.Equals(e.key) {
+		return nil, false
+	}
+	blk, err := blocks.NewBlockWithCid(buf, e.key)
+	if err != nil {
+		return nil, false
+	}
+	return blk, true
+}
+
+// FilestoreReindexRes is the outcome of the reindexing of the references to
+// one backing file.
+type FilestoreReindexRes struct {
+	From     string
+	To       string `json:",omitempty"`
+	Blocks   int
+	ErrorMsg string `json:",omitempty"`
+}
+
+// FilestoreReindex looks for the backing files of the filestore references
+// that are missing or changed in the absolute directory dir, and updates the
+// references of the files found there with unchanged contents. Files with the
+// same name are tried first, then any file large enough.
+func FilestoreReindex(ctx context.Context, fstore *filestore.Filestore, root, dir string, emit func(*FilestoreReindexRes) error) error {
+	if !filepath.IsAbs(dir) {
+		return fmt.Errorf("%s is not an absolute path", dir)
+	}
+	dir = filepath.Clean(dir)
+	if rel, err := filepath.Rel(root, dir); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s is outside of the filestore root %s", dir, root)
+	}
+
+	broken := make(map[string][]filestoreEntry)
+	next, err := filestore.VerifyAll(ctx, fstore, true)
+	if err != nil {
+		return err
+	}
+	for r := next(ctx); r != nil; r = next(ctx) {
+		if r.Status != filestore.StatusFileNotFound && r.Status != filestore.StatusFileChanged {
+			continue
+		}
+		if filestore.IsURL(r.FilePath) {
+			continue
+		}
+		broken[r.FilePath] = append(broken[r.FilePath], filestoreEntry{key: r.Key, offset: r.Offset, size: r.Size})
+	}
+	if len(broken) == 0 {
+		return nil
+	}
+
+	type candidate struct {
+		path string
+		size int64
+	}
+	var candidates []candidate
+	byName := make(map[string][]candidate)
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			logger.Warnf("filestore reindex: %s", err)
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		c := candidate{path: path, size: info.Size()}
+		candidates = append(candidates, c)
+		byName[d.Name()] = append(byName[d.Name()], c)
+		return ctx.Err()
+	})
+	if err != nil {
+		return err
+	}
+
+	oldPaths := make([]string, 0, len(broken))
+	for p := range broken {
+		oldPaths = append(oldPaths, p)
+	}
+	sort.Strings(oldPaths)
+
+	for _, oldPath := range oldPaths {
+		entries := broken[oldPath]
+		var extent uint64
+		for _, e := range entries {
+			if end := e.offset + e.size; end > extent {
+				extent = end
+			}
+		}
+		res := &FilestoreReindexRes{From: oldPath, Blocks: len(entries)}
+
+		var nodes []*posinfo.FilestoreNode
+		for _, cands := range [][]candidate{byName[filepath.Base(filepath.FromSlash(oldPath))], candidates} {
+			for _, c := range cands {
+				if uint64(c.size) < extent {
+					continue
+				}
+				if nodes = matchFilestoreEntries(c.path, entries); nodes != nil {
+					res.To, err = filepath.Rel(root, c.path)
+					if err != nil {
+						return err
+					}
+					res.To = filepath.ToSlash(res.To)
+					break
+				}
+			}
+			if nodes != nil {
+				break
+			}
+		}
+
+		if nodes == nil {
+			res.ErrorMsg = "no matching file found"
+		} else if err := fstore.FileManager().PutMany(ctx, nodes); err != nil {
+			return err
+		}
+		if err := emit(res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchFilestoreEntries returns the references to the blocks of entries in
+// the file at path, or nil if any of them can't be read there.
+func matchFilestoreEntries(path string, entries []filestoreEntry) []*posinfo.FilestoreNode {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	nodes := make([]*posinfo.FilestoreNode, 0, len(entries))
+	for _, e := range entries {
+		blk, ok := readFilestoreEntry(f, e)
+		if !ok {
+			return nil
+		}
+		nodes = append(nodes, &posinfo.FilestoreNode{
+			Node:    &merkledag.RawNode{Block: blk},
+			PosInfo: &posinfo.PosInfo{FullPath: path, Offset: e.offset},
+		})
+	}
+	return nodes
+}
+
+// FilestoreRemove drops filestore references, without touching the backing
+// files. arg is either a CID, whose own reference and the references of the
+// blocks of its DAG are dropped, or an absolute file or directory path or a URL, the
+// references to whose blocks are dropped. The dropped references are passed to emit.
+func FilestoreRemove(ctx context.Context, fstore *filestore.Filestore, dag ipld.DAGService, root, arg string, emit func(*filestore.ListRes) error) error {
+	fm := fstore.FileManager()
+	removed := 0
+	remove := func(c cid.Cid) error {
+		r := filestore.List(ctx, fstore, c)
+		if err := fm.DeleteBlock(ctx, c); err != nil {
+			return err
+		}
+		removed++
+		return emit(r)
+	}
+
+	if c, err := cid.Decode(arg); err == nil {
+		getLinks := func(ctx context.Context, c cid.Cid) ([]*ipld.Link, error) {
+			has, err := fm.Has(ctx, c)
+			if err != nil {
+				return nil, err
+			}
+			if has {
+				// Filestore blocks are leaves.
+				return nil, remove(c)
+			}
+			if c.Type() == cid.Raw {
+				return nil, nil
+			}
+			return ipld.GetLinks(ctx, dag, c)
+		}
+		if err := merkledag.Walk(ctx, getLinks, c, cid.NewSet().Visit); err != nil {
+			return err
+		}
+	} else {
+		// URL references are stored as is, file references relative to root.
+		rel := strings.TrimSuffix(arg, "/")
+		if !filestore.IsURL(arg) {
+			if !filepath.IsAbs(arg) {
+				return fmt.Errorf("%s is not an absolute path", arg)
+			}
+			var err error
+			if rel, err = filepath.Rel(root, filepath.Clean(arg)); err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+		}
+
+		next, err := filestore.ListAll(ctx, fstore, true)
+		if err != nil {
+			return err
+		}
+		var keys []cid.Cid
+		for r := next(ctx); r != nil; r = next(ctx) {
+			if r.FilePath == rel || strings.HasPrefix(r.FilePath, rel+"/") {
+				keys = append(keys, r.Key)
+			}
+		}
+		for _, c := range keys {
+			if err := remove(c); err != nil {
+				return err
+			}
+		}
+	}
+
+	if removed == 0 {
+		return fmt.Errorf("no filestore references to %s", arg)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package node
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfs/boxo/blockservice"
+	blockstore "github.com/ipfs/boxo/blockstore"
+	offline "github.com/ipfs/boxo/exchange/offline"
+	"github.com/ipfs/boxo/filestore"
+	"github.com/ipfs/boxo/filestore/posinfo"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+)
+
+func TestFilestoreReindexAndRemove(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	fm := filestore.NewFileManager(dstore, root)
+	fm.AllowFiles = true
+	fstore := filestore.NewFilestore(blockstore.NewBlockstore(dstore), fm)
+	dag := merkledag.NewDAGService(blockservice.New(fstore, offline.Exchange(fstore)))
+
+	// Add the two halves of a file, and a directory node linking to them.
+	data := []byte("hello filestore, hello reindex")
+	oldPath := filepath.Join(root, "a", "file.txt")
+	if err := os.MkdirAll(filepath.Dir(oldPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(oldPath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	parent := merkledag.NodeWithData(nil)
+	for i, part := range [][]byte{data[:15], data[15:]} {
+		nd := merkledag.NewRawNode(part)
+		err := fm.Put(ctx, &posinfo.FilestoreNode{
+			Node:    nd,
+			PosInfo: &posinfo.PosInfo{FullPath: oldPath, Offset: uint64(15 * i)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := parent.AddNodeLink(string(rune('a'+i)), nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dag.Add(ctx, parent); err != nil {
+		t.Fatal(err)
+	}
+
+	// Move the file, and add a decoy with the same name and size.
+	newPath := filepath.Join(root, "b", "c", "file.txt")
+	if err := os.MkdirAll(filepath.Dir(newPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(oldPath, newPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "b", "file.txt"), make([]byte, len(data)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var reindexed []*FilestoreReindexRes
+	err := FilestoreReindex(ctx, fstore, root, filepath.Join(root, "b"), func(r *FilestoreReindexRes) error {
+		reindexed = append(reindexed, r)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reindexed) != 1 || reindexed[0].From != "a/file.txt" || reindexed[0].To != "b/c/file.txt" || reindexed[0].Blocks != 2 {
+		t.Fatalf("unexpected reindex results: %+v", reindexed)
+	}
+	if err := merkledag.FetchGraph(ctx, parent.Cid(), dag); err != nil {
+		t.Fatalf("file not readable after reindexing: %s", err)
+	}
+
+	if err := FilestoreReindex(ctx, fstore, root, "/", nil); err == nil {
+		t.Fatal("expected an error for a directory outside of the root")
+	}
+	if err := FilestoreReindex(ctx, fstore, root, "b", nil); err == nil {
+		t.Fatal("expected an error for a relative path")
+	}
+
+	var removed int
+	count := func(*filestore.ListRes) error {
+		removed++
+		return nil
+	}
+	if err := FilestoreRemove(ctx, fstore, dag, root, "b", count); err == nil {
+		t.Fatal("expected an error for a relative path")
+	}
+	// Removing by directory drops the references to the files in it.
+	if err := FilestoreRemove(ctx, fstore, dag, root, filepath.Join(root, "b"), count); err != nil {
+		t.Fatal(err)
+	}
+	if removed != 2 {
+		t.Fatalf("expected 2 references removed, got %d", removed)
+	}
+	if err := FilestoreRemove(ctx, fstore, dag, root, newPath, count); err == nil {
+		t.Fatal("expected an error when there are no references left")
+	}
+
+	// Removing by CID drops the references of the whole DAG.
+	if err := fm.Put(ctx, &posinfo.FilestoreNode{
+		Node:    merkledag.NewRawNode(data[:15]),
+		PosInfo: &posinfo.PosInfo{FullPath: newPath, Offset: 0},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	removed = 0
+	if err := FilestoreRemove(ctx, fstore, dag, root, parent.Cid().String(), count); err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Fatalf("expected 1 reference removed, got %d", removed)
+	}
+}
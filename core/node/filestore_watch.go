@@ -0,0 +1,169 @@
+package node
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	fsnotify "github.com/fsnotify/fsnotify"
+	"github.com/ipfs/boxo/filestore"
+	cid "github.com/ipfs/go-cid"
+	"go.uber.org/fx"
+
+	"github.com/ipfs/kubo/core/node/helpers"
+	"github.com/ipfs/kubo/repo"
+)
+
+const (
+	// filestoreWatchRescanInterval is how often the filestore references are
+	// listed again, so that the files added since are watched too.
+	filestoreWatchRescanInterval = 10 * time.Minute
+	// filestoreWatchDelay is how long the changes to files are collected
+	// before their references are checked, so that a file being written is
+	// checked once.
+	filestoreWatchDelay = time.Second
+)
+
+// filestoreWatcher drops the filestore references to blocks whose backing file
+// is changed or removed, as reported by fsnotify.
+type filestoreWatcher struct {
+	fstore  *filestore.Filestore
+	root    string
+	watcher *fsnotify.Watcher
+
+	// refs are the references to the blocks of each backing file, by path
+	// relative to root, as of the last scan.
+	refs map[string][]cid.Cid
+	dirs map[string]struct{}
+}
+
+// FilestoreWatcher watches the directories of the filestore backing files
+// when Experimental.FilestoreWatch is set.
+func FilestoreWatcher(mctx helpers.MetricsCtx, lc fx.Lifecycle, r repo.Repo, fstore *filestore.Filestore) error {
+	root, err := FilestoreRoot(r)
+	if err != nil {
+		return err
+	}
+	ctx := helpers.LifecycleCtx(mctx, lc)
+
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			watcher, err := fsnotify.NewWatcher()
+			if err != nil {
+				return err
+			}
+			w := &filestoreWatcher{
+				fstore:  fstore,
+				root:    root,
+				watcher: watcher,
+				dirs:    make(map[string]struct{}),
+			}
+			go w.run(ctx)
+			return nil
+		},
+	})
+	return nil
+}
+
+func (w *filestoreWatcher) run(ctx context.Context) {
+	defer w.watcher.Close()
+
+	rescan := time.NewTicker(filestoreWatchRescanInterval)
+	defer rescan.Stop()
+	delay := time.NewTimer(filestoreWatchDelay)
+	delay.Stop()
+	changed := make(map[string]struct{})
+
+	w.scan(ctx)
+	for {
+		select {
+		case e := <-w.watcher.Events:
+			if e.Op == fsnotify.Chmod {
+				continue
+			}
+			rel, err := filepath.Rel(w.root, e.Name)
+			if err != nil {
+				continue
+			}
+			rel = filepath.ToSlash(rel)
+			if _, ok := w.refs[rel]; !ok {
+				continue
+			}
+			if len(changed) == 0 {
+				delay.Reset(filestoreWatchDelay)
+			}
+			changed[rel] = struct{}{}
+		case <-delay.C:
+			for rel := range changed {
+				w.check(ctx, rel)
+			}
+			changed = make(map[string]struct{})
+		case err := <-w.watcher.Errors:
+			logger.Warnf("filestore watcher: %s", err)
+		case <-rescan.C:
+			w.scan(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// scan lists the filestore references and watches the directories of their
+// backing files.
+func (w *filestoreWatcher) scan(ctx context.Context) {
+	next, err := filestore.ListAll(ctx, w.fstore, false)
+	if err != nil {
+		logger.Errorf("filestore watcher: listing references: %s", err)
+		return
+	}
+	refs := make(map[string][]cid.Cid)
+	for r := next(ctx); r != nil; r = next(ctx) {
+		if r.Status != filestore.StatusOk || filestore.IsURL(r.FilePath) {
+			continue
+		}
+		refs[r.FilePath] = append(refs[r.FilePath], r.Key)
+	}
+	w.refs = refs
+
+	for rel := range refs {
+		dir := filepath.Dir(filepath.Join(w.root, filepath.FromSlash(rel)))
+		if _, ok := w.dirs[dir]; ok {
+			continue
+		}
+		if err := w.watcher.Add(dir); err != nil {
+			logger.Warnf("filestore watcher: watching %s: %s", dir, err)
+			continue
+		}
+		w.dirs[dir] = struct{}{}
+	}
+}
+
+// check drops the references to the blocks of the file rel that can no longer
+// be read from it.
+func (w *filestoreWatcher) check(ctx context.Context, rel string) {
+	var kept []cid.Cid
+	for _, c := range w.refs[rel] {
+		r := filestore.Verify(ctx, w.fstore, c)
+		switch r.Status {
+		case filestore.StatusFileNotFound, filestore.StatusFileChanged:
+			if r.FilePath != rel {
+				// Reindexed to another file since the scan.
+				continue
+			}
+			if err := w.fstore.FileManager().DeleteBlock(ctx, c); err != nil {
+				logger.Errorf("filestore watcher: dropping reference to %s: %s", c, err)
+				kept = append(kept, c)
+				continue
+			}
+			logger.Infof("filestore watcher: dropped reference to %s, %s changed", c, rel)
+		case filestore.StatusKeyNotFound:
+		default:
+			kept = append(kept, c)
+		}
+	}
+	if len(kept) == 0 {
+		delete(w.refs, rel)
+	} else {
+		w.refs[rel] = kept
+	}
+}
@@ -42,16 +42,46 @@ func LibP2P(bcfg *BuildCfg, cfg *config.Config, userResourceOverrides rcmgr.Part
 	connMgrType := cfg.Swarm.ConnMgr.Type.WithDefault(config.DefaultConnMgrType)
 	switch connMgrType {
 	case "none":
+		if len(cfg.Swarm.ConnMgr.Rules) > 0 {
+			return fx.Error(fmt.Errorf("Swarm.ConnMgr.Rules require the basic connection manager, but Swarm.ConnMgr.Type is %q", connMgrType))
+		}
 		connmgr = fx.Options() // noop
 	case "", "basic":
 		grace := cfg.Swarm.ConnMgr.GracePeriod.WithDefault(config.DefaultConnMgrGracePeriod)
 		low := int(cfg.Swarm.ConnMgr.LowWater.WithDefault(config.DefaultConnMgrLowWater))
 		high := int(cfg.Swarm.ConnMgr.HighWater.WithDefault(config.DefaultConnMgrHighWater))
-		connmgr = fx.Provide(libp2p.ConnectionManager(low, high, grace))
+		connmgr = fx.Options(
+			fx.Provide(libp2p.ConnectionManager(low, high, grace)),
+			maybeProvide(libp2p.ConnectionManagerRules(cfg.Swarm.ConnMgr.Rules), len(cfg.Swarm.ConnMgr.Rules) > 0),
+		)
 	default:
 		return fx.Error(fmt.Errorf("unrecognized Swarm.ConnMgr.Type: %q", connMgrType))
 	}
 
+	rep, err := libp2p.ReputationTracker(cfg.Swarm.Reputation)
+	if err != nil {
+		return fx.Error(err)
+	}
+	reputation := fx.Options()
+	if rep != nil {
+		reputation = fx.Options(
+			fx.Supply(rep),
+			fx.Invoke(libp2p.ReputationBans(rep)),
+		)
+	}
+
+	// LAN mode, set by the daemon for Routing.Type = "lan"
+	lan := bcfg.getOpt("lan")
+	mdnsServiceTag := cfg.Discovery.MDNS.ServiceTag.WithDefault(config.DefaultMDNSServiceTag)
+	lanMode := fx.Options()
+	if lan {
+		info := &libp2p.LAN{}
+		if cfg.Discovery.MDNS.Enabled {
+			info.MDNSServiceTag = mdnsServiceTag
+		}
+		lanMode = fx.Supply(info)
+	}
+
 	// parse PubSub config
 
 	ps, disc := fx.Options(), fx.Options()
@@ -77,16 +107,29 @@ func LibP2P(bcfg *BuildCfg, cfg *config.Config, userResourceOverrides rcmgr.Part
 		}
 		pubsubOptions = append(pubsubOptions, pubsub.WithSeenMessagesStrategy(seenMessagesStrategy))
 
+		tracer := libp2p.NewPubsubTracer()
+		if rep != nil {
+			pubsubOptions = append(pubsubOptions, libp2p.ReputationPubsubTracing(rep)...)
+		}
+
 		switch cfg.Pubsub.Router {
 		case "":
 			fallthrough
 		case "gossipsub":
+			pubsubOptions = append(pubsubOptions, libp2p.PubsubTracing(tracer, cfg.Pubsub.PeerScoring.WithDefault(false))...)
 			ps = fx.Provide(libp2p.GossipSub(pubsubOptions...))
 		case "floodsub":
+			pubsubOptions = append(pubsubOptions, libp2p.PubsubTracing(tracer, false)...)
 			ps = fx.Provide(libp2p.FloodSub(pubsubOptions...))
 		default:
 			return fx.Error(fmt.Errorf("unknown pubsub router %s", cfg.Pubsub.Router))
 		}
+		ps = fx.Options(
+			ps,
+			fx.Supply(tracer),
+			fx.Invoke(libp2p.PubsubTopicValidators(cfg.Pubsub.Topics)),
+			fx.Provide(libp2p.DurablePubsub(cfg.Pubsub.Topics)),
+		)
 	}
 
 	autonat := fx.Options()
@@ -130,15 +173,15 @@ func LibP2P(bcfg *BuildCfg, cfg *config.Config, userResourceOverrides rcmgr.Part
 		fx.Provide(libp2p.UserAgent()),
 
 		// Services (resource management)
-		fx.Provide(libp2p.ResourceManager(cfg.Swarm, userResourceOverrides)),
-		fx.Provide(libp2p.AddrFilters(cfg.Swarm.AddrFilters)),
-		fx.Provide(libp2p.AddrsFactory(cfg.Addresses.Announce, cfg.Addresses.AppendAnnounce, cfg.Addresses.NoAnnounce)),
+		fx.Provide(libp2p.ResourceManager(cfg.Swarm, userResourceOverrides, rep)),
+		fx.Provide(libp2p.AddrFilters(cfg.Swarm.AddrFilters, rep)),
+		fx.Provide(libp2p.AddrsFactory(cfg.Addresses.Announce, cfg.Addresses.AppendAnnounce, cfg.Addresses.NoAnnounce, lan)),
 		fx.Provide(libp2p.SmuxTransport(cfg.Swarm.Transports)),
 		fx.Provide(libp2p.RelayTransport(enableRelayTransport)),
 		fx.Provide(libp2p.RelayService(enableRelayService, cfg.Swarm.RelayService)),
 		fx.Provide(libp2p.Transports(cfg.Swarm.Transports)),
 		fx.Provide(libp2p.ListenOn(cfg.Addresses.Swarm)),
-		fx.Invoke(libp2p.SetupDiscovery(cfg.Discovery.MDNS.Enabled)),
+		fx.Invoke(libp2p.SetupDiscovery(cfg.Discovery.MDNS.Enabled, mdnsServiceTag)),
 		fx.Provide(libp2p.ForceReachability(cfg.Internal.Libp2pForceReachability)),
 		fx.Provide(libp2p.HolePunching(cfg.Swarm.EnableHolePunching, enableRelayClient)),
 
@@ -155,6 +198,8 @@ func LibP2P(bcfg *BuildCfg, cfg *config.Config, userResourceOverrides rcmgr.Part
 		libp2p.MaybeAutoRelay(cfg.Swarm.RelayClient.StaticRelays, cfg.Peering, enableRelayClient),
 		autonat,
 		connmgr,
+		reputation,
+		lanMode,
 		ps,
 		disc,
 	)
@@ -270,16 +315,23 @@ func Online(bcfg *BuildCfg, cfg *config.Config, userResourceOverrides rcmgr.Part
 	shouldBitswapProvide := !cfg.Experimental.StrategicProviding
 
 	return fx.Options(
+		BitswapServePolicy(cfg.Bitswap),
 		fx.Provide(BitswapOptions(cfg, shouldBitswapProvide)),
-		fx.Provide(OnlineExchange()),
+		fx.Provide(OnlineExchange(cfg.Bitswap)),
+		maybeProvide(ServerOnlyExchange, cfg.Bitswap.Mode.WithDefault(config.DefaultBitswapMode) == "server"),
 		fx.Provide(DNSResolver),
+		fx.Provide(MultiaddrDNSResolver),
 		fx.Provide(Namesys(ipnsCacheSize, cfg.Ipns.MaxCacheTTL.WithDefault(config.DefaultIpnsMaxCacheTTL))),
 		fx.Provide(Peering),
-		PeerWith(cfg.Peering.Peers...),
+		fx.Provide(PeeringGroups(cfg.Peering)),
+		maybeProvide(libp2p.RendezvousService(cfg.Discovery.Rendezvous), cfg.Discovery.Rendezvous.Enabled.WithDefault(config.DefaultRendezvousEnabled)),
 
 		fx.Invoke(IpnsRepublisher(repubPeriod, recordLifetime)),
 
 		fx.Provide(p2p.New),
+		maybeInvoke(P2PListeners(cfg.P2P.Listeners), cfg.Experimental.Libp2pStreamMounting),
+		maybeInvoke(P2PForwards(cfg.P2P.Forwards), cfg.Experimental.Libp2pStreamMounting),
+		maybeInvoke(FilestoreWatcher, cfg.Experimental.FilestoreEnabled && cfg.Experimental.FilestoreWatch),
 
 		LibP2P(bcfg, cfg, userResourceOverrides),
 		OnlineProviders(
@@ -296,6 +348,7 @@ func Offline(cfg *config.Config) fx.Option {
 	return fx.Options(
 		fx.Provide(offline.Exchange),
 		fx.Provide(DNSResolver),
+		fx.Provide(MultiaddrDNSResolver),
 		fx.Provide(Namesys(0, 0)),
 		fx.Provide(libp2p.Routing),
 		fx.Provide(libp2p.ContentRouting),
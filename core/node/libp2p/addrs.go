@@ -2,17 +2,20 @@ package libp2p
 
 import (
 	"fmt"
+	"sort"
 
+	"github.com/ipfs/kubo/reputation"
 	"github.com/libp2p/go-libp2p"
 	p2pbhost "github.com/libp2p/go-libp2p/p2p/host/basic"
 	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
 	mamask "github.com/whyrusleeping/multiaddr-filter"
 )
 
-func AddrFilters(filters []string) func() (*ma.Filters, Libp2pOpts, error) {
+func AddrFilters(filters []string, rep *reputation.Tracker) func() (*ma.Filters, Libp2pOpts, error) {
 	return func() (filter *ma.Filters, opts Libp2pOpts, err error) {
 		filter = ma.NewFilters()
-		opts.Opts = append(opts.Opts, libp2p.ConnectionGater((*filtersConnectionGater)(filter)))
+		opts.Opts = append(opts.Opts, libp2p.ConnectionGater(&filtersConnectionGater{filters: filter, reputation: rep}))
 		for _, s := range filters {
 			f, err := mamask.NewMask(s)
 			if err != nil {
@@ -24,7 +27,7 @@ func AddrFilters(filters []string) func() (*ma.Filters, Libp2pOpts, error) {
 	}
 }
 
-func makeAddrsFactory(announce []string, appendAnnouce []string, noAnnounce []string) (p2pbhost.AddrsFactory, error) {
+func makeAddrsFactory(announce []string, appendAnnouce []string, noAnnounce []string, preferLocal bool) (p2pbhost.AddrsFactory, error) {
 	var err error                     // To assign to the slice in the for loop
 	existing := make(map[string]bool) // To avoid duplicates
 
@@ -83,13 +86,34 @@ func makeAddrsFactory(announce []string, appendAnnouce []string, noAnnounce []st
 				out = append(out, maddr)
 			}
 		}
+		if preferLocal {
+			sort.SliceStable(out, func(i, j int) bool {
+				return localAddrRank(out[i]) < localAddrRank(out[j])
+			})
+		}
 		return out
 	}, nil
 }
 
-func AddrsFactory(announce []string, appendAnnouce []string, noAnnounce []string) func() (opts Libp2pOpts, err error) {
+// localAddrRank orders addresses for local networks: private and link-local
+// addresses first, then public ones, and loopback ones last as they are only
+// useful on the same machine.
+func localAddrRank(maddr ma.Multiaddr) int {
+	switch {
+	case manet.IsIPLoopback(maddr):
+		return 2
+	case manet.IsPrivateAddr(maddr):
+		return 0
+	default:
+		return 1
+	}
+}
+
+// AddrsFactory announces the addresses configured in Addresses. In LAN mode,
+// preferLocal moves private and link-local addresses first.
+func AddrsFactory(announce []string, appendAnnouce []string, noAnnounce []string, preferLocal bool) func() (opts Libp2pOpts, err error) {
 	return func() (opts Libp2pOpts, err error) {
-		addrsFactory, err := makeAddrsFactory(announce, appendAnnouce, noAnnounce)
+		addrsFactory, err := makeAddrsFactory(announce, appendAnnouce, noAnnounce, preferLocal)
 		if err != nil {
 			return opts, err
 		}
@@ -0,0 +1,254 @@
+package libp2p
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	bsmsg "github.com/ipfs/boxo/bitswap/message"
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/core/node/helpers"
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	manet "github.com/multiformats/go-multiaddr/net"
+	mamask "github.com/whyrusleeping/multiaddr-filter"
+	"go.uber.org/fx"
+)
+
+// connMgrRulesInterval is how often the rules are applied to all the
+// connected peers, so that ProvidedWithin expires.
+const connMgrRulesInterval = 30 * time.Second
+
+// connMgrRule is a parsed Swarm.ConnMgr.Rules entry.
+type connMgrRule struct {
+	tag            string
+	agentPrefix    string
+	networks       []*net.IPNet
+	providedWithin time.Duration
+	weight         int
+	protect        bool
+}
+
+// ConnMgrRules tags the peers matching Swarm.ConnMgr.Rules in the connection
+// manager. It is a bitswap tracer, to learn which peers sent us blocks we
+// wanted.
+type ConnMgrRules struct {
+	host  host.Host
+	rules []connMgrRule
+
+	mu sync.Mutex
+	// wantlist returns the local bitswap wantlist.
+	wantlist func() []cid.Cid
+	// provided is when peers last sent us blocks.
+	provided map[peer.ID]time.Time
+	// maxProvidedWithin is how long provided entries are useful.
+	maxProvidedWithin time.Duration
+}
+
+// ConnectionManagerRules applies Swarm.ConnMgr.Rules.
+func ConnectionManagerRules(rules []config.ConnMgrRule) func(helpers.MetricsCtx, fx.Lifecycle, host.Host) (*ConnMgrRules, error) {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, h host.Host) (*ConnMgrRules, error) {
+		cr, err := newConnMgrRules(h, rules)
+		if err != nil {
+			return nil, err
+		}
+		sub, err := h.EventBus().Subscribe(new(event.EvtPeerIdentificationCompleted))
+		if err != nil {
+			return nil, err
+		}
+
+		ctx, cancel := context.WithCancel(helpers.LifecycleCtx(mctx, lc))
+		done := make(chan struct{})
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go func() {
+					defer close(done)
+					cr.run(ctx, sub)
+				}()
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				cancel()
+				<-done
+				return sub.Close()
+			},
+		})
+		return cr, nil
+	}
+}
+
+func newConnMgrRules(h host.Host, rules []config.ConnMgrRule) (*ConnMgrRules, error) {
+	cr := &ConnMgrRules{
+		host:     h,
+		provided: make(map[peer.ID]time.Time),
+	}
+	names := make(map[string]struct{}, len(rules))
+	for i, r := range rules {
+		if r.Name == "" {
+			return nil, fmt.Errorf("Swarm.ConnMgr.Rules[%d]: missing Name", i)
+		}
+		if _, ok := names[r.Name]; ok {
+			return nil, fmt.Errorf("Swarm.ConnMgr.Rules[%d]: duplicate Name %q", i, r.Name)
+		}
+		names[r.Name] = struct{}{}
+
+		rule := connMgrRule{
+			tag:            "rule:" + r.Name,
+			agentPrefix:    r.AgentVersionPrefix.WithDefault(""),
+			providedWithin: r.ProvidedWithin.WithDefault(0),
+			weight:         int(r.Weight.WithDefault(config.DefaultConnMgrRuleWeight)),
+			protect:        r.Protect.WithDefault(false),
+		}
+		for _, s := range r.Networks {
+			ipnet, err := mamask.NewMask(s)
+			if err != nil {
+				return nil, fmt.Errorf("Swarm.ConnMgr.Rules[%d]: invalid network %q: %w", i, s, err)
+			}
+			rule.networks = append(rule.networks, ipnet)
+		}
+		if rule.agentPrefix == "" && len(rule.networks) == 0 && rule.providedWithin <= 0 {
+			return nil, fmt.Errorf("Swarm.ConnMgr.Rules[%d]: rule %q has no condition, set AgentVersionPrefix, Networks or ProvidedWithin", i, r.Name)
+		}
+		cr.maxProvidedWithin = max(cr.maxProvidedWithin, rule.providedWithin)
+		cr.rules = append(cr.rules, rule)
+	}
+	return cr, nil
+}
+
+func (cr *ConnMgrRules) run(ctx context.Context, sub event.Subscription) {
+	ticker := time.NewTicker(connMgrRulesInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case e := <-sub.Out():
+			cr.apply(e.(event.EvtPeerIdentificationCompleted).Peer)
+		case <-ticker.C:
+			cr.expire()
+			for _, p := range cr.host.Network().Peers() {
+				cr.apply(p)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// expire forgets the peers that sent us blocks too long ago to match any
+// rule.
+func (cr *ConnMgrRules) expire() {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	for p, t := range cr.provided {
+		if time.Since(t) > cr.maxProvidedWithin {
+			delete(cr.provided, p)
+		}
+	}
+}
+
+// apply tags or untags p for each rule.
+func (cr *ConnMgrRules) apply(p peer.ID) {
+	cm := cr.host.ConnManager()
+	for _, r := range cr.rules {
+		if cr.matches(r, p) {
+			cm.TagPeer(p, r.tag, r.weight)
+			if r.protect {
+				cm.Protect(p, r.tag)
+			}
+		} else {
+			cm.UntagPeer(p, r.tag)
+			cm.Unprotect(p, r.tag)
+		}
+	}
+}
+
+func (cr *ConnMgrRules) matches(r connMgrRule, p peer.ID) bool {
+	if r.agentPrefix != "" {
+		av, _ := cr.host.Peerstore().Get(p, "AgentVersion")
+		if s, _ := av.(string); !strings.HasPrefix(s, r.agentPrefix) {
+			return false
+		}
+	}
+	if len(r.networks) > 0 && !cr.inNetworks(r.networks, p) {
+		return false
+	}
+	if r.providedWithin > 0 {
+		cr.mu.Lock()
+		t, ok := cr.provided[p]
+		cr.mu.Unlock()
+		if !ok || time.Since(t) > r.providedWithin {
+			return false
+		}
+	}
+	return true
+}
+
+// inNetworks reports whether one of the connections to p is from an address
+// in networks.
+func (cr *ConnMgrRules) inNetworks(networks []*net.IPNet, p peer.ID) bool {
+	for _, c := range cr.host.Network().ConnsToPeer(p) {
+		ip, err := manet.ToIP(c.RemoteMultiaddr())
+		if err != nil {
+			continue
+		}
+		for _, n := range networks {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetWantlist sets the function returning the local bitswap wantlist. Blocks
+// are only credited to peers once it is set.
+func (cr *ConnMgrRules) SetWantlist(wantlist func() []cid.Cid) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	cr.wantlist = wantlist
+}
+
+// wanted reports whether one of blks is in the local wantlist. Bitswap calls
+// its tracer before processing the message, so the blocks are still wanted.
+func (cr *ConnMgrRules) wanted(blks []blocks.Block) bool {
+	cr.mu.Lock()
+	wantlist := cr.wantlist
+	cr.mu.Unlock()
+	if wantlist == nil {
+		return false
+	}
+	received := make(map[cid.Cid]struct{}, len(blks))
+	for _, b := range blks {
+		received[b.Cid()] = struct{}{}
+	}
+	for _, c := range wantlist() {
+		if _, ok := received[c]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// MessageReceived implements the bitswap tracer interface. Unsolicited blocks
+// are not credited.
+func (cr *ConnMgrRules) MessageReceived(p peer.ID, msg bsmsg.BitSwapMessage) {
+	if cr.maxProvidedWithin <= 0 || len(msg.Blocks()) == 0 || !cr.wanted(msg.Blocks()) {
+		return
+	}
+	cr.mu.Lock()
+	_, known := cr.provided[p]
+	cr.provided[p] = time.Now()
+	cr.mu.Unlock()
+	if !known && cr.host.Network().Connectedness(p) == network.Connected {
+		cr.apply(p)
+	}
+}
+
+// MessageSent implements the bitswap tracer interface.
+func (cr *ConnMgrRules) MessageSent(peer.ID, bsmsg.BitSwapMessage) {}
@@ -0,0 +1,117 @@
+package libp2p
+
+import (
+	"testing"
+	"time"
+
+	bsmsg "github.com/ipfs/boxo/bitswap/message"
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/kubo/config"
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	bcm "github.com/libp2p/go-libp2p/p2p/net/connmgr"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	manet "github.com/multiformats/go-multiaddr/net"
+	"github.com/stretchr/testify/require"
+)
+
+// connMgrHost replaces the null connection manager of mocknet hosts.
+type connMgrHost struct {
+	host.Host
+	cm connmgr.ConnManager
+}
+
+func (h connMgrHost) ConnManager() connmgr.ConnManager { return h.cm }
+
+func TestConnMgrRules(t *testing.T) {
+	require := require.New(t)
+
+	mn, err := mocknet.FullMeshConnected(3)
+	require.NoError(err)
+	defer mn.Close()
+	hosts := mn.Hosts()
+	a, b, c := hosts[0], hosts[1], hosts[2]
+
+	cm, err := bcm.NewConnManager(1, 10)
+	require.NoError(err)
+	defer cm.Close()
+	h := connMgrHost{Host: a, cm: cm}
+	tags := func(p peer.ID) map[string]int {
+		if ti := cm.GetTagInfo(p); ti != nil && len(ti.Tags) > 0 {
+			return ti.Tags
+		}
+		return nil
+	}
+
+	_, err = newConnMgrRules(h, []config.ConnMgrRule{{Name: "empty"}})
+	require.Error(err)
+	_, err = newConnMgrRules(h, []config.ConnMgrRule{{Name: "bad", Networks: []string{"10.0.0.0/8"}}})
+	require.Error(err)
+
+	// The network of b's address, as seen by a. Mocknet peers have IPv6
+	// addresses.
+	ip, err := manet.ToIP(a.Network().ConnsToPeer(b.ID())[0].RemoteMultiaddr())
+	require.NoError(err)
+	network := "/ip6/" + ip.String() + "/ipcidr/128"
+
+	cr, err := newConnMgrRules(h, []config.ConnMgrRule{
+		{
+			Name:               "kubo",
+			AgentVersionPrefix: config.NewOptionalString("kubo/"),
+			Protect:            config.True,
+		},
+		{
+			Name:     "network",
+			Networks: []string{network},
+			Weight:   config.NewOptionalInteger(7),
+		},
+		{
+			Name:           "providers",
+			ProvidedWithin: config.NewOptionalDuration(time.Minute),
+		},
+	})
+	require.NoError(err)
+
+	require.NoError(a.Peerstore().Put(b.ID(), "AgentVersion", "kubo/0.27.0"))
+	require.NoError(a.Peerstore().Put(c.ID(), "AgentVersion", "other/1.0"))
+	cr.apply(b.ID())
+	cr.apply(c.ID())
+
+	require.Equal(map[string]int{"rule:kubo": config.DefaultConnMgrRuleWeight, "rule:network": 7}, tags(b.ID()))
+	require.True(cm.IsProtected(b.ID(), "rule:kubo"))
+	require.Empty(tags(c.ID()))
+	require.False(cm.IsProtected(c.ID(), ""))
+
+	// Unsolicited blocks are not credited.
+	blk := blocks.NewBlock([]byte("block"))
+	msg := bsmsg.New(false)
+	msg.AddBlock(blk)
+	cr.MessageReceived(c.ID(), msg)
+	require.Empty(tags(c.ID()))
+	var wantlist []cid.Cid
+	cr.SetWantlist(func() []cid.Cid { return wantlist })
+	cr.MessageReceived(c.ID(), msg)
+	require.Empty(tags(c.ID()))
+	require.Empty(cr.provided)
+
+	// Peers sending wanted blocks match ProvidedWithin until it elapses.
+	wantlist = []cid.Cid{blocks.NewBlock([]byte("other")).Cid(), blk.Cid()}
+	cr.MessageReceived(c.ID(), msg)
+	require.Equal(map[string]int{"rule:providers": config.DefaultConnMgrRuleWeight}, tags(c.ID()))
+
+	cr.mu.Lock()
+	cr.provided[c.ID()] = time.Now().Add(-2 * time.Minute)
+	cr.mu.Unlock()
+	cr.expire()
+	cr.apply(c.ID())
+	require.Empty(tags(c.ID()))
+	require.Empty(cr.provided)
+
+	// Rules stop matching peers that changed.
+	require.NoError(a.Peerstore().Put(b.ID(), "AgentVersion", "other/1.0"))
+	cr.apply(b.ID())
+	require.False(cm.IsProtected(b.ID(), ""))
+	require.Equal(map[string]int{"rule:network": 7}, tags(b.ID()))
+}
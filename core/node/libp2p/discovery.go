@@ -36,10 +36,11 @@ func DiscoveryHandler(mctx helpers.MetricsCtx, lc fx.Lifecycle, host host.Host)
 	}
 }
 
-func SetupDiscovery(useMdns bool) func(helpers.MetricsCtx, fx.Lifecycle, host.Host, *discoveryHandler) error {
+// SetupDiscovery starts mDNS discovery under serviceTag when useMdns is set.
+func SetupDiscovery(useMdns bool, serviceTag string) func(helpers.MetricsCtx, fx.Lifecycle, host.Host, *discoveryHandler) error {
 	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, host host.Host, handler *discoveryHandler) error {
 		if useMdns {
-			service := mdns.NewMdnsService(host, mdns.ServiceName, handler)
+			service := mdns.NewMdnsService(host, serviceTag, handler)
 			if err := service.Start(); err != nil {
 				log.Error("error starting mdns service: ", err)
 				return nil
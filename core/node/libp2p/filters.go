@@ -1,6 +1,7 @@
 package libp2p
 
 import (
+	"github.com/ipfs/kubo/reputation"
 	"github.com/libp2p/go-libp2p/core/connmgr"
 	"github.com/libp2p/go-libp2p/core/control"
 	"github.com/libp2p/go-libp2p/core/network"
@@ -10,25 +11,29 @@ import (
 )
 
 // filtersConnectionGater is an adapter that turns multiaddr.Filter into a
-// connmgr.ConnectionGater.
-type filtersConnectionGater ma.Filters
+// connmgr.ConnectionGater. It also refuses the peers banned by the reputation
+// subsystem, since libp2p takes a single connection gater.
+type filtersConnectionGater struct {
+	filters    *ma.Filters
+	reputation *reputation.Tracker // nil unless Swarm.Reputation is enabled
+}
 
 var _ connmgr.ConnectionGater = (*filtersConnectionGater)(nil)
 
-func (f *filtersConnectionGater) InterceptAddrDial(_ peer.ID, addr ma.Multiaddr) (allow bool) {
-	return !(*ma.Filters)(f).AddrBlocked(addr)
+func (f *filtersConnectionGater) InterceptAddrDial(p peer.ID, addr ma.Multiaddr) (allow bool) {
+	return !f.filters.AddrBlocked(addr) && !f.reputation.Banned(p)
 }
 
 func (f *filtersConnectionGater) InterceptPeerDial(p peer.ID) (allow bool) {
-	return true
+	return !f.reputation.Banned(p)
 }
 
 func (f *filtersConnectionGater) InterceptAccept(connAddr network.ConnMultiaddrs) (allow bool) {
-	return !(*ma.Filters)(f).AddrBlocked(connAddr.RemoteMultiaddr())
+	return !f.filters.AddrBlocked(connAddr.RemoteMultiaddr())
 }
 
-func (f *filtersConnectionGater) InterceptSecured(_ network.Direction, _ peer.ID, connAddr network.ConnMultiaddrs) (allow bool) {
-	return !(*ma.Filters)(f).AddrBlocked(connAddr.RemoteMultiaddr())
+func (f *filtersConnectionGater) InterceptSecured(_ network.Direction, p peer.ID, connAddr network.ConnMultiaddrs) (allow bool) {
+	return !f.filters.AddrBlocked(connAddr.RemoteMultiaddr()) && !f.reputation.Banned(p)
 }
 
 func (f *filtersConnectionGater) InterceptUpgraded(_ network.Conn) (allow bool, reason control.DisconnectReason) {
@@ -13,6 +13,7 @@ import (
 
 	"github.com/ipfs/kubo/core/node/helpers"
 	"github.com/ipfs/kubo/repo"
+	"github.com/ipfs/kubo/reputation"
 
 	"go.uber.org/fx"
 )
@@ -26,6 +27,7 @@ type P2PHostIn struct {
 	RoutingOption RoutingOption
 	ID            peer.ID
 	Peerstore     peerstore.Peerstore
+	Reputation    *reputation.Tracker `optional:"true"`
 
 	Opts [][]libp2p.Option `group:"libp2p"`
 }
@@ -53,9 +55,16 @@ func Host(mctx helpers.MetricsCtx, lc fx.Lifecycle, params P2PHostIn) (out P2PHo
 		return out, err
 	}
 
+	// Only repos stored on disk have a path.
+	var repoPath string
+	if pr, ok := params.Repo.(interface{ Path() string }); ok {
+		repoPath = pr.Path()
+	}
+
 	routingOptArgs := RoutingOptionArgs{
 		Ctx:                           ctx,
 		Datastore:                     params.Repo.Datastore(),
+		RepoPath:                      repoPath,
 		Validator:                     params.Validator,
 		BootstrapPeers:                bootstrappers,
 		OptimisticProvide:             cfg.Experimental.OptimisticProvide,
@@ -64,6 +73,9 @@ func Host(mctx helpers.MetricsCtx, lc fx.Lifecycle, params P2PHostIn) (out P2PHo
 	opts = append(opts, libp2p.Routing(func(h host.Host) (routing.PeerRouting, error) {
 		args := routingOptArgs
 		args.Host = h
+		if params.Reputation != nil {
+			args.Host = ReputationDHTHost(h, params.Reputation, params.Validator)
+		}
 		r, err := params.RoutingOption(args)
 		out.Routing = r
 		return r, err
@@ -1,9 +1,12 @@
 package libp2p
 
 import (
+	"time"
+
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	"github.com/libp2p/go-libp2p/core/discovery"
 	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
 	"go.uber.org/fx"
 
 	"github.com/ipfs/kubo/core/node/helpers"
@@ -24,3 +27,44 @@ func GossipSub(pubsubOptions ...pubsub.Option) interface{} {
 		)
 	}
 }
+
+// PubsubTracing returns the options hooking tracer into pubsub. When
+// peerScoring is set, gossipsub peer scoring is enabled and the scores are
+// reported to the tracer; this must only be used with the gossipsub router.
+func PubsubTracing(tracer *PubsubTracer, peerScoring bool) []pubsub.Option {
+	opts := []pubsub.Option{pubsub.WithRawTracer(tracer)}
+	if peerScoring {
+		opts = append(
+			opts,
+			pubsub.WithPeerScore(peerScoreParams(), peerScoreThresholds()),
+			pubsub.WithPeerScoreInspect(pubsub.PeerScoreInspectFn(tracer.updateScores), pubsubScoreInspectPeriod),
+		)
+	}
+	return opts
+}
+
+// peerScoreParams only penalize misbehaving peers: peers that don't follow up
+// on the messages they advertised, or that flap GRAFT/PRUNE. Well-behaved
+// peers keep a score of zero.
+func peerScoreParams() *pubsub.PeerScoreParams {
+	return &pubsub.PeerScoreParams{
+		Topics:                    make(map[string]*pubsub.TopicScoreParams),
+		AppSpecificScore:          func(peer.ID) float64 { return 0 },
+		BehaviourPenaltyWeight:    -10,
+		BehaviourPenaltyThreshold: 6,
+		BehaviourPenaltyDecay:     pubsub.ScoreParameterDecay(10 * time.Minute),
+		DecayInterval:             pubsub.DefaultDecayInterval,
+		DecayToZero:               pubsub.DefaultDecayToZero,
+		RetainScore:               time.Hour,
+	}
+}
+
+func peerScoreThresholds() *pubsub.PeerScoreThresholds {
+	return &pubsub.PeerScoreThresholds{
+		GossipThreshold:             -500,
+		PublishThreshold:            -1000,
+		GraylistThreshold:           -2500,
+		AcceptPXThreshold:           1000,
+		OpportunisticGraftThreshold: 3.5,
+	}
+}
@@ -0,0 +1,370 @@
+package libp2p
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"go.uber.org/fx"
+
+	config "github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/core/node/helpers"
+	"github.com/ipfs/kubo/repo"
+)
+
+var pubsubBufferPrefix = ds.NewKey("/pubsub/buffer")
+
+// pubsubBufferPruneInterval is how often messages older than the retention age
+// are removed from the buffers.
+const pubsubBufferPruneInterval = time.Minute
+
+// ErrSubscriberTooSlow is returned by BufferSubscription.Next when the
+// subscriber did not keep up with the messages published on the topic. The
+// missed messages can be replayed from the buffer by subscribing again.
+var ErrSubscriberTooSlow = errors.New("subscriber fell behind, resubscribe to replay missed messages")
+
+// BufferedMessage is a pubsub message stored in the buffer of a durable topic.
+type BufferedMessage struct {
+	// Seq is the position of the message in the topic buffer. It increases
+	// monotonically and is preserved across daemon restarts.
+	Seq      uint64
+	From     peer.ID `json:",omitempty"`
+	Data     []byte
+	Seqno    []byte
+	Topic    string
+	Received time.Time
+}
+
+// PubsubBuffer keeps the messages received on durable topics in the repo
+// datastore, so that subscribers can replay what they missed while
+// disconnected before streaming new messages.
+type PubsubBuffer struct {
+	topics map[string]*bufferedTopic
+}
+
+type bufferedTopic struct {
+	name    string
+	ds      ds.Datastore
+	prefix  ds.Key
+	maxSize uint64
+	maxAge  time.Duration
+
+	mu        sync.Mutex
+	first     uint64 // seq of the oldest buffered message
+	next      uint64 // seq assigned to the next message
+	listeners map[chan *BufferedMessage]struct{}
+}
+
+// DurablePubsub subscribes to every topic marked as Durable in
+// Pubsub.Topics and buffers its messages in the repo datastore.
+func DurablePubsub(topics map[string]config.PubsubTopic) interface{} {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, ps *pubsub.PubSub, r repo.Repo) (*PubsubBuffer, error) {
+		ctx := helpers.LifecycleCtx(mctx, lc)
+		b := &PubsubBuffer{topics: make(map[string]*bufferedTopic)}
+
+		for name, cfg := range topics {
+			if !cfg.Durable.WithDefault(false) {
+				continue
+			}
+			maxSize := cfg.RetentionSize.WithDefault(config.DefaultPubsubRetentionSize)
+			if maxSize <= 0 {
+				return nil, fmt.Errorf("invalid Pubsub.Topics[%q].RetentionSize: must be positive", name)
+			}
+			t := &bufferedTopic{
+				name:      name,
+				ds:        r.Datastore(),
+				prefix:    pubsubBufferPrefix.ChildString(base64.RawURLEncoding.EncodeToString([]byte(name))),
+				maxSize:   uint64(maxSize),
+				maxAge:    cfg.RetentionAge.WithDefault(config.DefaultPubsubRetentionAge),
+				listeners: make(map[chan *BufferedMessage]struct{}),
+			}
+			if err := t.load(ctx); err != nil {
+				return nil, fmt.Errorf("loading buffer of pubsub topic %q: %w", name, err)
+			}
+			b.topics[name] = t
+		}
+
+		if len(b.topics) == 0 {
+			return b, nil
+		}
+
+		var subs []*pubsub.Subscription
+		lc.Append(fx.Hook{
+			OnStart: func(_ context.Context) error {
+				for _, t := range b.topics {
+					//nolint deprecated
+					sub, err := ps.Subscribe(t.name)
+					if err != nil {
+						return err
+					}
+					subs = append(subs, sub)
+					go t.receive(ctx, sub)
+				}
+				go b.prune(ctx)
+				return nil
+			},
+			OnStop: func(_ context.Context) error {
+				for _, sub := range subs {
+					sub.Cancel()
+				}
+				return nil
+			},
+		})
+
+		return b, nil
+	}
+}
+
+// IsDurable returns whether messages on the given topic are buffered.
+func (b *PubsubBuffer) IsDurable(topic string) bool {
+	_, ok := b.topics[topic]
+	return ok
+}
+
+// Subscribe returns a subscription to a durable topic. It first replays the
+// buffered messages with a Seq greater than sinceSeq that were received at or
+// after sinceTime, then streams new messages as they arrive.
+func (b *PubsubBuffer) Subscribe(topic string, sinceSeq uint64, sinceTime time.Time) (*BufferSubscription, error) {
+	t, ok := b.topics[topic]
+	if !ok {
+		return nil, fmt.Errorf("pubsub topic %q is not durable, set Pubsub.Topics[%q].Durable to buffer its messages", topic, topic)
+	}
+
+	ch := make(chan *BufferedMessage, 128)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.listeners[ch] = struct{}{}
+
+	start := t.first
+	if sinceSeq >= start {
+		start = sinceSeq + 1
+	}
+	return &BufferSubscription{
+		topic:     t,
+		ch:        ch,
+		replaySeq: start,
+		replayEnd: t.next,
+		sinceTime: sinceTime,
+	}, nil
+}
+
+// BufferSubscription is a subscription to a durable topic.
+type BufferSubscription struct {
+	topic *bufferedTopic
+	ch    chan *BufferedMessage
+
+	replaySeq uint64
+	replayEnd uint64
+	sinceTime time.Time
+}
+
+// Next returns the next buffered or live message.
+func (s *BufferSubscription) Next(ctx context.Context) (*BufferedMessage, error) {
+	for s.replaySeq < s.replayEnd {
+		seq := s.replaySeq
+		s.replaySeq++
+
+		m, err := s.topic.get(ctx, seq)
+		if errors.Is(err, ds.ErrNotFound) {
+			// pruned in the meantime
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if m.Received.Before(s.sinceTime) {
+			continue
+		}
+		return m, nil
+	}
+
+	select {
+	case m, ok := <-s.ch:
+		if !ok {
+			return nil, ErrSubscriberTooSlow
+		}
+		return m, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close stops the delivery of new messages.
+func (s *BufferSubscription) Close() {
+	s.topic.mu.Lock()
+	delete(s.topic.listeners, s.ch)
+	s.topic.mu.Unlock()
+}
+
+func (t *bufferedTopic) key(seq uint64) ds.Key {
+	return t.prefix.ChildString(fmt.Sprintf("%020d", seq))
+}
+
+// nextKey stores the next sequence number when all the buffered messages are
+// pruned, as it can't be derived from the buffer content anymore.
+func (t *bufferedTopic) nextKey() ds.Key {
+	return t.prefix.ChildString("next")
+}
+
+func (t *bufferedTopic) load(ctx context.Context) error {
+	res, err := t.ds.Query(ctx, query.Query{Prefix: t.prefix.String(), KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	var first, last uint64
+	for r := range res.Next() {
+		if r.Error != nil {
+			return r.Error
+		}
+		seq, err := strconv.ParseUint(ds.RawKey(r.Key).BaseNamespace(), 10, 64)
+		if err != nil {
+			continue
+		}
+		if first == 0 || seq < first {
+			first = seq
+		}
+		if seq > last {
+			last = seq
+		}
+	}
+
+	if first != 0 {
+		t.first, t.next = first, last+1
+		return nil
+	}
+
+	// The buffer is empty: continue the sequence where it stopped before
+	// everything was pruned. Sequence numbers start at 1 so that a --since
+	// of 0 replays everything.
+	t.first, t.next = 1, 1
+	v, err := t.ds.Get(ctx, t.nextKey())
+	if errors.Is(err, ds.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	next, err := strconv.ParseUint(string(v), 10, 64)
+	if err != nil {
+		return err
+	}
+	t.first, t.next = next, next
+	return nil
+}
+
+func (t *bufferedTopic) get(ctx context.Context, seq uint64) (*BufferedMessage, error) {
+	v, err := t.ds.Get(ctx, t.key(seq))
+	if err != nil {
+		return nil, err
+	}
+	var m BufferedMessage
+	if err := json.Unmarshal(v, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (t *bufferedTopic) receive(ctx context.Context, sub *pubsub.Subscription) {
+	for {
+		msg, err := sub.Next(ctx)
+		if err != nil {
+			return
+		}
+		if err := t.add(ctx, msg); err != nil {
+			log.Errorf("buffering message on pubsub topic %q: %s", t.name, err)
+		}
+	}
+}
+
+func (t *bufferedTopic) add(ctx context.Context, msg *pubsub.Message) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	m := &BufferedMessage{
+		Seq:      t.next,
+		From:     msg.GetFrom(),
+		Data:     msg.GetData(),
+		Seqno:    msg.GetSeqno(),
+		Topic:    t.name,
+		Received: time.Now(),
+	}
+	v, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if err := t.ds.Put(ctx, t.key(m.Seq), v); err != nil {
+		return err
+	}
+	t.next++
+
+	for t.next-t.first > t.maxSize {
+		if err := t.ds.Delete(ctx, t.key(t.first)); err != nil {
+			return err
+		}
+		t.first++
+	}
+
+	for ch := range t.listeners {
+		select {
+		case ch <- m:
+		default:
+			close(ch)
+			delete(t.listeners, ch)
+		}
+	}
+	return nil
+}
+
+func (b *PubsubBuffer) prune(ctx context.Context) {
+	ticker := time.NewTicker(pubsubBufferPruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		for _, t := range b.topics {
+			if err := t.pruneOlderThan(ctx, time.Now().Add(-t.maxAge)); err != nil {
+				log.Errorf("pruning buffer of pubsub topic %q: %s", t.name, err)
+			}
+		}
+	}
+}
+
+func (t *bufferedTopic) pruneOlderThan(ctx context.Context, cutoff time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for t.first < t.next {
+		m, err := t.get(ctx, t.first)
+		if err != nil && !errors.Is(err, ds.ErrNotFound) {
+			return err
+		}
+		if m != nil && !m.Received.Before(cutoff) {
+			return nil
+		}
+		if t.first+1 == t.next {
+			if err := t.ds.Put(ctx, t.nextKey(), []byte(strconv.FormatUint(t.next, 10))); err != nil {
+				return err
+			}
+		}
+		if err := t.ds.Delete(ctx, t.key(t.first)); err != nil {
+			return err
+		}
+		t.first++
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package libp2p
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestBufferedTopic(t *testing.T, d ds.Datastore, maxSize uint64) *bufferedTopic {
+	t.Helper()
+	bt := &bufferedTopic{
+		name:      "topic",
+		ds:        d,
+		prefix:    pubsubBufferPrefix.ChildString("dG9waWM"),
+		maxSize:   maxSize,
+		maxAge:    time.Hour,
+		listeners: make(map[chan *BufferedMessage]struct{}),
+	}
+	require.NoError(t, bt.load(context.Background()))
+	return bt
+}
+
+func addTestMessages(t *testing.T, bt *bufferedTopic, data ...string) {
+	t.Helper()
+	for _, d := range data {
+		require.NoError(t, bt.add(context.Background(), &pubsub.Message{Message: &pb.Message{Data: []byte(d)}}))
+	}
+}
+
+func TestPubsubBuffer(t *testing.T) {
+	ctx := context.Background()
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	bt := newTestBufferedTopic(t, d, 3)
+	b := &PubsubBuffer{topics: map[string]*bufferedTopic{"topic": bt}}
+
+	_, err := b.Subscribe("other", 0, time.Time{})
+	require.Error(t, err)
+
+	addTestMessages(t, bt, "a", "b", "c", "d")
+
+	// the oldest message was dropped to respect the retention size
+	sub, err := b.Subscribe("topic", 0, time.Time{})
+	require.NoError(t, err)
+	for _, expected := range []string{"b", "c", "d"} {
+		m, err := sub.Next(ctx)
+		require.NoError(t, err)
+		require.Equal(t, expected, string(m.Data))
+	}
+
+	// live messages follow the replayed ones
+	addTestMessages(t, bt, "e")
+	m, err := sub.Next(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "e", string(m.Data))
+	require.Equal(t, uint64(5), m.Seq)
+	sub.Close()
+
+	// the buffer survives a restart and can be resumed from a seq
+	bt = newTestBufferedTopic(t, d, 3)
+	b = &PubsubBuffer{topics: map[string]*bufferedTopic{"topic": bt}}
+	sub, err = b.Subscribe("topic", 4, time.Time{})
+	require.NoError(t, err)
+	m, err = sub.Next(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "e", string(m.Data))
+	addTestMessages(t, bt, "f")
+	m, err = sub.Next(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(6), m.Seq)
+	sub.Close()
+
+	// messages older than the retention age are pruned
+	require.NoError(t, bt.pruneOlderThan(ctx, time.Now().Add(time.Minute)))
+	sub, err = b.Subscribe("topic", 0, time.Time{})
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = sub.Next(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	sub.Close()
+
+	// the sequence continues after a restart with an empty buffer
+	bt = newTestBufferedTopic(t, d, 3)
+	addTestMessages(t, bt, "g")
+	m, err = bt.get(context.Background(), 7)
+	require.NoError(t, err)
+	require.Equal(t, "g", string(m.Data))
+}
@@ -0,0 +1,359 @@
+package libp2p
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// pubsubScoreInspectPeriod is how often peer scores are refreshed when
+// gossipsub peer scoring is enabled.
+const pubsubScoreInspectPeriod = 10 * time.Second
+
+// pubsubScoreBounds are the upper bounds of the peer score ranges exported
+// by ipfs_pubsub_peer_scores.
+var pubsubScoreBounds = []float64{-100, -10, 0, 10, 100}
+
+var (
+	pubsubMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ipfs_pubsub_messages_total",
+		Help: "pubsub messages received, by topic and result (delivered or duplicate)",
+	}, []string{"topic", "result"})
+	pubsubRejectedMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ipfs_pubsub_rejected_messages_total",
+		Help: "pubsub messages rejected or ignored by validation, by topic and reason",
+	}, []string{"topic", "reason"})
+	pubsubControlMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ipfs_pubsub_control_messages_total",
+		Help: "gossipsub control messages, by type and direction",
+	}, []string{"type", "direction"})
+	pubsubMeshPeers = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ipfs_pubsub_mesh_peers",
+		Help: "number of peers in the gossipsub mesh of a topic",
+	}, []string{"topic"})
+	pubsubPeerScores = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ipfs_pubsub_peer_scores",
+		Help: "number of peers whose gossipsub score is at most le, as of the last score refresh",
+	}, []string{"le"})
+)
+
+// PubsubTracer is a pubsub.RawTracer that keeps track of the gossipsub mesh,
+// fanout peers, peer scores and per-topic message counters, for 'ipfs pubsub
+// inspect' and Prometheus.
+type PubsubTracer struct {
+	mu     sync.Mutex
+	joined map[string]struct{}
+	mesh   map[string]map[peer.ID]struct{}
+	fanout map[string]map[peer.ID]time.Time
+	topics map[string]*PubsubTopicStats
+	scores map[peer.ID]float64
+
+	iwantSent     uint64
+	iwantReceived uint64
+}
+
+// PubsubTopicStats are the message counters of a single topic.
+type PubsubTopicStats struct {
+	Delivered     uint64
+	Duplicate     uint64
+	Rejected      uint64
+	IHaveSent     uint64
+	IHaveReceived uint64
+}
+
+// PubsubTopicInspection describes the state of a single topic.
+type PubsubTopicInspection struct {
+	PubsubTopicStats
+	Topic  string
+	Mesh   []peer.ID
+	Fanout []peer.ID
+}
+
+// PubsubInspection is a snapshot of the state collected by PubsubTracer.
+type PubsubInspection struct {
+	Topics []PubsubTopicInspection
+	// Scores is nil unless gossipsub peer scoring is enabled.
+	Scores        map[peer.ID]float64
+	IWantSent     uint64
+	IWantReceived uint64
+}
+
+var _ pubsub.RawTracer = (*PubsubTracer)(nil)
+
+func NewPubsubTracer() *PubsubTracer {
+	return &PubsubTracer{
+		joined: make(map[string]struct{}),
+		mesh:   make(map[string]map[peer.ID]struct{}),
+		fanout: make(map[string]map[peer.ID]time.Time),
+		topics: make(map[string]*PubsubTopicStats),
+	}
+}
+
+// Inspect returns a snapshot of the tracked state. When topic is not empty,
+// only that topic is included.
+func (t *PubsubTracer) Inspect(topic string) PubsubInspection {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := PubsubInspection{
+		IWantSent:     t.iwantSent,
+		IWantReceived: t.iwantReceived,
+	}
+	if t.scores != nil {
+		out.Scores = make(map[peer.ID]float64, len(t.scores))
+		for p, s := range t.scores {
+			out.Scores[p] = s
+		}
+	}
+
+	names := make(map[string]struct{})
+	for name := range t.joined {
+		names[name] = struct{}{}
+	}
+	for name := range t.topics {
+		names[name] = struct{}{}
+	}
+	for name := range t.fanout {
+		names[name] = struct{}{}
+	}
+
+	now := time.Now()
+	for name := range names {
+		if topic != "" && name != topic {
+			continue
+		}
+		ti := PubsubTopicInspection{Topic: name}
+		if s, ok := t.topics[name]; ok {
+			ti.PubsubTopicStats = *s
+		}
+		for p := range t.mesh[name] {
+			ti.Mesh = append(ti.Mesh, p)
+		}
+		for p, last := range t.fanout[name] {
+			if now.Sub(last) > pubsub.GossipSubFanoutTTL {
+				delete(t.fanout[name], p)
+				continue
+			}
+			ti.Fanout = append(ti.Fanout, p)
+		}
+		sortPeers(ti.Mesh)
+		sortPeers(ti.Fanout)
+		out.Topics = append(out.Topics, ti)
+	}
+	sort.Slice(out.Topics, func(i, j int) bool { return out.Topics[i].Topic < out.Topics[j].Topic })
+	return out
+}
+
+func sortPeers(peers []peer.ID) {
+	sort.Slice(peers, func(i, j int) bool { return peers[i] < peers[j] })
+}
+
+// updateScores is a pubsub.PeerScoreInspectFn.
+func (t *PubsubTracer) updateScores(scores map[peer.ID]float64) {
+	t.mu.Lock()
+	t.scores = scores
+	t.mu.Unlock()
+
+	counts := make([]int, len(pubsubScoreBounds))
+	for _, score := range scores {
+		for i, bound := range pubsubScoreBounds {
+			if score <= bound {
+				counts[i]++
+			}
+		}
+	}
+	for i, bound := range pubsubScoreBounds {
+		pubsubPeerScores.WithLabelValues(strconv.FormatFloat(bound, 'f', -1, 64)).Set(float64(counts[i]))
+	}
+	pubsubPeerScores.WithLabelValues("+Inf").Set(float64(len(scores)))
+}
+
+// topicStats returns the stats of topic, or nil when the node neither joined
+// nor published to it. Topics only named by remote peers, such as in IHAVEs,
+// are not tracked so that peers cannot grow the tracked state. It must be
+// called with the lock held.
+func (t *PubsubTracer) topicStats(topic string) *PubsubTopicStats {
+	if s, ok := t.topics[topic]; ok {
+		return s
+	}
+	_, joined := t.joined[topic]
+	_, fanout := t.fanout[topic]
+	if !joined && !fanout {
+		return nil
+	}
+	s := &PubsubTopicStats{}
+	t.topics[topic] = s
+	return s
+}
+
+func (t *PubsubTracer) AddPeer(p peer.ID, proto protocol.ID) {}
+
+func (t *PubsubTracer) RemovePeer(p peer.ID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for topic, peers := range t.mesh {
+		if _, ok := peers[p]; ok {
+			delete(peers, p)
+			pubsubMeshPeers.WithLabelValues(topic).Set(float64(len(peers)))
+		}
+	}
+	for _, peers := range t.fanout {
+		delete(peers, p)
+	}
+}
+
+func (t *PubsubTracer) Join(topic string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.joined[topic] = struct{}{}
+	delete(t.fanout, topic)
+}
+
+func (t *PubsubTracer) Leave(topic string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.joined, topic)
+	delete(t.mesh, topic)
+	if _, ok := t.fanout[topic]; !ok {
+		delete(t.topics, topic)
+	}
+	pubsubMeshPeers.DeleteLabelValues(topic)
+}
+
+func (t *PubsubTracer) Graft(p peer.ID, topic string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	peers, ok := t.mesh[topic]
+	if !ok {
+		peers = make(map[peer.ID]struct{})
+		t.mesh[topic] = peers
+	}
+	peers[p] = struct{}{}
+	pubsubMeshPeers.WithLabelValues(topic).Set(float64(len(peers)))
+}
+
+func (t *PubsubTracer) Prune(p peer.ID, topic string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if peers, ok := t.mesh[topic]; ok {
+		delete(peers, p)
+		pubsubMeshPeers.WithLabelValues(topic).Set(float64(len(peers)))
+	}
+}
+
+func (t *PubsubTracer) ValidateMessage(msg *pubsub.Message) {}
+
+func (t *PubsubTracer) DeliverMessage(msg *pubsub.Message) {
+	t.countMessage(msg.GetTopic(), "delivered")
+}
+
+func (t *PubsubTracer) RejectMessage(msg *pubsub.Message, reason string) {
+	t.countMessage(msg.GetTopic(), "rejected")
+
+	// Pubsub.Topics validators tell why they rejected or ignored the
+	// message.
+	if r, ok := msg.ValidatorData.(pubsubRejection); ok {
+		reason = string(r)
+	}
+	pubsubRejectedMessages.WithLabelValues(msg.GetTopic(), reason).Inc()
+}
+
+func (t *PubsubTracer) DuplicateMessage(msg *pubsub.Message) {
+	t.countMessage(msg.GetTopic(), "duplicate")
+}
+
+func (t *PubsubTracer) countMessage(topic, result string) {
+	t.mu.Lock()
+	s := t.topicStats(topic)
+	if s != nil {
+		switch result {
+		case "delivered":
+			s.Delivered++
+		case "rejected":
+			s.Rejected++
+		case "duplicate":
+			s.Duplicate++
+		}
+	}
+	t.mu.Unlock()
+	if s != nil && result != "rejected" {
+		pubsubMessages.WithLabelValues(topic, result).Inc()
+	}
+}
+
+func (t *PubsubTracer) ThrottlePeer(p peer.ID) {}
+
+func (t *PubsubTracer) RecvRPC(rpc *pubsub.RPC) {
+	t.countControl(rpc, "received")
+}
+
+func (t *PubsubTracer) SendRPC(rpc *pubsub.RPC, p peer.ID) {
+	t.countControl(rpc, "sent")
+
+	if len(rpc.GetPublish()) == 0 {
+		return
+	}
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, msg := range rpc.GetPublish() {
+		topic := msg.GetTopic()
+		// messages published on topics we did not join go to fanout peers
+		if _, ok := t.joined[topic]; ok {
+			continue
+		}
+		peers, ok := t.fanout[topic]
+		if !ok {
+			peers = make(map[peer.ID]time.Time)
+			t.fanout[topic] = peers
+		}
+		peers[p] = now
+	}
+}
+
+func (t *PubsubTracer) DropRPC(rpc *pubsub.RPC, p peer.ID) {}
+
+func (t *PubsubTracer) UndeliverableMessage(msg *pubsub.Message) {}
+
+func (t *PubsubTracer) countControl(rpc *pubsub.RPC, direction string) {
+	ctl := rpc.GetControl()
+	if ctl == nil {
+		return
+	}
+
+	var iwant uint64
+	for _, w := range ctl.GetIwant() {
+		iwant += uint64(len(w.GetMessageIDs()))
+	}
+
+	t.mu.Lock()
+	for _, h := range ctl.GetIhave() {
+		s := t.topicStats(h.GetTopicID())
+		if s == nil {
+			continue
+		}
+		if direction == "sent" {
+			s.IHaveSent += uint64(len(h.GetMessageIDs()))
+		} else {
+			s.IHaveReceived += uint64(len(h.GetMessageIDs()))
+		}
+	}
+	if direction == "sent" {
+		t.iwantSent += iwant
+	} else {
+		t.iwantReceived += iwant
+	}
+	t.mu.Unlock()
+
+	pubsubControlMessages.WithLabelValues("ihave", direction).Add(float64(len(ctl.GetIhave())))
+	pubsubControlMessages.WithLabelValues("iwant", direction).Add(float64(len(ctl.GetIwant())))
+	pubsubControlMessages.WithLabelValues("graft", direction).Add(float64(len(ctl.GetGraft())))
+	pubsubControlMessages.WithLabelValues("prune", direction).Add(float64(len(ctl.GetPrune())))
+}
@@ -0,0 +1,85 @@
+package libp2p
+
+import (
+	"testing"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/test"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPubsubTracer(t *testing.T) {
+	tr := NewPubsubTracer()
+
+	a, err := test.RandPeerID()
+	require.NoError(t, err)
+	b, err := test.RandPeerID()
+	require.NoError(t, err)
+
+	topic := "joined"
+	other := "fanout"
+	msg := &pubsub.Message{Message: &pb.Message{Topic: &topic}}
+
+	tr.Join(topic)
+	tr.Graft(a, topic)
+	tr.Graft(b, topic)
+	tr.Prune(b, topic)
+	tr.DeliverMessage(msg)
+	tr.DuplicateMessage(msg)
+	tr.DuplicateMessage(msg)
+	tr.RejectMessage(msg, pubsub.RejectValidationFailed)
+
+	tr.SendRPC(&pubsub.RPC{RPC: pb.RPC{
+		Publish: []*pb.Message{{Topic: &other}},
+		Control: &pb.ControlMessage{
+			Ihave: []*pb.ControlIHave{{TopicID: &topic, MessageIDs: []string{"1", "2"}}},
+			Iwant: []*pb.ControlIWant{{MessageIDs: []string{"3"}}},
+		},
+	}}, b)
+
+	// topics only named by remote peers are not tracked
+	random := "random"
+	tr.RecvRPC(&pubsub.RPC{RPC: pb.RPC{
+		Control: &pb.ControlMessage{
+			Ihave: []*pb.ControlIHave{{TopicID: &random, MessageIDs: []string{"4"}}},
+		},
+	}})
+	tr.DeliverMessage(&pubsub.Message{Message: &pb.Message{Topic: &random}})
+
+	res := tr.Inspect("")
+	require.Nil(t, res.Scores)
+	require.Equal(t, uint64(1), res.IWantSent)
+	require.Len(t, res.Topics, 2)
+
+	require.Equal(t, other, res.Topics[0].Topic)
+	require.Equal(t, []peer.ID{b}, res.Topics[0].Fanout)
+
+	joined := res.Topics[1]
+	require.Equal(t, topic, joined.Topic)
+	require.Equal(t, []peer.ID{a}, joined.Mesh)
+	require.Empty(t, joined.Fanout)
+	require.Equal(t, PubsubTopicStats{Delivered: 1, Duplicate: 2, Rejected: 1, IHaveSent: 2}, joined.PubsubTopicStats)
+
+	// Rejections by Pubsub.Topics validators are counted with their reason.
+	rejected := pubsubRejectedMessages.WithLabelValues(topic, rejectReasonSize)
+	before := testutil.ToFloat64(rejected)
+	tr.RejectMessage(&pubsub.Message{Message: &pb.Message{Topic: &topic}, ValidatorData: pubsubRejection(rejectReasonSize)}, pubsub.RejectValidationFailed)
+	require.Equal(t, before+1, testutil.ToFloat64(rejected))
+
+	tr.updateScores(map[peer.ID]float64{a: -1, b: 20})
+	for le, n := range map[string]float64{"-10": 0, "0": 1, "10": 1, "100": 2, "+Inf": 2} {
+		require.Equal(t, n, testutil.ToFloat64(pubsubPeerScores.WithLabelValues(le)), le)
+	}
+	tr.RemovePeer(a)
+	res = tr.Inspect(topic)
+	require.Len(t, res.Topics, 1)
+	require.Empty(t, res.Topics[0].Mesh)
+	require.Equal(t, -1.0, res.Scores[a])
+
+	tr.Leave(topic)
+	res = tr.Inspect(topic)
+	require.Empty(t, res.Topics)
+}
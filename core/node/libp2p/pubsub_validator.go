@@ -0,0 +1,195 @@
+package libp2p
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ipfs/kubo/config"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	rejectReasonPublisher = "publisher"
+	rejectReasonSize      = "size"
+	rejectReasonRate      = "rate"
+	rejectReasonValidator = "validator"
+)
+
+var pubsubValidators = map[string]pubsub.ValidatorEx{}
+
+// AddPubsubValidator registers a named pubsub validator that can be enabled on
+// topics through Pubsub.Topics[topic].Validator.
+func AddPubsubValidator(name string, v pubsub.ValidatorEx) error {
+	_, ok := pubsubValidators[name]
+	if ok {
+		return fmt.Errorf("already have a pubsub validator named %q", name)
+	}
+
+	pubsubValidators[name] = v
+	return nil
+}
+
+// pubsubRejection is the reason a topic validator rejected or ignored a
+// message. It is set as the ValidatorData of the message, for the tracers.
+type pubsubRejection string
+
+// PubsubTopicValidators registers a validator on every topic listed in
+// Pubsub.Topics, enforcing the configured publishers, message size, per-peer
+// rate limit and plugin validator.
+func PubsubTopicValidators(topics map[string]config.PubsubTopic) interface{} {
+	return func(h host.Host, ps *pubsub.PubSub) error {
+		if len(topics) == 0 {
+			return nil
+		}
+		for topic, cfg := range topics {
+			v, err := newTopicValidator(topic, h.ID(), cfg)
+			if err != nil {
+				return err
+			}
+			if err := ps.RegisterTopicValidator(topic, v.validate); err != nil {
+				return fmt.Errorf("registering validator for pubsub topic %q: %w", topic, err)
+			}
+		}
+		return nil
+	}
+}
+
+type topicValidator struct {
+	self       peer.ID
+	publishers map[peer.ID]struct{}
+	maxSize    int64
+	limiter    *peerRateLimiter
+	custom     pubsub.ValidatorEx
+}
+
+func newTopicValidator(topic string, self peer.ID, cfg config.PubsubTopic) (*topicValidator, error) {
+	v := &topicValidator{
+		self:    self,
+		maxSize: cfg.MaxMessageSize.WithDefault(0),
+	}
+
+	if len(cfg.AllowedPublishers) > 0 {
+		v.publishers = make(map[peer.ID]struct{}, len(cfg.AllowedPublishers))
+		for _, s := range cfg.AllowedPublishers {
+			p, err := peer.Decode(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid peer ID %q in Pubsub.Topics[%q].AllowedPublishers: %w", s, topic, err)
+			}
+			v.publishers[p] = struct{}{}
+		}
+	}
+
+	if rate := cfg.RateLimit.WithDefault(0); rate > 0 {
+		v.limiter = newPeerRateLimiter(float64(rate), time.Now)
+	}
+
+	if name := cfg.Validator.WithDefault(""); name != "" {
+		custom, ok := pubsubValidators[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown pubsub validator %q in Pubsub.Topics[%q].Validator", name, topic)
+		}
+		v.custom = custom
+	}
+
+	return v, nil
+}
+
+func (v *topicValidator) validate(ctx context.Context, from peer.ID, msg *pubsub.Message) pubsub.ValidationResult {
+	if v.publishers != nil {
+		if _, ok := v.publishers[msg.GetFrom()]; !ok {
+			return v.reject(msg, rejectReasonPublisher)
+		}
+	}
+	if v.maxSize > 0 && int64(len(msg.GetData())) > v.maxSize {
+		return v.reject(msg, rejectReasonSize)
+	}
+	// Messages published locally are never rate limited. Messages over the
+	// limit are ignored rather than rejected: the forwarding peer may be an
+	// honest relay of a busy topic, and must not be penalized.
+	if v.limiter != nil && from != v.self && !v.limiter.allow(from) {
+		msg.ValidatorData = pubsubRejection(rejectReasonRate)
+		return pubsub.ValidationIgnore
+	}
+	if v.custom != nil {
+		res := v.custom(ctx, from, msg)
+		if res == pubsub.ValidationReject {
+			msg.ValidatorData = pubsubRejection(rejectReasonValidator)
+		}
+		return res
+	}
+	return pubsub.ValidationAccept
+}
+
+func (v *topicValidator) reject(msg *pubsub.Message, reason string) pubsub.ValidationResult {
+	msg.ValidatorData = pubsubRejection(reason)
+	return pubsub.ValidationReject
+}
+
+// peerRateLimiter is a token bucket per peer, refilled at rate tokens per
+// second with a burst of one second worth of tokens.
+type peerRateLimiter struct {
+	rate float64
+	now  func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[peer.ID]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newPeerRateLimiter(rate float64, now func() time.Time) *peerRateLimiter {
+	return &peerRateLimiter{
+		rate:      rate,
+		now:       now,
+		buckets:   make(map[peer.ID]*tokenBucket),
+		lastSweep: now(),
+	}
+}
+
+func (l *peerRateLimiter) allow(p peer.ID) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[p]
+	if !ok {
+		b = &tokenBucket{tokens: l.rate, last: now}
+		l.buckets[p] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.rate {
+		b.tokens = l.rate
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// sweep drops buckets of peers that have been idle long enough for their
+// bucket to be full again, keeping memory bounded by the active peer set.
+func (l *peerRateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for p, b := range l.buckets {
+		if now.Sub(b.last) > time.Second {
+			delete(l.buckets, p)
+		}
+	}
+}
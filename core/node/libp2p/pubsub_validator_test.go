@@ -0,0 +1,116 @@
+package libp2p
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/ipfs/kubo/config"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/test"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestMessage(t *testing.T, from peer.ID, data []byte) *pubsub.Message {
+	t.Helper()
+	return &pubsub.Message{Message: &pb.Message{From: []byte(from), Data: data}}
+}
+
+func TestTopicValidator(t *testing.T) {
+	ctx := context.Background()
+	self, err := test.RandPeerID()
+	require.NoError(t, err)
+	allowed, err := test.RandPeerID()
+	require.NoError(t, err)
+	other, err := test.RandPeerID()
+	require.NoError(t, err)
+
+	t.Run("allowed publishers", func(t *testing.T) {
+		v, err := newTopicValidator("t", self, config.PubsubTopic{
+			AllowedPublishers: []string{allowed.String()},
+		})
+		require.NoError(t, err)
+		require.Equal(t, pubsub.ValidationAccept, v.validate(ctx, other, newTestMessage(t, allowed, nil)))
+		msg := newTestMessage(t, other, nil)
+		require.Equal(t, pubsub.ValidationReject, v.validate(ctx, allowed, msg))
+		require.Equal(t, pubsubRejection(rejectReasonPublisher), msg.ValidatorData)
+	})
+
+	t.Run("max message size", func(t *testing.T) {
+		v, err := newTopicValidator("t", self, config.PubsubTopic{
+			MaxMessageSize: config.NewOptionalInteger(4),
+		})
+		require.NoError(t, err)
+		require.Equal(t, pubsub.ValidationAccept, v.validate(ctx, other, newTestMessage(t, other, []byte("1234"))))
+		require.Equal(t, pubsub.ValidationReject, v.validate(ctx, other, newTestMessage(t, other, []byte("12345"))))
+	})
+
+	t.Run("rate limit", func(t *testing.T) {
+		v, err := newTopicValidator("t", self, config.PubsubTopic{
+			RateLimit: config.NewOptionalInteger(1),
+		})
+		require.NoError(t, err)
+		require.Equal(t, pubsub.ValidationAccept, v.validate(ctx, other, newTestMessage(t, allowed, nil)))
+		// Relays of busy topics are not penalized.
+		msg := newTestMessage(t, allowed, nil)
+		require.Equal(t, pubsub.ValidationIgnore, v.validate(ctx, other, msg))
+		require.Equal(t, pubsubRejection(rejectReasonRate), msg.ValidatorData)
+		// Locally published messages are not limited.
+		require.Equal(t, pubsub.ValidationAccept, v.validate(ctx, self, newTestMessage(t, self, nil)))
+		require.Equal(t, pubsub.ValidationAccept, v.validate(ctx, self, newTestMessage(t, self, nil)))
+	})
+
+	t.Run("plugin validator", func(t *testing.T) {
+		name := "test-" + t.Name()
+		require.NoError(t, AddPubsubValidator(name, func(context.Context, peer.ID, *pubsub.Message) pubsub.ValidationResult {
+			return pubsub.ValidationIgnore
+		}))
+		require.Error(t, AddPubsubValidator(name, nil))
+
+		v, err := newTopicValidator("t", self, config.PubsubTopic{
+			Validator: config.NewOptionalString(name),
+		})
+		require.NoError(t, err)
+		require.Equal(t, pubsub.ValidationIgnore, v.validate(ctx, other, newTestMessage(t, other, nil)))
+
+		_, err = newTopicValidator("t", self, config.PubsubTopic{
+			Validator: config.NewOptionalString("does-not-exist"),
+		})
+		require.Error(t, err)
+	})
+
+	t.Run("invalid publisher", func(t *testing.T) {
+		_, err := newTopicValidator("t", self, config.PubsubTopic{
+			AllowedPublishers: []string{"not-a-peer-id"},
+		})
+		require.Error(t, err)
+	})
+}
+
+func TestPeerRateLimiter(t *testing.T) {
+	clk := clock.NewMock()
+	l := newPeerRateLimiter(2, clk.Now)
+
+	a, err := test.RandPeerID()
+	require.NoError(t, err)
+	b, err := test.RandPeerID()
+	require.NoError(t, err)
+
+	require.True(t, l.allow(a))
+	require.True(t, l.allow(a))
+	require.False(t, l.allow(a))
+	// buckets are per peer
+	require.True(t, l.allow(b))
+
+	clk.Add(500 * time.Millisecond)
+	require.True(t, l.allow(a))
+	require.False(t, l.allow(a))
+
+	// idle buckets are dropped
+	clk.Add(2 * time.Minute)
+	require.True(t, l.allow(a))
+	require.Len(t, l.buckets, 1)
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/ipfs/kubo/config"
 	"github.com/ipfs/kubo/core/node/helpers"
 	"github.com/ipfs/kubo/repo"
+	"github.com/ipfs/kubo/reputation"
 )
 
 var rcmgrLogger = logging.Logger("rcmgr")
@@ -28,7 +29,7 @@ const NetLimitTraceFilename = "rcmgr.json.gz"
 
 var ErrNoResourceMgr = fmt.Errorf("missing ResourceMgr: make sure the daemon is running with Swarm.ResourceMgr.Enabled")
 
-func ResourceManager(cfg config.SwarmConfig, userResourceOverrides rcmgr.PartialLimitConfig) interface{} {
+func ResourceManager(cfg config.SwarmConfig, userResourceOverrides rcmgr.PartialLimitConfig, rep *reputation.Tracker) interface{} {
 	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, repo repo.Repo) (network.ResourceManager, Libp2pOpts, error) {
 		var manager network.ResourceManager
 		var opts Libp2pOpts
@@ -102,9 +103,11 @@ filled in with autocomputed defaults.`)
 				return nil, opts, fmt.Errorf("creating libp2p resource manager: %w", err)
 			}
 			lrm := &loggingResourceManager{
-				clock:    clock.New(),
-				logger:   &logging.Logger("resourcemanager").SugaredLogger,
-				delegate: manager,
+				clock:      clock.New(),
+				logger:     &logging.Logger("resourcemanager").SugaredLogger,
+				delegate:   manager,
+				reputation: rep,
+				limiter:    limiter,
 			}
 			lrm.start(helpers.LifecycleCtx(mctx, lc))
 			manager = lrm
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/benbjohnson/clock"
+	"github.com/ipfs/kubo/reputation"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/protocol"
@@ -23,6 +24,11 @@ type loggingResourceManager struct {
 
 	mut               sync.Mutex
 	limitExceededErrs map[string]int
+
+	// reputation is told about the peers opening streams over their limits,
+	// those of limiter.
+	reputation *reputation.Tracker
+	limiter    rcmgr.Limiter
 }
 
 type loggingScope struct {
@@ -121,9 +127,30 @@ func (n *loggingResourceManager) OpenConnection(dir network.Direction, usefd boo
 func (n *loggingResourceManager) OpenStream(p peer.ID, dir network.Direction) (network.StreamManagementScope, error) {
 	connMgmtScope, err := n.delegate.OpenStream(p, dir)
 	n.countErrs(err)
+	if err != nil && dir == network.DirInbound && n.peerStreamLimitExceeded(err, p) {
+		n.reputation.Penalize(p, ReasonStreamLimit, penaltyStreamLimit)
+	}
 	return connMgmtScope, err
 }
 
+// peerStreamLimitExceeded reports whether err is caused by the stream limits
+// of the peer scope of p, rather than by limits shared with other peers.
+func (n *loggingResourceManager) peerStreamLimitExceeded(err error, p peer.ID) bool {
+	var limitErr *rcmgr.ErrStreamOrConnLimitExceeded
+	if n.limiter == nil || !errors.As(err, &limitErr) {
+		return false
+	}
+	limit := n.limiter.GetPeerLimits(p)
+	var exceeded bool
+	_ = n.delegate.ViewPeer(p, func(s network.PeerScope) error {
+		stat := s.Stat()
+		exceeded = stat.NumStreamsInbound >= limit.GetStreamLimit(network.DirInbound) ||
+			stat.NumStreamsInbound+stat.NumStreamsOutbound >= limit.GetStreamTotalLimit()
+		return nil
+	})
+	return exceeded
+}
+
 func (n *loggingResourceManager) Close() error {
 	return n.delegate.Close()
 }
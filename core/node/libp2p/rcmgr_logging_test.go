@@ -6,7 +6,9 @@ import (
 	"time"
 
 	"github.com/benbjohnson/clock"
+	"github.com/ipfs/kubo/reputation"
 	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
 	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
 	ma "github.com/multiformats/go-multiaddr"
 	"github.com/stretchr/testify/require"
@@ -61,3 +63,41 @@ func TestLoggingResourceManager(t *testing.T) {
 		}
 	}
 }
+
+func TestLoggingResourceManagerPenalizesStreams(t *testing.T) {
+	a, b := peer.ID("a"), peer.ID("b")
+	orig := rcmgr.DefaultLimits.AutoScale()
+	limits := orig.ToPartialLimitConfig()
+	limits.System.StreamsInbound = 2
+	limits.Transient.StreamsInbound = 2
+	limits.PeerDefault.StreamsInbound = 10
+	limits.Peer = map[peer.ID]rcmgr.ResourceLimits{a: {StreamsInbound: 1}}
+	limiter := rcmgr.NewFixedLimiter(limits.Build(orig))
+	rm, err := rcmgr.NewResourceManager(limiter)
+	require.NoError(t, err)
+	defer rm.Close()
+
+	rep := reputation.NewTracker(100, time.Hour)
+	lrm := &loggingResourceManager{
+		clock:      clock.NewMock(),
+		logger:     zap.NewNop().Sugar(),
+		delegate:   rm,
+		reputation: rep,
+		limiter:    limiter,
+	}
+
+	// Streams over the limit of the peer are penalized.
+	_, err = lrm.OpenStream(a, network.DirInbound)
+	require.NoError(t, err)
+	_, err = lrm.OpenStream(a, network.DirInbound)
+	require.ErrorIs(t, err, network.ErrResourceLimitExceeded)
+	require.Len(t, rep.Peers(), 1)
+
+	// Streams over limits shared with other peers are not.
+	_, err = lrm.OpenStream(b, network.DirInbound)
+	require.NoError(t, err)
+	_, err = lrm.OpenStream(b, network.DirInbound)
+	require.ErrorIs(t, err, network.ErrResourceLimitExceeded)
+	require.Len(t, rep.Peers(), 1)
+	require.Equal(t, a, rep.Peers()[0].ID)
+}
@@ -0,0 +1,425 @@
+package libp2p
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ipfs/boxo/peering"
+	"github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/core/node/helpers"
+	"github.com/ipfs/kubo/repo"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	ma "github.com/multiformats/go-multiaddr"
+	"go.uber.org/fx"
+)
+
+// RendezvousProtocol is the protocol spoken with rendezvous points.
+const RendezvousProtocol protocol.ID = "/kubo/rendezvous/1.0.0"
+
+const (
+	// rendezvousMaxPoints is the number of rendezvous points queried at each
+	// round.
+	rendezvousMaxPoints = 8
+	// rendezvousMaxPeers is the number of peers returned by a rendezvous
+	// point.
+	rendezvousMaxPeers = 1000
+	// rendezvousMaxTTL caps the lifetime of registrations.
+	rendezvousMaxTTL = time.Hour
+	// rendezvousMaxMessageSize caps the size of requests and responses.
+	rendezvousMaxMessageSize = 1 << 20
+	// rendezvousStreamTimeout bounds a request to a rendezvous point.
+	rendezvousStreamTimeout = 30 * time.Second
+	// rendezvousFirstRound leaves time to connect to the bootstrap peers
+	// before the first round.
+	rendezvousFirstRound = 5 * time.Second
+)
+
+// rendezvousRequest registers its sender with a rendezvous point, unless TTL
+// is zero, and asks for the peers the point knows.
+type rendezvousRequest struct {
+	Addrs []string
+	TTL   time.Duration
+}
+
+type rendezvousResponse struct {
+	Peers []rendezvousRecord
+	// TTL is the granted lifetime of the registration.
+	TTL time.Duration
+}
+
+// rendezvousRecord is a peer known by a rendezvous point.
+type rendezvousRecord struct {
+	Peer peer.AddrInfo
+	// TTL is the remaining lifetime of the registration of the peer, which
+	// is kept when the peer is shared further, so that peers that left are
+	// forgotten everywhere once their last registration expires.
+	TTL time.Duration
+}
+
+// RendezvousPeer is a peer found through a rendezvous point.
+type RendezvousPeer struct {
+	peer.AddrInfo
+	// Via is the rendezvous point the peer was last found through.
+	Via peer.ID
+	// LastSeen is when the peer was last found.
+	LastSeen time.Time
+	// Expires is when the latest registration the peer was found through
+	// expires.
+	Expires time.Time
+	// Peered is set when the peer was added to the peering service.
+	Peered bool
+}
+
+type rendezvousRegistration struct {
+	addrs   []ma.Multiaddr
+	expires time.Time
+}
+
+// Rendezvous discovers the peers of a private network: it registers the node
+// with the peers it is connected to, which act as rendezvous points, and
+// learns from them the peers registered with them or found by them. Peers
+// found this way become rendezvous points themselves once connected, so peer
+// lists propagate through the network.
+type Rendezvous struct {
+	host     host.Host
+	peering  *peering.PeeringService // nil unless found peers are peered with
+	interval time.Duration
+
+	mu            sync.Mutex
+	registrations map[peer.ID]rendezvousRegistration
+	found         map[peer.ID]*RendezvousPeer
+
+	refresh chan chan struct{}
+}
+
+// RendezvousService starts rendezvous discovery as configured in cfg.
+func RendezvousService(cfg config.Rendezvous) func(helpers.MetricsCtx, fx.Lifecycle, repo.Repo, host.Host, *peering.PeeringService) (*Rendezvous, error) {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, r repo.Repo, h host.Host, ps *peering.PeeringService) (*Rendezvous, error) {
+		swarmkey, err := r.SwarmKey()
+		if err != nil {
+			return nil, err
+		}
+		if swarmkey == nil {
+			return nil, errors.New("Discovery.Rendezvous requires a private network, but there is no swarm key")
+		}
+
+		interval := cfg.Interval.WithDefault(config.DefaultRendezvousInterval)
+		if interval <= 0 {
+			return nil, errors.New("Discovery.Rendezvous.Interval must be positive")
+		}
+		if !cfg.Peering.WithDefault(config.DefaultRendezvousPeering) {
+			ps = nil
+		}
+		rv := newRendezvous(h, ps, interval, cfg.Server.WithDefault(config.DefaultRendezvousServer))
+
+		ctx, cancel := context.WithCancel(helpers.LifecycleCtx(mctx, lc))
+		done := make(chan struct{})
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go func() {
+					defer close(done)
+					rv.run(ctx)
+				}()
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				h.RemoveStreamHandler(RendezvousProtocol)
+				cancel()
+				<-done
+				return nil
+			},
+		})
+		return rv, nil
+	}
+}
+
+func newRendezvous(h host.Host, ps *peering.PeeringService, interval time.Duration, server bool) *Rendezvous {
+	rv := &Rendezvous{
+		host:          h,
+		peering:       ps,
+		interval:      interval,
+		registrations: make(map[peer.ID]rendezvousRegistration),
+		found:         make(map[peer.ID]*RendezvousPeer),
+		refresh:       make(chan chan struct{}),
+	}
+	if server {
+		h.SetStreamHandler(RendezvousProtocol, rv.handleStream)
+	}
+	return rv
+}
+
+// ttl is the lifetime of the registrations of the node: they survive a
+// couple of missed rounds.
+func (rv *Rendezvous) ttl() time.Duration {
+	return 3 * rv.interval
+}
+
+// Peers returns the peers found through rendezvous points, sorted by ID.
+func (rv *Rendezvous) Peers() []RendezvousPeer {
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+
+	peers := make([]RendezvousPeer, 0, len(rv.found))
+	for _, p := range rv.found {
+		peers = append(peers, *p)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].ID < peers[j].ID })
+	return peers
+}
+
+// Refresh queries the rendezvous points now, and returns once done.
+func (rv *Rendezvous) Refresh(ctx context.Context) error {
+	done := make(chan struct{})
+	select {
+	case rv.refresh <- done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (rv *Rendezvous) run(ctx context.Context) {
+	timer := time.NewTimer(rendezvousFirstRound)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			rv.round(ctx)
+			timer.Reset(rv.interval)
+		case done := <-rv.refresh:
+			rv.round(ctx)
+			close(done)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// round registers with the rendezvous points and connects to the peers they
+// know, then forgets the peers no longer found.
+func (rv *Rendezvous) round(ctx context.Context) {
+	var points []peer.ID
+	for _, p := range rv.host.Network().Peers() {
+		if ok, _ := rv.host.Peerstore().SupportsProtocols(p, RendezvousProtocol); len(ok) > 0 {
+			points = append(points, p)
+		}
+	}
+	rand.Shuffle(len(points), func(i, j int) { points[i], points[j] = points[j], points[i] })
+	if len(points) > rendezvousMaxPoints {
+		points = points[:rendezvousMaxPoints]
+	}
+
+	var wg sync.WaitGroup
+	for _, p := range points {
+		wg.Add(1)
+		go func(p peer.ID) {
+			defer wg.Done()
+			recs, err := rv.query(ctx, p)
+			if err != nil {
+				log.Debugf("rendezvous with %s: %s", p, err)
+				return
+			}
+			for _, rec := range recs {
+				rv.foundPeer(ctx, p, rec)
+			}
+		}(p)
+	}
+	wg.Wait()
+
+	rv.expire()
+}
+
+func (rv *Rendezvous) query(ctx context.Context, p peer.ID) ([]rendezvousRecord, error) {
+	ctx, cancel := context.WithTimeout(ctx, rendezvousStreamTimeout)
+	defer cancel()
+
+	s, err := rv.host.NewStream(ctx, p, RendezvousProtocol)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = s.SetDeadline(deadline)
+	}
+
+	req := rendezvousRequest{TTL: rv.ttl()}
+	for _, a := range rv.host.Addrs() {
+		req.Addrs = append(req.Addrs, a.String())
+	}
+	if err := json.NewEncoder(s).Encode(&req); err != nil {
+		_ = s.Reset()
+		return nil, err
+	}
+	if err := s.CloseWrite(); err != nil {
+		_ = s.Reset()
+		return nil, err
+	}
+
+	var resp rendezvousResponse
+	if err := json.NewDecoder(io.LimitReader(s, rendezvousMaxMessageSize)).Decode(&resp); err != nil {
+		_ = s.Reset()
+		return nil, err
+	}
+	return resp.Peers, nil
+}
+
+func (rv *Rendezvous) foundPeer(ctx context.Context, via peer.ID, rec rendezvousRecord) {
+	ai, ttl := rec.Peer, rec.TTL
+	if ai.ID == rv.host.ID() || ai.ID == "" || len(ai.Addrs) == 0 || ttl <= 0 {
+		return
+	}
+	if ttl > rendezvousMaxTTL {
+		ttl = rendezvousMaxTTL
+	}
+
+	now := time.Now()
+	rv.mu.Lock()
+	p, known := rv.found[ai.ID]
+	if !known {
+		p = &RendezvousPeer{}
+		rv.found[ai.ID] = p
+	}
+	p.LastSeen = now
+	// Keep the most recent registration.
+	if expires := now.Add(ttl); expires.After(p.Expires) {
+		p.AddrInfo = ai
+		p.Via = via
+		p.Expires = expires
+	}
+	addPeering := rv.peering != nil && !p.Peered && !rv.isPeered(ai.ID)
+	if addPeering {
+		p.Peered = true
+	}
+	rv.mu.Unlock()
+
+	if addPeering {
+		log.Infof("peering with %s, found through rendezvous with %s", ai.ID, via)
+		rv.peering.AddPeer(ai)
+		return
+	}
+	rv.host.Peerstore().AddAddrs(ai.ID, ai.Addrs, ttl)
+	if !known && rv.host.Network().Connectedness(ai.ID) != network.Connected {
+		go func() {
+			ctx, cancel := context.WithTimeout(ctx, discoveryConnTimeout)
+			defer cancel()
+			if err := rv.host.Connect(ctx, ai); err != nil {
+				log.Debugf("failed to connect to %s, found through rendezvous: %s", ai.ID, err)
+			}
+		}()
+	}
+}
+
+// isPeered reports whether p was added to the peering service by someone
+// else, e.g. from Peering.Peers, in which case it is left alone.
+func (rv *Rendezvous) isPeered(p peer.ID) bool {
+	for _, ai := range rv.peering.ListPeers() {
+		if ai.ID == p {
+			return true
+		}
+	}
+	return false
+}
+
+// expire forgets the registrations and the found peers that have expired,
+// and stops peering with the latter.
+func (rv *Rendezvous) expire() {
+	now := time.Now()
+	var unpeer []peer.ID
+
+	rv.mu.Lock()
+	for p, reg := range rv.registrations {
+		if now.After(reg.expires) {
+			delete(rv.registrations, p)
+		}
+	}
+	for id, p := range rv.found {
+		if now.After(p.Expires) {
+			delete(rv.found, id)
+			if p.Peered {
+				unpeer = append(unpeer, id)
+			}
+		}
+	}
+	rv.mu.Unlock()
+
+	for _, p := range unpeer {
+		log.Infof("no longer peering with %s, not found through rendezvous anymore", p)
+		rv.peering.RemovePeer(p)
+	}
+}
+
+// handleStream serves the requests of the peers using the node as rendezvous
+// point.
+func (rv *Rendezvous) handleStream(s network.Stream) {
+	defer s.Close()
+	_ = s.SetDeadline(time.Now().Add(rendezvousStreamTimeout))
+
+	var req rendezvousRequest
+	if err := json.NewDecoder(io.LimitReader(s, rendezvousMaxMessageSize)).Decode(&req); err != nil {
+		_ = s.Reset()
+		return
+	}
+
+	remote := s.Conn().RemotePeer()
+	ttl := req.TTL
+	if ttl > rendezvousMaxTTL {
+		ttl = rendezvousMaxTTL
+	}
+	var addrs []ma.Multiaddr
+	for _, a := range req.Addrs {
+		addr, err := ma.NewMultiaddr(a)
+		if err != nil {
+			_ = s.Reset()
+			return
+		}
+		addrs = append(addrs, addr)
+	}
+
+	rv.mu.Lock()
+	if ttl > 0 && len(addrs) > 0 {
+		rv.registrations[remote] = rendezvousRegistration{addrs: addrs, expires: time.Now().Add(ttl)}
+	} else {
+		ttl = 0
+	}
+	resp := rendezvousResponse{TTL: ttl}
+	now := time.Now()
+	for p, reg := range rv.registrations {
+		if p != remote && now.Before(reg.expires) {
+			resp.Peers = append(resp.Peers, rendezvousRecord{
+				Peer: peer.AddrInfo{ID: p, Addrs: reg.addrs},
+				TTL:  reg.expires.Sub(now),
+			})
+		}
+	}
+	// Peers found through other rendezvous points are shared too, so that
+	// peer lists propagate, with the lifetime of their registration.
+	for p, found := range rv.found {
+		if _, ok := rv.registrations[p]; !ok && p != remote && now.Before(found.Expires) {
+			resp.Peers = append(resp.Peers, rendezvousRecord{Peer: found.AddrInfo, TTL: found.Expires.Sub(now)})
+		}
+	}
+	rv.mu.Unlock()
+
+	if len(resp.Peers) > rendezvousMaxPeers {
+		rand.Shuffle(len(resp.Peers), func(i, j int) { resp.Peers[i], resp.Peers[j] = resp.Peers[j], resp.Peers[i] })
+		resp.Peers = resp.Peers[:rendezvousMaxPeers]
+	}
+
+	if err := json.NewEncoder(s).Encode(&resp); err != nil {
+		_ = s.Reset()
+	}
+}
@@ -0,0 +1,113 @@
+package libp2p
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/peering"
+	"github.com/libp2p/go-libp2p/core/host"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRendezvous(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	mn, err := mocknet.FullMeshLinked(3)
+	require.NoError(err)
+	defer mn.Close()
+	hosts := mn.Hosts()
+	a, point, c := hosts[0], hosts[1], hosts[2]
+
+	ps := peering.NewPeeringService(a)
+	require.NoError(ps.Start())
+	defer ps.Stop()
+
+	rvA := newRendezvous(a, ps, time.Minute, false)
+	newRendezvous(point, nil, time.Minute, true)
+	rvC := newRendezvous(c, nil, time.Minute, false)
+
+	// a and c only know the rendezvous point.
+	for _, h := range []host.Host{a, c} {
+		_, err := mn.ConnectPeers(h.ID(), point.ID())
+		require.NoError(err)
+		h.Peerstore().AddProtocols(point.ID(), RendezvousProtocol)
+	}
+
+	rvA.round(ctx)
+	require.Empty(rvA.Peers())
+
+	rvC.round(ctx)
+	peers := rvC.Peers()
+	require.Len(peers, 1)
+	require.Equal(a.ID(), peers[0].ID)
+	require.Equal(point.ID(), peers[0].Via)
+	require.False(peers[0].Peered)
+
+	// Found peers are added to the peering service, when set.
+	rvA.round(ctx)
+	peers = rvA.Peers()
+	require.Len(peers, 1)
+	require.Equal(c.ID(), peers[0].ID)
+	require.True(peers[0].Peered)
+	require.Equal(c.ID(), ps.ListPeers()[0].ID)
+
+	// Peers no longer found are forgotten.
+	rvA.mu.Lock()
+	rvA.found[c.ID()].Expires = time.Now().Add(-time.Second)
+	rvA.mu.Unlock()
+	rvA.expire()
+	require.Empty(rvA.Peers())
+	require.Empty(ps.ListPeers())
+}
+
+func TestRendezvousPeerLeaves(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	mn, err := mocknet.FullMeshConnected(3)
+	require.NoError(err)
+	defer mn.Close()
+	hosts := mn.Hosts()
+
+	const interval = 100 * time.Millisecond
+	var rvs []*Rendezvous
+	for _, h := range hosts {
+		rvs = append(rvs, newRendezvous(h, nil, interval, true))
+		for _, other := range hosts {
+			if other != h {
+				h.Peerstore().AddProtocols(other.ID(), RendezvousProtocol)
+			}
+		}
+	}
+	for i := 0; i < 2; i++ {
+		for _, rv := range rvs {
+			rv.round(ctx)
+		}
+	}
+	for _, rv := range rvs {
+		require.Len(rv.Peers(), 2)
+	}
+
+	// The last peer leaves: the other two keep sharing it with each other,
+	// but not past the expiry of its last registration.
+	left := hosts[2].ID()
+	require.NoError(mn.UnlinkPeers(hosts[0].ID(), left))
+	require.NoError(mn.UnlinkPeers(hosts[1].ID(), left))
+	require.NoError(mn.DisconnectPeers(hosts[0].ID(), left))
+	require.NoError(mn.DisconnectPeers(hosts[1].ID(), left))
+
+	deadline := time.Now().Add(3*rvs[0].ttl() + time.Second)
+	for time.Now().Before(deadline) {
+		rvs[0].round(ctx)
+		rvs[1].round(ctx)
+		time.Sleep(interval / 2)
+	}
+	for _, rv := range rvs[:2] {
+		for _, p := range rv.Peers() {
+			require.NotEqual(left, p.ID)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package libp2p
+
+import (
+	"encoding/binary"
+	"errors"
+
+	bsmsg "github.com/ipfs/boxo/bitswap/message"
+	"github.com/ipfs/boxo/bitswap/tracer"
+	"github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/reputation"
+	dhtpb "github.com/libp2p/go-libp2p-kad-dht/pb"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	record "github.com/libp2p/go-libp2p-record"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// Misbehaviors reported to the reputation subsystem, and their penalties.
+// With the default Swarm.Reputation.BanThreshold, a peer is banned after
+// about 10 invalid pubsub messages, invalid DHT records or oversized
+// wantlists, or 100 streams
+// over its limit, in a few minutes.
+const (
+	ReasonBitswapWantlist = "bitswap-wantlist"
+	ReasonDHTInvalid      = "dht-invalid"
+	ReasonPubsubInvalid   = "pubsub-invalid"
+	ReasonStreamLimit     = "stream-limit"
+
+	penaltyBitswapWantlist = 10
+	penaltyDHTInvalid      = 10
+	penaltyPubsubInvalid   = 10
+	penaltyStreamLimit     = 1
+)
+
+// ReputationTracker returns the reputation tracker configured by cfg, or nil
+// when the reputation subsystem is disabled.
+func ReputationTracker(cfg config.Reputation) (*reputation.Tracker, error) {
+	if !cfg.Enabled.WithDefault(config.DefaultReputationEnabled) {
+		return nil, nil
+	}
+	threshold := cfg.BanThreshold.WithDefault(config.DefaultReputationBanThreshold)
+	if threshold <= 0 {
+		return nil, errors.New("Swarm.Reputation.BanThreshold must be positive")
+	}
+	banDuration := cfg.BanDuration.WithDefault(config.DefaultReputationBanDuration)
+	if banDuration <= 0 {
+		return nil, errors.New("Swarm.Reputation.BanDuration must be positive")
+	}
+	return reputation.NewTracker(float64(threshold), banDuration), nil
+}
+
+// ReputationBans disconnects the peers when they get banned. New connections
+// are refused by the connection gater.
+func ReputationBans(rep *reputation.Tracker) func(host.Host) {
+	return func(h host.Host) {
+		rep.OnBan(func(p peer.ID) {
+			if err := h.Network().ClosePeer(p); err != nil {
+				log.Debugf("disconnecting banned peer %s: %s", p, err)
+			}
+		})
+	}
+}
+
+// reputationBitswapTracer penalizes the peers sending more wantlist entries
+// at once than bitswap keeps.
+type reputationBitswapTracer struct {
+	rep             *reputation.Tracker
+	maxWantlistSize int
+}
+
+// ReputationBitswapTracer returns a bitswap tracer reporting oversized
+// wantlists to rep.
+func ReputationBitswapTracer(rep *reputation.Tracker, maxWantlistSize int) tracer.Tracer {
+	return &reputationBitswapTracer{rep: rep, maxWantlistSize: maxWantlistSize}
+}
+
+func (t *reputationBitswapTracer) MessageReceived(p peer.ID, msg bsmsg.BitSwapMessage) {
+	if len(msg.Wantlist()) > t.maxWantlistSize {
+		t.rep.Penalize(p, ReasonBitswapWantlist, penaltyBitswapWantlist)
+	}
+}
+
+func (t *reputationBitswapTracer) MessageSent(peer.ID, bsmsg.BitSwapMessage) {}
+
+// reputationPubsubTracer penalizes the peers forwarding messages that fail
+// signature checks or validation, such as invalid IPNS records, or that are
+// rejected by the validator plugin of their topic.
+type reputationPubsubTracer struct {
+	rep *reputation.Tracker
+}
+
+var _ pubsub.RawTracer = (*reputationPubsubTracer)(nil)
+
+// ReputationPubsubTracing returns the options reporting invalid pubsub
+// messages to rep.
+func ReputationPubsubTracing(rep *reputation.Tracker) []pubsub.Option {
+	return []pubsub.Option{pubsub.WithRawTracer(&reputationPubsubTracer{rep: rep})}
+}
+
+func (t *reputationPubsubTracer) RejectMessage(msg *pubsub.Message, reason string) {
+	switch reason {
+	case pubsub.RejectMissingSignature, pubsub.RejectUnexpectedSignature, pubsub.RejectUnexpectedAuthInfo,
+		pubsub.RejectInvalidSignature, pubsub.RejectValidationFailed:
+		// Messages rejected by the allowed publishers or the maximum message
+		// size of Pubsub.Topics break a local policy, not the protocol.
+		if r, ok := msg.ValidatorData.(pubsubRejection); ok && r != rejectReasonValidator {
+			return
+		}
+		t.rep.Penalize(msg.ReceivedFrom, ReasonPubsubInvalid, penaltyPubsubInvalid)
+	}
+}
+
+func (t *reputationPubsubTracer) AddPeer(p peer.ID, proto protocol.ID)     {}
+func (t *reputationPubsubTracer) RemovePeer(p peer.ID)                     {}
+func (t *reputationPubsubTracer) Join(topic string)                        {}
+func (t *reputationPubsubTracer) Leave(topic string)                       {}
+func (t *reputationPubsubTracer) Graft(p peer.ID, topic string)            {}
+func (t *reputationPubsubTracer) Prune(p peer.ID, topic string)            {}
+func (t *reputationPubsubTracer) ValidateMessage(msg *pubsub.Message)      {}
+func (t *reputationPubsubTracer) DeliverMessage(msg *pubsub.Message)       {}
+func (t *reputationPubsubTracer) DuplicateMessage(msg *pubsub.Message)     {}
+func (t *reputationPubsubTracer) ThrottlePeer(p peer.ID)                   {}
+func (t *reputationPubsubTracer) RecvRPC(rpc *pubsub.RPC)                  {}
+func (t *reputationPubsubTracer) SendRPC(rpc *pubsub.RPC, p peer.ID)       {}
+func (t *reputationPubsubTracer) DropRPC(rpc *pubsub.RPC, p peer.ID)       {}
+func (t *reputationPubsubTracer) UndeliverableMessage(msg *pubsub.Message) {}
+
+// reputationDHTHost is the host given to the DHT, to penalize the peers
+// putting invalid records. The DHT validates the records, but does not tell
+// which peer sent them: the records of the PUT_VALUE messages are validated
+// again as the DHT reads them from the streams of the peers.
+type reputationDHTHost struct {
+	host.Host
+	rep       *reputation.Tracker
+	validator record.Validator
+}
+
+// ReputationDHTHost wraps the host given to the DHT to report the peers
+// putting records failing validator to rep.
+func ReputationDHTHost(h host.Host, rep *reputation.Tracker, validator record.Validator) host.Host {
+	return &reputationDHTHost{Host: h, rep: rep, validator: validator}
+}
+
+func (h *reputationDHTHost) SetStreamHandler(pid protocol.ID, handler network.StreamHandler) {
+	h.Host.SetStreamHandler(pid, func(s network.Stream) {
+		handler(&reputationDHTStream{Stream: s, host: h})
+	})
+}
+
+// reputationDHTStream splits the data read from a DHT stream in the varint
+// length prefixed messages of the DHT protocol, and checks the records put.
+type reputationDHTStream struct {
+	network.Stream
+	host *reputationDHTHost
+
+	// size holds the bytes of the length of the next message while it is
+	// read, and msg the message read so far after that.
+	size   []byte
+	msg    []byte
+	broken bool
+}
+
+func (s *reputationDHTStream) Read(b []byte) (int, error) {
+	n, err := s.Stream.Read(b)
+	if !s.broken {
+		s.consume(b[:n])
+	}
+	return n, err
+}
+
+func (s *reputationDHTStream) consume(b []byte) {
+	for len(b) > 0 {
+		if s.msg == nil {
+			c := b[0]
+			b = b[1:]
+			s.size = append(s.size, c)
+			if c&0x80 != 0 {
+				if len(s.size) == binary.MaxVarintLen64 {
+					s.broken = true
+					return
+				}
+				continue
+			}
+			size, _ := binary.Uvarint(s.size)
+			s.size = s.size[:0]
+			if size > network.MessageSizeMax {
+				// The DHT resets the stream.
+				s.broken = true
+				return
+			}
+			s.msg = make([]byte, 0, size)
+		} else {
+			n := min(cap(s.msg)-len(s.msg), len(b))
+			s.msg = append(s.msg, b[:n]...)
+			b = b[n:]
+		}
+		if len(s.msg) == cap(s.msg) {
+			s.check(s.msg)
+			s.msg = nil
+		}
+	}
+}
+
+func (s *reputationDHTStream) check(msg []byte) {
+	var req dhtpb.Message
+	if err := req.Unmarshal(msg); err != nil || req.GetType() != dhtpb.Message_PUT_VALUE {
+		return
+	}
+	rec := req.GetRecord()
+	if rec == nil {
+		return
+	}
+	// Records of unknown types may come from newer nodes, and are not
+	// penalized.
+	err := s.host.validator.Validate(string(rec.GetKey()), rec.GetValue())
+	if err != nil && !errors.Is(err, record.ErrInvalidRecordType) {
+		s.host.rep.Penalize(s.Conn().RemotePeer(), ReasonDHTInvalid, penaltyDHTInvalid)
+	}
+}
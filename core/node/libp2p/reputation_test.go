@@ -0,0 +1,109 @@
+package libp2p
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ipfs/kubo/reputation"
+	dhtpb "github.com/libp2p/go-libp2p-kad-dht/pb"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	record "github.com/libp2p/go-libp2p-record"
+	recpb "github.com/libp2p/go-libp2p-record/pb"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/test"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReputationPubsubTracer(t *testing.T) {
+	rep := reputation.NewTracker(1000, time.Hour)
+	tr := &reputationPubsubTracer{rep: rep}
+
+	p, err := test.RandPeerID()
+	require.NoError(t, err)
+	reject := func(data interface{}, reason string) {
+		tr.RejectMessage(&pubsub.Message{Message: &pb.Message{}, ReceivedFrom: p, ValidatorData: data}, reason)
+	}
+
+	// Local policies of Pubsub.Topics are not misbehavior.
+	reject(pubsubRejection(rejectReasonPublisher), pubsub.RejectValidationFailed)
+	reject(pubsubRejection(rejectReasonSize), pubsub.RejectValidationFailed)
+	reject(pubsubRejection(rejectReasonRate), pubsub.RejectValidationIgnored)
+	reject(nil, pubsub.RejectValidationThrottled)
+	require.Empty(t, rep.Peers())
+
+	reject(nil, pubsub.RejectInvalidSignature)
+	reject(nil, pubsub.RejectValidationFailed)
+	reject(pubsubRejection(rejectReasonValidator), pubsub.RejectValidationFailed)
+	peers := rep.Peers()
+	require.Len(t, peers, 1)
+	require.Equal(t, 3, peers[0].Reasons[ReasonPubsubInvalid])
+}
+
+type testRecordValidator struct{}
+
+func (testRecordValidator) Validate(_ string, value []byte) error {
+	if string(value) != "valid" {
+		return errors.New("invalid record")
+	}
+	return nil
+}
+
+func (testRecordValidator) Select(string, [][]byte) (int, error) { return 0, nil }
+
+func TestReputationDHTHost(t *testing.T) {
+	mn := mocknet.New()
+	defer mn.Close()
+	server, err := mn.GenPeer()
+	require.NoError(t, err)
+	client, err := mn.GenPeer()
+	require.NoError(t, err)
+	require.NoError(t, mn.LinkAll())
+	require.NoError(t, mn.ConnectAllButSelf())
+
+	rep := reputation.NewTracker(1000, time.Hour)
+	h := ReputationDHTHost(server, rep, record.NamespacedValidator{"test": testRecordValidator{}})
+	done := make(chan struct{})
+	h.SetStreamHandler("/test/kad", func(s network.Stream) {
+		defer close(done)
+		// Read in small chunks to split the messages.
+		buf := make([]byte, 3)
+		for {
+			if _, err := s.Read(buf); err != nil {
+				return
+			}
+		}
+	})
+
+	var data []byte
+	for _, m := range []*dhtpb.Message{
+		{Type: dhtpb.Message_PUT_VALUE, Key: []byte("/test/a"), Record: &recpb.Record{Key: []byte("/test/a"), Value: []byte("valid")}},
+		{Type: dhtpb.Message_PUT_VALUE, Key: []byte("/test/b"), Record: &recpb.Record{Key: []byte("/test/b"), Value: []byte("invalid")}},
+		{Type: dhtpb.Message_GET_VALUE, Key: []byte("/test/c")},
+		{},
+		{Type: dhtpb.Message_PUT_VALUE, Key: []byte("/other/d"), Record: &recpb.Record{Key: []byte("/other/d"), Value: []byte("valid")}},
+	} {
+		b, err := m.Marshal()
+		require.NoError(t, err)
+		data = binary.AppendUvarint(data, uint64(len(b)))
+		data = append(data, b...)
+	}
+
+	s, err := client.NewStream(context.Background(), server.ID(), "/test/kad")
+	require.NoError(t, err)
+	_, err = s.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+	<-done
+
+	// Only the invalid record is penalized, not the record of an unknown
+	// namespace.
+	peers := rep.Peers()
+	require.Len(t, peers, 1)
+	require.Equal(t, client.ID(), peers[0].ID)
+	require.Equal(t, 1, peers[0].Reasons[ReasonDHTInvalid])
+}
@@ -278,8 +278,8 @@ func autoRelayFeeder(cfgPeering config.Peering, peerChan chan<- peer.AddrInfo) f
 					return
 				}
 
-				// Always feed trusted IDs (Peering.Peers in the config)
-				for _, trustedPeer := range cfgPeering.Peers {
+				// Always feed trusted IDs (Peering.Peers and Peering.Groups in the config)
+				for _, trustedPeer := range cfgPeering.AllPeers() {
 					if len(trustedPeer.Addrs) == 0 {
 						continue
 					}
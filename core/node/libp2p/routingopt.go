@@ -16,12 +16,15 @@ import (
 	host "github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/peer"
 	routing "github.com/libp2p/go-libp2p/core/routing"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
 )
 
 type RoutingOptionArgs struct {
 	Ctx                           context.Context
 	Host                          host.Host
 	Datastore                     datastore.Batching
+	RepoPath                      string
 	Validator                     record.Validator
 	BootstrapPeers                []peer.AddrInfo
 	OptimisticProvide             bool
@@ -140,10 +143,60 @@ func ConstructDelegatedRouting(routers config.Routers, methods config.Methods, p
 				Addrs:      httpAddrsFromConfig(addrs),
 				PrivKeyB64: privKey,
 			},
+			&irouting.ExtraStaticParams{
+				RepoPath:  args.RepoPath,
+				Datastore: args.Datastore,
+			},
 		)
 	}
 }
 
+// LAN describes the LAN mode of the node, set with Routing.Type = "lan".
+type LAN struct {
+	// MDNSServiceTag is the mDNS service the node is discovered under, or
+	// empty when mDNS discovery is disabled.
+	MDNSServiceTag string
+}
+
+// BootstrapPeers keeps the addresses of ps in local networks, and drops the
+// peers without any, such as the public bootstrap peers.
+func (l *LAN) BootstrapPeers(ps []peer.AddrInfo) []peer.AddrInfo {
+	var out []peer.AddrInfo
+	for _, p := range ps {
+		var addrs []ma.Multiaddr
+		for _, a := range p.Addrs {
+			if manet.IsPrivateAddr(a) || manet.IsIPLoopback(a) {
+				addrs = append(addrs, a)
+			}
+		}
+		if len(addrs) > 0 {
+			out = append(out, peer.AddrInfo{ID: p.ID, Addrs: addrs})
+		}
+	}
+	return out
+}
+
+// constructLANDHTRouting is used when Routing.Type = "lan". The node runs a
+// LAN DHT server, and keeps the WAN DHT of the dual DHT empty so that the
+// public DHT is never queried or bootstrapped.
+func constructLANDHTRouting(args RoutingOptionArgs) (routing.Routing, error) {
+	dhtOpts := []dht.Option{
+		dht.Concurrency(10),
+		dht.Datastore(args.Datastore),
+		dht.Validator(args.Validator),
+	}
+	return dual.New(
+		args.Ctx, args.Host,
+		dual.DHTOption(dhtOpts...),
+		dual.WanDHTOption(
+			dht.Mode(dht.ModeClient),
+			dht.RoutingTableFilter(func(interface{}, peer.ID) bool { return false }),
+			dht.DisableAutoRefresh(),
+		),
+		dual.LanDHTOption(dht.Mode(dht.ModeServer)),
+	)
+}
+
 func constructNilRouting(_ RoutingOptionArgs) (routing.Routing, error) {
 	return routinghelpers.Null{}, nil
 }
@@ -152,6 +205,7 @@ var (
 	DHTOption       RoutingOption = constructDHTRouting(dht.ModeAuto)
 	DHTClientOption               = constructDHTRouting(dht.ModeClient)
 	DHTServerOption               = constructDHTRouting(dht.ModeServer)
+	LANDHTOption                  = constructLANDHTRouting
 	NilRouterOption               = constructNilRouting
 )
 
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	config "github.com/ipfs/kubo/config"
+	ma "github.com/multiformats/go-multiaddr"
 	"github.com/stretchr/testify/require"
 )
 
@@ -32,3 +33,43 @@ func TestHttpAddrsFromConfig(t *testing.T) {
 			AppendAnnounce: []string{"/ip4/192.168.0.2/tcp/4001"},
 		}), "AppendAnnounce addrs should be included if specified")
 }
+
+func TestLANBootstrapPeers(t *testing.T) {
+	ps, err := config.ParseBootstrapPeers([]string{
+		"/ip4/192.168.1.2/tcp/4001/p2p/12D3KooWGzxzKZYveHXtpCZ9nUo4jZqu7YwXWn2AVQC1UvYVo1dW",
+		"/ip4/1.2.3.4/tcp/4001/p2p/12D3KooWGzxzKZYveHXtpCZ9nUo4jZqu7YwXWn2AVQC1UvYVo1dW",
+		"/dnsaddr/bootstrap.libp2p.io/p2p/QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN",
+	})
+	require.NoError(t, err)
+
+	lan := (&LAN{}).BootstrapPeers(ps)
+	require.Len(t, lan, 1, "public bootstrap peers should be skipped")
+	require.Equal(t, "12D3KooWGzxzKZYveHXtpCZ9nUo4jZqu7YwXWn2AVQC1UvYVo1dW", lan[0].ID.String())
+	require.Len(t, lan[0].Addrs, 1, "public addrs should be dropped")
+	require.Equal(t, "/ip4/192.168.1.2/tcp/4001", lan[0].Addrs[0].String())
+}
+
+func TestAddrsFactoryPreferLocal(t *testing.T) {
+	af, err := makeAddrsFactory(nil, nil, nil, true)
+	require.NoError(t, err)
+
+	var addrs []ma.Multiaddr
+	for _, s := range []string{
+		"/ip4/127.0.0.1/tcp/4001",
+		"/ip4/1.2.3.4/tcp/4001",
+		"/ip6/fe80::1/tcp/4001",
+		"/ip4/10.0.0.2/tcp/4001",
+	} {
+		addrs = append(addrs, ma.StringCast(s))
+	}
+	var out []string
+	for _, a := range af(addrs) {
+		out = append(out, a.String())
+	}
+	require.Equal(t, []string{
+		"/ip6/fe80::1/tcp/4001",
+		"/ip4/10.0.0.2/tcp/4001",
+		"/ip4/1.2.3.4/tcp/4001",
+		"/ip4/127.0.0.1/tcp/4001",
+	}, out)
+}
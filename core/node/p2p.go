@@ -0,0 +1,74 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	pstore "github.com/libp2p/go-libp2p/core/peerstore"
+	"go.uber.org/fx"
+
+	config "github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/core/node/helpers"
+	"github.com/ipfs/kubo/p2p"
+)
+
+// p2pResolveTimeout bounds the resolution of the DNS target addresses of
+// P2P.Forwards.
+const p2pResolveTimeout = 10 * time.Second
+
+// P2PListeners starts the libp2p services listed in P2P.Listeners, as with
+// 'ipfs p2p listen'.
+func P2PListeners(listeners []config.P2PListener) interface{} {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, p *p2p.P2P) {
+		ctx := helpers.LifecycleCtx(mctx, lc)
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				for _, l := range listeners {
+					proto, target, opts, err := p2p.ParseListenerConfig(l)
+					if err != nil {
+						return fmt.Errorf("invalid P2P.Listeners entry for %q: %w", l.Protocol, err)
+					}
+					if _, err := p.ForwardRemoteWithOptions(ctx, proto, target, opts); err != nil {
+						return fmt.Errorf("starting p2p listener %q: %w", l.Protocol, err)
+					}
+				}
+				return nil
+			},
+		})
+	}
+}
+
+// P2PForwards starts the forwards listed in P2P.Forwards, as with 'ipfs p2p
+// forward'. Forwards whose target can't be resolved are skipped with an
+// error in the logs, so that a DNS failure doesn't prevent the daemon from
+// starting.
+func P2PForwards(forwards []config.P2PForward) interface{} {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, p *p2p.P2P, ps pstore.Peerstore) {
+		ctx := helpers.LifecycleCtx(mctx, lc)
+		lc.Append(fx.Hook{
+			OnStart: func(startCtx context.Context) error {
+				for _, f := range forwards {
+					proto, listen, target, err := p2p.ParseForwardConfig(f)
+					if err != nil {
+						return fmt.Errorf("invalid P2P.Forwards entry for %q: %w", f.ListenAddress, err)
+					}
+
+					rctx, cancel := context.WithTimeout(startCtx, p2pResolveTimeout)
+					pi, err := p2p.ResolvePeerAddr(rctx, target)
+					cancel()
+					if err != nil {
+						logger.Errorf("skipping p2p forward %s: resolving %s: %s", f.ListenAddress, f.TargetAddress, err)
+						continue
+					}
+
+					ps.AddAddrs(pi.ID, pi.Addrs, pstore.TempAddrTTL)
+					if _, err := p.ForwardLocalWithToken(ctx, pi.ID, proto, listen, f.Token); err != nil {
+						return fmt.Errorf("starting p2p forward %s: %w", f.ListenAddress, err)
+					}
+				}
+				return nil
+			},
+		})
+	}
+}
@@ -2,8 +2,11 @@ package node
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/ipfs/boxo/peering"
+	"github.com/ipfs/kubo/config"
+	kpeering "github.com/ipfs/kubo/peering"
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"go.uber.org/fx"
@@ -33,3 +36,51 @@ func PeerWith(peers ...peer.AddrInfo) fx.Option {
 		}
 	})
 }
+
+// PeeringGroups constructs the peering groups, with the peers of
+// Peering.Peers in the default group, and hooks them into fx's lifetime
+// management system.
+func PeeringGroups(cfg config.Peering) func(fx.Lifecycle, host.Host, *peering.PeeringService) (*kpeering.Groups, error) {
+	return func(lc fx.Lifecycle, host host.Host, ps *peering.PeeringService) (*kpeering.Groups, error) {
+		groupOf := make(map[peer.ID]string)
+		for _, ai := range cfg.Peers {
+			groupOf[ai.ID] = kpeering.DefaultGroup
+		}
+		for name, group := range cfg.Groups {
+			for _, ai := range group.Peers {
+				if other, ok := groupOf[ai.ID]; ok && other != name {
+					return nil, fmt.Errorf("peer %s is in both the %q and %q peering groups", ai.ID, other, name)
+				}
+				groupOf[ai.ID] = name
+			}
+		}
+
+		groups := kpeering.NewGroups(host, ps)
+		lc.Append(fx.Hook{
+			OnStop: func(context.Context) error {
+				groups.Close()
+				return nil
+			},
+		})
+
+		for name, group := range cfg.Groups {
+			err := groups.SetBackoff(name, kpeering.Backoff{
+				Initial: group.InitialBackoff.WithDefault(config.DefaultPeeringInitialBackoff),
+				Max:     group.MaxBackoff.WithDefault(config.DefaultPeeringMaxBackoff),
+			})
+			if err != nil {
+				groups.Close()
+				return nil, fmt.Errorf("peering group %q: %w", name, err)
+			}
+		}
+		for _, ai := range cfg.Peers {
+			groups.AddPeer(kpeering.DefaultGroup, ai)
+		}
+		for name, group := range cfg.Groups {
+			for _, ai := range group.Peers {
+				groups.AddPeer(name, ai)
+			}
+		}
+		return groups, nil
+	}
+}
@@ -0,0 +1,332 @@
+// Package dnsresolver wraps the DNS resolver of the gateway, which resolves
+// names with the DNS over HTTPS resolvers of DNS.Resolvers, to explain how
+// lookups were answered and to list and flush the answers of the DoH
+// resolvers.
+package dnsresolver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http/httptrace"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/boxo/gateway"
+	doh "github.com/libp2p/go-doh-resolver"
+	"github.com/miekg/dns"
+	madns "github.com/multiformats/go-multiaddr-dns"
+)
+
+// SystemResolver is the name of the resolver provided by the operating
+// system, used for the domains without a DoH resolver.
+const SystemResolver = "system"
+
+const (
+	// minSweep is the number of cache entries below which the expired
+	// entries are not swept.
+	minSweep = 1024
+	// maxCacheEntries is the maximum number of cache entries listed. The
+	// entries closest to expiring are dropped first from the list when it is
+	// full, they are still cached by the DoH resolvers.
+	maxCacheEntries = 64 * 1024
+)
+
+// Lookup describes how a DNS query was answered.
+type Lookup struct {
+	Name     string
+	Type     string
+	Resolver string
+	Records  []string
+	// TTL is the TTL of the records in seconds, as answered by a DoH
+	// resolver, or what remains of it when answered from the cache.
+	TTL uint32 `json:",omitempty"`
+	// Cached is set when a DoH resolver answered from its cache.
+	Cached bool
+	Error  string `json:",omitempty"`
+}
+
+// CacheEntry is an answer fetched from a DoH resolver, which caches it for
+// its TTL, capped by the max cache TTL.
+type CacheEntry struct {
+	Name     string
+	Type     string
+	Resolver string
+	Records  []string
+	Fetched  time.Time
+	// TTL is the TTL of the records in seconds, as answered by the DoH
+	// resolver.
+	TTL uint32
+	// Expires is when the answer is dropped from the cache.
+	Expires time.Time
+}
+
+type cacheKey struct {
+	name  string
+	qtype string
+}
+
+// Resolver resolves DNS names with the resolver built by
+// gateway.NewDNSResolver. It implements madns.BasicResolver, and wraps a
+// madns.Resolver for resolving multiaddrs.
+type Resolver struct {
+	*madns.Resolver
+
+	resolvers   map[string]string
+	maxCacheTTL time.Duration
+
+	mu      sync.Mutex
+	inner   *madns.Resolver
+	cache   map[cacheKey]CacheEntry
+	sweepAt int
+}
+
+// ValidateResolvers checks the domains and URLs of the DNS.Resolvers
+// configuration.
+func ValidateResolvers(resolvers map[string]string) error {
+	for domain, u := range resolvers {
+		if domain != "." && !dns.IsFqdn(domain) {
+			return fmt.Errorf("DNS.Resolvers: invalid domain %q: must be a fully qualified domain name ending with a dot, such as %q", domain, dns.Fqdn(domain))
+		}
+		if _, ok := dns.IsDomainName(domain); !ok {
+			return fmt.Errorf("DNS.Resolvers: invalid domain %q", domain)
+		}
+		if u == "" {
+			continue
+		}
+		parsed, err := url.Parse(u)
+		if err != nil {
+			return fmt.Errorf("DNS.Resolvers: invalid resolver URL for %q: %w", domain, err)
+		}
+		if parsed.Scheme != "https" {
+			return fmt.Errorf("DNS.Resolvers: invalid resolver URL %q for %q: only https:// DNS over HTTPS endpoints are supported", u, domain)
+		}
+		if parsed.Host == "" {
+			return fmt.Errorf("DNS.Resolvers: invalid resolver URL %q for %q: missing host", u, domain)
+		}
+	}
+	return nil
+}
+
+// New returns a resolver using the given map of FQDNs to DoH resolver URLs,
+// on top of the implicit resolvers of gateway.NewDNSResolver. An empty URL
+// selects the system resolver. DoH answers are cached for their TTL, capped
+// by maxCacheTTL.
+func New(resolvers map[string]string, maxCacheTTL time.Duration) (*Resolver, error) {
+	if err := ValidateResolvers(resolvers); err != nil {
+		return nil, err
+	}
+
+	installTransport()
+	r := &Resolver{
+		resolvers:   resolvers,
+		maxCacheTTL: maxCacheTTL,
+		cache:       make(map[cacheKey]CacheEntry),
+		sweepAt:     minSweep,
+	}
+	var err error
+	r.inner, err = r.newInner()
+	if err != nil {
+		return nil, err
+	}
+	r.Resolver, err = madns.NewResolver(madns.WithDefaultResolver((*tracer)(r)))
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Resolver) newInner() (*madns.Resolver, error) {
+	return gateway.NewDNSResolver(r.resolvers, doh.WithMaxCacheTTL(r.maxCacheTTL))
+}
+
+// configuredFor returns the DNS.Resolvers URL of the most specific domain
+// that name is a subdomain of, like madns.Resolver does. ok is false when no
+// domain matches.
+func (r *Resolver) configuredFor(fqdn string) (u string, ok bool) {
+	for i := 0; ; {
+		if u, ok := r.resolvers[fqdn[i:]]; ok {
+			return u, true
+		}
+		next, end := dns.NextLabel(fqdn, i)
+		if end {
+			break
+		}
+		i = next
+	}
+	u, ok = r.resolvers["."]
+	return u, ok
+}
+
+// CacheEntries returns the cached answers fetched from DoH resolvers, sorted
+// by name and type.
+func (r *Resolver) CacheEntries() []CacheEntry {
+	now := time.Now()
+	r.mu.Lock()
+	entries := make([]CacheEntry, 0, len(r.cache))
+	for _, e := range r.cache {
+		if e.Expires.After(now) {
+			entries = append(entries, e)
+		}
+	}
+	r.mu.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Name != entries[j].Name {
+			return entries[i].Name < entries[j].Name
+		}
+		return entries[i].Type < entries[j].Type
+	})
+	return entries
+}
+
+// FlushCache empties the caches of the DoH resolvers, and returns the number
+// of cached answers.
+func (r *Resolver) FlushCache() (int, error) {
+	inner, err := r.newInner()
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int
+	for _, e := range r.cache {
+		if e.Expires.After(now) {
+			n++
+		}
+	}
+	r.inner = inner
+	r.cache = make(map[cacheKey]CacheEntry)
+	return n, nil
+}
+
+// record remembers an answer fetched from a DoH resolver, with the TTL of its
+// records. Like the DoH resolvers, answers with a zero TTL are not cached.
+func (r *Resolver) record(e CacheEntry) {
+	if e.TTL == 0 {
+		return
+	}
+	e.Expires = e.Fetched.Add(min(time.Duration(e.TTL)*time.Second, r.maxCacheTTL))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cache[cacheKey{e.Name, e.Type}] = e
+
+	// The expired entries are swept when the cache doubled in size since the
+	// last sweep. When the cache is still full, the entries closest to
+	// expiring are dropped.
+	if len(r.cache) < r.sweepAt && len(r.cache) <= maxCacheEntries {
+		return
+	}
+	now := time.Now()
+	for k, e := range r.cache {
+		if !e.Expires.After(now) {
+			delete(r.cache, k)
+		}
+	}
+	if len(r.cache) > maxCacheEntries {
+		keys := make([]cacheKey, 0, len(r.cache))
+		for k := range r.cache {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return r.cache[keys[i]].Expires.Before(r.cache[keys[j]].Expires)
+		})
+		for _, k := range keys[:len(keys)-maxCacheEntries*3/4] {
+			delete(r.cache, k)
+		}
+	}
+	r.sweepAt = min(max(2*len(r.cache), minSweep), maxCacheEntries+1)
+}
+
+// tracer is the madns.BasicResolver wrapping the inner resolver.
+type tracer Resolver
+
+// LookupTXT implements madns.BasicResolver.
+func (t *tracer) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	r := (*Resolver)(t)
+	var txt []string
+	err := r.lookup(ctx, name, "TXT", func(ctx context.Context, inner *madns.Resolver) ([]string, error) {
+		var err error
+		txt, err = inner.LookupTXT(ctx, name)
+		return txt, err
+	})
+	return txt, err
+}
+
+// LookupIPAddr implements madns.BasicResolver.
+func (t *tracer) LookupIPAddr(ctx context.Context, name string) ([]net.IPAddr, error) {
+	r := (*Resolver)(t)
+	var ips []net.IPAddr
+	err := r.lookup(ctx, name, "A/AAAA", func(ctx context.Context, inner *madns.Resolver) ([]string, error) {
+		var err error
+		ips, err = inner.LookupIPAddr(ctx, name)
+		records := make([]string, len(ips))
+		for i, ip := range ips {
+			records[i] = ip.String()
+		}
+		return records, err
+	})
+	return ips, err
+}
+
+// lookup runs a query with the inner resolver, and works out from the DoH
+// requests sent which resolver answered it.
+func (r *Resolver) lookup(ctx context.Context, name, qtype string, query func(context.Context, *madns.Resolver) ([]string, error)) error {
+	var (
+		mu   sync.Mutex
+		host string
+	)
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GetConn: func(hostPort string) {
+			mu.Lock()
+			host = strings.TrimSuffix(hostPort, ":443")
+			mu.Unlock()
+		},
+	})
+
+	ctx, rec := withTTLRecorder(ctx)
+
+	r.mu.Lock()
+	inner := r.inner
+	r.mu.Unlock()
+	records, err := query(ctx, inner)
+
+	l := Lookup{Name: dns.Fqdn(name), Type: qtype, Records: records}
+	key := cacheKey{l.Name, qtype}
+	configured, isConfigured := r.configuredFor(l.Name)
+	mu.Lock()
+	requested := host
+	mu.Unlock()
+	now := time.Now()
+	r.mu.Lock()
+	cached, isCached := r.cache[key]
+	r.mu.Unlock()
+	isCached = isCached && cached.Expires.After(now)
+	switch {
+	case requested != "":
+		l.Resolver = configured
+		if l.Resolver == "" {
+			// An implicit resolver of gateway.NewDNSResolver.
+			l.Resolver = "https://" + requested
+		}
+		l.TTL, _ = rec.TTL()
+		if err == nil && len(records) > 0 {
+			r.record(CacheEntry{Name: l.Name, Type: qtype, Resolver: l.Resolver, Records: records, Fetched: now, TTL: l.TTL})
+		}
+	case isCached:
+		l.Resolver, l.Cached = cached.Resolver, err == nil
+		l.TTL = uint32(cached.Expires.Sub(now).Round(time.Second) / time.Second)
+	case isConfigured && configured != "":
+		l.Resolver, l.Cached = configured, err == nil
+	default:
+		l.Resolver = SystemResolver
+	}
+	trace(ctx, l, err)
+	return err
+}
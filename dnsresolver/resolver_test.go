@@ -0,0 +1,174 @@
+package dnsresolver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+// mockDoHResolver answers TXT queries from records, and counts the queries.
+func mockDoHResolver(t *testing.T, records map[string][]string, queries *atomic.Int32) string {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries.Add(1)
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		m := new(dns.Msg)
+		require.NoError(t, m.Unpack(body))
+
+		resp := new(dns.Msg)
+		resp.SetReply(m)
+		q := m.Question[0]
+		txt, ok := records[q.Name]
+		if !ok {
+			resp.Rcode = dns.RcodeNameError
+		}
+		if q.Qtype == dns.TypeTXT {
+			for _, v := range txt {
+				resp.Answer = append(resp.Answer, &dns.TXT{
+					Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+					Txt: []string{v},
+				})
+			}
+		}
+		data, err := resp.Pack()
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+
+	// go-doh-resolver sends its queries with http.DefaultClient.
+	transport := http.DefaultClient.Transport
+	http.DefaultClient.Transport = srv.Client().Transport
+	t.Cleanup(func() { http.DefaultClient.Transport = transport })
+	return srv.URL
+}
+
+func TestValidateResolvers(t *testing.T) {
+	for _, resolvers := range []map[string]string{
+		{"eth": "https://dns.eth.limo/dns-query"},
+		{"eth.": "http://dns.eth.limo/dns-query"},
+		{"eth.": "dns.eth.limo"},
+		{"eth.": "https:///dns-query"},
+		{"eth.": "https://dns.eth.limo:port/dns-query"},
+	} {
+		require.Error(t, ValidateResolvers(resolvers), resolvers)
+	}
+	require.NoError(t, ValidateResolvers(map[string]string{
+		".":     "https://cloudflare-dns.com/dns-query",
+		"eth.":  "",
+		"test.": "https://127.0.0.1:8053/dns-query",
+	}))
+}
+
+func TestResolverLookups(t *testing.T) {
+	var queries atomic.Int32
+	url := mockDoHResolver(t, map[string][]string{
+		"_dnslink.example.com.": {"dnslink=/ipfs/bafkqaaa"},
+	}, &queries)
+	r, err := New(map[string]string{"com.": url}, 30*time.Second)
+	require.NoError(t, err)
+
+	ctx, trace := WithTrace(context.Background())
+	txt, err := r.LookupTXT(ctx, "_dnslink.example.com")
+	require.NoError(t, err)
+	require.Equal(t, []string{"dnslink=/ipfs/bafkqaaa"}, txt)
+
+	txt, err = r.LookupTXT(ctx, "_dnslink.example.com.")
+	require.NoError(t, err)
+	require.Equal(t, []string{"dnslink=/ipfs/bafkqaaa"}, txt)
+	require.EqualValues(t, 1, queries.Load())
+
+	// Empty answers are not cached.
+	txt, err = r.LookupTXT(ctx, "_dnslink.missing.com")
+	require.NoError(t, err)
+	require.Empty(t, txt)
+	require.EqualValues(t, 2, queries.Load())
+
+	lookups := trace.Lookups()
+	require.Len(t, lookups, 3)
+	require.Equal(t, Lookup{
+		Name:     "_dnslink.example.com.",
+		Type:     "TXT",
+		Resolver: url,
+		Records:  []string{"dnslink=/ipfs/bafkqaaa"},
+		TTL:      60,
+	}, lookups[0])
+	require.True(t, lookups[1].Cached)
+	require.Equal(t, url, lookups[1].Resolver)
+	// The remaining TTL, capped by the max cache TTL.
+	require.InDelta(t, 30, lookups[1].TTL, 1)
+	require.False(t, lookups[2].Cached)
+
+	entries := r.CacheEntries()
+	require.Len(t, entries, 1)
+	require.Equal(t, "_dnslink.example.com.", entries[0].Name)
+	require.Equal(t, url, entries[0].Resolver)
+	require.EqualValues(t, 60, entries[0].TTL)
+	require.Equal(t, entries[0].Fetched.Add(30*time.Second), entries[0].Expires)
+
+	n, err := r.FlushCache()
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Empty(t, r.CacheEntries())
+	_, err = r.LookupTXT(ctx, "_dnslink.example.com")
+	require.NoError(t, err)
+	require.EqualValues(t, 3, queries.Load())
+
+	// Multiaddr resolution goes through the same resolvers.
+	_, err = r.Resolve(ctx, ma.StringCast("/dnsaddr/example.com"))
+	require.NoError(t, err)
+	require.EqualValues(t, 4, queries.Load())
+}
+
+func TestResolverCacheExpiry(t *testing.T) {
+	r, err := New(nil, time.Hour)
+	require.NoError(t, err)
+
+	now := time.Now()
+	r.record(CacheEntry{Name: "expired.", Type: "TXT", Fetched: now.Add(-time.Minute), TTL: 30})
+	r.record(CacheEntry{Name: "uncached.", Type: "TXT", Fetched: now})
+	r.record(CacheEntry{Name: "cached.", Type: "TXT", Fetched: now, TTL: 30})
+	entries := r.CacheEntries()
+	require.Len(t, entries, 1)
+	require.Equal(t, "cached.", entries[0].Name)
+
+	// Expired entries are swept, and the cache size is capped.
+	for i := 0; i <= maxCacheEntries; i++ {
+		r.record(CacheEntry{Name: fmt.Sprintf("%d.", i), Type: "TXT", Fetched: now, TTL: uint32(60 + i)})
+	}
+	r.mu.Lock()
+	_, expired := r.cache[cacheKey{"expired.", "TXT"}]
+	_, last := r.cache[cacheKey{fmt.Sprintf("%d.", maxCacheEntries), "TXT"}]
+	size := len(r.cache)
+	r.mu.Unlock()
+	require.False(t, expired)
+	require.True(t, last)
+	require.LessOrEqual(t, size, maxCacheEntries)
+}
+
+func TestSystemResolverLookups(t *testing.T) {
+	r, err := New(nil, time.Hour)
+	require.NoError(t, err)
+
+	ctx, trace := WithTrace(context.Background())
+	_, err = r.LookupTXT(ctx, "invalid.")
+	var dnsErr *net.DNSError
+	require.ErrorAs(t, err, &dnsErr)
+
+	lookups := trace.Lookups()
+	require.Len(t, lookups, 1)
+	require.Equal(t, SystemResolver, lookups[0].Resolver)
+	require.NotEmpty(t, lookups[0].Error)
+	require.Empty(t, r.CacheEntries())
+}
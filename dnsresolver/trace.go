@@ -0,0 +1,41 @@
+package dnsresolver
+
+import (
+	"context"
+	"sync"
+)
+
+type traceKey struct{}
+
+// Trace records the lookups made with a context returned by WithTrace.
+type Trace struct {
+	mu      sync.Mutex
+	lookups []Lookup
+}
+
+// WithTrace returns a context recording the lookups made with it in the
+// returned Trace.
+func WithTrace(ctx context.Context) (context.Context, *Trace) {
+	t := &Trace{}
+	return context.WithValue(ctx, traceKey{}, t), t
+}
+
+// Lookups returns the recorded lookups, in the order they completed.
+func (t *Trace) Lookups() []Lookup {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Lookup(nil), t.lookups...)
+}
+
+func trace(ctx context.Context, l Lookup, err error) {
+	t, ok := ctx.Value(traceKey{}).(*Trace)
+	if !ok {
+		return
+	}
+	if err != nil {
+		l.Error = err.Error()
+	}
+	t.mu.Lock()
+	t.lookups = append(t.lookups, l)
+	t.mu.Unlock()
+}
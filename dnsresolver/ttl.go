@@ -0,0 +1,98 @@
+package dnsresolver
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+const dohMimeType = "application/dns-message"
+
+type ttlKey struct{}
+
+// ttlRecorder records the smallest TTL of the answers to the DoH requests
+// sent with a context returned by withTTLRecorder.
+type ttlRecorder struct {
+	mu  sync.Mutex
+	ttl uint32
+	ok  bool
+}
+
+func withTTLRecorder(ctx context.Context) (context.Context, *ttlRecorder) {
+	rec := &ttlRecorder{}
+	return context.WithValue(ctx, ttlKey{}, rec), rec
+}
+
+// add records the TTLs of the records the DoH resolvers use, like they
+// compute the TTL of their answers.
+func (rec *ttlRecorder) add(answer []dns.RR) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	for _, rr := range answer {
+		switch rr.(type) {
+		case *dns.A, *dns.AAAA, *dns.TXT:
+		default:
+			continue
+		}
+		if ttl := rr.Header().Ttl; !rec.ok || ttl < rec.ttl {
+			rec.ttl, rec.ok = ttl, true
+		}
+	}
+}
+
+// TTL returns the smallest recorded TTL, in seconds. ok is false when no
+// record was answered.
+func (rec *ttlRecorder) TTL() (ttl uint32, ok bool) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.ttl, rec.ok
+}
+
+var transportMu sync.Mutex
+
+// installTransport wraps the transport of http.DefaultClient, which the DoH
+// resolvers send their requests with, to read the TTLs of their answers: the
+// DoH resolvers cache them, but do not return them. Only the responses to
+// requests with a ttlRecorder are read.
+func installTransport() {
+	transportMu.Lock()
+	defer transportMu.Unlock()
+	if _, ok := http.DefaultClient.Transport.(*ttlTransport); !ok {
+		http.DefaultClient.Transport = &ttlTransport{next: http.DefaultClient.Transport}
+	}
+}
+
+type ttlTransport struct {
+	next http.RoundTripper
+}
+
+func (t *ttlTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	rec, ok := req.Context().Value(ttlKey{}).(*ttlRecorder)
+	if !ok || resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != dohMimeType {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, dns.MaxMsgSize+1))
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	m := new(dns.Msg)
+	if err := m.Unpack(body); err == nil {
+		rec.add(m.Answer)
+	}
+	return resp, nil
+}
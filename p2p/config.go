@@ -0,0 +1,112 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	config "github.com/ipfs/kubo/config"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	ma "github.com/multiformats/go-multiaddr"
+	madns "github.com/multiformats/go-multiaddr-dns"
+)
+
+// ParseListenerConfig parses a listener from the P2P.Listeners config into
+// the arguments of ForwardRemoteWithOptions.
+func ParseListenerConfig(cfg config.P2PListener) (protocol.ID, ma.Multiaddr, ListenerOptions, error) {
+	var opts ListenerOptions
+
+	if cfg.Protocol == "" {
+		return "", nil, opts, fmt.Errorf("missing protocol")
+	}
+
+	target, err := ma.NewMultiaddr(cfg.TargetAddress)
+	if err != nil {
+		return "", nil, opts, fmt.Errorf("invalid target address %q: %w", cfg.TargetAddress, err)
+	}
+
+	for _, s := range cfg.AllowedPeers {
+		p, err := peer.Decode(s)
+		if err != nil {
+			return "", nil, opts, fmt.Errorf("invalid allowed peer %q: %w", s, err)
+		}
+		opts.AllowedPeers = append(opts.AllowedPeers, p)
+	}
+
+	maxStreams := cfg.MaxStreams.WithDefault(0)
+	if maxStreams < 0 {
+		return "", nil, opts, fmt.Errorf("invalid MaxStreams: must not be negative")
+	}
+	maxBandwidth := cfg.MaxBandwidth.WithDefault(0)
+	if maxBandwidth < 0 {
+		return "", nil, opts, fmt.Errorf("invalid MaxBandwidth: must not be negative")
+	}
+
+	opts.ReportRemote = cfg.ReportPeerID
+	opts.Token = cfg.Token
+	opts.MaxStreams = int(maxStreams)
+	opts.MaxBandwidth = maxBandwidth
+	return protocol.ID(cfg.Protocol), target, opts, nil
+}
+
+// ParseForwardConfig parses a forward from the P2P.Forwards config into its
+// protocol, listen address and target address. The target address can be
+// resolved with ResolvePeerAddr.
+func ParseForwardConfig(cfg config.P2PForward) (protocol.ID, ma.Multiaddr, ma.Multiaddr, error) {
+	if cfg.Protocol == "" {
+		return "", nil, nil, fmt.Errorf("missing protocol")
+	}
+
+	listen, err := ma.NewMultiaddr(cfg.ListenAddress)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("invalid listen address %q: %w", cfg.ListenAddress, err)
+	}
+
+	target, err := ma.NewMultiaddr(cfg.TargetAddress)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("invalid target address %q: %w", cfg.TargetAddress, err)
+	}
+
+	return protocol.ID(cfg.Protocol), listen, target, nil
+}
+
+// ResolvePeerAddr returns the peer and addresses a forward target refers to,
+// resolving DNS multiaddrs when the address doesn't contain a peer ID.
+func ResolvePeerAddr(ctx context.Context, addr ma.Multiaddr) (*peer.AddrInfo, error) {
+	pi, err := peer.AddrInfoFromP2pAddr(addr)
+	if err == nil {
+		return pi, nil
+	}
+
+	// resolve multiaddr whose protocol is not ma.P_IPFS
+	addrs, err := madns.Resolve(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, errors.New("fail to resolve the multiaddr:" + addr.String())
+	}
+	var info peer.AddrInfo
+	for _, a := range addrs {
+		taddr, id := peer.SplitAddr(a)
+		if id == "" {
+			// not an ipfs addr, skipping.
+			continue
+		}
+		switch info.ID {
+		case "":
+			info.ID = id
+		case id:
+		default:
+			return nil, fmt.Errorf(
+				"ambiguous multiaddr %s could refer to %s or %s",
+				addr,
+				info.ID,
+				id,
+			)
+		}
+		info.Addrs = append(info.Addrs, taddr)
+	}
+	return &info, nil
+}
@@ -0,0 +1,74 @@
+package p2p
+
+import (
+	"context"
+	"testing"
+
+	config "github.com/ipfs/kubo/config"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseListenerConfig(t *testing.T) {
+	p, err := test.RandPeerID()
+	require.NoError(t, err)
+
+	proto, target, opts, err := ParseListenerConfig(config.P2PListener{
+		Protocol:      "/x/test",
+		TargetAddress: "/ip4/127.0.0.1/tcp/1234",
+		ReportPeerID:  true,
+		AllowedPeers:  []string{p.String()},
+		Token:         "secret",
+		MaxStreams:    config.NewOptionalInteger(4),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "/x/test", string(proto))
+	require.Equal(t, "/ip4/127.0.0.1/tcp/1234", target.String())
+	require.Equal(t, ListenerOptions{
+		ReportRemote: true,
+		AllowedPeers: []peer.ID{p},
+		Token:        "secret",
+		MaxStreams:   4,
+	}, opts)
+
+	_, _, _, err = ParseListenerConfig(config.P2PListener{
+		Protocol:      "/x/test",
+		TargetAddress: "/ip4/127.0.0.1/tcp/1234",
+		AllowedPeers:  []string{"not a peer"},
+	})
+	require.Error(t, err)
+
+	_, _, _, err = ParseListenerConfig(config.P2PListener{
+		Protocol:      "/x/test",
+		TargetAddress: "/ip4/127.0.0.1/tcp/1234",
+		MaxBandwidth:  config.NewOptionalInteger(-1),
+	})
+	require.Error(t, err)
+}
+
+func TestParseForwardConfig(t *testing.T) {
+	p, err := test.RandPeerID()
+	require.NoError(t, err)
+
+	proto, listen, target, err := ParseForwardConfig(config.P2PForward{
+		Protocol:      "/x/test",
+		ListenAddress: "/ip4/127.0.0.1/tcp/1234",
+		TargetAddress: "/p2p/" + p.String(),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "/x/test", string(proto))
+	require.Equal(t, "/ip4/127.0.0.1/tcp/1234", listen.String())
+
+	pi, err := ResolvePeerAddr(context.Background(), target)
+	require.NoError(t, err)
+	require.Equal(t, p, pi.ID)
+	require.Empty(t, pi.Addrs)
+
+	_, _, _, err = ParseForwardConfig(config.P2PForward{
+		Protocol:      "/x/test",
+		ListenAddress: "not a multiaddr",
+		TargetAddress: "/p2p/" + p.String(),
+	})
+	require.Error(t, err)
+}
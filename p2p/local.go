@@ -2,6 +2,7 @@ package p2p
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	tec "github.com/jbenet/go-temp-err-catcher"
@@ -23,15 +24,26 @@ type localListener struct {
 	peer  peer.ID
 
 	listener manet.Listener
+
+	// token sent as the first line of every stream, for remote listeners
+	// requiring one
+	token string
 }
 
 // ForwardLocal creates new P2P stream to a remote listener.
 func (p2p *P2P) ForwardLocal(ctx context.Context, peer peer.ID, proto protocol.ID, bindAddr ma.Multiaddr) (Listener, error) {
+	return p2p.ForwardLocalWithToken(ctx, peer, proto, bindAddr, "")
+}
+
+// ForwardLocalWithToken creates new P2P stream to a remote listener, sending
+// token as the first line of every stream when not empty.
+func (p2p *P2P) ForwardLocalWithToken(ctx context.Context, peer peer.ID, proto protocol.ID, bindAddr ma.Multiaddr, token string) (Listener, error) {
 	listener := &localListener{
 		ctx:   ctx,
 		p2p:   p2p,
 		proto: proto,
 		peer:  peer,
+		token: token,
 	}
 
 	maListener, err := manet.Listen(bindAddr)
@@ -80,6 +92,15 @@ func (l *localListener) setupStream(local manet.Conn) {
 		return
 	}
 
+	if l.token != "" {
+		if _, err := fmt.Fprintf(remote, "%s\n", l.token); err != nil {
+			local.Close()
+			_ = remote.Reset()
+			log.Warnf("failed to send token to remote %s/%s", l.peer, l.proto)
+			return
+		}
+	}
+
 	stream := &Stream{
 		Protocol: l.proto,
 
@@ -2,9 +2,14 @@ package p2p
 
 import (
 	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
+	"sync/atomic"
+	"time"
 
 	net "github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/protocol"
 	ma "github.com/multiformats/go-multiaddr"
 	manet "github.com/multiformats/go-multiaddr/net"
@@ -12,6 +17,38 @@ import (
 
 var maPrefix = "/" + ma.ProtocolWithCode(ma.P_IPFS).Name + "/"
 
+// tokenTimeout is how long a remote peer has to send the token of a listener
+// after opening a stream.
+const tokenTimeout = 10 * time.Second
+
+// maxTokenLength bounds how much is read from a stream while looking for the
+// token line.
+const maxTokenLength = 1024
+
+// ListenerOptions restricts and limits the streams accepted by a remote
+// listener.
+type ListenerOptions struct {
+	// ReportRemote makes the handler send '<base58 remote peerid>\n' to
+	// the target before any data is forwarded.
+	ReportRemote bool
+
+	// AllowedPeers is the set of peers allowed to open streams. When empty,
+	// any peer is allowed.
+	AllowedPeers []peer.ID
+
+	// Token is a shared secret that must be sent as the first line of every
+	// stream. It is not forwarded to the target.
+	Token string
+
+	// MaxStreams is the maximum number of concurrent streams. Zero means no
+	// limit.
+	MaxStreams int
+
+	// MaxBandwidth is the maximum throughput of each stream, in bytes per
+	// second in each direction. Zero means no limit.
+	MaxBandwidth int64
+}
+
 // remoteListener accepts libp2p streams and proxies them to a manet host.
 type remoteListener struct {
 	p2p *P2P
@@ -22,20 +59,35 @@ type remoteListener struct {
 	// Address to proxy the incoming connections to
 	addr ma.Multiaddr
 
-	// reportRemote if set to true makes the handler send '<base58 remote peerid>\n'
-	// to target before any data is forwarded
-	reportRemote bool
+	opts    ListenerOptions
+	allowed map[peer.ID]struct{}
+
+	// number of active streams, for opts.MaxStreams
+	active atomic.Int64
 }
 
 // ForwardRemote creates new p2p listener.
 func (p2p *P2P) ForwardRemote(ctx context.Context, proto protocol.ID, addr ma.Multiaddr, reportRemote bool) (Listener, error) {
+	return p2p.ForwardRemoteWithOptions(ctx, proto, addr, ListenerOptions{ReportRemote: reportRemote})
+}
+
+// ForwardRemoteWithOptions creates new p2p listener only accepting the
+// streams allowed by opts.
+func (p2p *P2P) ForwardRemoteWithOptions(ctx context.Context, proto protocol.ID, addr ma.Multiaddr, opts ListenerOptions) (Listener, error) {
 	listener := &remoteListener{
 		p2p: p2p,
 
 		proto: proto,
 		addr:  addr,
 
-		reportRemote: reportRemote,
+		opts: opts,
+	}
+
+	if len(opts.AllowedPeers) > 0 {
+		listener.allowed = make(map[peer.ID]struct{}, len(opts.AllowedPeers))
+		for _, p := range opts.AllowedPeers {
+			listener.allowed[p] = struct{}{}
+		}
 	}
 
 	if err := p2p.ListenersP2P.Register(listener); err != nil {
@@ -46,16 +98,48 @@ func (p2p *P2P) ForwardRemote(ctx context.Context, proto protocol.ID, addr ma.Mu
 }
 
 func (l *remoteListener) handleStream(remote net.Stream) {
+	peer := remote.Conn().RemotePeer()
+
+	if l.allowed != nil {
+		if _, ok := l.allowed[peer]; !ok {
+			log.Debugf("p2p listener %s: rejecting stream from %s: peer not allowed", l.proto, peer)
+			_ = remote.Reset()
+			return
+		}
+	}
+
+	if l.opts.MaxStreams > 0 && l.active.Add(1) > int64(l.opts.MaxStreams) {
+		l.active.Add(-1)
+		log.Debugf("p2p listener %s: rejecting stream from %s: too many streams", l.proto, peer)
+		_ = remote.Reset()
+		return
+	}
+	release := func() {
+		if l.opts.MaxStreams > 0 {
+			l.active.Add(-1)
+		}
+	}
+
+	if l.opts.Token != "" {
+		if err := checkToken(remote, l.opts.Token); err != nil {
+			log.Debugf("p2p listener %s: rejecting stream from %s: %s", l.proto, peer, err)
+			release()
+			_ = remote.Reset()
+			return
+		}
+	}
+
 	local, err := manet.Dial(l.addr)
 	if err != nil {
+		release()
 		_ = remote.Reset()
 		return
 	}
 
-	peer := remote.Conn().RemotePeer()
-
-	if l.reportRemote {
+	if l.opts.ReportRemote {
 		if _, err := fmt.Fprintf(local, "%s\n", peer); err != nil {
+			release()
+			_ = local.Close()
 			_ = remote.Reset()
 			return
 		}
@@ -63,6 +147,8 @@ func (l *remoteListener) handleStream(remote net.Stream) {
 
 	peerMa, err := ma.NewMultiaddr(maPrefix + peer.String())
 	if err != nil {
+		release()
+		_ = local.Close()
 		_ = remote.Reset()
 		return
 	}
@@ -78,11 +164,43 @@ func (l *remoteListener) handleStream(remote net.Stream) {
 		Remote: remote,
 
 		Registry: l.p2p.Streams,
+
+		maxBandwidth: l.opts.MaxBandwidth,
+		release:      release,
 	}
 
 	l.p2p.Streams.Register(stream)
 }
 
+// checkToken reads the first line of the stream and checks it matches token.
+// It reads one byte at a time so nothing past the line is consumed.
+func checkToken(s net.Stream, token string) error {
+	if err := s.SetReadDeadline(time.Now().Add(tokenTimeout)); err != nil {
+		return err
+	}
+	defer func() { _ = s.SetReadDeadline(time.Time{}) }()
+
+	line := make([]byte, 0, len(token)+1)
+	b := make([]byte, 1)
+	for {
+		if _, err := s.Read(b); err != nil {
+			return fmt.Errorf("reading token: %w", err)
+		}
+		if b[0] == '\n' {
+			break
+		}
+		if len(line) >= maxTokenLength {
+			return errors.New("token too long")
+		}
+		line = append(line, b[0])
+	}
+
+	if subtle.ConstantTimeCompare(line, []byte(token)) != 1 {
+		return errors.New("invalid token")
+	}
+	return nil
+}
+
 func (l *remoteListener) Protocol() protocol.ID {
 	return l.proto
 }
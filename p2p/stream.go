@@ -3,6 +3,7 @@ package p2p
 import (
 	"io"
 	"sync"
+	"time"
 
 	ifconnmgr "github.com/libp2p/go-libp2p/core/connmgr"
 	net "github.com/libp2p/go-libp2p/core/network"
@@ -28,6 +29,12 @@ type Stream struct {
 	Remote net.Stream
 
 	Registry *StreamRegistry
+
+	// maximum throughput in each direction, in bytes per second (0 is
+	// unlimited)
+	maxBandwidth int64
+	// release is called once when the stream is deregistered
+	release func()
 }
 
 // close stream endpoints and deregister it.
@@ -41,8 +48,14 @@ func (s *Stream) reset() {
 }
 
 func (s *Stream) startStreaming() {
+	var local, remote io.Reader = s.Local, s.Remote
+	if s.maxBandwidth > 0 {
+		local = newThrottledReader(s.Local, s.maxBandwidth)
+		remote = newThrottledReader(s.Remote, s.maxBandwidth)
+	}
+
 	go func() {
-		_, err := io.Copy(s.Local, s.Remote)
+		_, err := io.Copy(s.Local, remote)
 		if err != nil {
 			s.reset()
 		} else {
@@ -51,7 +64,7 @@ func (s *Stream) startStreaming() {
 	}()
 
 	go func() {
-		_, err := io.Copy(s.Remote, s.Local)
+		_, err := io.Copy(s.Remote, local)
 		if err != nil {
 			s.reset()
 		} else {
@@ -103,6 +116,10 @@ func (r *StreamRegistry) Deregister(streamID uint64) {
 	}
 
 	delete(r.Streams, streamID)
+
+	if s.release != nil {
+		s.release()
+	}
 }
 
 // Close stream endpoints and deregister it.
@@ -118,3 +135,36 @@ func (r *StreamRegistry) Reset(s *Stream) {
 	_ = s.Remote.Reset()
 	s.Registry.Deregister(s.id)
 }
+
+// throttledReader limits the rate at which data is read from a reader, with
+// bursts of up to one second worth of data.
+type throttledReader struct {
+	r      io.Reader
+	limit  int64
+	tokens float64
+	last   time.Time
+}
+
+func newThrottledReader(r io.Reader, limit int64) *throttledReader {
+	return &throttledReader{r: r, limit: limit, tokens: float64(limit), last: time.Now()}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > t.limit {
+		p = p[:t.limit]
+	}
+	n, err := t.r.Read(p)
+
+	now := time.Now()
+	t.tokens += now.Sub(t.last).Seconds() * float64(t.limit)
+	if t.tokens > float64(t.limit) {
+		t.tokens = float64(t.limit)
+	}
+	t.last = now
+
+	t.tokens -= float64(n)
+	if t.tokens < 0 {
+		time.Sleep(time.Duration(-t.tokens / float64(t.limit) * float64(time.Second)))
+	}
+	return n, err
+}
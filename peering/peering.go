@@ -0,0 +1,378 @@
+// Package peering organizes the peers of the boxo peering service in named
+// groups with their own reconnection backoff, and reports their status.
+//
+// The boxo peering service keeps the peers connected and reconnects them with
+// its own, fixed, backoff. Groups adds reconnection attempts following the
+// backoff of the group of each peer, so that some peers can be reconnected
+// to more eagerly, and counts the failed attempts.
+package peering
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ipfs/boxo/peering"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	// DefaultGroup is the group of the peers of the peering service that
+	// were not added to another group.
+	DefaultGroup = "default"
+
+	// The backoff will be cut off when we get within 10% of the actual max.
+	// If we go over the max, we'll adjust the delay down to a random value
+	// between 90-100% of the max backoff.
+	maxBackoffJitter = 10 // %
+	dialTimeout      = time.Minute
+)
+
+var log = logging.Logger("peering")
+
+var (
+	peerConnected = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "ipfs",
+		Subsystem: "peering",
+		Name:      "peer_connected",
+		Help:      "Whether each peer of the peering service is connected (1) or not (0), by group.",
+	}, []string{"group", "peer"})
+	peerFailures = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "ipfs",
+		Subsystem: "peering",
+		Name:      "peer_failures",
+		Help:      "Failed reconnection attempts to each peer of the peering service since it was last connected, by group.",
+	}, []string{"group", "peer"})
+)
+
+// Backoff configures the delays between the reconnection attempts to the
+// peers of a group.
+type Backoff struct {
+	// Initial is the delay before the first reconnection attempt.
+	Initial time.Duration
+	// Max is the maximum delay between reconnection attempts.
+	Max time.Duration
+}
+
+// DefaultBackoff is the backoff of the groups with no backoff set. It is the
+// backoff of the boxo peering service.
+var DefaultBackoff = Backoff{Initial: 5 * time.Second, Max: 10 * time.Minute}
+
+// PeerStatus is the status of a peer of the peering service.
+type PeerStatus struct {
+	peer.AddrInfo
+	Group     string
+	Connected bool
+	// LastConnected is when the peer was last seen connected, or zero.
+	LastConnected time.Time
+	// Failures is the number of failed reconnection attempts since the peer
+	// was last connected, and LastError the error of the last one.
+	Failures  int
+	LastError string
+	// Latency is the latency to the peer, or zero if unknown.
+	Latency time.Duration
+}
+
+// groupPeer is a peer added to the peering service through Groups.
+type groupPeer struct {
+	group         string
+	addrs         []multiaddr.Multiaddr
+	timer         *time.Timer
+	nextDelay     time.Duration
+	lastConnected time.Time
+	failures      int
+	lastError     string
+}
+
+// Groups wraps a peering service to organize its peers in groups.
+type Groups struct {
+	host   host.Host
+	ps     *peering.PeeringService
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	backoffs map[string]Backoff
+	peers    map[peer.ID]*groupPeer
+}
+
+// NewGroups returns the groups of the peers of ps. Close must be called to
+// stop reconnecting to them.
+func NewGroups(h host.Host, ps *peering.PeeringService) *Groups {
+	g := &Groups{
+		host:     h,
+		ps:       ps,
+		backoffs: make(map[string]Backoff),
+		peers:    make(map[peer.ID]*groupPeer),
+	}
+	g.ctx, g.cancel = context.WithCancel(context.Background())
+	h.Network().Notify((*netNotifee)(g))
+	return g
+}
+
+// Close stops reconnecting to the peers. They are still kept connected by
+// the peering service.
+func (g *Groups) Close() {
+	g.host.Network().StopNotify((*netNotifee)(g))
+	g.cancel()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for id, gp := range g.peers {
+		g.stopTimer(gp)
+		g.deleteMetrics(id, gp)
+	}
+}
+
+// SetBackoff sets the backoff of the peers of group, including the ones
+// already added.
+func (g *Groups) SetBackoff(group string, b Backoff) error {
+	if b.Initial <= 0 || b.Max < b.Initial {
+		return errors.New("the initial backoff must be positive, and not greater than the max backoff")
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.backoffs[group] = b
+	return nil
+}
+
+func (g *Groups) backoff(group string) Backoff {
+	if b, ok := g.backoffs[group]; ok {
+		return b
+	}
+	return DefaultBackoff
+}
+
+// AddPeer adds a peer to the peering service, in group. It may be called
+// again for the same peer: the new addresses and group replace the old.
+func (g *Groups) AddPeer(group string, info peer.AddrInfo) {
+	g.ps.AddPeer(info)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	gp, ok := g.peers[info.ID]
+	if ok {
+		g.deleteMetrics(info.ID, gp)
+	} else {
+		gp = &groupPeer{}
+		g.peers[info.ID] = gp
+	}
+	gp.group = group
+	gp.addrs = append([]multiaddr.Multiaddr(nil), info.Addrs...)
+	gp.nextDelay = g.backoff(group).Initial
+	g.stopTimer(gp)
+	if g.connected(info.ID) {
+		gp.lastConnected = time.Now()
+	} else {
+		g.schedule(info.ID, gp)
+	}
+	g.updateMetrics(info.ID, gp)
+}
+
+// RemovePeer removes a peer from the peering service.
+func (g *Groups) RemovePeer(id peer.ID) {
+	g.ps.RemovePeer(id)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.forget(id)
+}
+
+// Status returns the status of the peers of the peering service, sorted by
+// group and ID. The peers not added through Groups are in DefaultGroup.
+func (g *Groups) Status() []PeerStatus {
+	peers := g.ps.ListPeers()
+
+	g.mu.Lock()
+	out := make([]PeerStatus, 0, len(peers))
+	for _, ai := range peers {
+		st := PeerStatus{
+			AddrInfo:  ai,
+			Group:     DefaultGroup,
+			Connected: g.connected(ai.ID),
+			Latency:   g.host.Peerstore().LatencyEWMA(ai.ID),
+		}
+		if gp, ok := g.peers[ai.ID]; ok {
+			st.Group = gp.group
+			st.LastConnected = gp.lastConnected
+			st.Failures = gp.failures
+			st.LastError = gp.lastError
+		}
+		out = append(out, st)
+	}
+	g.mu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Group != out[j].Group {
+			return out[i].Group < out[j].Group
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+func (g *Groups) connected(id peer.ID) bool {
+	return g.host.Network().Connectedness(id) == network.Connected
+}
+
+// forget stops tracking a peer. It must be called with g.mu held.
+func (g *Groups) forget(id peer.ID) {
+	if gp, ok := g.peers[id]; ok {
+		g.stopTimer(gp)
+		g.deleteMetrics(id, gp)
+		delete(g.peers, id)
+	}
+}
+
+// schedule schedules the next reconnection attempt to a peer, unless one is
+// already scheduled. It must be called with g.mu held.
+func (g *Groups) schedule(id peer.ID, gp *groupPeer) {
+	if gp.timer != nil || g.ctx.Err() != nil {
+		return
+	}
+	gp.timer = time.AfterFunc(gp.nextDelay, func() { g.reconnect(id, gp) })
+
+	// Grow the delay of the following attempt.
+	maxBackoff := g.backoff(gp.group).Max
+	if gp.nextDelay < maxBackoff {
+		gp.nextDelay += gp.nextDelay/2 + time.Duration(rand.Int63n(int64(gp.nextDelay)+1))
+	}
+	if gp.nextDelay > maxBackoff {
+		gp.nextDelay = maxBackoff - time.Duration(rand.Int63n(int64(maxBackoff)*maxBackoffJitter/100+1))
+	}
+}
+
+// stopTimer cancels the scheduled reconnection attempt to a peer. It must be
+// called with g.mu held.
+func (g *Groups) stopTimer(gp *groupPeer) {
+	if gp.timer != nil {
+		gp.timer.Stop()
+		gp.timer = nil
+	}
+}
+
+func (g *Groups) reconnect(id peer.ID, gp *groupPeer) {
+	g.mu.Lock()
+	if g.peers[id] != gp || g.connected(id) {
+		g.mu.Unlock()
+		return
+	}
+	addrs := gp.addrs
+	g.mu.Unlock()
+
+	// Dial even if the swarm backs off from the peer after the failed
+	// attempts of the peering service, the group sets the pace.
+	ctx, cancel := context.WithTimeout(g.ctx, dialTimeout)
+	ctx = network.WithForceDirectDial(ctx, "peering group backoff")
+	log.Debugw("reconnecting", "peer", id, "addrs", addrs)
+	err := g.host.Connect(ctx, peer.AddrInfo{ID: id, Addrs: addrs})
+	cancel()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.peers[id] != gp || gp.timer == nil {
+		// The peer was removed, or connected in the meantime.
+		return
+	}
+	gp.timer = nil
+	if err == nil || g.connected(id) {
+		return
+	}
+	if g.ctx.Err() != nil {
+		return
+	}
+	if !g.inPeeringService(id) {
+		// Removed from the peering service directly, e.g. by rendezvous
+		// discovery.
+		g.forget(id)
+		return
+	}
+	log.Debugw("failed to reconnect", "peer", id, "error", err)
+	gp.failures++
+	gp.lastError = err.Error()
+	g.updateMetrics(id, gp)
+	g.schedule(id, gp)
+}
+
+func (g *Groups) inPeeringService(id peer.ID) bool {
+	for _, ai := range g.ps.ListPeers() {
+		if ai.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// updateMetrics exports the status of a peer. It must be called with g.mu
+// held.
+func (g *Groups) updateMetrics(id peer.ID, gp *groupPeer) {
+	connected := 0.0
+	if g.connected(id) {
+		connected = 1
+	}
+	peerConnected.WithLabelValues(gp.group, id.String()).Set(connected)
+	peerFailures.WithLabelValues(gp.group, id.String()).Set(float64(gp.failures))
+}
+
+// deleteMetrics stops exporting the status of a peer. It must be called with
+// g.mu held.
+func (g *Groups) deleteMetrics(id peer.ID, gp *groupPeer) {
+	peerConnected.DeleteLabelValues(gp.group, id.String())
+	peerFailures.DeleteLabelValues(gp.group, id.String())
+}
+
+type netNotifee Groups
+
+func (nn *netNotifee) Connected(_ network.Network, c network.Conn) {
+	g := (*Groups)(nn)
+	p := c.RemotePeer()
+
+	// Use a goroutine to avoid blocking events.
+	go func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		gp, ok := g.peers[p]
+		if !ok || !g.connected(p) {
+			return
+		}
+		log.Debugw("connected", "peer", p)
+		g.stopTimer(gp)
+		gp.lastConnected = time.Now()
+		gp.nextDelay = g.backoff(gp.group).Initial
+		gp.failures = 0
+		gp.lastError = ""
+		g.updateMetrics(p, gp)
+	}()
+}
+
+func (nn *netNotifee) Disconnected(_ network.Network, c network.Conn) {
+	g := (*Groups)(nn)
+	p := c.RemotePeer()
+
+	go func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		gp, ok := g.peers[p]
+		if !ok || g.connected(p) {
+			return
+		}
+		log.Debugw("disconnected", "peer", p)
+		g.schedule(p, gp)
+		g.updateMetrics(p, gp)
+	}()
+}
+func (nn *netNotifee) OpenedStream(network.Network, network.Stream)     {}
+func (nn *netNotifee) ClosedStream(network.Network, network.Stream)     {}
+func (nn *netNotifee) Listen(network.Network, multiaddr.Multiaddr)      {}
+func (nn *netNotifee) ListenClose(network.Network, multiaddr.Multiaddr) {}
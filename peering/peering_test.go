@@ -0,0 +1,75 @@
+package peering
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/peering"
+	"github.com/libp2p/go-libp2p/core/peer"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeeringGroups(t *testing.T) {
+	require := require.New(t)
+
+	mn := mocknet.New()
+	defer mn.Close()
+	var hosts [4]peer.ID
+	for i := range hosts {
+		h, err := mn.GenPeer()
+		require.NoError(err)
+		hosts[i] = h.ID()
+	}
+	h0 := mn.Host(hosts[0])
+
+	ps := peering.NewPeeringService(h0)
+	require.NoError(ps.Start())
+	defer ps.Stop()
+	g := NewGroups(h0, ps)
+	defer g.Close()
+
+	require.Error(g.SetBackoff("fast", Backoff{Initial: time.Second, Max: time.Millisecond}))
+	require.NoError(g.SetBackoff("fast", Backoff{Initial: 10 * time.Millisecond, Max: 50 * time.Millisecond}))
+
+	// The peers are not linked yet, so reconnecting fails.
+	g.AddPeer("fast", peer.AddrInfo{ID: hosts[1], Addrs: mn.Host(hosts[1]).Addrs()})
+	g.AddPeer(DefaultGroup, peer.AddrInfo{ID: hosts[2], Addrs: mn.Host(hosts[2]).Addrs()})
+	// Peers added to the peering service directly are in the default group.
+	ps.AddPeer(peer.AddrInfo{ID: hosts[3], Addrs: mn.Host(hosts[3]).Addrs()})
+
+	require.Eventually(func() bool {
+		return g.Status()[2].Failures >= 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	status := g.Status()
+	require.Len(status, 3)
+	require.Equal(DefaultGroup, status[0].Group)
+	require.Equal(DefaultGroup, status[1].Group)
+	require.Zero(status[0].Failures+status[1].Failures, "the default backoff is longer")
+	require.Equal("fast", status[2].Group)
+	require.Equal(hosts[1], status[2].ID)
+	require.False(status[2].Connected)
+	require.True(status[2].LastConnected.IsZero())
+	require.NotEmpty(status[2].LastError)
+
+	_, err := mn.LinkPeers(hosts[0], hosts[1])
+	require.NoError(err)
+	require.Eventually(func() bool {
+		return g.Status()[2].Connected
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(func() bool {
+		st := g.Status()[2]
+		return st.Failures == 0 && st.LastError == "" && !st.LastConnected.IsZero()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Peers can be moved to another group.
+	g.AddPeer(DefaultGroup, peer.AddrInfo{ID: hosts[1], Addrs: mn.Host(hosts[1]).Addrs()})
+	for _, st := range g.Status() {
+		require.Equal(DefaultGroup, st.Group)
+	}
+
+	g.RemovePeer(hosts[1])
+	require.Len(ps.ListPeers(), 2)
+	require.Len(g.Status(), 2)
+}
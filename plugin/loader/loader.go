@@ -14,6 +14,7 @@ import (
 
 	"github.com/ipfs/kubo/core"
 	"github.com/ipfs/kubo/core/coreapi"
+	"github.com/ipfs/kubo/core/node/libp2p"
 	plugin "github.com/ipfs/kubo/plugin"
 	fsrepo "github.com/ipfs/kubo/repo/fsrepo"
 
@@ -292,6 +293,13 @@ func (loader *PluginLoader) Inject() error {
 				return err
 			}
 		}
+		if pl, ok := pl.(plugin.PluginPubsubValidator); ok {
+			err := injectPubsubValidatorPlugin(pl)
+			if err != nil {
+				loader.state = loaderFailed
+				return err
+			}
+		}
 		if pl, ok := pl.(plugin.PluginFx); ok {
 			err := injectFxPlugin(pl)
 			if err != nil {
@@ -371,6 +379,10 @@ func injectDatastorePlugin(pl plugin.PluginDatastore) error {
 	return fsrepo.AddDatastoreConfigHandler(pl.DatastoreTypeName(), pl.DatastoreConfigParser())
 }
 
+func injectPubsubValidatorPlugin(pl plugin.PluginPubsubValidator) error {
+	return libp2p.AddPubsubValidator(pl.PubsubValidatorName(), pl.PubsubValidator())
+}
+
 func injectIPLDPlugin(pl plugin.PluginIPLD) error {
 	return pl.Register(multicodec.DefaultRegistry)
 }
@@ -0,0 +1,150 @@
+package pebbleds
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/ipfs/kubo/plugin"
+	"github.com/ipfs/kubo/repo"
+	"github.com/ipfs/kubo/repo/fsrepo"
+
+	"github.com/cockroachdb/pebble"
+	humanize "github.com/dustin/go-humanize"
+	pebbleds "github.com/ipfs/go-ds-pebble"
+)
+
+// Plugins is exported list of plugins that will be loaded.
+var Plugins = []plugin.Plugin{
+	&pebbledsPlugin{},
+}
+
+type pebbledsPlugin struct{}
+
+var _ plugin.PluginDatastore = (*pebbledsPlugin)(nil)
+
+func (*pebbledsPlugin) Name() string {
+	return "ds-pebble"
+}
+
+func (*pebbledsPlugin) Version() string {
+	return "0.1.0"
+}
+
+func (*pebbledsPlugin) Init(_ *plugin.Environment) error {
+	return nil
+}
+
+func (*pebbledsPlugin) DatastoreTypeName() string {
+	return "pebbleds"
+}
+
+type datastoreConfig struct {
+	path string
+
+	// Zero values leave the pebble defaults in place.
+	cacheSize                int64
+	memTableSize             int64
+	maxConcurrentCompactions int
+	walBytesPerSync          int64
+	disableWAL               bool
+}
+
+// DatastoreConfigParser returns a configuration stub for a pebble datastore
+// from the given parameters.
+func (*pebbledsPlugin) DatastoreConfigParser() fsrepo.ConfigFromMap {
+	return func(params map[string]interface{}) (fsrepo.DatastoreConfig, error) {
+		var c datastoreConfig
+		var ok bool
+		var err error
+
+		c.path, ok = params["path"].(string)
+		if !ok {
+			return nil, fmt.Errorf("'path' field is missing or not string")
+		}
+
+		if c.cacheSize, err = parseBytes(params, "cacheSize"); err != nil {
+			return nil, err
+		}
+		if c.memTableSize, err = parseBytes(params, "memTableSize"); err != nil {
+			return nil, err
+		}
+		if c.walBytesPerSync, err = parseBytes(params, "walBytesPerSync"); err != nil {
+			return nil, err
+		}
+
+		switch mcc := params["maxConcurrentCompactions"].(type) {
+		case nil:
+		case float64:
+			if mcc < 1 || mcc != float64(int(mcc)) {
+				return nil, fmt.Errorf("'maxConcurrentCompactions' must be a positive integer")
+			}
+			c.maxConcurrentCompactions = int(mcc)
+		default:
+			return nil, fmt.Errorf("'maxConcurrentCompactions' field was not a number")
+		}
+
+		if dw, ok := params["disableWAL"]; ok {
+			if c.disableWAL, ok = dw.(bool); !ok {
+				return nil, fmt.Errorf("'disableWAL' field was not a boolean")
+			}
+		}
+
+		return &c, nil
+	}
+}
+
+// parseBytes parses an optional human readable size such as "64MiB".
+func parseBytes(params map[string]interface{}, key string) (int64, error) {
+	v, ok := params[key]
+	if !ok {
+		return 0, nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return 0, fmt.Errorf("'%s' field was not a string", key)
+	}
+	n, err := humanize.ParseBytes(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid '%s': %w", key, err)
+	}
+	return int64(n), nil
+}
+
+func (c *datastoreConfig) DiskSpec() fsrepo.DiskSpec {
+	return map[string]interface{}{
+		"type": "pebbleds",
+		"path": c.path,
+	}
+}
+
+func (c *datastoreConfig) Create(path string) (repo.Datastore, error) {
+	p := c.path
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(path, p)
+	}
+
+	opts := c.options()
+	ds, err := pebbleds.NewDatastore(p, opts)
+	if opts.Cache != nil {
+		// The database holds its own reference to the cache.
+		opts.Cache.Unref()
+	}
+	return ds, err
+}
+
+func (c *datastoreConfig) options() *pebble.Options {
+	opts := &pebble.Options{
+		DisableWAL:      c.disableWAL,
+		MemTableSize:    int(c.memTableSize),
+		WALBytesPerSync: int(c.walBytesPerSync),
+	}
+	if c.cacheSize > 0 {
+		opts.Cache = pebble.NewCache(c.cacheSize)
+	}
+	if c.maxConcurrentCompactions > 0 {
+		n := c.maxConcurrentCompactions
+		opts.MaxConcurrentCompactions = func() int { return n }
+	}
+	opts.EnsureDefaults()
+	return opts
+}
@@ -0,0 +1,64 @@
+package pebbleds
+
+import (
+	"context"
+	"testing"
+
+	ds "github.com/ipfs/go-datastore"
+)
+
+func TestConfigParser(t *testing.T) {
+	parse := (&pebbledsPlugin{}).DatastoreConfigParser()
+
+	cfg, err := parse(map[string]interface{}{
+		"path":                     "pebbleds",
+		"cacheSize":                "8MiB",
+		"memTableSize":             "4MiB",
+		"maxConcurrentCompactions": float64(2),
+		"walBytesPerSync":          "512KiB",
+		"disableWAL":               false,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := cfg.(*datastoreConfig)
+	if c.cacheSize != 8<<20 || c.memTableSize != 4<<20 || c.walBytesPerSync != 512<<10 || c.maxConcurrentCompactions != 2 {
+		t.Fatalf("unexpected config: %+v", c)
+	}
+	if spec := cfg.DiskSpec(); len(spec) != 2 || spec["path"] != "pebbleds" {
+		t.Fatalf("tuning knobs must not be part of the disk spec: %v", spec)
+	}
+
+	d, err := cfg.Create(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	ctx := context.Background()
+	key := ds.NewKey("/foo")
+	if err := d.Put(ctx, key, []byte("bar")); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := d.Get(ctx, key); err != nil || string(v) != "bar" {
+		t.Fatalf("got %q, %v", v, err)
+	}
+}
+
+func TestConfigParserErrors(t *testing.T) {
+	parse := (&pebbledsPlugin{}).DatastoreConfigParser()
+
+	for _, params := range []map[string]interface{}{
+		{},
+		{"path": "pebbleds", "cacheSize": 1024},
+		{"path": "pebbleds", "memTableSize": "lots"},
+		{"path": "pebbleds", "maxConcurrentCompactions": float64(0)},
+		{"path": "pebbleds", "maxConcurrentCompactions": "2"},
+		{"path": "pebbleds", "disableWAL": "yes"},
+	} {
+		if _, err := parse(params); err == nil {
+			t.Errorf("expected an error for %v", params)
+		}
+	}
+}
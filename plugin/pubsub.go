@@ -0,0 +1,15 @@
+package plugin
+
+import (
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+)
+
+// PluginPubsubValidator is an interface that can be implemented to add custom
+// pubsub message validators. Validators are enabled per topic by referencing
+// their name in Pubsub.Topics[topic].Validator.
+type PluginPubsubValidator interface {
+	Plugin
+
+	PubsubValidatorName() string
+	PubsubValidator() pubsub.ValidatorEx
+}
@@ -72,6 +72,24 @@ var measureConfig = []byte(`{
           "type": "measure"
 }`)
 
+var tieredConfig = []byte(`{
+          "type": "tiered",
+          "maxHotSize": "1GiB",
+          "promoteAfter": 3,
+          "hot": {
+            "path": "blocks",
+            "shardFunc": "/repo/flatfs/shard/v1/next-to-last/2",
+            "sync": true,
+            "type": "flatfs"
+          },
+          "cold": {
+            "path": "blocks-cold",
+            "shardFunc": "/repo/flatfs/shard/v1/next-to-last/2",
+            "sync": false,
+            "type": "flatfs"
+          }
+}`)
+
 func TestDefaultDatastoreConfig(t *testing.T) {
 	loader, err := loader.NewPluginLoader("")
 	if err != nil {
@@ -216,3 +234,33 @@ func TestMeasureConfig(t *testing.T) {
 		t.Errorf("expected '*measure.measure' got '%s'", typ)
 	}
 }
+
+func TestTieredConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	spec := make(map[string]interface{})
+	err := json.Unmarshal(tieredConfig, &spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dsc, err := fsrepo.AnyDatastoreConfig(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"cold":{"path":"blocks-cold","shardFunc":"/repo/flatfs/shard/v1/next-to-last/2","type":"flatfs"},"hot":{"path":"blocks","shardFunc":"/repo/flatfs/shard/v1/next-to-last/2","type":"flatfs"},"type":"tiered"}`
+	if dsc.DiskSpec().String() != expected {
+		t.Errorf("expected '%s' got '%s' as DiskId", expected, dsc.DiskSpec().String())
+	}
+
+	ds, err := dsc.Create(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+
+	if typ := reflect.TypeOf(ds).String(); typ != "*tiered.Datastore" {
+		t.Errorf("expected '*tiered.Datastore' got '%s'", typ)
+	}
+}
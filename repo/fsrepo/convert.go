@@ -0,0 +1,534 @@
+package fsrepo
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	lockfile "github.com/ipfs/go-fs-lock"
+	serialize "github.com/ipfs/kubo/config/serialize"
+	repo "github.com/ipfs/kubo/repo"
+	"github.com/ipfs/kubo/repo/common"
+)
+
+// convertDir holds the state of an unfinished datastore conversion, the new
+// datastore while it is filled and the old one while they are swapped.
+const convertDir = "datastore-convert"
+
+const (
+	convertStateFile = "state.json"
+	convertNewDir    = "new"
+	convertOldDir    = "old"
+)
+
+// convertBatchSize is the number of entries written per batch when copying
+// the datastore.
+const convertBatchSize = 1024
+
+// Phases of a datastore conversion. The old datastore stays in use until the
+// conversion reaches ConvertPhaseSwapOld.
+const (
+	ConvertPhaseCopy   = "copy"
+	ConvertPhaseVerify = "verify"
+	// ConvertPhasePending is reached when the datastore was copied while the
+	// repo was in use. The conversion is finished the next time the repo is
+	// opened.
+	ConvertPhasePending = "pending"
+	ConvertPhaseSwapOld = "swap-old"
+	ConvertPhaseSwapNew = "swap-new"
+	ConvertPhaseDone    = "done"
+)
+
+// ConvertProgress reports the progress of ConvertDatastore.
+type ConvertProgress struct {
+	Phase string
+	// Copied is the number of entries copied to the new datastore.
+	Copied uint64
+	// Skipped is the number of entries already copied by an interrupted
+	// conversion.
+	Skipped uint64
+}
+
+type convertState struct {
+	// Spec is the Datastore.Spec of the new datastore.
+	Spec map[string]interface{}
+	// DiskSpec is the disk spec of the new datastore.
+	DiskSpec string
+	Phase    string
+}
+
+// ConvertDatastore copies every entry of the datastore of the repo at
+// repoPath to a new datastore built from spec, checks that both hold the same
+// entries, then replaces the old datastore with the new one and updates
+// Datastore.Spec and the datastore_spec file.
+//
+// The repo must not be in use, see PrepareDatastoreConversion otherwise. An
+// interrupted conversion is resumed by calling ConvertDatastore again:
+// entries that were already copied are skipped. A nil spec resumes the
+// interrupted conversion with its original spec.
+func ConvertDatastore(ctx context.Context, repoPath string, spec map[string]interface{}, progress func(ConvertProgress)) error {
+	r, err := newFSRepo(repoPath, "")
+	if err != nil {
+		return err
+	}
+	if err := checkInitialized(r.path); err != nil {
+		return err
+	}
+
+	lock, err := lockfile.Lock(r.path, LockFile)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	return r.convertDatastore(ctx, spec, progress)
+}
+
+// PrepareDatastoreConversion converts the datastore of a repo in use, such as
+// by a running daemon: it copies every entry of src, the datastore of the
+// open repo at repoPath, to a new datastore built from spec and checks that
+// both hold the same entries. The datastores are swapped the next time the
+// repo is opened, after copying the entries changed in the meantime.
+func PrepareDatastoreConversion(ctx context.Context, repoPath string, src repo.Datastore, spec map[string]interface{}, progress func(ConvertProgress)) error {
+	if progress == nil {
+		progress = func(ConvertProgress) {}
+	}
+
+	r, err := newFSRepo(repoPath, "")
+	if err != nil {
+		return err
+	}
+	job, err := r.startConversion(spec)
+	if err != nil {
+		return err
+	}
+	if err := copyToNewDatastore(ctx, src, job.dsc, filepath.Join(job.dir, convertNewDir), progress); err != nil {
+		return err
+	}
+	job.state.Phase = ConvertPhasePending
+	if err := job.state.write(job.dir); err != nil {
+		return err
+	}
+	progress(ConvertProgress{Phase: ConvertPhasePending})
+	return nil
+}
+
+// convertJob is a datastore conversion, started or resumed.
+type convertJob struct {
+	dir      string
+	state    *convertState
+	dsc      DatastoreConfig
+	diskSpec DiskSpec
+	oldSpec  string
+}
+
+// startConversion starts a conversion to spec, or resumes the conversion in
+// progress when spec is nil or matches it.
+func (r *FSRepo) startConversion(spec map[string]interface{}) (*convertJob, error) {
+	dir := filepath.Join(r.path, convertDir)
+	state, err := readConvertState(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if spec == nil {
+		if state == nil {
+			return nil, errors.New("no datastore conversion in progress, a target spec is required")
+		}
+		spec = state.Spec
+	}
+	dsc, err := AnyDatastoreConfig(spec)
+	if err != nil {
+		return nil, err
+	}
+	diskSpec := dsc.DiskSpec()
+	if err := checkSpecPaths(diskSpec); err != nil {
+		return nil, err
+	}
+
+	oldSpec, err := r.readSpec()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case state != nil && state.DiskSpec != diskSpec.String():
+		return nil, fmt.Errorf("a conversion to %s is in progress, finish it first or remove %s to abort it", state.DiskSpec, dir)
+	case state == nil && oldSpec == diskSpec.String():
+		return nil, errors.New("the datastore already uses this spec")
+	case state == nil:
+		if err := os.RemoveAll(dir); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, err
+		}
+		state = &convertState{Spec: spec, DiskSpec: diskSpec.String(), Phase: ConvertPhaseCopy}
+		if err := state.write(dir); err != nil {
+			return nil, err
+		}
+	}
+	return &convertJob{dir: dir, state: state, dsc: dsc, diskSpec: diskSpec, oldSpec: oldSpec}, nil
+}
+
+// convertDatastore runs or resumes a conversion. The repo lock must be held.
+func (r *FSRepo) convertDatastore(ctx context.Context, spec map[string]interface{}, progress func(ConvertProgress)) error {
+	if progress == nil {
+		progress = func(ConvertProgress) {}
+	}
+	if err := r.openConfig(); err != nil {
+		return err
+	}
+
+	job, err := r.startConversion(spec)
+	if err != nil {
+		return err
+	}
+	state, dir := job.state, job.dir
+
+	if state.Phase == ConvertPhaseCopy || state.Phase == ConvertPhasePending {
+		if err := r.openDatastore(); err != nil {
+			return err
+		}
+		err := copyToNewDatastore(ctx, r.ds, job.dsc, filepath.Join(dir, convertNewDir), progress)
+		r.ds.Close()
+		if err != nil {
+			return err
+		}
+		state.Phase = ConvertPhaseSwapOld
+		if err := state.write(dir); err != nil {
+			return err
+		}
+	}
+
+	if state.Phase == ConvertPhaseSwapOld {
+		progress(ConvertProgress{Phase: ConvertPhaseSwapOld})
+		var old map[string]interface{}
+		if err := json.Unmarshal([]byte(job.oldSpec), &old); err != nil {
+			return fmt.Errorf("failed to decode %s: %w", specFn, err)
+		}
+		if err := moveSpecPaths(old, r.path, filepath.Join(dir, convertOldDir)); err != nil {
+			return err
+		}
+		state.Phase = ConvertPhaseSwapNew
+		if err := state.write(dir); err != nil {
+			return err
+		}
+	}
+
+	if state.Phase == ConvertPhaseSwapNew {
+		progress(ConvertProgress{Phase: ConvertPhaseSwapNew})
+		if err := moveSpecPaths(job.diskSpec, filepath.Join(dir, convertNewDir), r.path); err != nil {
+			return err
+		}
+		if err := r.setDatastoreSpec(state.Spec); err != nil {
+			return err
+		}
+		fn := filepath.Join(r.path, specFn)
+		if err := os.WriteFile(fn, job.diskSpec.Bytes(), 0o600); err != nil {
+			return err
+		}
+		state.Phase = ConvertPhaseDone
+		if err := state.write(dir); err != nil {
+			return err
+		}
+	}
+
+	progress(ConvertProgress{Phase: ConvertPhaseDone})
+	return os.RemoveAll(dir)
+}
+
+// finishConversion finishes a conversion prepared while the repo was in use,
+// or interrupted while swapping the datastores. The repo lock must be held.
+func (r *FSRepo) finishConversion() error {
+	state, err := readConvertState(filepath.Join(r.path, convertDir))
+	if err != nil {
+		return err
+	}
+	if state == nil || state.Phase == ConvertPhaseCopy {
+		return nil
+	}
+	log.Warnf("finishing the conversion of the datastore to %s, this may take a while", state.DiskSpec)
+	if err := r.convertDatastore(context.Background(), nil, nil); err != nil {
+		return fmt.Errorf("failed to finish the datastore conversion, run 'ipfs repo convert' to retry: %w", err)
+	}
+	return nil
+}
+
+// setDatastoreSpec writes Datastore.Spec to the config file, leaving the
+// other keys untouched.
+func (r *FSRepo) setDatastoreSpec(spec map[string]interface{}) error {
+	var mapconf map[string]interface{}
+	if err := serialize.ReadConfigFile(r.configFilePath, &mapconf); err != nil {
+		return err
+	}
+	if err := common.MapSetKV(mapconf, "Datastore.Spec", spec); err != nil {
+		return err
+	}
+	return serialize.WriteConfigFile(r.configFilePath, mapconf)
+}
+
+func readConvertState(dir string) (*convertState, error) {
+	data, err := os.ReadFile(filepath.Join(dir, convertStateFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state convertState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to decode datastore conversion state: %w", err)
+	}
+	return &state, nil
+}
+
+func (s *convertState) write(dir string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	fn := filepath.Join(dir, convertStateFile)
+	if err := os.WriteFile(fn+".tmp", data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(fn+".tmp", fn)
+}
+
+// copyToNewDatastore copies every entry of src to the datastore created by
+// dsc in dir, then checks that both hold the same entries.
+func copyToNewDatastore(ctx context.Context, src repo.Datastore, dsc DatastoreConfig, dir string, progress func(ConvertProgress)) error {
+	_, err := os.Stat(dir)
+	resume := err == nil
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	dst, err := dsc.Create(dir)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	srcSum, err := copyDatastore(ctx, src, dst, resume, progress)
+	if err != nil {
+		return err
+	}
+
+	progress(ConvertProgress{Phase: ConvertPhaseVerify})
+	if resume {
+		// the repo may have been used since the conversion was interrupted
+		if err := pruneDatastore(ctx, dst, src); err != nil {
+			return err
+		}
+	}
+	dstSum, err := sumDatastore(ctx, dst)
+	if err != nil {
+		return err
+	}
+	if srcSum.count != dstSum.count {
+		return fmt.Errorf("verification failed: the old datastore has %d entries, the new one %d", srcSum.count, dstSum.count)
+	}
+	if srcSum.sum != dstSum.sum {
+		return errors.New("verification failed: the entries of the new datastore do not match the old one")
+	}
+	return dst.Sync(ctx, ds.NewKey("/"))
+}
+
+// datastoreSum is an order independent checksum of the entries of a
+// datastore.
+type datastoreSum struct {
+	count uint64
+	sum   [sha256.Size]byte
+}
+
+func (s *datastoreSum) add(key string, value []byte) {
+	h := sha256.New()
+	h.Write([]byte(key))
+	h.Write([]byte{0})
+	h.Write(value)
+	var entry [sha256.Size]byte
+	h.Sum(entry[:0])
+	for i := range s.sum {
+		s.sum[i] ^= entry[i]
+	}
+	s.count++
+}
+
+func copyDatastore(ctx context.Context, src repo.Datastore, dst repo.Datastore, resume bool, progress func(ConvertProgress)) (*datastoreSum, error) {
+	res, err := src.Query(ctx, query.Query{})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	var sum datastoreSum
+	p := ConvertProgress{Phase: ConvertPhaseCopy}
+
+	batch, err := dst.Batch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pending := 0
+
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		sum.add(r.Key, r.Value)
+		key := ds.RawKey(r.Key)
+
+		if resume {
+			v, err := dst.Get(ctx, key)
+			if err != nil && !errors.Is(err, ds.ErrNotFound) {
+				return nil, err
+			}
+			if err == nil && bytes.Equal(v, r.Value) {
+				p.Skipped++
+				continue
+			}
+		}
+
+		if err := batch.Put(ctx, key, r.Value); err != nil {
+			return nil, err
+		}
+		p.Copied++
+		pending++
+		if pending < convertBatchSize {
+			continue
+		}
+		if err := batch.Commit(ctx); err != nil {
+			return nil, err
+		}
+		progress(p)
+		if batch, err = dst.Batch(ctx); err != nil {
+			return nil, err
+		}
+		pending = 0
+	}
+
+	if err := batch.Commit(ctx); err != nil {
+		return nil, err
+	}
+	progress(p)
+	return &sum, nil
+}
+
+// pruneDatastore removes the entries of dst that are not in src.
+func pruneDatastore(ctx context.Context, dst repo.Datastore, src repo.Datastore) error {
+	res, err := dst.Query(ctx, query.Query{KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	for r := range res.Next() {
+		if r.Error != nil {
+			return r.Error
+		}
+		key := ds.RawKey(r.Key)
+		has, err := src.Has(ctx, key)
+		if err != nil {
+			return err
+		}
+		if !has {
+			if err := dst.Delete(ctx, key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func sumDatastore(ctx context.Context, d repo.Datastore) (*datastoreSum, error) {
+	res, err := d.Query(ctx, query.Query{})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	var sum datastoreSum
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		sum.add(r.Key, r.Value)
+	}
+	return &sum, nil
+}
+
+// specPaths returns the paths of the directories used by the datastores of
+// a disk spec.
+func specPaths(spec map[string]interface{}) []string {
+	var paths []string
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case DiskSpec:
+			walk(map[string]interface{}(v))
+		case map[string]interface{}:
+			for k, child := range v {
+				if p, ok := child.(string); ok && k == "path" {
+					paths = append(paths, p)
+					continue
+				}
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(spec)
+	sort.Strings(paths)
+	return paths
+}
+
+// checkSpecPaths checks that the datastores of a disk spec are all inside the
+// repo, so that they can be swapped.
+func checkSpecPaths(spec DiskSpec) error {
+	paths := specPaths(spec)
+	if len(paths) == 0 {
+		return errors.New("cannot convert to a datastore without a path")
+	}
+	for _, p := range paths {
+		if filepath.IsAbs(p) || !filepath.IsLocal(p) {
+			return fmt.Errorf("cannot convert to a datastore outside the repo: %q", p)
+		}
+	}
+	return nil
+}
+
+// moveSpecPaths moves the datastore directories of a disk spec from one
+// directory to another. Paths already moved are skipped, so that an
+// interrupted swap can be resumed.
+func moveSpecPaths(spec map[string]interface{}, from, to string) error {
+	for _, p := range specPaths(spec) {
+		src := filepath.Join(from, p)
+		if _, err := os.Stat(src); errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		dst := filepath.Join(to, p)
+		if err := os.MkdirAll(filepath.Dir(dst), 0o700); err != nil {
+			return err
+		}
+		if err := os.Rename(src, dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
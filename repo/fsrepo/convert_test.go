@@ -0,0 +1,153 @@
+package fsrepo_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/stretchr/testify/require"
+
+	config "github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/plugin"
+	"github.com/ipfs/kubo/plugin/plugins/flatfs"
+	"github.com/ipfs/kubo/plugin/plugins/levelds"
+	"github.com/ipfs/kubo/repo/fsrepo"
+)
+
+func addTestDatastores() {
+	for _, p := range append(flatfs.Plugins, levelds.Plugins...) {
+		pd := p.(plugin.PluginDatastore)
+		// already added when the plugin loader was used by another test
+		_ = fsrepo.AddDatastoreConfigHandler(pd.DatastoreTypeName(), pd.DatastoreConfigParser())
+	}
+}
+
+func TestConvertDatastore(t *testing.T) {
+	addTestDatastores()
+	ctx := context.Background()
+	path := t.TempDir()
+
+	require.NoError(t, fsrepo.Init(path, &config.Config{Datastore: config.DefaultDatastoreConfig()}))
+	r, err := fsrepo.Open(path)
+	require.NoError(t, err)
+	entries := map[ds.Key][]byte{
+		ds.NewKey("/blocks/CIQA"): []byte("block"),
+		ds.NewKey("/local/pins"):  []byte("pins"),
+		ds.NewKey("/key"):         []byte("value"),
+	}
+	for k, v := range entries {
+		require.NoError(t, r.Datastore().Put(ctx, k, v))
+	}
+	require.NoError(t, r.Close())
+
+	var cfg config.Config
+	require.NoError(t, config.Profiles["levelds"].Transform(&cfg))
+
+	// interrupt the conversion while copying
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	require.ErrorIs(t, fsrepo.ConvertDatastore(cctx, path, cfg.Datastore.Spec, nil), context.Canceled)
+
+	// the repo can still be used, and its new entries are converted too
+	r, err = fsrepo.Open(path)
+	require.NoError(t, err)
+	entries[ds.NewKey("/blocks/CIQB")] = []byte("new block")
+	require.NoError(t, r.Datastore().Put(ctx, ds.NewKey("/blocks/CIQB"), []byte("new block")))
+	require.NoError(t, r.Close())
+
+	// resume with the spec of the interrupted conversion
+	var phases []string
+	require.NoError(t, fsrepo.ConvertDatastore(ctx, path, nil, func(p fsrepo.ConvertProgress) {
+		phases = append(phases, p.Phase)
+	}))
+	require.Equal(t, []string{
+		fsrepo.ConvertPhaseCopy,
+		fsrepo.ConvertPhaseVerify,
+		fsrepo.ConvertPhaseSwapOld,
+		fsrepo.ConvertPhaseSwapNew,
+		fsrepo.ConvertPhaseDone,
+	}, phases)
+
+	spec, err := os.ReadFile(filepath.Join(path, "datastore_spec"))
+	require.NoError(t, err)
+	require.Equal(t, `{"path":"datastore","type":"levelds"}`, string(spec))
+	require.NoDirExists(t, filepath.Join(path, "blocks"))
+	require.NoDirExists(t, filepath.Join(path, "datastore-convert"))
+
+	r, err = fsrepo.Open(path)
+	require.NoError(t, err)
+	for k, v := range entries {
+		actual, err := r.Datastore().Get(ctx, k)
+		require.NoError(t, err)
+		require.Equal(t, v, actual)
+	}
+
+	rcfg, err := r.Config()
+	require.NoError(t, err)
+	require.Equal(t, "measure", rcfg.Datastore.Spec["type"])
+	require.NoError(t, r.Close())
+
+	require.ErrorContains(t, fsrepo.ConvertDatastore(ctx, path, cfg.Datastore.Spec, nil), "already uses")
+
+	// back to the flatfs and levelds mounts
+	require.NoError(t, fsrepo.ConvertDatastore(ctx, path, config.DefaultDatastoreConfig().Spec, nil))
+	require.DirExists(t, filepath.Join(path, "blocks"))
+	r, err = fsrepo.Open(path)
+	require.NoError(t, err)
+	for k, v := range entries {
+		actual, err := r.Datastore().Get(ctx, k)
+		require.NoError(t, err)
+		require.Equal(t, v, actual)
+	}
+	require.NoError(t, r.Close())
+}
+
+func TestPrepareDatastoreConversion(t *testing.T) {
+	addTestDatastores()
+	ctx := context.Background()
+	path := t.TempDir()
+
+	require.NoError(t, fsrepo.Init(path, &config.Config{Datastore: config.DefaultDatastoreConfig()}))
+	r, err := fsrepo.Open(path)
+	require.NoError(t, err)
+	require.NoError(t, r.Datastore().Put(ctx, ds.NewKey("/blocks/CIQA"), []byte("block")))
+	require.NoError(t, r.Datastore().Put(ctx, ds.NewKey("/local/pins"), []byte("pins")))
+
+	var cfg config.Config
+	require.NoError(t, config.Profiles["levelds"].Transform(&cfg))
+
+	// copy while the repo is in use
+	var phases []string
+	require.NoError(t, fsrepo.PrepareDatastoreConversion(ctx, path, r.Datastore(), cfg.Datastore.Spec, func(p fsrepo.ConvertProgress) {
+		phases = append(phases, p.Phase)
+	}))
+	require.Equal(t, []string{
+		fsrepo.ConvertPhaseCopy,
+		fsrepo.ConvertPhaseVerify,
+		fsrepo.ConvertPhasePending,
+	}, phases)
+
+	// changes made before the swap are not lost
+	require.NoError(t, r.Datastore().Put(ctx, ds.NewKey("/blocks/CIQB"), []byte("new block")))
+	require.NoError(t, r.Datastore().Delete(ctx, ds.NewKey("/local/pins")))
+	require.NoError(t, r.Close())
+
+	// the datastores are swapped when the repo is opened again
+	r, err = fsrepo.Open(path)
+	require.NoError(t, err)
+	defer r.Close()
+
+	spec, err := os.ReadFile(filepath.Join(path, "datastore_spec"))
+	require.NoError(t, err)
+	require.Equal(t, `{"path":"datastore","type":"levelds"}`, string(spec))
+	require.NoDirExists(t, filepath.Join(path, "datastore-convert"))
+
+	v, err := r.Datastore().Get(ctx, ds.NewKey("/blocks/CIQB"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("new block"), v)
+	has, err := r.Datastore().Has(ctx, ds.NewKey("/local/pins"))
+	require.NoError(t, err)
+	require.False(t, has)
+}
@@ -2,16 +2,20 @@ package fsrepo
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"sort"
 
 	"github.com/ipfs/kubo/repo"
+	"github.com/ipfs/kubo/thirdparty/tiered"
 
 	ds "github.com/ipfs/go-datastore"
 	"github.com/ipfs/go-datastore/mount"
 	dssync "github.com/ipfs/go-datastore/sync"
 	"github.com/ipfs/go-ds-measure"
+
+	humanize "github.com/dustin/go-humanize"
 )
 
 // ConfigFromMap creates a new datastore config from a map.
@@ -58,6 +62,7 @@ var datastores map[string]ConfigFromMap
 func init() {
 	datastores = map[string]ConfigFromMap{
 		"mount":   MountDatastoreConfig,
+		"tiered":  TieredDatastoreConfig,
 		"mem":     MemDatastoreConfig,
 		"log":     LogDatastoreConfig,
 		"measure": MeasureDatastoreConfig,
@@ -161,6 +166,82 @@ func (c *mountDatastoreConfig) Create(path string) (repo.Datastore, error) {
 	return mount.New(mounts), nil
 }
 
+type tieredDatastoreConfig struct {
+	hot, cold DatastoreConfig
+	opts      tiered.Options
+}
+
+// TieredDatastoreConfig returns a tiered DatastoreConfig from a spec.
+func TieredDatastoreConfig(params map[string]interface{}) (DatastoreConfig, error) {
+	var res tieredDatastoreConfig
+	for _, tier := range []struct {
+		field string
+		cfg   *DatastoreConfig
+	}{{"hot", &res.hot}, {"cold", &res.cold}} {
+		childField, ok := params[tier.field].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("'%s' field is missing or not a map", tier.field)
+		}
+		child, err := AnyDatastoreConfig(childField)
+		if err != nil {
+			return nil, err
+		}
+		*tier.cfg = child
+	}
+
+	if v, ok := params["maxHotSize"]; ok {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("'maxHotSize' field was not a string")
+		}
+		size, err := humanize.ParseBytes(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid 'maxHotSize': %w", err)
+		}
+		res.opts.MaxHotSize = int64(size)
+	}
+
+	switch v := params["promoteAfter"].(type) {
+	case nil:
+	case float64:
+		if v != float64(int(v)) {
+			return nil, fmt.Errorf("'promoteAfter' field was not an integer")
+		}
+		res.opts.PromoteAfter = int(v)
+	default:
+		return nil, fmt.Errorf("'promoteAfter' field was not a number")
+	}
+
+	return &res, nil
+}
+
+func (c *tieredDatastoreConfig) DiskSpec() DiskSpec {
+	return map[string]interface{}{
+		"type": "tiered",
+		"hot":  map[string]interface{}(c.hot.DiskSpec()),
+		"cold": map[string]interface{}(c.cold.DiskSpec()),
+	}
+}
+
+func (c *tieredDatastoreConfig) Create(path string) (repo.Datastore, error) {
+	hot, err := c.hot.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	cold, err := c.cold.Create(path)
+	if err != nil {
+		hot.Close()
+		return nil, err
+	}
+	d, err := tiered.New(context.Background(), hot, cold, c.opts)
+	if err != nil {
+		hot.Close()
+		cold.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
 type memDatastoreConfig struct {
 	cfg map[string]interface{}
 }
@@ -180,6 +180,10 @@ func open(repoPath string, userConfigFilePath string) (repo.Repo, error) {
 		return nil, err
 	}
 
+	if err := r.finishConversion(); err != nil {
+		return nil, err
+	}
+
 	if err := r.openConfig(); err != nil {
 		return nil, err
 	}
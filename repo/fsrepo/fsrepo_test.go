@@ -103,6 +103,8 @@ func TestOpenMoreThanOnceInSameProcess(t *testing.T) {
 	r2, err := Open(path)
 	assert.Nil(err, t, "second repo should open successfully")
 	assert.True(r1 == r2, t, "second open returns same value")
+	pr, ok := r1.(interface{ Path() string })
+	assert.True(ok && pr.Path() == path, t, "opened repo has the repo path")
 
 	assert.Nil(r1.Close(), t)
 	assert.Nil(r2.Close(), t)
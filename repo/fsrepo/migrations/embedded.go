@@ -0,0 +1,136 @@
+package migrations
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// Options configures a run of an embedded migration.
+type Options struct {
+	// Path is the ipfs directory of the repo to migrate.
+	Path string
+	// DryRun makes the migration report the changes it would make without
+	// modifying the repo.
+	DryRun bool
+	// Logger receives a description of each change.
+	Logger *log.Logger
+}
+
+// Migration is a repo migration built into Kubo and run in-process, instead
+// of downloading and executing an fs-repo-migrations binary.
+//
+// Apply and Revert only change the content of the repo: the version file is
+// written by RunMigration once they succeed.
+type Migration interface {
+	// Versions returns the versions the migration goes between, e.g.
+	// "14-to-15".
+	Versions() string
+	// Apply migrates the repo to the next version.
+	Apply(opts Options) error
+	// Revert migrates the repo back to the previous version.
+	Revert(opts Options) error
+	// Reversible returns whether Revert is supported.
+	Reversible() bool
+}
+
+// embeddedMigrations are indexed by migration name, e.g. "fs-repo-14-to-15".
+// Repos older than the first embedded migration still rely on downloaded
+// binaries.
+var embeddedMigrations = map[string]Migration{}
+
+func init() {
+	for _, m := range []Migration{
+		migration13to14{},
+		migration14to15{},
+	} {
+		embeddedMigrations["fs-repo-"+m.Versions()] = m
+	}
+}
+
+// runEmbeddedMigration applies or reverts m and writes version to the repo
+// version file.
+func runEmbeddedMigration(m Migration, ipfsDir string, revert, dryRun bool, version int, logger *log.Logger) error {
+	opts := Options{Path: ipfsDir, DryRun: dryRun, Logger: logger}
+	var err error
+	if revert {
+		if !m.Reversible() {
+			return errors.New("migration is not reversible")
+		}
+		err = m.Revert(opts)
+	} else {
+		err = m.Apply(opts)
+	}
+	if err != nil || dryRun {
+		return err
+	}
+	return WriteRepoVersion(ipfsDir, version)
+}
+
+const configFile = "config"
+
+// readConfigMap reads the repo config without decoding it into config.Config,
+// as migrations need to handle fields the current version doesn't know about.
+func readConfigMap(ipfsDir string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(filepath.Join(ipfsDir, configFile))
+	if err != nil {
+		return nil, err
+	}
+	var cfg map[string]interface{}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to decode config: %w", err)
+	}
+	return cfg, nil
+}
+
+// writeConfigMap atomically replaces the repo config.
+func writeConfigMap(ipfsDir string, cfg map[string]interface{}) error {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(ipfsDir, configFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// backupConfig copies the repo config next to it, so that the migration named
+// versions can be reverted with restoreConfig.
+func backupConfig(ipfsDir, versions string) error {
+	data, err := os.ReadFile(filepath.Join(ipfsDir, configFile))
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(backupConfigPath(ipfsDir, versions), data, 0o600)
+}
+
+// restoreConfig replaces the repo config with its backup made by backupConfig.
+func restoreConfig(ipfsDir, versions string) error {
+	backup := backupConfigPath(ipfsDir, versions)
+	if _, err := os.Stat(backup); err != nil {
+		return fmt.Errorf("cannot revert without the config backup: %w", err)
+	}
+	return os.Rename(backup, filepath.Join(ipfsDir, configFile))
+}
+
+func backupConfigPath(ipfsDir, versions string) string {
+	return filepath.Join(ipfsDir, configFile+"."+versions+".bak")
+}
+
+// configSection returns the object at key in cfg, creating it when create is
+// true. It returns nil if the key is missing or isn't an object.
+func configSection(cfg map[string]interface{}, key string, create bool) map[string]interface{} {
+	section, ok := cfg[key].(map[string]interface{})
+	if !ok && create {
+		section = make(map[string]interface{})
+		cfg[key] = section
+	}
+	return section
+}
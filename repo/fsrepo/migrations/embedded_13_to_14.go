@@ -0,0 +1,48 @@
+package migrations
+
+// migration13to14 moves Experimental.AcceleratedDHTClient to
+// Routing.AcceleratedDHTClient, as the accelerated DHT client is no longer
+// experimental.
+type migration13to14 struct{}
+
+func (migration13to14) Versions() string { return "13-to-14" }
+
+func (migration13to14) Reversible() bool { return true }
+
+func (migration13to14) Apply(opts Options) error {
+	return moveConfigField(opts, "Experimental", "Routing", "AcceleratedDHTClient")
+}
+
+func (migration13to14) Revert(opts Options) error {
+	return moveConfigField(opts, "Routing", "Experimental", "AcceleratedDHTClient")
+}
+
+// moveConfigField moves field from the from section of the config to the to
+// section, keeping the value already set in the to section if any.
+func moveConfigField(opts Options, from, to, field string) error {
+	cfg, err := readConfigMap(opts.Path)
+	if err != nil {
+		return err
+	}
+
+	src := configSection(cfg, from, false)
+	v, ok := src[field]
+	if !ok {
+		opts.Logger.Printf("  %s.%s is not set, nothing to do", from, field)
+		return nil
+	}
+	delete(src, field)
+
+	dst := configSection(cfg, to, true)
+	if existing, ok := dst[field]; ok {
+		opts.Logger.Printf("  Removing %s.%s (%v), keeping %s.%s (%v)", from, field, v, to, field, existing)
+	} else {
+		opts.Logger.Printf("  Moving %s.%s (%v) to %s.%s", from, field, v, to, field)
+		dst[field] = v
+	}
+
+	if opts.DryRun {
+		return nil
+	}
+	return writeConfigMap(opts.Path, cfg)
+}
@@ -0,0 +1,80 @@
+package migrations
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// migration14to15 removes the QUIC draft-29 ('/quic') addresses, as support
+// for it was dropped by go-libp2p. The '/quic-v1' addresses added next to them
+// by the 12-to-13 migration are kept.
+type migration14to15 struct{}
+
+func (migration14to15) Versions() string { return "14-to-15" }
+
+func (migration14to15) Reversible() bool { return true }
+
+func (m migration14to15) Apply(opts Options) error {
+	cfg, err := readConfigMap(opts.Path)
+	if err != nil {
+		return err
+	}
+
+	var changed bool
+	addrs := configSection(cfg, "Addresses", false)
+	for _, field := range []string{"Swarm", "Announce", "AppendAnnounce", "NoAnnounce"} {
+		list, ok := addrs[field].([]interface{})
+		if !ok {
+			continue
+		}
+		kept := make([]interface{}, 0, len(list))
+		for _, v := range list {
+			if s, ok := v.(string); ok && isQuicDraft29(s) {
+				opts.Logger.Printf("  Removing %s from Addresses.%s", s, field)
+				changed = true
+				continue
+			}
+			kept = append(kept, v)
+		}
+		addrs[field] = kept
+	}
+
+	if !changed {
+		opts.Logger.Print("  No QUIC draft-29 addresses found, nothing to do")
+	}
+	if opts.DryRun || !changed {
+		return nil
+	}
+	if err := backupConfig(opts.Path, m.Versions()); err != nil {
+		return err
+	}
+	return writeConfigMap(opts.Path, cfg)
+}
+
+// Revert restores the config saved by Apply. Apply only saves it when it
+// removed addresses, so there is nothing to do without a backup.
+func (m migration14to15) Revert(opts Options) error {
+	backup := backupConfigPath(opts.Path, m.Versions())
+	if _, err := os.Stat(backup); errors.Is(err, fs.ErrNotExist) {
+		opts.Logger.Print("  No config backup found, nothing to do")
+		return nil
+	}
+	opts.Logger.Printf("  Restoring the config from %s", backup)
+	if opts.DryRun {
+		return nil
+	}
+	return restoreConfig(opts.Path, m.Versions())
+}
+
+// isQuicDraft29 returns whether the multiaddr string uses the '/quic'
+// protocol, rather than '/quic-v1'.
+func isQuicDraft29(addr string) bool {
+	for _, p := range strings.Split(addr, "/") {
+		if p == "quic" {
+			return true
+		}
+	}
+	return false
+}
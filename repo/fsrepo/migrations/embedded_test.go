@@ -0,0 +1,66 @@
+package migrations
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const embeddedTestConfig = `{
+  "Addresses": {
+    "Swarm": [
+      "/ip4/0.0.0.0/tcp/4001",
+      "/ip4/0.0.0.0/udp/4001/quic",
+      "/ip4/0.0.0.0/udp/4001/quic-v1"
+    ],
+    "Announce": [],
+    "NoAnnounce": ["/ip4/10.0.0.1/udp/4001/quic"]
+  },
+  "Experimental": {
+    "AcceleratedDHTClient": true
+  }
+}`
+
+func TestEmbeddedMigrations(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, configFile), []byte(embeddedTestConfig), 0o600))
+	require.NoError(t, WriteRepoVersion(dir, 13))
+
+	// a dry run doesn't touch the repo
+	require.NoError(t, DryRunMigration(ctx, 15, dir, false))
+	ver, err := RepoVersion(dir)
+	require.NoError(t, err)
+	require.Equal(t, 13, ver)
+	data, err := os.ReadFile(filepath.Join(dir, configFile))
+	require.NoError(t, err)
+	require.Equal(t, embeddedTestConfig, string(data))
+
+	// no fetcher is needed when all the migrations are embedded
+	require.NoError(t, RunMigration(ctx, nil, 15, dir, false))
+	ver, err = RepoVersion(dir)
+	require.NoError(t, err)
+	require.Equal(t, 15, ver)
+
+	cfg, err := readConfigMap(dir)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{}, cfg["Experimental"])
+	require.Equal(t, map[string]interface{}{"AcceleratedDHTClient": true}, cfg["Routing"])
+	addrs := configSection(cfg, "Addresses", false)
+	require.Equal(t, []interface{}{"/ip4/0.0.0.0/tcp/4001", "/ip4/0.0.0.0/udp/4001/quic-v1"}, addrs["Swarm"])
+	require.Equal(t, []interface{}{}, addrs["NoAnnounce"])
+
+	require.NoError(t, RunMigration(ctx, nil, 13, dir, true))
+	ver, err = RepoVersion(dir)
+	require.NoError(t, err)
+	require.Equal(t, 13, ver)
+
+	cfg, err = readConfigMap(dir)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"AcceleratedDHTClient": true}, cfg["Experimental"])
+	addrs = configSection(cfg, "Addresses", false)
+	require.Len(t, addrs["Swarm"], 3)
+}
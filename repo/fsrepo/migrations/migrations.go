@@ -24,8 +24,22 @@ const (
 )
 
 // RunMigration finds, downloads, and runs the individual migrations needed to
-// migrate the repo from its current version to the target version.
+// migrate the repo from its current version to the target version. Migrations
+// embedded in Kubo are run in-process, the others are looked up in PATH or
+// downloaded with fetcher.
 func RunMigration(ctx context.Context, fetcher Fetcher, targetVer int, ipfsDir string, allowDowngrade bool) error {
+	return runMigrations(ctx, fetcher, targetVer, ipfsDir, allowDowngrade, false)
+}
+
+// DryRunMigration reports the changes the migrations from the current repo
+// version to the target version would make, without modifying the repo. Only
+// embedded migrations support dry runs. Each migration reports its changes
+// against the current repo, as the previous ones are not applied.
+func DryRunMigration(ctx context.Context, targetVer int, ipfsDir string, allowDowngrade bool) error {
+	return runMigrations(ctx, nil, targetVer, ipfsDir, allowDowngrade, true)
+}
+
+func runMigrations(ctx context.Context, fetcher Fetcher, targetVer int, ipfsDir string, allowDowngrade, dryRun bool) error {
 	ipfsDir, err := CheckIpfsDir(ipfsDir)
 	if err != nil {
 		return err
@@ -44,22 +58,27 @@ func RunMigration(ctx context.Context, fetcher Fetcher, targetVer int, ipfsDir s
 
 	logger := log.New(os.Stdout, "", 0)
 
-	logger.Print("Looking for suitable migration binaries.")
+	logger.Print("Looking for suitable migrations.")
 
 	migrations, binPaths, err := findMigrations(ctx, fromVer, targetVer)
 	if err != nil {
 		return err
 	}
 
-	// Download migrations that were not found
-	if len(binPaths) < len(migrations) {
-		missing := make([]string, 0, len(migrations)-len(binPaths))
-		for _, mig := range migrations {
-			if _, ok := binPaths[mig]; !ok {
-				missing = append(missing, mig)
-			}
+	// Download migrations that are neither embedded nor found in PATH
+	var missing []string
+	for _, mig := range migrations {
+		if _, ok := embeddedMigrations[mig]; ok {
+			continue
 		}
-
+		if dryRun {
+			return fmt.Errorf("migration %s is not embedded and does not support dry runs", mig)
+		}
+		if _, ok := binPaths[mig]; !ok {
+			missing = append(missing, mig)
+		}
+	}
+	if len(missing) > 0 {
 		logger.Println("Need", len(missing), "migrations, downloading.")
 
 		tmpDir, err := os.MkdirTemp("", "migrations")
@@ -79,18 +98,36 @@ func RunMigration(ctx context.Context, fetcher Fetcher, targetVer int, ipfsDir s
 		}
 	}
 
+	step := 1
 	var revert bool
 	if fromVer > targetVer {
+		step = -1
 		revert = true
 	}
-	for _, migration := range migrations {
-		logger.Println("Running migration", migration, "...")
-		err = runMigration(ctx, binPaths[migration], ipfsDir, revert, logger)
+	for i, migration := range migrations {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if m, ok := embeddedMigrations[migration]; ok {
+			if dryRun {
+				logger.Println("Dry run of embedded migration", migration, "...")
+			} else {
+				logger.Println("Running embedded migration", migration, "...")
+			}
+			err = runEmbeddedMigration(m, ipfsDir, revert, dryRun, fromVer+(i+1)*step, logger)
+		} else {
+			logger.Println("Running migration", migration, "...")
+			err = runMigration(ctx, binPaths[migration], ipfsDir, revert, logger)
+		}
 		if err != nil {
 			return fmt.Errorf("migration %s failed: %w", migration, err)
 		}
 	}
-	logger.Printf("Success: fs-repo migrated to version %d.\n", targetVer)
+	if dryRun {
+		logger.Printf("Dry run: fs-repo was not modified.\n")
+	} else {
+		logger.Printf("Success: fs-repo migrated to version %d.\n", targetVer)
+	}
 
 	return nil
 }
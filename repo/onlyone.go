@@ -56,6 +56,15 @@ type ref struct {
 
 var _ Repo = (*ref)(nil)
 
+// Path returns the path of the repo, for the repos stored on disk. The
+// embedded Repo interface would hide it.
+func (r *ref) Path() string {
+	if pr, ok := r.Repo.(interface{ Path() string }); ok {
+		return pr.Path()
+	}
+	return ""
+}
+
 func (r *ref) Close() error {
 	r.parent.mu.Lock()
 	defer r.parent.mu.Unlock()
@@ -0,0 +1,204 @@
+// Package reputation scores peers on their misbehavior, reported by the
+// subsystems they talk to, and temporarily bans the peers whose score goes
+// over a threshold.
+//
+// Scores decay over time, so that occasional misbehavior, which can be
+// caused by bugs or bad luck rather than malice, does not add up to a ban.
+package reputation
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var log = logging.Logger("reputation")
+
+// ScoreHalfLife is the time it takes for a score to halve.
+const ScoreHalfLife = 10 * time.Minute
+
+// minScore is the score below which peers are forgotten.
+const minScore = 0.1
+
+// minSweep is the number of tracked peers below which forgotten peers are
+// not swept.
+const minSweep = 1024
+
+var (
+	penaltiesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ipfs_reputation_penalties_total",
+		Help: "Misbehaviors reported to the reputation subsystem, by reason.",
+	}, []string{"reason"})
+	bansTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "ipfs_reputation_bans_total",
+		Help: "Peers banned by the reputation subsystem.",
+	})
+)
+
+// PeerReputation is the reputation of a peer.
+type PeerReputation struct {
+	ID peer.ID
+	// Score is the decayed sum of the penalties of the peer.
+	Score float64
+	// Reasons counts the penalties of the peer by reason, since it was
+	// last forgotten or unbanned.
+	Reasons map[string]int
+	// BannedUntil is zero unless the peer is banned.
+	BannedUntil time.Time `json:",omitempty"`
+}
+
+type entry struct {
+	score       float64
+	updated     time.Time
+	reasons     map[string]int
+	bannedUntil time.Time
+}
+
+// decay brings the score of e to now.
+func (e *entry) decay(now time.Time) {
+	e.score *= math.Exp2(-float64(now.Sub(e.updated)) / float64(ScoreHalfLife))
+	e.updated = now
+}
+
+// Tracker keeps the reputation of peers. A nil Tracker ignores penalties and
+// bans nobody.
+type Tracker struct {
+	threshold   float64
+	banDuration time.Duration
+
+	mu      sync.Mutex
+	peers   map[peer.ID]*entry
+	sweepAt int
+	onBan   []func(peer.ID)
+}
+
+// NewTracker returns a tracker banning peers for banDuration when their
+// score reaches threshold.
+func NewTracker(threshold float64, banDuration time.Duration) *Tracker {
+	return &Tracker{
+		threshold:   threshold,
+		banDuration: banDuration,
+		peers:       make(map[peer.ID]*entry),
+		sweepAt:     minSweep,
+	}
+}
+
+// OnBan registers f to be called with the peers when they get banned, such
+// as to disconnect them.
+func (t *Tracker) OnBan(f func(peer.ID)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onBan = append(t.onBan, f)
+}
+
+// Penalize adds penalty to the score of p for reason, and bans p when its
+// score reaches the threshold.
+func (t *Tracker) Penalize(p peer.ID, reason string, penalty float64) {
+	if t == nil {
+		return
+	}
+	penaltiesTotal.WithLabelValues(reason).Inc()
+
+	now := time.Now()
+	t.mu.Lock()
+	e, ok := t.peers[p]
+	if !ok {
+		e = &entry{updated: now, reasons: make(map[string]int)}
+		t.peers[p] = e
+		t.sweep(now)
+	}
+	e.decay(now)
+	e.score += penalty
+	e.reasons[reason]++
+
+	var onBan []func(peer.ID)
+	if e.score >= t.threshold && !e.bannedUntil.After(now) {
+		e.bannedUntil = now.Add(t.banDuration)
+		onBan = t.onBan
+		log.Infow("banning peer", "peer", p, "score", e.score, "until", e.bannedUntil, "reasons", e.reasons)
+		bansTotal.Inc()
+	}
+	t.mu.Unlock()
+
+	for _, f := range onBan {
+		f(p)
+	}
+}
+
+// Banned reports whether p is banned.
+func (t *Tracker) Banned(p peer.ID) bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e, ok := t.peers[p]
+	return ok && e.bannedUntil.After(time.Now())
+}
+
+// Unban lifts the ban of p and forgets its penalties. It reports whether p
+// was banned.
+func (t *Tracker) Unban(p peer.ID) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e, ok := t.peers[p]
+	if !ok {
+		return false
+	}
+	delete(t.peers, p)
+	return e.bannedUntil.After(time.Now())
+}
+
+// Peers returns the reputation of the peers with a penalty or a ban, sorted
+// by decreasing score.
+func (t *Tracker) Peers() []PeerReputation {
+	now := time.Now()
+	t.mu.Lock()
+	out := make([]PeerReputation, 0, len(t.peers))
+	for p, e := range t.peers {
+		e.decay(now)
+		if e.score < minScore && !e.bannedUntil.After(now) {
+			delete(t.peers, p)
+			continue
+		}
+		pr := PeerReputation{ID: p, Score: e.score, Reasons: make(map[string]int, len(e.reasons))}
+		for r, n := range e.reasons {
+			pr.Reasons[r] = n
+		}
+		if e.bannedUntil.After(now) {
+			pr.BannedUntil = e.bannedUntil
+		}
+		out = append(out, pr)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// sweep forgets the peers that are not banned and whose score decayed below
+// minScore, when the number of tracked peers doubled since the last sweep.
+// The caller must hold t.mu.
+func (t *Tracker) sweep(now time.Time) {
+	if len(t.peers) < t.sweepAt {
+		return
+	}
+	for p, e := range t.peers {
+		e.decay(now)
+		if e.score < minScore && !e.bannedUntil.After(now) {
+			delete(t.peers, p)
+		}
+	}
+	t.sweepAt = max(2*len(t.peers), minSweep)
+}
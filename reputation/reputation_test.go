@@ -0,0 +1,76 @@
+package reputation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracker(t *testing.T) {
+	require := require.New(t)
+
+	tr := NewTracker(100, time.Hour)
+	var banned []peer.ID
+	tr.OnBan(func(p peer.ID) { banned = append(banned, p) })
+
+	a, b := peer.ID("a"), peer.ID("b")
+	for i := 0; i < 9; i++ {
+		tr.Penalize(a, "invalid", 10)
+	}
+	tr.Penalize(b, "limit", 1)
+	require.False(tr.Banned(a))
+	require.Empty(banned)
+
+	tr.Penalize(a, "limit", 20)
+	require.True(tr.Banned(a))
+	require.False(tr.Banned(b))
+	require.Equal([]peer.ID{a}, banned)
+
+	// Banned peers are not banned again.
+	tr.Penalize(a, "invalid", 10)
+	require.Len(banned, 1)
+
+	peers := tr.Peers()
+	require.Len(peers, 2)
+	require.Equal(a, peers[0].ID)
+	require.Equal(map[string]int{"invalid": 10, "limit": 1}, peers[0].Reasons)
+	require.False(peers[0].BannedUntil.IsZero())
+	require.Equal(b, peers[1].ID)
+	require.True(peers[1].BannedUntil.IsZero())
+
+	require.True(tr.Unban(a))
+	require.False(tr.Banned(a))
+	require.False(tr.Unban(a))
+	require.False(tr.Unban(b))
+	require.Empty(tr.Peers())
+}
+
+func TestTrackerDecay(t *testing.T) {
+	require := require.New(t)
+
+	tr := NewTracker(100, time.Hour)
+	p := peer.ID("p")
+	tr.Penalize(p, "invalid", 80)
+
+	// Penalties spread over time do not add up to a ban.
+	tr.mu.Lock()
+	tr.peers[p].updated = time.Now().Add(-ScoreHalfLife)
+	tr.mu.Unlock()
+	tr.Penalize(p, "invalid", 50)
+	require.False(tr.Banned(p))
+	require.InDelta(90, tr.Peers()[0].Score, 0.1)
+
+	// Peers whose score decayed away are forgotten.
+	tr.mu.Lock()
+	tr.peers[p].updated = time.Now().Add(-20 * ScoreHalfLife)
+	tr.mu.Unlock()
+	require.Empty(tr.Peers())
+}
+
+func TestTrackerNil(t *testing.T) {
+	var tr *Tracker
+	tr.Penalize(peer.ID("p"), "invalid", 1000)
+	require.False(t, tr.Banned(peer.ID("p")))
+}
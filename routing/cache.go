@@ -0,0 +1,291 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2"
+	"github.com/ipfs/boxo/ipns"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/kubo/config"
+	routinghelpers "github.com/libp2p/go-libp2p-routing-helpers"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/routing"
+	"github.com/multiformats/go-multihash"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Results of the lookups in the cache of routers, for metrics.
+const (
+	cacheHit         = "hit"
+	cacheNegativeHit = "negative_hit"
+	cacheMiss        = "miss"
+)
+
+var cacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "ipfs",
+	Subsystem: "routing",
+	Name:      "cache_lookups_total",
+	Help:      "Lookups in the cache of routers, by router, record type and result (hit, negative_hit or miss).",
+}, []string{"router", "record", "result"})
+
+var (
+	_ routing.Routing                  = &cachedRouter{}
+	_ routinghelpers.ProvideManyRouter = &cachedRouter{}
+	_ routinghelpers.ReadyAbleRouter   = &cachedRouter{}
+)
+
+// cacheEntry is a cached lookup.
+type cacheEntry struct {
+	expires time.Time
+	// empty is set when the lookup found nothing.
+	empty bool
+
+	providers []peer.AddrInfo
+	// complete is set when providers are all the providers found, and not
+	// only the number asked for.
+	complete bool
+
+	peer  peer.AddrInfo
+	value []byte
+}
+
+// cachedRouter caches the provider, peer and IPNS records returned by a router
+// in a size-bounded LRU cache, along with the lookups that found nothing.
+type cachedRouter struct {
+	routing.Routing
+
+	name        string
+	ttl         time.Duration
+	negativeTTL time.Duration
+	cache       *lru.Cache[string, *cacheEntry]
+}
+
+func newCachedRouter(name string, router routing.Routing, params *config.RouterCacheParams) (*cachedRouter, error) {
+	size := int(params.MaxEntries.WithDefault(config.DefaultRouterCacheMaxEntries))
+	if size <= 0 {
+		return nil, errors.New("router cache: MaxEntries must be positive")
+	}
+	cache, err := lru.New[string, *cacheEntry](size)
+	if err != nil {
+		return nil, err
+	}
+	return &cachedRouter{
+		Routing:     router,
+		name:        name,
+		ttl:         params.TTL.WithDefault(config.DefaultRouterCacheTTL),
+		negativeTTL: params.NegativeTTL.WithDefault(config.DefaultRouterCacheNegativeTTL),
+		cache:       cache,
+	}, nil
+}
+
+// get returns the fresh entry for key, if it answers the lookup, and counts
+// the lookup. usable reports whether an entry that isn't empty answers it.
+func (r *cachedRouter) get(record, key string, usable func(*cacheEntry) bool) *cacheEntry {
+	e, ok := r.cache.Get(key)
+	if ok && time.Now().After(e.expires) {
+		r.cache.Remove(key)
+		ok = false
+	}
+	switch {
+	case ok && e.empty:
+		cacheLookups.WithLabelValues(r.name, record, cacheNegativeHit).Inc()
+		return e
+	case ok && (usable == nil || usable(e)):
+		cacheLookups.WithLabelValues(r.name, record, cacheHit).Inc()
+		return e
+	default:
+		cacheLookups.WithLabelValues(r.name, record, cacheMiss).Inc()
+		return nil
+	}
+}
+
+// put caches e for ttl, or for the negative TTL if e is empty.
+func (r *cachedRouter) put(key string, e *cacheEntry, ttl time.Duration) {
+	if e.empty {
+		ttl = r.negativeTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+	e.expires = time.Now().Add(ttl)
+	r.cache.Add(key, e)
+}
+
+func providersKey(c cid.Cid) string { return "/providers/" + string(c.Hash()) }
+func peerKey(p peer.ID) string      { return "/peers/" + string(p) }
+func valueKey(key string) string    { return "/values/" + key }
+
+func (r *cachedRouter) FindProvidersAsync(ctx context.Context, c cid.Cid, count int) <-chan peer.AddrInfo {
+	key := providersKey(c)
+	e := r.get("providers", key, func(e *cacheEntry) bool {
+		// Entries with fewer providers than asked for are only usable when
+		// they hold all the providers found.
+		return e.complete || count > 0 && len(e.providers) >= count
+	})
+	if e != nil {
+		providers := e.providers
+		if count > 0 && len(providers) > count {
+			providers = providers[:count]
+		}
+		ch := make(chan peer.AddrInfo, len(providers))
+		for _, p := range providers {
+			ch <- p
+		}
+		close(ch)
+		return ch
+	}
+
+	in := r.Routing.FindProvidersAsync(ctx, c, count)
+	out := make(chan peer.AddrInfo)
+	go func() {
+		defer close(out)
+		var found []peer.AddrInfo
+		for p := range in {
+			found = append(found, p)
+			select {
+			case out <- p:
+			case <-ctx.Done():
+				for range in {
+				}
+				return
+			}
+		}
+		if ctx.Err() != nil {
+			// The lookup was interrupted, its results may be partial.
+			return
+		}
+		complete := count <= 0 || len(found) < count
+		r.put(key, &cacheEntry{empty: len(found) == 0, providers: found, complete: complete}, r.ttl)
+	}()
+	return out
+}
+
+func (r *cachedRouter) FindPeer(ctx context.Context, p peer.ID) (peer.AddrInfo, error) {
+	key := peerKey(p)
+	if e := r.get("peers", key, nil); e != nil {
+		if e.empty {
+			return peer.AddrInfo{}, routing.ErrNotFound
+		}
+		return e.peer, nil
+	}
+
+	ai, err := r.Routing.FindPeer(ctx, p)
+	switch {
+	case err == nil:
+		r.put(key, &cacheEntry{peer: ai}, r.ttl)
+	case errors.Is(err, routing.ErrNotFound):
+		r.put(key, &cacheEntry{empty: true}, 0)
+	}
+	return ai, err
+}
+
+func (r *cachedRouter) PutValue(ctx context.Context, key string, val []byte, opts ...routing.Option) error {
+	r.cache.Remove(valueKey(key))
+	return r.Routing.PutValue(ctx, key, val, opts...)
+}
+
+func (r *cachedRouter) GetValue(ctx context.Context, key string, opts ...routing.Option) ([]byte, error) {
+	ckey := valueKey(key)
+	if e := r.get(valueRecordType(key), ckey, nil); e != nil {
+		if e.empty {
+			return nil, routing.ErrNotFound
+		}
+		return e.value, nil
+	}
+
+	val, err := r.Routing.GetValue(ctx, key, opts...)
+	r.putValue(key, val, err)
+	return val, err
+}
+
+func (r *cachedRouter) SearchValue(ctx context.Context, key string, opts ...routing.Option) (<-chan []byte, error) {
+	ckey := valueKey(key)
+	if e := r.get(valueRecordType(key), ckey, nil); e != nil {
+		if e.empty {
+			return nil, routing.ErrNotFound
+		}
+		ch := make(chan []byte, 1)
+		ch <- e.value
+		close(ch)
+		return ch, nil
+	}
+
+	in, err := r.Routing.SearchValue(ctx, key, opts...)
+	if err != nil || in == nil {
+		r.putValue(key, nil, err)
+		return in, err
+	}
+	out := make(chan []byte)
+	go func() {
+		defer close(out)
+		var last []byte
+		for val := range in {
+			last = val
+			select {
+			case out <- val:
+			case <-ctx.Done():
+				for range in {
+				}
+				return
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if last == nil {
+			r.putValue(key, nil, routing.ErrNotFound)
+		} else {
+			r.putValue(key, last, nil)
+		}
+	}()
+	return out, nil
+}
+
+// putValue caches the outcome of a value lookup. IPNS records are cached at
+// most for their TTL.
+func (r *cachedRouter) putValue(key string, val []byte, err error) {
+	switch {
+	case err == nil && val != nil:
+		ttl := r.ttl
+		if strings.HasPrefix(key, ipns.NamespacePrefix) {
+			if rec, err := ipns.UnmarshalRecord(val); err == nil {
+				if recTTL, err := rec.TTL(); err == nil && recTTL < ttl {
+					ttl = recTTL
+				}
+			}
+		}
+		r.put(valueKey(key), &cacheEntry{value: val}, ttl)
+	case errors.Is(err, routing.ErrNotFound):
+		r.put(valueKey(key), &cacheEntry{empty: true}, 0)
+	}
+}
+
+func valueRecordType(key string) string {
+	if strings.HasPrefix(key, ipns.NamespacePrefix) {
+		return "ipns"
+	}
+	return "values"
+}
+
+func (r *cachedRouter) ProvideMany(ctx context.Context, keys []multihash.Multihash) error {
+	if pmr, ok := r.Routing.(routinghelpers.ProvideManyRouter); ok {
+		return pmr.ProvideMany(ctx, keys)
+	}
+	for _, k := range keys {
+		if err := r.Routing.Provide(ctx, cid.NewCidV1(cid.Raw, k), true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *cachedRouter) Ready() bool {
+	if rr, ok := r.Routing.(routinghelpers.ReadyAbleRouter); ok {
+		return rr.Ready()
+	}
+	return true
+}
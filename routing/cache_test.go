@@ -0,0 +1,181 @@
+package routing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/ipns"
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/kubo/config"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/routing"
+	"github.com/stretchr/testify/require"
+)
+
+// countingRouter returns fixed records and counts the lookups it gets.
+type countingRouter struct {
+	routing.Routing
+
+	providers []peer.AddrInfo
+	peers     map[peer.ID]peer.AddrInfo
+	values    map[string][]byte
+	lookups   int
+}
+
+func (r *countingRouter) FindProvidersAsync(ctx context.Context, c cid.Cid, count int) <-chan peer.AddrInfo {
+	r.lookups++
+	providers := r.providers
+	if count > 0 && len(providers) > count {
+		providers = providers[:count]
+	}
+	ch := make(chan peer.AddrInfo, len(providers))
+	for _, p := range providers {
+		ch <- p
+	}
+	close(ch)
+	return ch
+}
+
+func (r *countingRouter) FindPeer(ctx context.Context, p peer.ID) (peer.AddrInfo, error) {
+	r.lookups++
+	ai, ok := r.peers[p]
+	if !ok {
+		return peer.AddrInfo{}, routing.ErrNotFound
+	}
+	return ai, nil
+}
+
+func (r *countingRouter) GetValue(ctx context.Context, key string, opts ...routing.Option) ([]byte, error) {
+	r.lookups++
+	val, ok := r.values[key]
+	if !ok {
+		return nil, routing.ErrNotFound
+	}
+	return val, nil
+}
+
+func (r *countingRouter) PutValue(ctx context.Context, key string, val []byte, opts ...routing.Option) error {
+	r.values[key] = val
+	return nil
+}
+
+func collectProviders(ch <-chan peer.AddrInfo) []peer.AddrInfo {
+	var provs []peer.AddrInfo
+	for ai := range ch {
+		provs = append(provs, ai)
+	}
+	return provs
+}
+
+func TestCachedRouterProviders(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	c, err := cid.Decode("bafkreifjjcie6lypi6ny7amxnfftagclbuxndqonfipmb64f2km2devei4")
+	require.NoError(err)
+	var provs []peer.AddrInfo
+	for i := 0; i < 3; i++ {
+		pid, _, err := generatePeerID()
+		require.NoError(err)
+		p, err := peer.Decode(pid)
+		require.NoError(err)
+		provs = append(provs, peer.AddrInfo{ID: p})
+	}
+
+	fake := &countingRouter{providers: provs}
+	r, err := newCachedRouter("http", fake, &config.RouterCacheParams{})
+	require.NoError(err)
+
+	// Two providers out of three are not enough to answer a lookup for more.
+	require.Len(collectProviders(r.FindProvidersAsync(ctx, c, 2)), 2)
+	require.Len(collectProviders(r.FindProvidersAsync(ctx, c, 1)), 1)
+	require.Equal(1, fake.lookups)
+	require.Len(collectProviders(r.FindProvidersAsync(ctx, c, 0)), 3)
+	require.Equal(2, fake.lookups)
+
+	// All the providers answer any lookup, and are matched by multihash.
+	require.Len(collectProviders(r.FindProvidersAsync(ctx, cid.NewCidV1(cid.DagProtobuf, c.Hash()), 10)), 3)
+	require.Equal(2, fake.lookups)
+
+	// Lookups that find nothing are cached for the negative TTL.
+	fake.providers = nil
+	r, err = newCachedRouter("http", fake, &config.RouterCacheParams{
+		NegativeTTL: config.NewOptionalDuration(50 * time.Millisecond),
+	})
+	require.NoError(err)
+	require.Empty(collectProviders(r.FindProvidersAsync(ctx, c, 0)))
+	require.Empty(collectProviders(r.FindProvidersAsync(ctx, c, 0)))
+	require.Equal(3, fake.lookups)
+	time.Sleep(100 * time.Millisecond)
+	require.Empty(collectProviders(r.FindProvidersAsync(ctx, c, 0)))
+	require.Equal(4, fake.lookups)
+}
+
+func TestCachedRouterPeersAndValues(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	pid, _, err := generatePeerID()
+	require.NoError(err)
+	p, err := peer.Decode(pid)
+	require.NoError(err)
+
+	fake := &countingRouter{
+		peers:  map[peer.ID]peer.AddrInfo{p: {ID: p}},
+		values: map[string][]byte{},
+	}
+	r, err := newCachedRouter("http", fake, &config.RouterCacheParams{
+		NegativeTTL: config.NewOptionalDuration(0),
+	})
+	require.NoError(err)
+
+	for i := 0; i < 2; i++ {
+		ai, err := r.FindPeer(ctx, p)
+		require.NoError(err)
+		require.Equal(p, ai.ID)
+	}
+	require.Equal(1, fake.lookups)
+
+	// Negative caching is disabled with a zero negative TTL.
+	for i := 0; i < 2; i++ {
+		_, err = r.GetValue(ctx, "/ipns/foo")
+		require.ErrorIs(err, routing.ErrNotFound)
+	}
+	require.Equal(3, fake.lookups)
+
+	// IPNS records are cached at most for their TTL.
+	sk, _, err := crypto.GenerateEd25519Key(nil)
+	require.NoError(err)
+	name := ipns.NameFromPeer(mustIDFromPrivateKey(t, sk))
+	c, err := cid.Decode("bafkreifjjcie6lypi6ny7amxnfftagclbuxndqonfipmb64f2km2devei4")
+	require.NoError(err)
+	rec, err := ipns.NewRecord(sk, path.FromCid(c), 1, time.Now().Add(time.Hour), 50*time.Millisecond)
+	require.NoError(err)
+	recBytes, err := ipns.MarshalRecord(rec)
+	require.NoError(err)
+	key := string(name.RoutingKey())
+
+	require.NoError(r.PutValue(ctx, key, recBytes))
+	for i := 0; i < 2; i++ {
+		val, err := r.GetValue(ctx, key)
+		require.NoError(err)
+		require.Equal(recBytes, val)
+	}
+	require.Equal(4, fake.lookups)
+	time.Sleep(100 * time.Millisecond)
+	_, err = r.GetValue(ctx, key)
+	require.NoError(err)
+	require.Equal(5, fake.lookups)
+
+	// Publishing a value invalidates the cached one.
+	require.NoError(r.PutValue(ctx, key, recBytes))
+	_, err = r.GetValue(ctx, key)
+	require.NoError(err)
+	require.Equal(6, fake.lookups)
+
+	_, err = newCachedRouter("http", fake, &config.RouterCacheParams{MaxEntries: config.NewOptionalInteger(0)})
+	require.Error(err)
+}
@@ -28,20 +28,25 @@ import (
 
 var log = logging.Logger("routing/delegated")
 
-func Parse(routers config.Routers, methods config.Methods, extraDHT *ExtraDHTParams, extraHTTP *ExtraHTTPParams) (routing.Routing, error) {
+func Parse(routers config.Routers, methods config.Methods, extraDHT *ExtraDHTParams, extraHTTP *ExtraHTTPParams, extraStatic *ExtraStaticParams) (routing.Routing, error) {
 	if err := methods.Check(); err != nil {
 		return nil, err
 	}
 
 	createdRouters := make(map[string]routing.Routing)
+	explained := make(map[string]routing.Routing)
 	finalRouter := &Composer{}
 
 	// Create all needed routers from method names
 	for mn, m := range methods {
-		router, err := parse(make(map[string]bool), createdRouters, m.RouterName, routers, extraDHT, extraHTTP)
+		router, err := parse(make(map[string]bool), createdRouters, m.RouterName, routers, extraDHT, extraHTTP, extraStatic)
 		if err != nil {
 			return nil, err
 		}
+		if _, ok := explained[m.RouterName]; !ok {
+			explained[m.RouterName] = withExplain(router, m.RouterName, "", false)
+		}
+		router = explained[m.RouterName]
 
 		switch mn {
 		case config.MethodNamePutIPNS:
@@ -68,6 +73,7 @@ func parse(visited map[string]bool,
 	routersCfg config.Routers,
 	extraDHT *ExtraDHTParams,
 	extraHTTP *ExtraHTTPParams,
+	extraStatic *ExtraStaticParams,
 ) (routing.Routing, error) {
 	// check if we already created it
 	r, ok := createdRouters[routerName]
@@ -93,19 +99,27 @@ func parse(visited map[string]bool,
 	switch cfg.Type {
 	case config.RouterTypeHTTP:
 		router, err = httpRoutingFromConfig(cfg.Router, extraHTTP)
+		if err != nil {
+			break
+		}
+		if params, ok := cfg.Parameters.(*config.HTTPRouterParams); ok && params.Cache != nil {
+			router, err = newCachedRouter(routerName, router, params.Cache)
+		}
 	case config.RouterTypeDHT:
 		router, err = dhtRoutingFromConfig(cfg.Router, extraDHT)
+	case config.RouterTypeStatic:
+		router, err = staticRoutingFromConfig(routerName, cfg.Router, extraStatic)
 	case config.RouterTypeParallel:
 		crp := cfg.Parameters.(*config.ComposableRouterParams)
 		var pr []*routinghelpers.ParallelRouter
 		for _, cr := range crp.Routers {
-			ri, err := parse(visited, createdRouters, cr.RouterName, routersCfg, extraDHT, extraHTTP)
+			ri, err := parse(visited, createdRouters, cr.RouterName, routersCfg, extraDHT, extraHTTP, extraStatic)
 			if err != nil {
 				return nil, err
 			}
 
 			pr = append(pr, &routinghelpers.ParallelRouter{
-				Router:                  ri,
+				Router:                  withExplain(ri, cr.RouterName, routerName, cr.IgnoreErrors),
 				IgnoreError:             cr.IgnoreErrors,
 				DoNotWaitForSearchValue: true,
 				Timeout:                 cr.Timeout.Duration,
@@ -119,13 +133,13 @@ func parse(visited map[string]bool,
 		crp := cfg.Parameters.(*config.ComposableRouterParams)
 		var sr []*routinghelpers.SequentialRouter
 		for _, cr := range crp.Routers {
-			ri, err := parse(visited, createdRouters, cr.RouterName, routersCfg, extraDHT, extraHTTP)
+			ri, err := parse(visited, createdRouters, cr.RouterName, routersCfg, extraDHT, extraHTTP, extraStatic)
 			if err != nil {
 				return nil, err
 			}
 
 			sr = append(sr, &routinghelpers.SequentialRouter{
-				Router:      ri,
+				Router:      withExplain(ri, cr.RouterName, routerName, cr.IgnoreErrors),
 				IgnoreError: cr.IgnoreErrors,
 				Timeout:     cr.Timeout.Duration,
 			})
@@ -171,8 +185,8 @@ func ConstructHTTPRouter(endpoint string, peerID string, addrs []string, privKey
 }
 
 func httpRoutingFromConfig(conf config.Router, extraHTTP *ExtraHTTPParams) (routing.Routing, error) {
-	params := conf.Parameters.(*config.HTTPRouterParams)
-	if params.Endpoint == "" {
+	params, ok := conf.Parameters.(*config.HTTPRouterParams)
+	if !ok || params.Endpoint == "" {
 		return nil, NewParamNeededErr("Endpoint", conf.Type)
 	}
 
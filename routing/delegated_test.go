@@ -3,6 +3,7 @@ package routing
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/json"
 	"testing"
 
 	"github.com/ipfs/kubo/config"
@@ -57,7 +58,7 @@ func TestParser(t *testing.T) {
 	}, &ExtraDHTParams{}, &ExtraHTTPParams{
 		PeerID:     string(pid),
 		PrivKeyB64: sk,
-	})
+	}, &ExtraStaticParams{})
 
 	require.NoError(err)
 
@@ -148,7 +149,7 @@ func TestParserRecursive(t *testing.T) {
 	}, &ExtraDHTParams{}, &ExtraHTTPParams{
 		PeerID:     string(pid),
 		PrivKeyB64: sk,
-	})
+	}, &ExtraStaticParams{})
 
 	require.NoError(err)
 
@@ -200,7 +201,7 @@ func TestParserRecursiveLoop(t *testing.T) {
 		config.MethodNameProvide: config.Method{
 			RouterName: "composable2",
 		},
-	}, &ExtraDHTParams{}, nil)
+	}, &ExtraDHTParams{}, nil, nil)
 
 	require.ErrorContains(err, "dependency loop creating router with name \"composable2\"")
 }
@@ -224,3 +225,20 @@ func generatePeerID() (string, string, error) {
 	pid, err := peer.IDFromPublicKey(pk)
 	return pid.String(), enc, err
 }
+
+func TestParserHTTPWithoutParameters(t *testing.T) {
+	require := require.New(t)
+
+	var routers config.Routers
+	err := json.Unmarshal([]byte(`{"r1": {"Type": "http", "Parameters": null}}`), &routers)
+	require.NoError(err)
+
+	_, err = Parse(routers, config.Methods{
+		config.MethodNameFindPeers:     config.Method{RouterName: "r1"},
+		config.MethodNameFindProviders: config.Method{RouterName: "r1"},
+		config.MethodNameGetIPNS:       config.Method{RouterName: "r1"},
+		config.MethodNamePutIPNS:       config.Method{RouterName: "r1"},
+		config.MethodNameProvide:       config.Method{RouterName: "r1"},
+	}, &ExtraDHTParams{}, nil, nil)
+	require.ErrorContains(err, "Endpoint")
+}
@@ -0,0 +1,221 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	routinghelpers "github.com/libp2p/go-libp2p-routing-helpers"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/routing"
+	"github.com/multiformats/go-multihash"
+)
+
+// ExplainEventType is the type of an ExplainEvent.
+type ExplainEventType string
+
+const (
+	ExplainStart    ExplainEventType = "start"    // The router was queried.
+	ExplainResult   ExplainEventType = "result"   // The router returned a result.
+	ExplainError    ExplainEventType = "error"    // The router failed.
+	ExplainDone     ExplainEventType = "done"     // The router returned all its results.
+	ExplainTimeout  ExplainEventType = "timeout"  // The router was stopped by a timeout.
+	ExplainCanceled ExplainEventType = "canceled" // The router was stopped by its caller.
+)
+
+// ExplainEvent is a step of a query through the routers of Routing.Routers.
+type ExplainEvent struct {
+	// Event is not named Type, as go-ipfs-cmds decodes objects with an
+	// "error" Type as command errors.
+	Event ExplainEventType
+	// Router is the name of the router in Routing.Routers.
+	Router string
+	// Parent is the name of the parallel or sequential router that queried
+	// Router, or empty if Router is used directly by a method.
+	Parent string `json:",omitempty"`
+	// IgnoreErrors is set when the errors of Router are ignored by Parent.
+	IgnoreErrors bool `json:",omitempty"`
+	// Elapsed is the time since Router was queried.
+	Elapsed time.Duration
+	Result  string `json:",omitempty"`
+	Error   string `json:",omitempty"`
+}
+
+type explainerKey struct{}
+
+// ContextWithExplainer returns a context whose routing queries report their
+// steps through the routers of Routing.Routers to explain. explain may be
+// called concurrently.
+func ContextWithExplainer(ctx context.Context, explain func(ExplainEvent)) context.Context {
+	return context.WithValue(ctx, explainerKey{}, explain)
+}
+
+func explainerFromContext(ctx context.Context) func(ExplainEvent) {
+	explain, _ := ctx.Value(explainerKey{}).(func(ExplainEvent))
+	return explain
+}
+
+var (
+	_ routing.Routing                  = &explainRouter{}
+	_ routinghelpers.ReadyAbleRouter   = &explainRouter{}
+	_ routinghelpers.ProvideManyRouter = &explainProvideManyRouter{}
+)
+
+// explainRouter reports the queries to a router to the explainer of their
+// context, if any.
+type explainRouter struct {
+	routing.Routing
+
+	name         string
+	parent       string
+	ignoreErrors bool
+}
+
+// explainProvideManyRouter is an explainRouter for routers that implement
+// ProvideMany, so that composing routers keep using it.
+type explainProvideManyRouter struct {
+	*explainRouter
+	pmr routinghelpers.ProvideManyRouter
+}
+
+func (r *explainProvideManyRouter) ProvideMany(ctx context.Context, keys []multihash.Multihash) error {
+	return r.pmr.ProvideMany(ctx, keys)
+}
+
+// withExplain wraps the router name, queried by parent, so that its queries
+// are explained.
+func withExplain(router routing.Routing, name, parent string, ignoreErrors bool) routing.Routing {
+	er := &explainRouter{Routing: router, name: name, parent: parent, ignoreErrors: ignoreErrors}
+	if pmr, ok := router.(routinghelpers.ProvideManyRouter); ok {
+		return &explainProvideManyRouter{explainRouter: er, pmr: pmr}
+	}
+	return er
+}
+
+func (r *explainRouter) Ready() bool {
+	if rr, ok := r.Routing.(routinghelpers.ReadyAbleRouter); ok {
+		return rr.Ready()
+	}
+	return true
+}
+
+// start reports that the router is queried, and returns a function reporting
+// the next steps, or nil if ctx has no explainer.
+func (r *explainRouter) start(ctx context.Context) func(t ExplainEventType, result string, err error) {
+	explain := explainerFromContext(ctx)
+	if explain == nil {
+		return nil
+	}
+	begin := time.Now()
+	report := func(t ExplainEventType, result string, err error) {
+		ev := ExplainEvent{
+			Event:        t,
+			Router:       r.name,
+			Parent:       r.parent,
+			IgnoreErrors: r.ignoreErrors,
+			Elapsed:      time.Since(begin),
+			Result:       result,
+		}
+		if err != nil {
+			ev.Error = err.Error()
+		}
+		explain(ev)
+	}
+	report(ExplainStart, "", nil)
+	return report
+}
+
+// reportEnd reports how a query ended.
+func reportEnd(ctx context.Context, report func(ExplainEventType, string, error), err error) {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+		report(ExplainTimeout, "", err)
+	case errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled):
+		report(ExplainCanceled, "", err)
+	case err != nil:
+		report(ExplainError, "", err)
+	default:
+		report(ExplainDone, "", nil)
+	}
+}
+
+func (r *explainRouter) FindProvidersAsync(ctx context.Context, c cid.Cid, count int) <-chan peer.AddrInfo {
+	report := r.start(ctx)
+	ch := r.Routing.FindProvidersAsync(ctx, c, count)
+	if report == nil {
+		return ch
+	}
+	out := make(chan peer.AddrInfo)
+	go func() {
+		defer close(out)
+		for ai := range ch {
+			report(ExplainResult, ai.String(), nil)
+			select {
+			case out <- ai:
+			case <-ctx.Done():
+				// Drain ch so the router can finish.
+				for range ch {
+				}
+				reportEnd(ctx, report, nil)
+				return
+			}
+		}
+		reportEnd(ctx, report, nil)
+	}()
+	return out
+}
+
+func (r *explainRouter) FindPeer(ctx context.Context, p peer.ID) (peer.AddrInfo, error) {
+	report := r.start(ctx)
+	ai, err := r.Routing.FindPeer(ctx, p)
+	if report != nil {
+		if err == nil {
+			report(ExplainResult, ai.String(), nil)
+		}
+		reportEnd(ctx, report, err)
+	}
+	return ai, err
+}
+
+func (r *explainRouter) GetValue(ctx context.Context, key string, opts ...routing.Option) ([]byte, error) {
+	report := r.start(ctx)
+	val, err := r.Routing.GetValue(ctx, key, opts...)
+	if report != nil {
+		if err == nil {
+			report(ExplainResult, fmt.Sprintf("value of %d bytes", len(val)), nil)
+		}
+		reportEnd(ctx, report, err)
+	}
+	return val, err
+}
+
+func (r *explainRouter) SearchValue(ctx context.Context, key string, opts ...routing.Option) (<-chan []byte, error) {
+	report := r.start(ctx)
+	ch, err := r.Routing.SearchValue(ctx, key, opts...)
+	if report == nil {
+		return ch, err
+	}
+	if err != nil || ch == nil {
+		reportEnd(ctx, report, err)
+		return ch, err
+	}
+	out := make(chan []byte)
+	go func() {
+		defer close(out)
+		for val := range ch {
+			report(ExplainResult, fmt.Sprintf("value of %d bytes", len(val)), nil)
+			select {
+			case out <- val:
+			case <-ctx.Done():
+				for range ch {
+				}
+				reportEnd(ctx, report, nil)
+				return
+			}
+		}
+		reportEnd(ctx, report, nil)
+	}()
+	return out, nil
+}
@@ -0,0 +1,85 @@
+package routing
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/ipfs/kubo/config"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplain(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	pid, _, err := generatePeerID()
+	require.NoError(err)
+	p, err := peer.Decode(pid)
+	require.NoError(err)
+
+	extra := &ExtraStaticParams{RepoPath: dir}
+	store, err := NewStaticStore("full", &config.StaticRouterParams{File: "full.json"}, extra)
+	require.NoError(err)
+	require.NoError(EditStaticRecords(ctx, store, func(r *StaticRecords) error {
+		r.AddPeer(p, []ma.Multiaddr{ma.StringCast("/ip4/10.0.0.1/tcp/4001")})
+		return nil
+	}))
+
+	r, err := Parse(config.Routers{
+		"empty": config.RouterParser{
+			Router: config.Router{Type: config.RouterTypeStatic, Parameters: &config.StaticRouterParams{File: "empty.json"}},
+		},
+		"full": config.RouterParser{
+			Router: config.Router{Type: config.RouterTypeStatic, Parameters: &config.StaticRouterParams{File: "full.json"}},
+		},
+		"seq": config.RouterParser{
+			Router: config.Router{
+				Type: config.RouterTypeSequential,
+				Parameters: &config.ComposableRouterParams{
+					Routers: []config.ConfigRouter{
+						{RouterName: "empty", IgnoreErrors: true},
+						{RouterName: "full"},
+					},
+				},
+			},
+		},
+	}, config.Methods{
+		config.MethodNameFindPeers:     config.Method{RouterName: "seq"},
+		config.MethodNameFindProviders: config.Method{RouterName: "seq"},
+		config.MethodNameGetIPNS:       config.Method{RouterName: "seq"},
+		config.MethodNamePutIPNS:       config.Method{RouterName: "seq"},
+		config.MethodNameProvide:       config.Method{RouterName: "seq"},
+	}, &ExtraDHTParams{}, &ExtraHTTPParams{}, extra)
+	require.NoError(err)
+
+	// Nothing is reported without an explainer.
+	_, err = r.FindPeer(ctx, p)
+	require.NoError(err)
+
+	var mu sync.Mutex
+	var events []ExplainEvent
+	ctx = ContextWithExplainer(ctx, func(ev ExplainEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		ev.Elapsed = 0
+		events = append(events, ev)
+	})
+	_, err = r.FindPeer(ctx, p)
+	require.NoError(err)
+
+	require.Equal([]ExplainEvent{
+		{Event: ExplainStart, Router: "seq"},
+		{Event: ExplainStart, Router: "empty", Parent: "seq", IgnoreErrors: true},
+		{Event: ExplainError, Router: "empty", Parent: "seq", IgnoreErrors: true, Error: "routing: not found"},
+		{Event: ExplainStart, Router: "full", Parent: "seq"},
+		{Event: ExplainResult, Router: "full", Parent: "seq", Result: events[4].Result},
+		{Event: ExplainDone, Router: "full", Parent: "seq"},
+		{Event: ExplainResult, Router: "seq", Result: events[4].Result},
+		{Event: ExplainDone, Router: "seq"},
+	}, events)
+	require.Contains(events[4].Result, "/ip4/10.0.0.1/tcp/4001")
+}
@@ -0,0 +1,242 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ipfs/boxo/datastore/dshelp"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multihash"
+)
+
+// providerStorePrefix is the datastore namespace of the provider records
+// announced to the routing API.
+var providerStorePrefix = datastore.NewKey("/routing/providers")
+
+// providerStoreGCInterval is how often expired provider records are removed.
+const providerStoreGCInterval = time.Hour
+
+// MaxProviderKeysPerPut is the maximum number of keys of a provider
+// announcement.
+const MaxProviderKeysPerPut = 100
+
+// providerRecord is a stored provider record, under
+// /routing/providers/<multihash>/<peer id>.
+type providerRecord struct {
+	Addrs   []string
+	Expires time.Time
+}
+
+// ProviderStore stores the provider records announced to the routing API
+// until they expire. Expired records are removed every
+// providerStoreGCInterval.
+type ProviderStore struct {
+	ds         datastore.Batching
+	maxPerPeer int
+	maxTotal   int
+
+	// mu serializes Put and GC, and guards the record counts. The counts
+	// include the expired records until they are removed.
+	mu      sync.Mutex
+	perPeer map[peer.ID]int
+	total   int
+}
+
+// NewProviderStore returns a ProviderStore keeping its records in ds, at most
+// maxPerPeer for each peer and maxTotal overall. Expired records are removed
+// until ctx is canceled.
+func NewProviderStore(ctx context.Context, ds datastore.Batching, maxPerPeer, maxTotal int) *ProviderStore {
+	s := newProviderStore(ds, maxPerPeer, maxTotal)
+	go s.gcLoop(ctx)
+	return s
+}
+
+func newProviderStore(ds datastore.Batching, maxPerPeer, maxTotal int) *ProviderStore {
+	return &ProviderStore{
+		ds:         ds,
+		maxPerPeer: maxPerPeer,
+		maxTotal:   maxTotal,
+		perPeer:    make(map[peer.ID]int),
+	}
+}
+
+// gcLoop removes the expired records, and counts the others, right away and
+// then every providerStoreGCInterval.
+func (s *ProviderStore) gcLoop(ctx context.Context) {
+	ticker := time.NewTicker(providerStoreGCInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.GC(ctx); err != nil && ctx.Err() == nil {
+			log.Errorf("removing expired provider records: %s", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func providerKey(mh multihash.Multihash) datastore.Key {
+	return providerStorePrefix.Child(dshelp.MultihashToDsKey(mh))
+}
+
+// Put records that the peer ai provides keys until expires. Records of the
+// same peer for the same keys are replaced. Announcements of more than
+// MaxProviderKeysPerPut keys, or that would store more records than allowed
+// for the peer or overall, are rejected.
+func (s *ProviderStore) Put(ctx context.Context, keys []multihash.Multihash, ai peer.AddrInfo, expires time.Time) error {
+	if len(keys) > MaxProviderKeysPerPut {
+		return fmt.Errorf("provider announcement has %d keys, the limit is %d", len(keys), MaxProviderKeysPerPut)
+	}
+
+	rec := providerRecord{Expires: expires.UTC()}
+	for _, a := range ai.Addrs {
+		rec.Addrs = append(rec.Addrs, a.String())
+	}
+	value, err := json.Marshal(&rec)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dsKeys := make(map[datastore.Key]struct{}, len(keys))
+	added := 0
+	for _, k := range keys {
+		dsKey := providerKey(k).ChildString(ai.ID.String())
+		if _, ok := dsKeys[dsKey]; ok {
+			continue
+		}
+		dsKeys[dsKey] = struct{}{}
+		has, err := s.ds.Has(ctx, dsKey)
+		if err != nil {
+			return err
+		}
+		if !has {
+			added++
+		}
+	}
+	if s.perPeer[ai.ID]+added > s.maxPerPeer {
+		return fmt.Errorf("too many provider records for peer %s, the limit is %d", ai.ID, s.maxPerPeer)
+	}
+	if s.total+added > s.maxTotal {
+		return fmt.Errorf("too many provider records, the limit is %d", s.maxTotal)
+	}
+
+	batch, err := s.ds.Batch(ctx)
+	if err != nil {
+		return err
+	}
+	for k := range dsKeys {
+		if err := batch.Put(ctx, k, value); err != nil {
+			return err
+		}
+	}
+	if err := batch.Commit(ctx); err != nil {
+		return err
+	}
+	if added > 0 {
+		s.perPeer[ai.ID] += added
+		s.total += added
+	}
+	return nil
+}
+
+// Get returns the peers providing key whose records have not expired.
+func (s *ProviderStore) Get(ctx context.Context, key multihash.Multihash) ([]peer.AddrInfo, error) {
+	var providers []peer.AddrInfo
+	err := s.query(ctx, providerKey(key), func(k datastore.Key, rec *providerRecord) error {
+		if time.Now().After(rec.Expires) {
+			return nil
+		}
+		id, err := peer.Decode(k.BaseNamespace())
+		if err != nil {
+			return err
+		}
+		ai := peer.AddrInfo{ID: id}
+		for _, a := range rec.Addrs {
+			addr, err := ma.NewMultiaddr(a)
+			if err != nil {
+				return err
+			}
+			ai.Addrs = append(ai.Addrs, addr)
+		}
+		providers = append(providers, ai)
+		return nil
+	})
+	return providers, err
+}
+
+// GC removes the expired provider records, and returns how many were removed.
+// It also counts the remaining records, for the limits of Put.
+func (s *ProviderStore) GC(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var expired []datastore.Key
+	perPeer := make(map[peer.ID]int)
+	total := 0
+	err := s.query(ctx, providerStorePrefix, func(k datastore.Key, rec *providerRecord) error {
+		if time.Now().After(rec.Expires) {
+			expired = append(expired, k)
+			return nil
+		}
+		// Records of invalid peer IDs can't be announced, they are
+		// counted overall only.
+		if id, err := peer.Decode(k.BaseNamespace()); err == nil {
+			perPeer[id]++
+		}
+		total++
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	batch, err := s.ds.Batch(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, k := range expired {
+		if err := batch.Delete(ctx, k); err != nil {
+			return 0, err
+		}
+	}
+	if err := batch.Commit(ctx); err != nil {
+		return 0, err
+	}
+	s.perPeer = perPeer
+	s.total = total
+	return len(expired), nil
+}
+
+// query calls fn with the provider records under prefix.
+func (s *ProviderStore) query(ctx context.Context, prefix datastore.Key, fn func(datastore.Key, *providerRecord) error) error {
+	results, err := s.ds.Query(ctx, query.Query{Prefix: prefix.String()})
+	if err != nil {
+		return err
+	}
+	defer results.Close()
+
+	for r := range results.Next() {
+		if r.Error != nil {
+			return r.Error
+		}
+		var rec providerRecord
+		if err := json.Unmarshal(r.Value, &rec); err != nil {
+			return fmt.Errorf("invalid provider record %s: %w", r.Key, err)
+		}
+		if err := fn(datastore.NewKey(r.Key), &rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package routing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProviderStore(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	store := newProviderStore(dssync.MutexWrap(datastore.NewMapDatastore()), 10, 10)
+
+	c, err := cid.Decode("bafkreifjjcie6lypi6ny7amxnfftagclbuxndqonfipmb64f2km2devei4")
+	require.NoError(err)
+	var ids []peer.ID
+	for i := 0; i < 2; i++ {
+		pid, _, err := generatePeerID()
+		require.NoError(err)
+		p, err := peer.Decode(pid)
+		require.NoError(err)
+		ids = append(ids, p)
+	}
+	addr := ma.StringCast("/ip4/10.0.0.1/tcp/4001")
+	keys := []multihash.Multihash{c.Hash()}
+
+	require.NoError(store.Put(ctx, keys, peer.AddrInfo{ID: ids[0], Addrs: []ma.Multiaddr{addr}}, time.Now().Add(time.Hour)))
+	require.NoError(store.Put(ctx, keys, peer.AddrInfo{ID: ids[1]}, time.Now().Add(-time.Second)))
+
+	// Expired records are not returned.
+	provs, err := store.Get(ctx, c.Hash())
+	require.NoError(err)
+	require.Equal([]peer.AddrInfo{{ID: ids[0], Addrs: []ma.Multiaddr{addr}}}, provs)
+
+	// Announcing again replaces the record of the peer.
+	require.NoError(store.Put(ctx, keys, peer.AddrInfo{ID: ids[1]}, time.Now().Add(time.Hour)))
+	provs, err = store.Get(ctx, c.Hash())
+	require.NoError(err)
+	require.Len(provs, 2)
+
+	require.NoError(store.Put(ctx, keys, peer.AddrInfo{ID: ids[1]}, time.Now().Add(-time.Second)))
+	removed, err := store.GC(ctx)
+	require.NoError(err)
+	require.Equal(1, removed)
+	provs, err = store.Get(ctx, c.Hash())
+	require.NoError(err)
+	require.Len(provs, 1)
+}
+
+func TestProviderStoreLimits(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	store := newProviderStore(dssync.MutexWrap(datastore.NewMapDatastore()), 3, 5)
+
+	var ids []peer.ID
+	for i := 0; i < 2; i++ {
+		pid, _, err := generatePeerID()
+		require.NoError(err)
+		p, err := peer.Decode(pid)
+		require.NoError(err)
+		ids = append(ids, p)
+	}
+	var keys []multihash.Multihash
+	for i := 0; i <= MaxProviderKeysPerPut; i++ {
+		mh, err := multihash.Sum([]byte{byte(i)}, multihash.SHA2_256, -1)
+		require.NoError(err)
+		keys = append(keys, mh)
+	}
+	expires := time.Now().Add(time.Hour)
+
+	require.ErrorContains(store.Put(ctx, keys, peer.AddrInfo{ID: ids[0]}, expires), "keys, the limit is")
+
+	// Announcing the same keys again doesn't count.
+	require.NoError(store.Put(ctx, keys[:3], peer.AddrInfo{ID: ids[0]}, expires))
+	require.NoError(store.Put(ctx, keys[:3], peer.AddrInfo{ID: ids[0]}, expires))
+	require.ErrorContains(store.Put(ctx, keys[3:4], peer.AddrInfo{ID: ids[0]}, expires), "for peer")
+
+	require.NoError(store.Put(ctx, keys[:2], peer.AddrInfo{ID: ids[1]}, expires))
+	require.ErrorContains(store.Put(ctx, keys[2:3], peer.AddrInfo{ID: ids[1]}, expires), "too many provider records, the limit is 5")
+
+	// Expired records no longer count once removed.
+	require.NoError(store.Put(ctx, keys[:2], peer.AddrInfo{ID: ids[1]}, time.Now().Add(-time.Second)))
+	removed, err := store.GC(ctx)
+	require.NoError(err)
+	require.Equal(2, removed)
+	require.NoError(store.Put(ctx, keys[2:4], peer.AddrInfo{ID: ids[1]}, expires))
+}
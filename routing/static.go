@@ -0,0 +1,540 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/facebookgo/atomicfile"
+	"github.com/ipfs/boxo/ipns"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/kubo/config"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/routing"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// staticReloadInterval is how long a static router serves its records before
+// checking whether its store changed.
+const staticReloadInterval = time.Second
+
+// staticDatastorePrefix is the datastore namespace of the records of static
+// routers without a file.
+var staticDatastorePrefix = datastore.NewKey("/routing/static")
+
+// ExtraStaticParams are the parameters of static routers not set in their
+// config.
+type ExtraStaticParams struct {
+	// RepoPath is the directory relative file paths are resolved against.
+	RepoPath  string
+	Datastore datastore.Datastore
+}
+
+// StaticRecords are the records served by a static router.
+type StaticRecords struct {
+	// Providers are the peer IDs providing each CID.
+	Providers map[string][]string `json:",omitempty"`
+	// Peers are the multiaddrs of each peer ID.
+	Peers map[string][]string `json:",omitempty"`
+	// IPNS are the IPNS records of each IPNS name.
+	IPNS map[string][]byte `json:",omitempty"`
+}
+
+// AddProviders adds providers of c.
+func (r *StaticRecords) AddProviders(c cid.Cid, providers []peer.ID) {
+	if r.Providers == nil {
+		r.Providers = make(map[string][]string)
+	}
+	key := c.String()
+	for k := range r.Providers {
+		if sameHash(k, c) {
+			key = k
+			break
+		}
+	}
+	r.Providers[key] = appendUnique(r.Providers[key], peerStrings(providers)...)
+}
+
+// RemoveProviders removes providers of c, or all of them if providers is
+// empty. It returns whether any was removed.
+func (r *StaticRecords) RemoveProviders(c cid.Cid, providers []peer.ID) bool {
+	removed := false
+	for k, ps := range r.Providers {
+		if !sameHash(k, c) {
+			continue
+		}
+		kept := removeAll(ps, peerStrings(providers)...)
+		if len(providers) == 0 {
+			kept = nil
+		}
+		removed = removed || len(kept) < len(ps)
+		if len(kept) == 0 {
+			delete(r.Providers, k)
+		} else {
+			r.Providers[k] = kept
+		}
+	}
+	return removed
+}
+
+// AddPeer adds multiaddrs of p.
+func (r *StaticRecords) AddPeer(p peer.ID, addrs []ma.Multiaddr) {
+	if r.Peers == nil {
+		r.Peers = make(map[string][]string)
+	}
+	strs := make([]string, len(addrs))
+	for i, a := range addrs {
+		strs[i] = a.String()
+	}
+	r.Peers[p.String()] = appendUnique(r.Peers[p.String()], strs...)
+}
+
+// RemovePeer removes multiaddrs of p, or all of them if addrs is empty. It
+// returns whether any was removed.
+func (r *StaticRecords) RemovePeer(p peer.ID, addrs []ma.Multiaddr) bool {
+	cur, ok := r.Peers[p.String()]
+	if !ok {
+		return false
+	}
+	var kept []string
+	if len(addrs) > 0 {
+		strs := make([]string, len(addrs))
+		for i, a := range addrs {
+			strs[i] = a.String()
+		}
+		kept = removeAll(cur, strs...)
+	}
+	if len(kept) == 0 {
+		delete(r.Peers, p.String())
+	} else {
+		r.Peers[p.String()] = kept
+	}
+	return len(kept) < len(cur)
+}
+
+// PutIPNS sets the IPNS record of name, after validating it.
+func (r *StaticRecords) PutIPNS(name ipns.Name, record []byte) error {
+	rec, err := ipns.UnmarshalRecord(record)
+	if err != nil {
+		return err
+	}
+	if err := ipns.ValidateWithName(rec, name); err != nil {
+		return err
+	}
+	if r.IPNS == nil {
+		r.IPNS = make(map[string][]byte)
+	}
+	for k := range r.IPNS {
+		if n, err := ipns.NameFromString(k); err == nil && n.Equal(name) {
+			delete(r.IPNS, k)
+		}
+	}
+	r.IPNS[name.String()] = record
+	return nil
+}
+
+// RemoveIPNS removes the IPNS record of name. It returns whether there was
+// one.
+func (r *StaticRecords) RemoveIPNS(name ipns.Name) bool {
+	removed := false
+	for k := range r.IPNS {
+		if n, err := ipns.NameFromString(k); err == nil && n.Equal(name) {
+			delete(r.IPNS, k)
+			removed = true
+		}
+	}
+	return removed
+}
+
+// StaticStore loads and saves the records of a static router.
+type StaticStore interface {
+	Load(ctx context.Context) (*StaticRecords, error)
+	Save(ctx context.Context, r *StaticRecords) error
+	// Version changes when the records are saved. It is cheaper than Load.
+	Version(ctx context.Context) (string, error)
+}
+
+// NewStaticStore returns the store of the records of the static router name.
+func NewStaticStore(name string, params *config.StaticRouterParams, extra *ExtraStaticParams) (StaticStore, error) {
+	if params.File != "" {
+		path := params.File
+		if !filepath.IsAbs(path) {
+			if extra.RepoPath == "" {
+				return nil, fmt.Errorf("static router %q: relative file path %q needs a repo on disk", name, path)
+			}
+			path = filepath.Join(extra.RepoPath, path)
+		}
+		return staticFileStore(path), nil
+	}
+	if extra.Datastore == nil {
+		return nil, NewParamNeededErr("File", config.RouterTypeStatic)
+	}
+	return &staticDatastoreStore{ds: extra.Datastore, key: staticDatastorePrefix.ChildString(name)}, nil
+}
+
+// staticEditLock serializes the edits of static records.
+var staticEditLock sync.Mutex
+
+// EditStaticRecords loads the records of store, passes them to edit, and saves
+// them if edit succeeds.
+func EditStaticRecords(ctx context.Context, store StaticStore, edit func(*StaticRecords) error) error {
+	staticEditLock.Lock()
+	defer staticEditLock.Unlock()
+
+	r, err := store.Load(ctx)
+	if err != nil {
+		return err
+	}
+	if err := edit(r); err != nil {
+		return err
+	}
+	return store.Save(ctx, r)
+}
+
+// staticFileStore stores the records as JSON in a file. A missing file holds
+// no records.
+type staticFileStore string
+
+func (f staticFileStore) Load(context.Context) (*StaticRecords, error) {
+	r := &StaticRecords{}
+	data, err := os.ReadFile(string(f))
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", string(f), err)
+	}
+	return r, nil
+}
+
+// Version is the modification time and size of the file.
+func (f staticFileStore) Version(context.Context) (string, error) {
+	fi, err := os.Stat(string(f))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d-%d", fi.ModTime().UnixNano(), fi.Size()), nil
+}
+
+func (f staticFileStore) Save(_ context.Context, r *StaticRecords) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	af, err := atomicfile.New(string(f), 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := af.Write(append(data, '\n')); err != nil {
+		af.Abort()
+		return err
+	}
+	return af.Close()
+}
+
+// staticDatastoreSaves counts the records saved to the datastore. The
+// datastore is only written by the daemon holding the repo, so it changes
+// with every static router whose records are in the datastore.
+var staticDatastoreSaves atomic.Uint64
+
+// staticDatastoreStore stores the records as JSON under a datastore key.
+type staticDatastoreStore struct {
+	ds  datastore.Datastore
+	key datastore.Key
+}
+
+func (s *staticDatastoreStore) Version(context.Context) (string, error) {
+	return strconv.FormatUint(staticDatastoreSaves.Load(), 10), nil
+}
+
+func (s *staticDatastoreStore) Load(ctx context.Context) (*StaticRecords, error) {
+	r := &StaticRecords{}
+	data, err := s.ds.Get(ctx, s.key)
+	if errors.Is(err, datastore.ErrNotFound) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *staticDatastoreStore) Save(ctx context.Context, r *StaticRecords) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if err := s.ds.Put(ctx, s.key, data); err != nil {
+		return err
+	}
+	staticDatastoreSaves.Add(1)
+	return s.ds.Sync(ctx, s.key)
+}
+
+var _ routing.Routing = &staticRouter{}
+
+// staticRouter serves the records of a StaticStore, checking at most every
+// staticReloadInterval whether they changed. It can't announce anything:
+// Provide does nothing, and PutValue is not supported.
+type staticRouter struct {
+	name  string
+	store StaticStore
+
+	mu        sync.Mutex
+	index     *staticIndex
+	checkedAt time.Time
+	// reloading is set while a lookup checks the store, other lookups use
+	// the current records meanwhile.
+	reloading bool
+	// version is the version of the store the records were last loaded or
+	// failed to load from.
+	version string
+}
+
+// staticIndex are static records indexed for lookups.
+type staticIndex struct {
+	providers map[string][]peer.ID // by multihash
+	peers     map[peer.ID][]ma.Multiaddr
+	values    map[string][]byte // by routing key
+}
+
+func newStaticRouter(name string, store StaticStore) (*staticRouter, error) {
+	ctx := context.Background()
+	version, err := store.Version(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("static router %q: %w", name, err)
+	}
+	// Fail early on invalid records.
+	idx, err := loadStaticIndex(ctx, store)
+	if err != nil {
+		return nil, fmt.Errorf("static router %q: %w", name, err)
+	}
+	return &staticRouter{name: name, store: store, index: idx, checkedAt: time.Now(), version: version}, nil
+}
+
+// records returns the index of the records, loading them again if the store
+// changed. The last valid records are kept when they can't be loaded.
+func (r *staticRouter) records(ctx context.Context) *staticIndex {
+	r.mu.Lock()
+	if r.reloading || time.Since(r.checkedAt) < staticReloadInterval {
+		defer r.mu.Unlock()
+		return r.index
+	}
+	r.reloading = true
+	version := r.version
+	r.mu.Unlock()
+
+	idx, version, err := r.reload(ctx, version)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reloading = false
+	r.checkedAt = time.Now()
+	if err != nil {
+		log.Errorf("static router %q: %s, keeping the previous records", r.name, err)
+	}
+	r.version = version
+	if idx != nil {
+		r.index = idx
+	}
+	return r.index
+}
+
+// reload loads the records if the version of the store is not version. It
+// returns the new version of the store, and nil records if they are unchanged
+// or invalid. An error is only returned once for each version.
+func (r *staticRouter) reload(ctx context.Context, version string) (*staticIndex, string, error) {
+	cur, err := r.store.Version(ctx)
+	if err != nil {
+		if version == "error: "+err.Error() {
+			return nil, version, nil
+		}
+		return nil, "error: " + err.Error(), err
+	}
+	if cur == version {
+		return nil, version, nil
+	}
+	idx, err := loadStaticIndex(ctx, r.store)
+	return idx, cur, err
+}
+
+func loadStaticIndex(ctx context.Context, store StaticStore) (*staticIndex, error) {
+	recs, err := store.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return indexStaticRecords(recs)
+}
+
+func indexStaticRecords(recs *StaticRecords) (*staticIndex, error) {
+	idx := &staticIndex{
+		providers: make(map[string][]peer.ID),
+		peers:     make(map[peer.ID][]ma.Multiaddr),
+		values:    make(map[string][]byte),
+	}
+	for k, ps := range recs.Providers {
+		c, err := cid.Decode(k)
+		if err != nil {
+			return nil, fmt.Errorf("provider record %q: %w", k, err)
+		}
+		for _, p := range ps {
+			id, err := peer.Decode(p)
+			if err != nil {
+				return nil, fmt.Errorf("provider record %q: %w", k, err)
+			}
+			idx.providers[string(c.Hash())] = append(idx.providers[string(c.Hash())], id)
+		}
+	}
+	for p, addrs := range recs.Peers {
+		id, err := peer.Decode(p)
+		if err != nil {
+			return nil, fmt.Errorf("peer record %q: %w", p, err)
+		}
+		for _, a := range addrs {
+			m, err := ma.NewMultiaddr(a)
+			if err != nil {
+				return nil, fmt.Errorf("peer record %q: %w", p, err)
+			}
+			idx.peers[id] = append(idx.peers[id], m)
+		}
+	}
+	for k, v := range recs.IPNS {
+		name, err := ipns.NameFromString(k)
+		if err != nil {
+			return nil, fmt.Errorf("IPNS record %q: %w", k, err)
+		}
+		idx.values[string(name.RoutingKey())] = v
+	}
+	return idx, nil
+}
+
+func (r *staticRouter) Provide(context.Context, cid.Cid, bool) error {
+	return nil
+}
+
+func (r *staticRouter) FindProvidersAsync(ctx context.Context, c cid.Cid, count int) <-chan peer.AddrInfo {
+	idx := r.records(ctx)
+	providers := idx.providers[string(c.Hash())]
+	if count > 0 && len(providers) > count {
+		providers = providers[:count]
+	}
+	ch := make(chan peer.AddrInfo, len(providers))
+	for _, p := range providers {
+		ch <- peer.AddrInfo{ID: p, Addrs: idx.peers[p]}
+	}
+	close(ch)
+	return ch
+}
+
+func (r *staticRouter) FindPeer(ctx context.Context, p peer.ID) (peer.AddrInfo, error) {
+	addrs, ok := r.records(ctx).peers[p]
+	if !ok {
+		return peer.AddrInfo{}, routing.ErrNotFound
+	}
+	return peer.AddrInfo{ID: p, Addrs: addrs}, nil
+}
+
+func (r *staticRouter) PutValue(context.Context, string, []byte, ...routing.Option) error {
+	return routing.ErrNotSupported
+}
+
+func (r *staticRouter) GetValue(ctx context.Context, key string, _ ...routing.Option) ([]byte, error) {
+	v, ok := r.records(ctx).values[key]
+	if !ok {
+		return nil, routing.ErrNotFound
+	}
+	return v, nil
+}
+
+func (r *staticRouter) SearchValue(ctx context.Context, key string, opts ...routing.Option) (<-chan []byte, error) {
+	v, err := r.GetValue(ctx, key, opts...)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan []byte, 1)
+	ch <- v
+	close(ch)
+	return ch, nil
+}
+
+func (r *staticRouter) Bootstrap(context.Context) error {
+	return nil
+}
+
+func staticRoutingFromConfig(name string, conf config.Router, extra *ExtraStaticParams) (routing.Routing, error) {
+	params := &config.StaticRouterParams{}
+	if conf.Parameters != nil {
+		var ok bool
+		if params, ok = conf.Parameters.(*config.StaticRouterParams); !ok {
+			return nil, errors.New("incorrect params for static router")
+		}
+	}
+	store, err := NewStaticStore(name, params, extra)
+	if err != nil {
+		return nil, err
+	}
+	return newStaticRouter(name, store)
+}
+
+func sameHash(key string, c cid.Cid) bool {
+	k, err := cid.Decode(key)
+	return err == nil && string(k.Hash()) == string(c.Hash())
+}
+
+func peerStrings(ps []peer.ID) []string {
+	strs := make([]string, len(ps))
+	for i, p := range ps {
+		strs[i] = p.String()
+	}
+	return strs
+}
+
+func appendUnique(list []string, items ...string) []string {
+	for _, it := range items {
+		found := false
+		for _, l := range list {
+			if l == it {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, it)
+		}
+	}
+	return list
+}
+
+func removeAll(list []string, items ...string) []string {
+	var kept []string
+	for _, l := range list {
+		found := false
+		for _, it := range items {
+			if l == it {
+				found = true
+				break
+			}
+		}
+		if !found {
+			kept = append(kept, l)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,188 @@
+package routing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/ipns"
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/kubo/config"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/routing"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaticRouterFile(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	c, err := cid.Decode("bafkreifjjcie6lypi6ny7amxnfftagclbuxndqonfipmb64f2km2devei4")
+	require.NoError(err)
+	pid, _, err := generatePeerID()
+	require.NoError(err)
+	p, err := peer.Decode(pid)
+	require.NoError(err)
+	addr := ma.StringCast("/ip4/10.0.0.1/tcp/4001")
+
+	r, err := Parse(config.Routers{
+		"static": config.RouterParser{
+			Router: config.Router{
+				Type:       config.RouterTypeStatic,
+				Parameters: &config.StaticRouterParams{File: "records.json"},
+			},
+		},
+	}, config.Methods{
+		config.MethodNameFindPeers:     config.Method{RouterName: "static"},
+		config.MethodNameFindProviders: config.Method{RouterName: "static"},
+		config.MethodNameGetIPNS:       config.Method{RouterName: "static"},
+		config.MethodNamePutIPNS:       config.Method{RouterName: "static"},
+		config.MethodNameProvide:       config.Method{RouterName: "static"},
+	}, &ExtraDHTParams{}, &ExtraHTTPParams{}, &ExtraStaticParams{RepoPath: dir})
+	require.NoError(err)
+
+	// A missing file holds no records.
+	_, err = r.FindPeer(ctx, p)
+	require.ErrorIs(err, routing.ErrNotFound)
+
+	store, err := NewStaticStore("static", &config.StaticRouterParams{File: "records.json"}, &ExtraStaticParams{RepoPath: dir})
+	require.NoError(err)
+
+	sk, _, err := crypto.GenerateEd25519Key(nil)
+	require.NoError(err)
+	name := ipns.NameFromPeer(mustIDFromPrivateKey(t, sk))
+	rec, err := ipns.NewRecord(sk, path.FromCid(c), 1, time.Now().Add(time.Hour), time.Minute)
+	require.NoError(err)
+	recBytes, err := ipns.MarshalRecord(rec)
+	require.NoError(err)
+
+	err = EditStaticRecords(ctx, store, func(r *StaticRecords) error {
+		r.AddProviders(c, []peer.ID{p})
+		r.AddPeer(p, []ma.Multiaddr{addr})
+		return r.PutIPNS(name, recBytes)
+	})
+	require.NoError(err)
+	require.FileExists(filepath.Join(dir, "records.json"))
+
+	// The records are loaded again after staticReloadInterval.
+	time.Sleep(staticReloadInterval)
+
+	// Providers are matched by multihash.
+	var provs []peer.AddrInfo
+	for ai := range r.FindProvidersAsync(ctx, cid.NewCidV1(cid.DagProtobuf, c.Hash()), 0) {
+		provs = append(provs, ai)
+	}
+	require.Len(provs, 1)
+	require.Equal(p, provs[0].ID)
+	require.Equal([]ma.Multiaddr{addr}, provs[0].Addrs)
+
+	ai, err := r.FindPeer(ctx, p)
+	require.NoError(err)
+	require.Equal([]ma.Multiaddr{addr}, ai.Addrs)
+
+	val, err := r.GetValue(ctx, string(name.RoutingKey()))
+	require.NoError(err)
+	require.Equal(recBytes, val)
+
+	require.ErrorIs(r.PutValue(ctx, string(name.RoutingKey()), recBytes), routing.ErrNotSupported)
+
+	// Invalid records are rejected, and the previous ones are kept.
+	require.NoError(os.WriteFile(filepath.Join(dir, "records.json"), []byte(`{"Peers": {"foo": []}}`), 0o600))
+	time.Sleep(staticReloadInterval)
+	_, err = r.FindPeer(ctx, p)
+	require.NoError(err)
+
+	err = EditStaticRecords(ctx, store, func(r *StaticRecords) error {
+		require.False(r.RemoveProviders(c, nil))
+		return nil
+	})
+	require.NoError(err)
+}
+
+func TestStaticStoreDatastore(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	store, err := NewStaticStore("static", &config.StaticRouterParams{}, &ExtraStaticParams{Datastore: datastore.NewMapDatastore()})
+	require.NoError(err)
+
+	c, err := cid.Decode("bafkreifjjcie6lypi6ny7amxnfftagclbuxndqonfipmb64f2km2devei4")
+	require.NoError(err)
+	pid, _, err := generatePeerID()
+	require.NoError(err)
+	p, err := peer.Decode(pid)
+	require.NoError(err)
+
+	require.NoError(EditStaticRecords(ctx, store, func(r *StaticRecords) error {
+		r.AddProviders(c, []peer.ID{p, p})
+		return nil
+	}))
+	recs, err := store.Load(ctx)
+	require.NoError(err)
+	require.Equal(map[string][]string{c.String(): {p.String()}}, recs.Providers)
+
+	require.NoError(EditStaticRecords(ctx, store, func(r *StaticRecords) error {
+		require.True(r.RemoveProviders(c, []peer.ID{p}))
+		return nil
+	}))
+	recs, err = store.Load(ctx)
+	require.NoError(err)
+	require.Empty(recs.Providers)
+}
+
+// countingStore counts the loads of a StaticStore whose version is set by the
+// test.
+type countingStore struct {
+	StaticStore
+	version string
+	loads   int
+}
+
+func (s *countingStore) Load(ctx context.Context) (*StaticRecords, error) {
+	s.loads++
+	return s.StaticStore.Load(ctx)
+}
+
+func (s *countingStore) Version(context.Context) (string, error) {
+	return s.version, nil
+}
+
+func TestStaticRouterReload(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	file, err := NewStaticStore("static", &config.StaticRouterParams{File: "records.json"}, &ExtraStaticParams{RepoPath: dir})
+	require.NoError(err)
+	store := &countingStore{StaticStore: file, version: "1"}
+	r, err := newStaticRouter("static", store)
+	require.NoError(err)
+	require.Equal(1, store.loads)
+
+	// The records are not loaded again while the store is unchanged.
+	r.checkedAt = time.Time{}
+	r.records(ctx)
+	require.Equal(1, store.loads)
+
+	// Invalid records are loaded once.
+	require.NoError(os.WriteFile(filepath.Join(dir, "records.json"), []byte(`{"Peers": {"foo": []}}`), 0o600))
+	store.version = "2"
+	for i := 0; i < 2; i++ {
+		r.checkedAt = time.Time{}
+		require.NotNil(r.records(ctx))
+	}
+	require.Equal(2, store.loads)
+}
+
+func mustIDFromPrivateKey(t *testing.T, sk crypto.PrivKey) peer.ID {
+	id, err := peer.IDFromPrivateKey(sk)
+	require.NoError(t, err)
+	return id
+}
@@ -3,6 +3,7 @@ package cli
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/ipfs/boxo/ipns"
@@ -12,7 +13,9 @@ import (
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/kubo/config"
 	"github.com/ipfs/kubo/test/cli/harness"
+	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -142,4 +145,73 @@ func TestRoutingV1Server(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, "/ipfs/"+cidStr, value.String())
 	})
+
+	t.Run("Provide Is Accepted With AcceptProviderRecords", func(t *testing.T) {
+		t.Parallel()
+
+		node := harness.NewT(t).NewNode().Init()
+		node.UpdateConfig(func(cfg *config.Config) {
+			cfg.Gateway.ExposeRoutingAPI = config.True
+			cfg.Gateway.AcceptProviderRecords = config.True
+			cfg.Routing.Type = config.NewOptionalString("dht")
+		})
+		node.StartDaemon()
+
+		sk, _, err := crypto.GenerateEd25519Key(nil)
+		assert.NoError(t, err)
+		pid, err := peer.IDFromPrivateKey(sk)
+		assert.NoError(t, err)
+		addr := multiaddr.StringCast("/ip4/10.0.0.1/tcp/4001")
+
+		c, err := client.New(node.GatewayURL(), client.WithIdentity(sk), client.WithProviderInfo(pid, []multiaddr.Multiaddr{addr}))
+		assert.NoError(t, err)
+
+		key, err := cid.Decode(node.IPFSAddStr("hello provide " + uuid.New().String()))
+		assert.NoError(t, err)
+		ttl, err := c.ProvideBitswap(context.Background(), []cid.Cid{key}, time.Hour)
+		assert.NoError(t, err)
+		assert.Greater(t, ttl, time.Duration(0))
+		assert.LessOrEqual(t, ttl, time.Hour)
+
+		resultsIter, err := c.FindProviders(context.Background(), key)
+		assert.NoError(t, err)
+		records, err := iter.ReadAllResults(resultsIter)
+		assert.NoError(t, err)
+
+		var found bool
+		for _, record := range records {
+			rec, ok := record.(*types.PeerRecord)
+			assert.True(t, ok)
+			if *rec.ID == pid {
+				found = true
+				assert.Len(t, rec.Addrs, 1)
+				assert.Equal(t, addr.String(), rec.Addrs[0].String())
+			}
+		}
+		assert.True(t, found)
+	})
+
+	t.Run("Provide Is Rejected By Default", func(t *testing.T) {
+		t.Parallel()
+
+		node := harness.NewT(t).NewNode().Init()
+		node.UpdateConfig(func(cfg *config.Config) {
+			cfg.Gateway.ExposeRoutingAPI = config.True
+			cfg.Routing.Type = config.NewOptionalString("dht")
+		})
+		node.StartDaemon()
+
+		sk, _, err := crypto.GenerateEd25519Key(nil)
+		assert.NoError(t, err)
+		pid, err := peer.IDFromPrivateKey(sk)
+		assert.NoError(t, err)
+
+		c, err := client.New(node.GatewayURL(), client.WithIdentity(sk), client.WithProviderInfo(pid, []multiaddr.Multiaddr{multiaddr.StringCast("/ip4/10.0.0.1/tcp/4001")}))
+		assert.NoError(t, err)
+
+		key, err := cid.Decode(node.IPFSAddStr("hello provide " + uuid.New().String()))
+		assert.NoError(t, err)
+		_, err = c.ProvideBitswap(context.Background(), []cid.Cid{key}, time.Hour)
+		assert.Error(t, err)
+	})
 }
@@ -242,6 +242,8 @@ test_config_cmd() {
 
   test_profile_apply_dry_run_not_alter local-discovery
 
+  test_profile_apply_dry_run_not_alter lan
+
   test_profile_apply_dry_run_not_alter test
 
   test_expect_success "'ipfs config profile apply local-discovery --dry-run' looks good with different profile info" '
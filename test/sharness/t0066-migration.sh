@@ -11,13 +11,15 @@ test_description="Test migrations auto update prompt"
 test_init_ipfs
 
 MIGRATION_START=7
+# migrations from this version are embedded in ipfs
+EMBEDDED_START=13
 IPFS_REPO_VER=$(<.ipfs/version)
 
-# Generate mock migration binaries
+# Generate mock migration binaries for the migrations that are not embedded
 gen_mock_migrations() {
   mkdir bin
   i=$((MIGRATION_START))
-  until [ $i -ge $IPFS_REPO_VER ]
+  until [ $i -ge $EMBEDDED_START ]
   do
     j=$((i+1))
     echo "#!/bin/bash" > bin/fs-repo-${i}-to-${j}
@@ -31,12 +33,18 @@ gen_mock_migrations() {
 check_migration_output() {
   out_file="$1"
   i=$((MIGRATION_START))
-  until [ $i -ge $IPFS_REPO_VER ]
+  until [ $i -ge $EMBEDDED_START ]
   do
     j=$((i+1))
     grep "applying ${i}-to-${j} repo migration" "$out_file" > /dev/null
     ((i++))
   done
+  until [ $i -ge $IPFS_REPO_VER ]
+  do
+    j=$((i+1))
+    grep "Running embedded migration fs-repo-${i}-to-${j}" "$out_file" > /dev/null
+    ((i++))
+  done
 }
 
 # Create fake migration binaries instead of letting ipfs download from network
@@ -44,7 +52,7 @@ check_migration_output() {
 test_expect_success "setup mock migrations" '
   gen_mock_migrations &&
   find bin -name "fs-repo-*-to-*" | wc -l > mock_count &&
-  echo $((IPFS_REPO_VER-MIGRATION_START)) > expect_mock_count &&
+  echo $((EMBEDDED_START-MIGRATION_START)) > expect_mock_count &&
   export PATH="$(pwd)/bin":$PATH &&
   test_cmp mock_count expect_mock_count
 '
@@ -61,17 +69,19 @@ test_expect_success "output looks good" '
   grep "Please get fs-repo-migrations from https://dist.ipfs.tech" false_out
 '
 
-# The migrations will succeed, but the daemon will still exit with 1 because
-# the fake migrations do not update the repo version number.
-#
-# If run with real migrations, the daemon continues running and must be killed.
-test_expect_success "ipfs daemon --migrate=true runs migration" '
-  test_expect_code 1 ipfs daemon --migrate=true > true_out
-'
+# The embedded migrations update the repo version number, so the daemon
+# starts once the migrations succeed.
+test_launch_ipfs_daemon_without_network --migrate=true
 
 test_expect_success "output looks good" '
-  check_migration_output true_out &&
-  grep "Success: fs-repo migrated to version $IPFS_REPO_VER" true_out > /dev/null
+  check_migration_output actual_daemon &&
+  grep "Success: fs-repo migrated to version $IPFS_REPO_VER" actual_daemon > /dev/null
+'
+
+test_kill_ipfs_daemon
+
+test_expect_success "manually reset repo version to $MIGRATION_START" '
+  echo "$MIGRATION_START" > "$IPFS_PATH"/version
 '
 
 test_expect_success "'ipfs daemon' prompts to auto migrate" '
@@ -90,7 +100,31 @@ test_expect_success "ipfs repo migrate succeed" '
 
 test_expect_success "output looks good" '
   grep "Found outdated fs-repo, starting migration." migrate_out > /dev/null &&
-  grep "Success: fs-repo migrated to version $IPFS_REPO_VER" true_out > /dev/null
+  grep "Success: fs-repo migrated to version $IPFS_REPO_VER" migrate_out > /dev/null
+'
+
+test_expect_success "manually reset repo version to $EMBEDDED_START" '
+  echo "$EMBEDDED_START" > "$IPFS_PATH"/version
+'
+
+test_expect_success "ipfs repo migrate --dry-run succeeds" '
+  test_expect_code 0 ipfs repo migrate --dry-run > dry_run_out
+'
+
+test_expect_success "dry run does not modify the repo" '
+  grep "Dry run of embedded migration fs-repo-${EMBEDDED_START}-to-" dry_run_out > /dev/null &&
+  grep "Dry run: fs-repo was not modified" dry_run_out > /dev/null &&
+  echo "$EMBEDDED_START" > expect_version &&
+  test_cmp expect_version "$IPFS_PATH"/version
+'
+
+test_expect_success "manually reset repo version to $MIGRATION_START" '
+  echo "$MIGRATION_START" > "$IPFS_PATH"/version
+'
+
+test_expect_success "ipfs repo migrate --dry-run fails with migrations that are not embedded" '
+  test_expect_code 1 ipfs repo migrate --dry-run 2> dry_run_err &&
+  grep "does not support dry runs" dry_run_err > /dev/null
 '
 
 test_expect_success "manually reset repo version to latest" '
@@ -57,4 +57,35 @@ do
   check_random_corruption
 done
 
+test_expect_success "break a pinned block" '
+  to_break=$(find "$IPFS_PATH/blocks" -type f -name "*.data" | sort_rand | head -n 1) &&
+  cp "$to_break" backup_file &&
+  echo "this is super broken" > "$to_break"
+'
+
+test_expect_success "repo verify --repair does not remove it offline" '
+  test_expect_code 1 ipfs repo verify --repair 2> repair_err &&
+  test_should_contain "without a running daemon" repair_err &&
+  test -e "$to_break"
+'
+
+test_expect_success "repo verify --repair quarantines it, but can not fetch it offline" '
+  test_expect_code 1 ipfs repo verify --repair --quarantine > repair_out &&
+  test_should_contain "moved corrupt block" repair_out &&
+  test_should_contain "was affected" repair_out &&
+  test_should_contain "could not fetch block" repair_out &&
+  test -f "$IPFS_PATH/quarantine/$(basename "$to_break" .data)" &&
+  test ! -e "$to_break"
+'
+
+test_expect_success "repo verify --pins-only reports the missing block" '
+  test_expect_code 1 ipfs repo verify --pins-only > pins_out &&
+  test_should_contain "is missing block" pins_out
+'
+
+test_expect_success "repo verify --pins-only passes once the block is back" '
+  cp backup_file "$to_break" &&
+  ipfs repo verify --pins-only
+'
+
 test_done
@@ -0,0 +1,101 @@
+#!/usr/bin/env bash
+#
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test ipfs repo backup and restore"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "add content, an MFS file and a key" '
+  echo "backed up" > file &&
+  HASH=$(ipfs add -Q --pin=false file) &&
+  ipfs pin add --name=mypin "$HASH" &&
+  echo "mfs data" | ipfs files write --create /notes.txt &&
+  ipfs key gen mykey > /dev/null &&
+  PEERID=$(ipfs config Identity.PeerID)
+'
+
+test_expect_success "add secrets to the config" '
+  ipfs config --json P2P.Listeners "[{\"Protocol\": \"/x/test\", \"TargetAddress\": \"/ip4/127.0.0.1/tcp/4001\", \"Token\": \"p2psecret\"}]" &&
+  ipfs pin remote service add mysrv "http://127.0.0.1:5000" pinsecret
+'
+
+test_expect_success "repo backup requires a passphrase for the keys" '
+  test_expect_code 1 ipfs repo backup --keys > /dev/null 2> backup_err &&
+  test_should_contain "requires --passphrase" backup_err
+'
+
+test_expect_success "repo backup succeeds" '
+  ipfs repo backup --keys --passphrase=secret > backup.car &&
+  ipfs repo backup > backup_nokeys.car
+'
+
+test_expect_success "the secrets of the config are not backed up" '
+  test_should_not_contain p2psecret backup.car &&
+  test_should_not_contain pinsecret backup.car
+'
+
+test_expect_success "init a new repo with another datastore" '
+  export IPFS_PATH="$(pwd)/.ipfs-restored" &&
+  ipfs init --profile=test,badgerds > /dev/null &&
+  ipfs config --json P2P.Listeners "[{\"Protocol\": \"/x/test\", \"TargetAddress\": \"/ip4/127.0.0.1/tcp/4002\", \"Token\": \"restoredsecret\"}]" &&
+  ipfs pin remote service add mysrv "http://127.0.0.1:5000" restoredpinsecret
+'
+
+test_launch_ipfs_daemon_without_network
+
+test_expect_success "repo restore requires the passphrase for the keys" '
+  test_expect_code 1 ipfs repo restore backup.car 2> restore_err &&
+  test_should_contain "passphrase is required" restore_err
+'
+
+test_expect_success "repo restore succeeds while the daemon is running" '
+  ipfs repo restore --passphrase=secret --replace-identity backup.car > restore_out &&
+  test_should_contain "restored 2 pins" restore_out &&
+  test_should_contain "restored MFS path /notes.txt" restore_out &&
+  test_should_contain "restored key mykey" restore_out
+'
+
+test_expect_success "the pins, MFS and keys are restored" '
+  ipfs pin ls --names --type=recursive > pins &&
+  test_should_contain "$HASH recursive mypin" pins &&
+  echo "mfs data" > expected_mfs &&
+  ipfs files read /notes.txt > actual_mfs &&
+  test_cmp expected_mfs actual_mfs &&
+  ipfs key list > keys &&
+  test_should_contain mykey keys
+'
+
+test_expect_success "a backup without keys is restored without them" '
+  ipfs repo restore backup_nokeys.car > restore_nokeys_out &&
+  test_should_contain "restored 2 pins" restore_nokeys_out &&
+  test_should_not_contain "restored key" restore_nokeys_out
+'
+
+test_expect_success "restoring the keys of a backup without keys fails" '
+  test_expect_code 1 ipfs repo restore --keys backup_nokeys.car 2> restore_nokeys_err &&
+  test_should_contain "the backup has no keys" restore_nokeys_err &&
+  test_expect_code 1 ipfs repo restore --replace-identity backup_nokeys.car 2> restore_nokeys_err &&
+  test_should_contain "the backup has no keys" restore_nokeys_err
+'
+
+test_kill_ipfs_daemon
+
+test_expect_success "the identity is restored" '
+  ipfs config Identity.PeerID > peerid &&
+  echo "$PEERID" > expected_peerid &&
+  test_cmp expected_peerid peerid
+'
+
+test_expect_success "--replace-config keeps the secrets of the repo" '
+  ipfs repo restore --replace-config backup_nokeys.car &&
+  ipfs config P2P.Listeners > listeners &&
+  test_should_contain 4001 listeners &&
+  test_should_contain restoredsecret listeners &&
+  test_should_contain restoredpinsecret "$IPFS_PATH/config"
+'
+
+test_done
@@ -186,11 +186,19 @@ EOF
     test $HASH2e32 = $HASH2b32
   '
 
+  test_expect_success "ipfs filestore rm works with urls" '
+    ipfs filestore rm http://127.0.0.1:$GWAY_PORT/ipfs/$HASH3a > rm_actual &&
+    test_should_contain "http://127.0.0.1:$GWAY_PORT/ipfs/$HASH3a" rm_actual &&
+    ipfs filestore ls > ls_actual_2 &&
+    test_should_not_contain "$HASH3a" ls_actual_2
+  '
+
   test_expect_success "ipfs cleanup" '
     rm -rf "$IPFS_PATH" && rmdir ipfs ipns mountdir
   '
 }
 
+test_urlstore urlstore add
 test_urlstore add -q --nocopy --cid-version=1
 
 test_done
@@ -0,0 +1,536 @@
+// Package tiered implements a datastore that keeps frequently accessed
+// entries on a fast datastore in front of a slower, larger one.
+package tiered
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log"
+)
+
+var log = logging.Logger("tiered")
+
+// DefaultPromoteAfter is the default number of reads of an entry from the cold
+// tier after which it is promoted to the hot tier.
+const DefaultPromoteAfter = 2
+
+// maxColdHits bounds the number of cold entries whose reads are counted.
+// The counts are reset when it is reached.
+const maxColdHits = 1 << 16
+
+// lowWater is the fraction of MaxHotSize a demotion pass brings the hot tier
+// back to, so that demotions don't run on every write.
+const lowWater = 0.9
+
+// Options configures a tiered datastore.
+type Options struct {
+	// MaxHotSize is the number of bytes the hot tier holds before its least
+	// frequently accessed entries are demoted to the cold tier. Zero means
+	// the hot tier is never demoted.
+	MaxHotSize int64
+	// PromoteAfter is the number of reads of an entry from the cold tier
+	// after which it is promoted to the hot tier. Zero means
+	// DefaultPromoteAfter, a negative value disables promotion.
+	PromoteAfter int
+}
+
+type hotEntry struct {
+	size     int64
+	hits     uint32
+	lastUsed time.Time
+}
+
+type promotion struct {
+	key   ds.Key
+	value []byte
+}
+
+// Datastore stores new entries on the hot datastore, promotes entries read
+// repeatedly from the cold datastore, and demotes the least frequently
+// accessed entries of the hot datastore when it grows over MaxHotSize.
+//
+// An entry lives in one tier at a time: queries return the entries of both
+// tiers and deletes remove the entry from both, so garbage collection sees
+// every entry whichever tier it is on.
+type Datastore struct {
+	hot, cold ds.Batching
+	opts      Options
+
+	// locks serialize writes and moves between tiers of the same key.
+	locks [256]sync.Mutex
+
+	mu       sync.Mutex
+	hotKeys  map[string]*hotEntry
+	hotSize  int64
+	coldHits map[string]int
+
+	promote chan promotion
+	demote  chan struct{}
+	closing chan struct{}
+	wg      sync.WaitGroup
+}
+
+var (
+	_ ds.Batching            = (*Datastore)(nil)
+	_ ds.PersistentDatastore = (*Datastore)(nil)
+)
+
+// New returns a tiered datastore over hot and cold. It lists the entries of
+// the hot datastore to learn their size and starts moving entries between
+// tiers in the background until Close is called.
+func New(ctx context.Context, hot, cold ds.Batching, opts Options) (*Datastore, error) {
+	if opts.PromoteAfter == 0 {
+		opts.PromoteAfter = DefaultPromoteAfter
+	}
+
+	d := &Datastore{
+		hot:      hot,
+		cold:     cold,
+		opts:     opts,
+		hotKeys:  make(map[string]*hotEntry),
+		coldHits: make(map[string]int),
+		promote:  make(chan promotion, 64),
+		demote:   make(chan struct{}, 1),
+		closing:  make(chan struct{}),
+	}
+	if err := d.loadHotKeys(ctx); err != nil {
+		return nil, err
+	}
+
+	d.wg.Add(1)
+	go d.worker()
+	d.triggerDemotion()
+	return d, nil
+}
+
+func (d *Datastore) loadHotKeys(ctx context.Context) error {
+	res, err := d.hot.Query(ctx, query.Query{KeysOnly: true, ReturnsSizes: true})
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	now := time.Now()
+	for r := range res.Next() {
+		if r.Error != nil {
+			return r.Error
+		}
+		size := int64(r.Size)
+		if r.Size < 0 {
+			s, err := d.hot.GetSize(ctx, ds.RawKey(r.Key))
+			if err != nil {
+				if errors.Is(err, ds.ErrNotFound) {
+					continue
+				}
+				return err
+			}
+			size = int64(s)
+		}
+		d.hotKeys[r.Key] = &hotEntry{size: size, lastUsed: now}
+		d.hotSize += size
+	}
+	return nil
+}
+
+func (d *Datastore) lock(key ds.Key) *sync.Mutex {
+	h := fnv.New32a()
+	_, _ = h.Write(key.Bytes())
+	return &d.locks[h.Sum32()%uint32(len(d.locks))]
+}
+
+// touch records a read of key and reports whether it is on the hot tier.
+func (d *Datastore) touch(key ds.Key) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	e, ok := d.hotKeys[key.String()]
+	if ok {
+		e.hits++
+		e.lastUsed = time.Now()
+	}
+	return ok
+}
+
+// coldRead records a read of key from the cold tier and queues its promotion
+// once it has been read often enough.
+func (d *Datastore) coldRead(key ds.Key, value []byte) {
+	if d.opts.PromoteAfter < 0 {
+		return
+	}
+
+	d.mu.Lock()
+	if len(d.coldHits) >= maxColdHits {
+		d.coldHits = make(map[string]int)
+	}
+	k := key.String()
+	d.coldHits[k]++
+	promote := d.coldHits[k] >= d.opts.PromoteAfter
+	if promote {
+		delete(d.coldHits, k)
+	}
+	d.mu.Unlock()
+
+	if !promote {
+		return
+	}
+	select {
+	case d.promote <- promotion{key: key, value: value}:
+	default:
+		// Promotion is best effort: the entry is promoted on a later read.
+	}
+}
+
+// Get returns the value of key from the hot tier, or from the cold tier.
+func (d *Datastore) Get(ctx context.Context, key ds.Key) ([]byte, error) {
+	d.touch(key)
+	value, err := d.hot.Get(ctx, key)
+	if !errors.Is(err, ds.ErrNotFound) {
+		return value, err
+	}
+	value, err = d.cold.Get(ctx, key)
+	if errors.Is(err, ds.ErrNotFound) {
+		// The key may have been promoted since the hot tier was read.
+		return d.hot.Get(ctx, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	d.coldRead(key, value)
+	return value, nil
+}
+
+// Has returns whether key is on either tier.
+func (d *Datastore) Has(ctx context.Context, key ds.Key) (bool, error) {
+	if d.touch(key) {
+		return true, nil
+	}
+	for _, tier := range []ds.Datastore{d.hot, d.cold, d.hot} {
+		found, err := tier.Has(ctx, key)
+		if err != nil || found {
+			return found, err
+		}
+	}
+	return false, nil
+}
+
+// GetSize returns the size of the value of key from either tier.
+func (d *Datastore) GetSize(ctx context.Context, key ds.Key) (int, error) {
+	d.mu.Lock()
+	e, ok := d.hotKeys[key.String()]
+	var size int64
+	if ok {
+		size = e.size
+	}
+	d.mu.Unlock()
+	if ok {
+		return int(size), nil
+	}
+
+	for _, tier := range []ds.Datastore{d.hot, d.cold} {
+		size, err := tier.GetSize(ctx, key)
+		if !errors.Is(err, ds.ErrNotFound) {
+			return size, err
+		}
+	}
+	return d.hot.GetSize(ctx, key)
+}
+
+// Put stores value on the hot tier and removes any previous value from the
+// cold tier.
+func (d *Datastore) Put(ctx context.Context, key ds.Key, value []byte) error {
+	l := d.lock(key)
+	l.Lock()
+	defer l.Unlock()
+
+	if err := d.hot.Put(ctx, key, value); err != nil {
+		return err
+	}
+	d.addHot(key, int64(len(value)))
+	return deleteIfFound(ctx, d.cold, key)
+}
+
+// Delete removes key from both tiers.
+func (d *Datastore) Delete(ctx context.Context, key ds.Key) error {
+	l := d.lock(key)
+	l.Lock()
+	defer l.Unlock()
+
+	d.removeHot(key)
+	if err := deleteIfFound(ctx, d.hot, key); err != nil {
+		return err
+	}
+	return deleteIfFound(ctx, d.cold, key)
+}
+
+func deleteIfFound(ctx context.Context, tier ds.Datastore, key ds.Key) error {
+	err := tier.Delete(ctx, key)
+	if errors.Is(err, ds.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (d *Datastore) addHot(key ds.Key, size int64) {
+	d.mu.Lock()
+	k := key.String()
+	if e, ok := d.hotKeys[k]; ok {
+		d.hotSize += size - e.size
+		e.size = size
+		e.lastUsed = time.Now()
+	} else {
+		d.hotKeys[k] = &hotEntry{size: size, lastUsed: time.Now()}
+		d.hotSize += size
+	}
+	delete(d.coldHits, k)
+	over := d.opts.MaxHotSize > 0 && d.hotSize > d.opts.MaxHotSize
+	d.mu.Unlock()
+
+	if over {
+		d.triggerDemotion()
+	}
+}
+
+func (d *Datastore) removeHot(key ds.Key) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	k := key.String()
+	if e, ok := d.hotKeys[k]; ok {
+		d.hotSize -= e.size
+		delete(d.hotKeys, k)
+	}
+	delete(d.coldHits, k)
+}
+
+func (d *Datastore) isHot(key string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.hotKeys[key]
+	return ok
+}
+
+// Query returns the entries of the hot tier followed by the entries of the
+// cold tier that aren't on the hot tier. Orders, offset and limit are applied
+// to the merged results.
+func (d *Datastore) Query(ctx context.Context, q query.Query) (query.Results, error) {
+	tierQuery := q
+	tierQuery.Orders = nil
+	tierQuery.Offset = 0
+	tierQuery.Limit = 0
+
+	hotRes, err := d.hot.Query(ctx, tierQuery)
+	if err != nil {
+		return nil, err
+	}
+	coldRes, err := d.cold.Query(ctx, tierQuery)
+	if err != nil {
+		hotRes.Close()
+		return nil, err
+	}
+
+	hotDone := false
+	merged := query.ResultsFromIterator(tierQuery, query.Iterator{
+		Next: func() (query.Result, bool) {
+			if !hotDone {
+				r, ok := hotRes.NextSync()
+				if ok {
+					return r, true
+				}
+				hotDone = true
+			}
+			for {
+				r, ok := coldRes.NextSync()
+				if !ok || r.Error != nil || !d.isHot(r.Key) {
+					return r, ok
+				}
+			}
+		},
+		Close: func() error {
+			err := hotRes.Close()
+			if cerr := coldRes.Close(); err == nil {
+				err = cerr
+			}
+			return err
+		},
+	})
+	return query.NaiveQueryApply(query.Query{
+		Orders: q.Orders,
+		Offset: q.Offset,
+		Limit:  q.Limit,
+	}, merged), nil
+}
+
+// Sync syncs both tiers.
+func (d *Datastore) Sync(ctx context.Context, prefix ds.Key) error {
+	if err := d.hot.Sync(ctx, prefix); err != nil {
+		return err
+	}
+	return d.cold.Sync(ctx, prefix)
+}
+
+// DiskUsage returns the disk usage of both tiers.
+func (d *Datastore) DiskUsage(ctx context.Context) (uint64, error) {
+	hot, err := ds.DiskUsage(ctx, d.hot)
+	if err != nil {
+		return 0, err
+	}
+	cold, err := ds.DiskUsage(ctx, d.cold)
+	return hot + cold, err
+}
+
+// Batch returns a batch applying its operations to the tiered datastore on
+// commit.
+func (d *Datastore) Batch(_ context.Context) (ds.Batch, error) {
+	return ds.NewBasicBatch(d), nil
+}
+
+// Close stops moving entries between tiers and closes both tiers.
+func (d *Datastore) Close() error {
+	close(d.closing)
+	d.wg.Wait()
+
+	err := d.hot.Close()
+	if cerr := d.cold.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (d *Datastore) triggerDemotion() {
+	if d.opts.MaxHotSize <= 0 {
+		return
+	}
+	select {
+	case d.demote <- struct{}{}:
+	default:
+	}
+}
+
+func (d *Datastore) worker() {
+	defer d.wg.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-d.closing
+		cancel()
+	}()
+
+	for {
+		select {
+		case p := <-d.promote:
+			if err := d.promoteEntry(ctx, p.key, p.value); err != nil {
+				log.Warnf("failed to promote %s: %s", p.key, err)
+			}
+		case <-d.demote:
+			if err := d.demoteEntries(ctx); err != nil {
+				log.Warnf("failed to demote entries: %s", err)
+			}
+		case <-d.closing:
+			return
+		}
+	}
+}
+
+// promoteEntry moves key from the cold tier to the hot tier. The entry is
+// written to the hot tier before it is removed from the cold one, so that it
+// can always be read.
+func (d *Datastore) promoteEntry(ctx context.Context, key ds.Key, value []byte) error {
+	l := d.lock(key)
+	l.Lock()
+	defer l.Unlock()
+
+	// The entry may have been deleted or overwritten since it was read.
+	if d.isHot(key.String()) {
+		return nil
+	}
+	found, err := d.cold.Has(ctx, key)
+	if err != nil || !found {
+		return err
+	}
+
+	if err := d.hot.Put(ctx, key, value); err != nil {
+		return err
+	}
+	d.addHot(key, int64(len(value)))
+	return deleteIfFound(ctx, d.cold, key)
+}
+
+// demoteEntries moves the least frequently accessed entries of the hot tier
+// to the cold tier until it is back under MaxHotSize, then halves the access
+// counts so that old accesses weigh less than recent ones.
+func (d *Datastore) demoteEntries(ctx context.Context) error {
+	type candidate struct {
+		key string
+		hotEntry
+	}
+
+	d.mu.Lock()
+	target := int64(float64(d.opts.MaxHotSize) * lowWater)
+	excess := d.hotSize - target
+	if d.hotSize <= d.opts.MaxHotSize {
+		excess = 0
+	}
+	var candidates []candidate
+	if excess > 0 {
+		candidates = make([]candidate, 0, len(d.hotKeys))
+		for k, e := range d.hotKeys {
+			candidates = append(candidates, candidate{k, *e})
+		}
+	}
+	for _, e := range d.hotKeys {
+		e.hits /= 2
+	}
+	d.mu.Unlock()
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].hits != candidates[j].hits {
+			return candidates[i].hits < candidates[j].hits
+		}
+		return candidates[i].lastUsed.Before(candidates[j].lastUsed)
+	})
+
+	for _, c := range candidates {
+		if excess <= 0 {
+			break
+		}
+		moved, err := d.demoteEntry(ctx, ds.RawKey(c.key))
+		if err != nil {
+			return err
+		}
+		excess -= moved
+	}
+	return nil
+}
+
+// demoteEntry moves key from the hot tier to the cold tier and returns the
+// number of bytes freed on the hot tier. The entry is written to the cold
+// tier before it is removed from the hot one, so that it can always be read.
+func (d *Datastore) demoteEntry(ctx context.Context, key ds.Key) (int64, error) {
+	l := d.lock(key)
+	l.Lock()
+	defer l.Unlock()
+
+	if !d.isHot(key.String()) {
+		return 0, nil
+	}
+	value, err := d.hot.Get(ctx, key)
+	if errors.Is(err, ds.ErrNotFound) {
+		d.removeHot(key)
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := d.cold.Put(ctx, key, value); err != nil {
+		return 0, err
+	}
+	d.removeHot(key)
+	return int64(len(value)), deleteIfFound(ctx, d.hot, key)
+}
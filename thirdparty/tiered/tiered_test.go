@@ -0,0 +1,144 @@
+package tiered
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	dssync "github.com/ipfs/go-datastore/sync"
+)
+
+func newTiered(t *testing.T, opts Options) (*Datastore, ds.Batching, ds.Batching) {
+	t.Helper()
+	hot := dssync.MutexWrap(ds.NewMapDatastore())
+	cold := dssync.MutexWrap(ds.NewMapDatastore())
+	d, err := New(context.Background(), hot, cold, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d, hot, cold
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func has(t *testing.T, d ds.Datastore, key ds.Key) bool {
+	t.Helper()
+	found, err := d.Has(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return found
+}
+
+func TestDemoteAndPromote(t *testing.T) {
+	ctx := context.Background()
+	d, hot, cold := newTiered(t, Options{MaxHotSize: 1000, PromoteAfter: 2})
+
+	value := bytes.Repeat([]byte{'x'}, 100)
+	for i := 0; i < 10; i++ {
+		if err := d.Put(ctx, ds.NewKey(fmt.Sprint(i)), value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Reading the first key makes it the most frequently accessed.
+	first := ds.NewKey("0")
+	for i := 0; i < 3; i++ {
+		if _, err := d.Get(ctx, first); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Going over MaxHotSize demotes the least frequently accessed keys.
+	if err := d.Put(ctx, ds.NewKey("10"), value); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "demotion", func() bool {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return d.hotSize <= 900
+	})
+	if !has(t, hot, first) || has(t, cold, first) {
+		t.Fatal("frequently accessed key was demoted")
+	}
+	demoted := ds.NewKey("1")
+	if has(t, hot, demoted) || !has(t, cold, demoted) {
+		t.Fatal("expected key to be demoted")
+	}
+
+	// Reading a cold key PromoteAfter times promotes it.
+	for i := 0; i < 2; i++ {
+		v, err := d.Get(ctx, demoted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(v, value) {
+			t.Fatal("unexpected value")
+		}
+	}
+	waitFor(t, "promotion", func() bool {
+		return has(t, hot, demoted) && !has(t, cold, demoted)
+	})
+}
+
+func TestQueryAndDeleteBothTiers(t *testing.T) {
+	ctx := context.Background()
+	d, hot, cold := newTiered(t, Options{PromoteAfter: -1})
+
+	if err := d.Put(ctx, ds.NewKey("/a"), []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := cold.Put(ctx, ds.NewKey("/b"), []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Overwriting an entry of the cold tier moves it to the hot tier.
+	if err := cold.Put(ctx, ds.NewKey("/c"), []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Put(ctx, ds.NewKey("/c"), []byte("c")); err != nil {
+		t.Fatal(err)
+	}
+	if has(t, cold, ds.NewKey("/c")) {
+		t.Fatal("overwritten entry left on the cold tier")
+	}
+
+	res, err := d.Query(ctx, query.Query{Orders: []query.Order{query.OrderByKey{}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Key+"="+string(e.Value))
+	}
+	if fmt.Sprint(got) != "[/a=a /b=b /c=c]" {
+		t.Fatalf("unexpected entries: %v", got)
+	}
+
+	for _, k := range []string{"/a", "/b", "/c"} {
+		if err := d.Delete(ctx, ds.NewKey(k)); err != nil {
+			t.Fatal(err)
+		}
+		if has(t, d, ds.NewKey(k)) || has(t, hot, ds.NewKey(k)) || has(t, cold, ds.NewKey(k)) {
+			t.Fatalf("%s was not deleted from both tiers", k)
+		}
+	}
+}